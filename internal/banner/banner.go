@@ -0,0 +1,106 @@
+// Package banner renders text in large letters with FIGlet fonts embedded in
+// the binary, for the help banner of generated scripts.
+package banner
+
+import (
+	"embed"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed fonts/*.flf
+var fontFiles embed.FS
+
+// DefaultFont is the font used when none is named.
+const DefaultFont = "block"
+
+// Fonts returns the names of the embedded fonts, sorted.
+func Fonts() []string {
+	entries, _ := fontFiles.ReadDir("fonts")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".flf"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render returns text drawn in the named font, as lines without trailing
+// spaces. Characters the font lacks are drawn as its "?".
+func Render(text string, font string) (string, error) {
+	if font == "" {
+		font = DefaultFont
+	}
+	b, err := fontFiles.ReadFile("fonts/" + font + ".flf")
+	if err != nil {
+		return "", fmt.Errorf("unknown banner font %q (expected %s)", font, strings.Join(Fonts(), " or "))
+	}
+	f, err := parseFont(string(b))
+	if err != nil {
+		return "", fmt.Errorf("banner font %s: %w", font, err)
+	}
+
+	lines := make([]string, f.height)
+	for _, r := range text {
+		glyph, ok := f.glyphs[r]
+		if !ok {
+			glyph = f.glyphs['?']
+		}
+		for i := range lines {
+			lines[i] += glyph[i]
+		}
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(strings.ReplaceAll(line, f.hardblank, " "), " ")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// font is a parsed FIGlet font: the lines of the glyph of each character,
+// with hard blanks left in.
+type font struct {
+	height    int
+	hardblank string
+	glyphs    map[rune][]string
+}
+
+// parseFont reads the header and the required ASCII characters, 32 to 126,
+// of a FIGlet font. Smushing is not supported: glyphs are placed side by
+// side as drawn.
+func parseFont(text string) (*font, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	header := strings.Fields(lines[0])
+	if len(header) < 6 || !strings.HasPrefix(header[0], "flf2a") || len(header[0]) < 6 {
+		return nil, fmt.Errorf("not a FIGlet font")
+	}
+	height, err := strconv.Atoi(header[1])
+	if err != nil || height < 1 {
+		return nil, fmt.Errorf("invalid height %q", header[1])
+	}
+	comments, err := strconv.Atoi(header[5])
+	if err != nil || comments < 0 {
+		return nil, fmt.Errorf("invalid comment line count %q", header[5])
+	}
+
+	f := &font{height: height, hardblank: header[0][5:6], glyphs: map[rune][]string{}}
+	next := 1 + comments
+	for r := rune(32); r <= 126; r++ {
+		if next+height > len(lines) {
+			return nil, fmt.Errorf("glyph %q is missing", r)
+		}
+		glyph := make([]string, height)
+		for i, line := range lines[next : next+height] {
+			if line == "" {
+				return nil, fmt.Errorf("glyph %q: empty line", r)
+			}
+			// Lines end with one endmark, the last line of a glyph with two.
+			endmark := line[len(line)-1:]
+			glyph[i] = strings.TrimRight(line, endmark)
+		}
+		f.glyphs[r] = glyph
+		next += height
+	}
+	return f, nil
+}
@@ -0,0 +1,119 @@
+package bashlyconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ApplyConditions removes commands whose "if" condition does not hold for
+// vars, recursively, and drops the "if" key from the commands that remain.
+//
+// A condition is a string or a list of strings that must all hold:
+//
+//	key=value   key is defined with this value (== is accepted too)
+//	key!=value  key is not defined with this value
+//	key         key is defined and not empty, false, no or 0
+//	!key        the negation of key
+func ApplyConditions(cfg map[string]any, vars map[string]string) error {
+	list, ok := cfg["commands"].([]any)
+	if !ok {
+		return nil
+	}
+	kept := make([]any, 0, len(list))
+	for _, raw := range list {
+		cmd, ok := raw.(map[string]any)
+		if !ok {
+			kept = append(kept, raw)
+			continue
+		}
+		if cond, ok := cmd["if"]; ok {
+			holds, err := evalCondition(cond, vars)
+			if err != nil {
+				return fmt.Errorf("command %v: %w", cmd["name"], err)
+			}
+			if !holds {
+				continue
+			}
+			delete(cmd, "if")
+		}
+		if err := ApplyConditions(cmd, vars); err != nil {
+			return err
+		}
+		kept = append(kept, cmd)
+	}
+	cfg["commands"] = kept
+	return nil
+}
+
+func evalCondition(cond any, vars map[string]string) (bool, error) {
+	switch t := cond.(type) {
+	case string:
+		return evalExpr(t, vars)
+	case []any:
+		for _, c := range t {
+			s, ok := c.(string)
+			if !ok {
+				return false, fmt.Errorf("if: conditions must be strings")
+			}
+			holds, err := evalExpr(s, vars)
+			if err != nil || !holds {
+				return false, err
+			}
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("if: must be a string or a list of strings")
+	}
+}
+
+func evalExpr(expr string, vars map[string]string) (bool, error) {
+	expr = strings.TrimSpace(expr)
+	if key, value, ok := strings.Cut(expr, "!="); ok {
+		v, defined := vars[strings.TrimSpace(key)]
+		return !defined || v != strings.TrimSpace(value), nil
+	}
+	if key, value, ok := strings.Cut(expr, "="); ok {
+		value = strings.TrimPrefix(value, "=")
+		v, defined := vars[strings.TrimSpace(key)]
+		return defined && v == strings.TrimSpace(value), nil
+	}
+	negate := strings.HasPrefix(expr, "!")
+	key := strings.TrimSpace(strings.TrimPrefix(expr, "!"))
+	if key == "" {
+		return false, fmt.Errorf("if: empty condition")
+	}
+	v := strings.ToLower(vars[key])
+	truthy := v != "" && v != "false" && v != "no" && v != "0"
+	return truthy != negate, nil
+}
+
+// RemoveDisabled removes commands with disabled: true, with their
+// subcommands, recursively, and returns their paths below the root.
+func RemoveDisabled(cfg map[string]any) []string {
+	return removeDisabled(cfg, nil)
+}
+
+func removeDisabled(cfg map[string]any, parents []string) []string {
+	list, ok := cfg["commands"].([]any)
+	if !ok {
+		return nil
+	}
+	var removed []string
+	kept := make([]any, 0, len(list))
+	for _, raw := range list {
+		cmd, ok := raw.(map[string]any)
+		if !ok {
+			kept = append(kept, raw)
+			continue
+		}
+		path := append(append([]string{}, parents...), fmt.Sprint(cmd["name"]))
+		if disabled, _ := cmd["disabled"].(bool); disabled {
+			removed = append(removed, strings.Join(path, " "))
+			continue
+		}
+		removed = append(removed, removeDisabled(cmd, path)...)
+		kept = append(kept, cmd)
+	}
+	cfg["commands"] = kept
+	return removed
+}
@@ -0,0 +1,140 @@
+package bashlyconfig
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ApplyDefinitions replaces the flags and args declared as "ref: <name>"
+// with the entry of that name under the config's "definitions" map, in
+// every command, and drops the map along with the top-level keys starting
+// with "x-", which only hold YAML anchors:
+//
+//	definitions:
+//	  flags:
+//	    output: {long: --output, short: -o, arg: format}
+//	  args:
+//	    file: {required: true}
+//	commands:
+//	- name: convert
+//	  args: [{ref: file}]
+//	  flags:
+//	  - ref: output
+//	    default: json
+//
+// Keys next to ref win over those of the definition. A definition without
+// a name is named by its key: an arg gets it as its name, a flag without
+// long and short gets it as its long name.
+func ApplyDefinitions(cfg map[string]any) error {
+	raw, declared := cfg["definitions"]
+	delete(cfg, "definitions")
+	for k := range cfg {
+		if strings.HasPrefix(k, "x-") {
+			delete(cfg, k)
+		}
+	}
+	defs := map[string]map[string]any{}
+	if declared && raw != nil {
+		m, ok := raw.(map[string]any)
+		if !ok {
+			return fmt.Errorf("definitions must be a mapping")
+		}
+		for kind, v := range m {
+			if kind != "flags" && kind != "args" {
+				return fmt.Errorf("definitions.%s: only flags and args can be defined", kind)
+			}
+			entries, ok := v.(map[string]any)
+			if !ok && v != nil {
+				return fmt.Errorf("definitions.%s must be a mapping of names to %s", kind, kind)
+			}
+			defs[kind] = map[string]any{}
+			for name, e := range entries {
+				if _, ok := e.(map[string]any); !ok {
+					return fmt.Errorf("definitions.%s.%s must be a mapping", kind, name)
+				}
+				defs[kind][name] = e
+			}
+		}
+	}
+	name, _ := cfg["name"].(string)
+	return applyDefinitions(cfg, name, defs)
+}
+
+func applyDefinitions(cmd map[string]any, path string, defs map[string]map[string]any) error {
+	for _, kind := range []string{"flags", "args"} {
+		list, ok := cmd[kind].([]any)
+		if !ok {
+			continue
+		}
+		for i, raw := range list {
+			entry, ok := raw.(map[string]any)
+			if !ok {
+				continue
+			}
+			ref, ok := entry["ref"]
+			if !ok {
+				continue
+			}
+			resolved, err := resolveRef(kind, ref, entry, defs[kind])
+			if err != nil {
+				return fmt.Errorf("command %s: %s[%d]: %w", path, kind, i, err)
+			}
+			list[i] = resolved
+		}
+	}
+	list, ok := cmd["commands"].([]any)
+	if !ok {
+		return nil
+	}
+	for _, raw := range list {
+		sub, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		if err := applyDefinitions(sub, strings.TrimSpace(path+" "+fmt.Sprint(sub["name"])), defs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveRef returns a copy of the definition entry refers to, with the
+// other keys of entry over it.
+func resolveRef(kind string, ref any, entry map[string]any, defs map[string]any) (map[string]any, error) {
+	name, ok := ref.(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("ref must be the name of a definition")
+	}
+	def, ok := defs[name]
+	if !ok {
+		if len(defs) == 0 {
+			return nil, fmt.Errorf("unknown ref %q: the config defines no %s", name, kind)
+		}
+		names := make([]string, 0, len(defs))
+		for n := range defs {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown ref %q (expected one of %s)", name, strings.Join(names, ", "))
+	}
+	out, _ := deepCopy(def).(map[string]any)
+	switch kind {
+	case "args":
+		if _, ok := out["name"]; !ok {
+			out["name"] = name
+		}
+	case "flags":
+		_, long := out["long"]
+		_, short := out["short"]
+		if !long && !short {
+			out["long"] = "--" + name
+		}
+	}
+	for k, v := range entry {
+		if k != "ref" {
+			out[k] = v
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,120 @@
+package bashlyconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DiscoverCommands merges command fragments found under dir into cfg.
+//
+// Each <dir>/<name>.yml file holds one command mapping that is appended to the
+// root commands; <dir>/<parent>/<name>.yml is appended to the commands of
+// <parent>, which must be declared in bashly.yml or by <dir>/<parent>.yml.
+// The command name defaults to the file name. Fragments are composed like the
+// main config, so they may use the import keyword. Given command paths in
+// opts.Only, fragments neither on the way to nor below one of them are
+// skipped.
+func DiscoverCommands(ctx context.Context, cfg map[string]any, dir string, keyword string, workdir string, opts ComposeOptions) error {
+	wd, err := filepath.Abs(workdir)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(wd, dir)
+	}
+
+	var files []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if !d.IsDir() && (ext == ".yml" || ext == ".yaml") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("discover commands: %w", err)
+	}
+
+	// Parents before children: shallower paths first, then by name.
+	rel := map[string][]string{}
+	for _, f := range files {
+		r, err := filepath.Rel(dir, f)
+		if err != nil {
+			return err
+		}
+		rel[f] = strings.Split(strings.TrimSuffix(filepath.ToSlash(r), filepath.Ext(r)), "/")
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if len(rel[files[i]]) != len(rel[files[j]]) {
+			return len(rel[files[i]]) < len(rel[files[j]])
+		}
+		return files[i] < files[j]
+	})
+
+	for _, f := range files {
+		parts := rel[f]
+		name := parts[len(parts)-1]
+
+		v, err := loadAnyYAMLFile(ctx, f, keyword)
+		if err != nil {
+			return err
+		}
+		if len(opts.Only) > 0 {
+			fragmentName := name
+			if m, ok := v.(map[string]any); ok && m["name"] != nil {
+				fragmentName = fmt.Sprint(m["name"])
+			}
+			p := strings.Join(append(append([]string{}, parts[:len(parts)-1]...), fragmentName), " ")
+			if onlyRelation(normalizePaths(opts.Only), p) == onlyNone {
+				continue
+			}
+		}
+		composed, err := composeAny(ctx, v, keyword, resolver{workdir: wd, external: opts.AllowExternalPaths})
+		if err != nil {
+			return err
+		}
+		cmd, ok := composed.(map[string]any)
+		if !ok {
+			return fmt.Errorf("command fragment %s must be a YAML mapping", f)
+		}
+		if _, ok := cmd["name"]; !ok {
+			cmd["name"] = name
+		}
+
+		parent := cfg
+		for _, p := range parts[:len(parts)-1] {
+			parent = findCommand(parent, p)
+			if parent == nil {
+				return fmt.Errorf("command fragment %s: parent command %q is not declared", f, p)
+			}
+		}
+		if findCommand(parent, fmt.Sprint(cmd["name"])) != nil {
+			return fmt.Errorf("command fragment %s: command %q is already declared", f, cmd["name"])
+		}
+		list, _ := parent["commands"].([]any)
+		parent["commands"] = append(list, cmd)
+	}
+	return nil
+}
+
+// findCommand returns the direct subcommand of parent with the given name.
+func findCommand(parent map[string]any, name string) map[string]any {
+	list, _ := parent["commands"].([]any)
+	for _, raw := range list {
+		if m, ok := raw.(map[string]any); ok && fmt.Sprint(m["name"]) == name {
+			return m
+		}
+	}
+	return nil
+}
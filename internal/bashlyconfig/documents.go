@@ -0,0 +1,269 @@
+package bashlyconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A config file may hold several YAML documents: the first is the config
+// and the others are fragments it uses. A fragment is named by the anchor
+// of its root, as in "--- &common_flags", or by an id key, which is not
+// part of it. The config refers to a fragment with an alias, or imports a
+// mapping fragment with "#" and its name, as it would import a file:
+//
+//	flags: *common_flags
+//	import: "#db_settings"
+//
+// Anchors defined inside a fragment can be used too. YAML anchors only
+// reach within their document, so references to other documents are
+// resolved here.
+
+var (
+	documentStart = regexp.MustCompile(`^---(\s|$)`)
+	documentEnd   = regexp.MustCompile(`^(\.\.\.(\s|$)|%)`)
+	anchorDef     = regexp.MustCompile(`(?:^|[\s\[{,])&([\w-]+)`)
+	aliasRef      = regexp.MustCompile(`(^|[\s\[{,])\*([\w-]+)`)
+)
+
+// fragmentRef prefixes the plain scalar an alias to another document is
+// replaced with, so that the document parses.
+const fragmentRef = "__bashly_fragment__"
+
+// ParseYAML parses the YAML of a config or imported file and returns its
+// first document, with the fragments it uses from the other documents
+// resolved. keyword is the import key. Errors name lines of the whole
+// file.
+func ParseYAML(b []byte, keyword string) (any, error) {
+	docs := splitDocuments(string(b))
+	if len(docs) < 2 {
+		var v any
+		err := yaml.Unmarshal(b, &v)
+		return v, err
+	}
+
+	defined := make([]map[string]bool, len(docs))
+	fragmentAnchors := map[string]bool{}
+	for i, d := range docs {
+		defined[i] = map[string]bool{}
+		for _, m := range anchorDef.FindAllStringSubmatch(d, -1) {
+			defined[i][m[1]] = true
+			if i > 0 {
+				fragmentAnchors[m[1]] = true
+			}
+		}
+	}
+	r := &fragments{keyword: keyword, byName: map[string]*yaml.Node{}, anchors: map[string]*yaml.Node{}, state: map[*yaml.Node]int{}}
+	var config *yaml.Node
+	for i, d := range docs {
+		d = aliasRef.ReplaceAllStringFunc(d, func(s string) string {
+			m := aliasRef.FindStringSubmatch(s)
+			if defined[i][m[2]] || !fragmentAnchors[m[2]] {
+				return s
+			}
+			return m[1] + fragmentRef + m[2]
+		})
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(d), &doc); err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		if i == 0 {
+			config = &doc
+			continue
+		}
+		if err := r.add(doc.Content[0]); err != nil {
+			return nil, err
+		}
+	}
+	if config == nil {
+		return nil, nil
+	}
+	if err := r.resolve(config); err != nil {
+		return nil, err
+	}
+	var v any
+	err := config.Decode(&v)
+	return v, err
+}
+
+// splitDocuments returns the documents of text, each as the whole text
+// with the lines of the others blanked, so that lines keep their numbers.
+// Directives and document end markers are blanked too.
+func splitDocuments(text string) []string {
+	lines := strings.Split(text, "\n")
+	var starts []int
+	content := false
+	for i, line := range lines {
+		switch {
+		case documentStart.MatchString(line):
+			if len(starts) == 0 && content {
+				starts = append(starts, 0)
+			}
+			starts = append(starts, i)
+		case len(starts) == 0 && !content:
+			trimmed := strings.TrimSpace(line)
+			content = trimmed != "" && !strings.HasPrefix(trimmed, "#") && !documentEnd.MatchString(line)
+		}
+	}
+	if len(starts) == 0 && content {
+		starts = append(starts, 0)
+	}
+
+	docs := make([]string, 0, len(starts))
+	for n, start := range starts {
+		end := len(lines)
+		if n+1 < len(starts) {
+			end = starts[n+1]
+		}
+		out := make([]string, len(lines))
+		for i := start; i < end; i++ {
+			if !documentEnd.MatchString(lines[i]) {
+				out[i] = lines[i]
+			}
+		}
+		docs = append(docs, strings.Join(out, "\n"))
+	}
+	return docs
+}
+
+// fragments resolves the references of the config to the fragments.
+type fragments struct {
+	keyword string
+	byName  map[string]*yaml.Node // fragments by root anchor and id
+	anchors map[string]*yaml.Node // every anchor of the fragments
+	state   map[*yaml.Node]int    // 1 while resolving, 2 when resolved
+}
+
+// add registers the fragment with root node n.
+func (r *fragments) add(n *yaml.Node) error {
+	var names []string
+	if n.Anchor != "" {
+		names = append(names, n.Anchor)
+	}
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == "id" && n.Content[i+1].Kind == yaml.ScalarNode {
+				names = append(names, n.Content[i+1].Value)
+				n.Content = append(n.Content[:i:i], n.Content[i+2:]...)
+				break
+			}
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("yaml: line %d: document has neither an anchor nor an id to refer to it by", n.Line)
+	}
+	for _, name := range names {
+		if _, ok := r.byName[name]; ok {
+			return fmt.Errorf("yaml: line %d: fragment %s is defined twice", n.Line, name)
+		}
+		r.byName[name] = n
+	}
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Anchor != "" {
+			r.anchors[n.Anchor] = n
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(n)
+	return nil
+}
+
+// resolve replaces, below n, the references to fragments by copies of
+// them.
+func (r *fragments) resolve(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if name, ok := strings.CutPrefix(n.Value, fragmentRef); ok && n.Style == 0 {
+			target, err := r.fragment(r.anchors[name], n)
+			if err != nil {
+				return err
+			}
+			*n = *clone(target)
+			return nil
+		}
+		// Text that merely looked like an alias.
+		n.Value = strings.ReplaceAll(n.Value, fragmentRef, "*")
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			name, ok := strings.CutPrefix(value.Value, "#")
+			if key.Value != r.keyword || value.Kind != yaml.ScalarNode || !ok {
+				continue
+			}
+			target, err := r.fragment(r.byName[name], value)
+			if err != nil {
+				return err
+			}
+			switch target.Kind {
+			case yaml.SequenceNode:
+				// Like an imported file holding a list, the list replaces
+				// the mapping.
+				*n = *clone(target)
+				return nil
+			case yaml.MappingNode:
+				// Keys of the importing mapping win over the fragment's.
+				rest := append(append([]*yaml.Node{}, n.Content[:i]...), n.Content[i+2:]...)
+				own := map[string]bool{}
+				for j := 0; j < len(rest); j += 2 {
+					own[rest[j].Value] = true
+				}
+				merged := rest[:len(rest):len(rest)]
+				for j := 0; j+1 < len(target.Content); j += 2 {
+					if !own[target.Content[j].Value] {
+						merged = append(merged, clone(target.Content[j]), clone(target.Content[j+1]))
+					}
+				}
+				n.Content = merged
+			default:
+				return fmt.Errorf("yaml: line %d: fragment %s is neither a mapping nor a list", value.Line, name)
+			}
+			break
+		}
+	}
+	for _, c := range n.Content {
+		if err := r.resolve(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fragment returns target with its own references resolved; ref is the
+// node referring to it, for errors.
+func (r *fragments) fragment(target *yaml.Node, ref *yaml.Node) (*yaml.Node, error) {
+	name := strings.TrimPrefix(strings.TrimPrefix(ref.Value, fragmentRef), "#")
+	if target == nil {
+		return nil, fmt.Errorf("yaml: line %d: unknown fragment %s", ref.Line, name)
+	}
+	switch r.state[target] {
+	case 1:
+		return nil, fmt.Errorf("yaml: line %d: fragment %s refers to itself", ref.Line, name)
+	case 2:
+		return target, nil
+	}
+	r.state[target] = 1
+	if err := r.resolve(target); err != nil {
+		return nil, err
+	}
+	r.state[target] = 2
+	return target, nil
+}
+
+// clone deep-copies n without its anchors, which belong to the original.
+func clone(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Anchor = ""
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = clone(child)
+	}
+	return &c
+}
@@ -1,11 +1,16 @@
 package bashlyconfig
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
 )
 
 func LoadYAMLFile(path string) (map[string]any, error) {
@@ -27,30 +32,61 @@ func LoadYAMLFile(path string) (map[string]any, error) {
 	return m, nil
 }
 
+// StdinPath is the config path that reads the config from standard input.
+const StdinPath = "-"
+
 // LoadComposedConfig loads a YAML file, then applies Bashly-style compose semantics.
-// ERB preprocessing is intentionally deferred in the Go clone.
-func LoadComposedConfig(path string, keyword string, workdir string) (map[string]any, error) {
+// ERB preprocessing is intentionally deferred in the Go clone. Loading stops
+// with the cause of ctx once it is done. A path of StdinPath reads the
+// config from standard input; its imports resolve against workdir as usual.
+func LoadComposedConfig(ctx context.Context, path string, keyword string, workdir string) (map[string]any, error) {
+	return LoadComposedSubtree(ctx, path, keyword, workdir, ComposeOptions{})
+}
+
+// ComposeOptions tune composition.
+type ComposeOptions struct {
+	// Only, given command paths, drops the commands neither on the way to
+	// nor below one of them before composing, so their imports and text
+	// files are not read beyond the file naming the command. An empty Only
+	// composes everything.
+	Only []string
+	// AllowExternalPaths lets imports and text files be outside the
+	// workdir. Otherwise they must be in it, symlinks resolved, so that a
+	// config cannot read other files of the machine.
+	AllowExternalPaths bool
+}
+
+// LoadComposedSubtree is LoadComposedConfig with opts.
+func LoadComposedSubtree(ctx context.Context, path string, keyword string, workdir string, opts ComposeOptions) (map[string]any, error) {
 	wd, err := filepath.Abs(workdir)
 	if err != nil {
 		return nil, err
 	}
 
-	configPath := path
-	if !filepath.IsAbs(configPath) {
-		configPath = filepath.Join(wd, configPath)
+	var v any
+	if path == StdinPath {
+		v, err = loadStdinYAML(ctx, keyword)
+	} else {
+		configPath := path
+		if !filepath.IsAbs(configPath) {
+			configPath = filepath.Join(wd, configPath)
+		}
+		var abspath string
+		abspath, err = filepath.Abs(configPath)
+		if err != nil {
+			return nil, err
+		}
+		v, err = loadAnyYAMLFile(ctx, abspath, keyword)
 	}
-
-	abspath, err := filepath.Abs(configPath)
 	if err != nil {
 		return nil, err
 	}
 
-	v, err := loadAnyYAMLFile(abspath)
-	if err != nil {
-		return nil, err
+	r := resolver{workdir: wd, external: opts.AllowExternalPaths}
+	if root, ok := v.(map[string]any); ok && len(opts.Only) > 0 {
+		pruneCommands(ctx, root, keyword, r, nil, normalizePaths(opts.Only))
 	}
-
-	composed, err := composeAny(v, keyword, wd)
+	composed, err := composeAny(ctx, v, keyword, r)
 	if err != nil {
 		return nil, err
 	}
@@ -63,27 +99,63 @@ func LoadComposedConfig(path string, keyword string, workdir string) (map[string
 	return m, nil
 }
 
-func loadAnyYAMLFile(path string) (any, error) {
+func loadStdinYAML(ctx context.Context, keyword string) (any, error) {
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config from stdin: %w", err)
+	}
+	v, err := ParseYAML(b, keyword)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse config from stdin: %w", err)
+	}
+	return v, nil
+}
+
+func loadAnyYAMLFile(ctx context.Context, path string, keyword string) (any, error) {
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("cannot read yaml file %s: %w", path, err)
 	}
 
-	var v any
-	if err := yaml.Unmarshal(b, &v); err != nil {
+	v, err := ParseYAML(b, keyword)
+	if err != nil {
 		return nil, fmt.Errorf("cannot parse yaml file %s: %w", path, err)
 	}
 	return v, nil
 }
 
-func composeAny(v any, keyword string, workdir string) (any, error) {
+// resolver resolves the paths of imports and text files, relative to the
+// workdir; unless external is set they must stay in it.
+type resolver struct {
+	workdir  string
+	external bool
+}
+
+func (r resolver) resolve(path string) (string, error) {
+	resolved := path
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(r.workdir, resolved)
+	}
+	if !r.external && !vfs.Inside(r.workdir, resolved) {
+		return "", fmt.Errorf("%s is outside the workdir (set allow_external_paths: true to allow it)", path)
+	}
+	return resolved, nil
+}
+
+func composeAny(ctx context.Context, v any, keyword string, r resolver) (any, error) {
 	switch t := v.(type) {
 	case map[string]any:
-		return composeMap(t, keyword, workdir)
+		return composeMap(ctx, t, keyword, r)
 	case []any:
 		out := make([]any, 0, len(t))
 		for _, x := range t {
-			cx, err := composeAny(x, keyword, workdir)
+			cx, err := composeAny(ctx, x, keyword, r)
 			if err != nil {
 				return nil, err
 			}
@@ -95,7 +167,7 @@ func composeAny(v any, keyword string, workdir string) (any, error) {
 	}
 }
 
-func composeMap(m map[string]any, keyword string, workdir string) (any, error) {
+func composeMap(ctx context.Context, m map[string]any, keyword string, r resolver) (any, error) {
 	result := map[string]any{}
 	for k, v := range m {
 		if k == keyword {
@@ -103,16 +175,19 @@ func composeMap(m map[string]any, keyword string, workdir string) (any, error) {
 			if !ok {
 				return nil, fmt.Errorf("%s must be a string path", keyword)
 			}
-			resolved := importPath
-			if !filepath.IsAbs(resolved) {
-				resolved = filepath.Join(workdir, resolved)
+			resolved, err := r.resolve(importPath)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", keyword, err)
 			}
-			sub, err := loadAnyYAMLFile(resolved)
+			sub, err := loadAnyYAMLFile(ctx, resolved, keyword)
 			if err != nil {
+				if ctx.Err() != nil {
+					return nil, err
+				}
 				// Keep Ruby-like message shape.
 				return nil, fmt.Errorf("cannot find import file %s", importPath)
 			}
-			subComposed, err := composeAny(sub, keyword, workdir)
+			subComposed, err := composeAny(ctx, sub, keyword, r)
 			if err != nil {
 				return nil, err
 			}
@@ -131,7 +206,16 @@ func composeMap(m map[string]any, keyword string, workdir string) (any, error) {
 			continue
 		}
 
-		cv, err := composeAny(v, keyword, workdir)
+		if text, ok := v.(string); ok && textKeys[k] && strings.HasPrefix(text, "@") {
+			loaded, err := loadText(ctx, text, r)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			result[k] = loaded
+			continue
+		}
+
+		cv, err := composeAny(ctx, v, keyword, r)
 		if err != nil {
 			return nil, err
 		}
@@ -139,3 +223,28 @@ func composeMap(m map[string]any, keyword string, workdir string) (any, error) {
 	}
 	return result, nil
 }
+
+// textKeys are the keys whose values may be read from a file with @path.
+var textKeys = map[string]bool{"help": true, "description": true, "help_header_override": true}
+
+// loadText resolves a text value starting with @: @path is replaced by the
+// file's content, without its trailing newlines, and @@ escapes a literal
+// leading @. Paths are relative to the workdir, as imports are.
+func loadText(ctx context.Context, text string, r resolver) (string, error) {
+	if strings.HasPrefix(text, "@@") {
+		return text[1:], nil
+	}
+	if ctx.Err() != nil {
+		return "", context.Cause(ctx)
+	}
+	path := strings.TrimPrefix(text, "@")
+	resolved, err := r.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(resolved)
+	if err != nil {
+		return "", fmt.Errorf("cannot read text file %s", path)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
@@ -0,0 +1,98 @@
+package bashlyconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// pruneCommands removes from the uncomposed commands of parent those that
+// are neither on the way to nor below a path of only. A command imported
+// from a file is read, without composing it, to learn its name; the rest
+// of its imports are left to composition.
+func pruneCommands(ctx context.Context, parent map[string]any, keyword string, r resolver, path []string, only []string) {
+	list, ok := parent["commands"].([]any)
+	if !ok {
+		return
+	}
+	kept := make([]any, 0, len(list))
+	for _, raw := range list {
+		cmd, ok := raw.(map[string]any)
+		if !ok {
+			kept = append(kept, raw)
+			continue
+		}
+		if _, named := cmd["name"]; !named {
+			cmd = inlineImport(ctx, cmd, keyword, r)
+		}
+		name, ok := cmd["name"]
+		if !ok {
+			// Left for composition to resolve or report.
+			kept = append(kept, raw)
+			continue
+		}
+		p := strings.Join(append(append([]string{}, path...), fmt.Sprint(name)), " ")
+		switch onlyRelation(only, p) {
+		case onlyBelow:
+			kept = append(kept, cmd)
+		case onlyOnTheWay:
+			pruneCommands(ctx, cmd, keyword, r, strings.Fields(p), only)
+			kept = append(kept, cmd)
+		}
+	}
+	parent["commands"] = kept
+}
+
+// inlineImport replaces the import keyword of cmd by the mapping of the
+// imported file, as composition would. On any problem cmd is returned
+// unchanged so composition reports it.
+func inlineImport(ctx context.Context, cmd map[string]any, keyword string, r resolver) map[string]any {
+	importPath, ok := cmd[keyword].(string)
+	if !ok {
+		return cmd
+	}
+	resolved, err := r.resolve(importPath)
+	if err != nil {
+		return cmd
+	}
+	v, err := loadAnyYAMLFile(ctx, resolved, keyword)
+	if err != nil {
+		return cmd
+	}
+	sub, ok := v.(map[string]any)
+	if !ok {
+		return cmd
+	}
+	out := map[string]any{}
+	for k, v := range cmd {
+		if k != keyword {
+			out[k] = v
+		}
+	}
+	for k, v := range sub {
+		out[k] = v
+	}
+	return out
+}
+
+type relation int
+
+const (
+	onlyNone     relation = iota
+	onlyOnTheWay          // a parent of a selected command
+	onlyBelow             // a selected command or one of its subcommands
+)
+
+// onlyRelation tells how the command path p relates to the paths of only.
+func onlyRelation(only []string, p string) relation {
+	rel := onlyNone
+	for _, o := range only {
+		switch {
+		case p == o, strings.HasPrefix(p, o+" "):
+			return onlyBelow
+		case strings.HasPrefix(o, p+" "):
+			rel = onlyOnTheWay
+		}
+	}
+	return rel
+}
@@ -0,0 +1,50 @@
+package bashlyconfig
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ApplyProfile merges the named entry of the config's "profiles" map over
+// the rest of the config and drops the map. Nested maps are merged key by
+// key; any other value, lists included, replaces the base one. An empty
+// name only drops the map.
+func ApplyProfile(cfg map[string]any, name string) error {
+	raw, declared := cfg["profiles"]
+	delete(cfg, "profiles")
+	if name == "" {
+		return nil
+	}
+	profiles, _ := raw.(map[string]any)
+	if !declared || len(profiles) == 0 {
+		return fmt.Errorf("profile %q: the config declares no profiles", name)
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown profile %q (expected one of %s)", name, strings.Join(names, ", "))
+	}
+	overrides, ok := profile.(map[string]any)
+	if !ok {
+		return fmt.Errorf("profile %q must be a mapping", name)
+	}
+	mergeMaps(cfg, overrides)
+	return nil
+}
+
+func mergeMaps(dst map[string]any, src map[string]any) {
+	for k, v := range src {
+		if sm, ok := v.(map[string]any); ok {
+			if dm, ok := dst[k].(map[string]any); ok {
+				mergeMaps(dm, sm)
+				continue
+			}
+		}
+		dst[k] = deepCopy(v)
+	}
+}
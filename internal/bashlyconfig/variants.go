@@ -0,0 +1,97 @@
+package bashlyconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilterCommands returns a copy of cfg keeping only the commands selected by
+// include and exclude. Both hold command paths below the root, e.g. "db" or
+// "db migrate". An empty include keeps every command; otherwise a command is
+// kept when it is included, below an included command, or on the way to one.
+// Excluded commands are removed with their subcommands. Paths that match no
+// command are reported as errors.
+func FilterCommands(cfg map[string]any, include []string, exclude []string) (map[string]any, error) {
+	out, _ := deepCopy(cfg).(map[string]any)
+	matched := map[string]bool{}
+	filterCommandList(out, nil, normalizePaths(include), normalizePaths(exclude), matched)
+
+	for _, p := range append(append([]string{}, include...), exclude...) {
+		if !matched[strings.Join(strings.Fields(p), " ")] {
+			return nil, fmt.Errorf("no command matches %q", p)
+		}
+	}
+	return out, nil
+}
+
+func filterCommandList(parent map[string]any, path []string, include []string, exclude []string, matched map[string]bool) {
+	list, ok := parent["commands"].([]any)
+	if !ok {
+		return
+	}
+	kept := make([]any, 0, len(list))
+	for _, raw := range list {
+		cmd, ok := raw.(map[string]any)
+		if !ok {
+			kept = append(kept, raw)
+			continue
+		}
+		p := strings.Join(append(append([]string{}, path...), fmt.Sprint(cmd["name"])), " ")
+		if containsPath(exclude, p) {
+			matched[p] = true
+			continue
+		}
+		keep := len(include) == 0
+		for _, inc := range include {
+			switch {
+			case inc == p:
+				matched[p] = true
+				keep = true
+			case strings.HasPrefix(p, inc+" "), strings.HasPrefix(inc, p+" "):
+				keep = true
+			}
+		}
+		if !keep {
+			continue
+		}
+		filterCommandList(cmd, strings.Fields(p), include, exclude, matched)
+		kept = append(kept, cmd)
+	}
+	parent["commands"] = kept
+}
+
+func normalizePaths(paths []string) []string {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		out = append(out, strings.Join(strings.Fields(p), " "))
+	}
+	return out
+}
+
+func containsPath(paths []string, p string) bool {
+	for _, x := range paths {
+		if x == p {
+			return true
+		}
+	}
+	return false
+}
+
+func deepCopy(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(t))
+		for k, x := range t {
+			m[k] = deepCopy(x)
+		}
+		return m
+	case []any:
+		l := make([]any, len(t))
+		for i, x := range t {
+			l[i] = deepCopy(x)
+		}
+		return l
+	default:
+		return v
+	}
+}
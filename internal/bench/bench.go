@@ -0,0 +1,193 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/bashlyconfig"
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/generate"
+	"github.com/dimitar-trifonov/go-bashly/internal/project"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+	"gopkg.in/yaml.v3"
+)
+
+// Stages are the parts of the generator pipeline Run measures, in order.
+var Stages = []string{"compose", "build", "render", "generate"}
+
+// Result is the timing of one stage over all runs.
+type Result struct {
+	Stage string        `json:"stage"`
+	Runs  int           `json:"runs"`
+	Mean  time.Duration `json:"mean_ns"`
+	Min   time.Duration `json:"min_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+// groupSize is the number of commands per imported group file: the group
+// command and its subcommands.
+const groupSize = 10
+
+// WriteProject writes a synthetic project with about commands commands to
+// dir: a root importing one file per group, each group with subcommands
+// declaring flags, args and environment variables, and their partials.
+func WriteProject(ctx context.Context, dir string, commands int) error {
+	if commands < 1 {
+		return fmt.Errorf("commands must be at least 1, got %d", commands)
+	}
+	st := settings.Default()
+	src := filepath.Join(dir, st.SourceDir)
+	if err := os.MkdirAll(filepath.Join(src, "groups"), 0o755); err != nil {
+		return err
+	}
+
+	var groups []any
+	for g := 0; g*groupSize < commands; g++ {
+		file := fmt.Sprintf("groups/group%d.yml", g)
+		children := make([]any, 0, groupSize-1)
+		for c := 1; c < groupSize && g*groupSize+c < commands; c++ {
+			children = append(children, leaf(c))
+		}
+		group := map[string]any{
+			"name":     fmt.Sprintf("group%d", g),
+			"help":     fmt.Sprintf("Group %d", g),
+			"flags":    []any{map[string]any{"long": "--verbose", "short": "-v", "help": "Print more"}},
+			"commands": children,
+		}
+		if err := writeYAML(filepath.Join(src, file), group); err != nil {
+			return err
+		}
+		groups = append(groups, map[string]any{"import": filepath.ToSlash(filepath.Join(st.SourceDir, file))})
+	}
+	root := map[string]any{
+		"name":     "bench",
+		"help":     "Synthetic CLI for benchmarks",
+		"version":  "1.0.0",
+		"commands": groups,
+	}
+	if err := writeYAML(filepath.Join(src, "bashly.yml"), root); err != nil {
+		return err
+	}
+
+	p, err := project.LoadContext(ctx, "", dir, project.Options{})
+	if err != nil {
+		return err
+	}
+	_, err = generate.EnsureCommandPartials(ctx, p.Root, p.Settings, generate.Options{Workdir: dir})
+	return err
+}
+
+func leaf(i int) map[string]any {
+	return map[string]any{
+		"name":  fmt.Sprintf("cmd%d", i),
+		"alias": fmt.Sprintf("c%d", i),
+		"help":  fmt.Sprintf("Command %d", i),
+		"args": []any{
+			map[string]any{"name": "source", "required": true, "help": "Source"},
+			map[string]any{"name": "target", "help": "Target"},
+		},
+		"flags": []any{
+			map[string]any{"long": "--force", "short": "-f", "help": "Overwrite"},
+			map[string]any{"long": "--mode", "arg": "mode", "allowed": []any{"fast", "safe"}, "default": "safe", "help": "Mode"},
+		},
+		"environment_variables": []any{
+			map[string]any{"name": fmt.Sprintf("CMD%d_TOKEN", i), "help": "Token"},
+		},
+	}
+}
+
+func writeYAML(path string, v any) error {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// Run measures the pipeline stages on the project in dir runs times:
+// compose loads and merges the config files, build turns the config into
+// a linted command tree, render renders the script of that tree, and
+// generate does all of it through project loading, as go-bashly generate
+// does without writing files.
+func Run(ctx context.Context, dir string, runs int) ([]Result, error) {
+	if runs < 1 {
+		return nil, fmt.Errorf("runs must be at least 1, got %d", runs)
+	}
+	p, err := project.LoadContext(ctx, "", dir, project.Options{})
+	if err != nil {
+		return nil, err
+	}
+	st := p.Settings
+
+	var cfg map[string]any
+	var root *commandmodel.Command
+	steps := map[string]func() error{
+		"compose": func() (err error) {
+			if cfg, err = bashlyconfig.LoadComposedConfig(ctx, st.ConfigPath, "import", dir); err != nil {
+				return err
+			}
+			return bashlyconfig.ApplyDefinitions(cfg)
+		},
+		"build": func() (err error) {
+			if root, err = commandmodel.BuildFromConfigMap(cfg, st); err != nil {
+				return err
+			}
+			return commandmodel.Lint(root)
+		},
+		"render": func() error {
+			_, _, err := generate.RenderMasterScript(ctx, root, st, generate.Options{Workdir: dir})
+			return err
+		},
+		"generate": func() error {
+			p, err := project.LoadContext(ctx, "", dir, project.Options{})
+			if err != nil {
+				return err
+			}
+			_, _, err = generate.RenderMasterScript(ctx, p.Root, p.Settings, generate.Options{Workdir: dir})
+			return err
+		},
+	}
+
+	results := make([]Result, len(Stages))
+	for i, stage := range Stages {
+		results[i] = Result{Stage: stage, Runs: runs}
+	}
+	for run := 0; run < runs; run++ {
+		for i, stage := range Stages {
+			start := time.Now()
+			if err := steps[stage](); err != nil {
+				return nil, fmt.Errorf("%s: %w", stage, err)
+			}
+			d := time.Since(start)
+			r := &results[i]
+			r.Mean += d
+			if run == 0 || d < r.Min {
+				r.Min = d
+			}
+			r.Max = max(r.Max, d)
+		}
+	}
+	for i := range results {
+		results[i].Mean /= time.Duration(runs)
+	}
+	return results, nil
+}
+
+// Print writes the results as a table.
+func Print(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tRUNS\tMEAN\tMIN\tMAX")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", r.Stage, r.Runs, round(r.Mean), round(r.Min), round(r.Max))
+	}
+	return tw.Flush()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
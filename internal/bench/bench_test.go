@@ -0,0 +1,92 @@
+package bench
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/bashlyconfig"
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/generate"
+	"github.com/dimitar-trifonov/go-bashly/internal/project"
+)
+
+// benchCommands is the size of the synthetic tree, as go-bashly bench
+// uses by default.
+const benchCommands = 500
+
+// setup writes the synthetic project to a temporary directory and loads it.
+func setup(b *testing.B) (string, *project.Project) {
+	b.Helper()
+	ctx := context.Background()
+	dir := b.TempDir()
+	if err := WriteProject(ctx, dir, benchCommands); err != nil {
+		b.Fatal(err)
+	}
+	p, err := project.LoadContext(ctx, "", dir, project.Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return dir, p
+}
+
+func BenchmarkCompose(b *testing.B) {
+	dir, p := setup(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cfg, err := bashlyconfig.LoadComposedConfig(ctx, p.Settings.ConfigPath, "import", dir)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := bashlyconfig.ApplyDefinitions(cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuild(b *testing.B) {
+	dir, p := setup(b)
+	cfg, err := bashlyconfig.LoadComposedConfig(context.Background(), p.Settings.ConfigPath, "import", dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := bashlyconfig.ApplyDefinitions(cfg); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root, err := commandmodel.BuildFromConfigMap(cfg, p.Settings)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := commandmodel.Lint(root); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRender(b *testing.B) {
+	dir, p := setup(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := generate.RenderMasterScript(ctx, p.Root, p.Settings, generate.Options{Workdir: dir}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	dir, _ := setup(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p, err := project.LoadContext(ctx, "", dir, project.Options{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, _, err := generate.RenderMasterScript(ctx, p.Root, p.Settings, generate.Options{Workdir: dir}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
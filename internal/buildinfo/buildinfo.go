@@ -0,0 +1,6 @@
+// Package buildinfo holds the version of go-bashly.
+package buildinfo
+
+// Version is the version of go-bashly, printed by go-bashly version and
+// recorded in the integrity footer of generated scripts.
+const Version = "0.1.0"
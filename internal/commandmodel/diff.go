@@ -0,0 +1,359 @@
+package commandmodel
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/term"
+)
+
+// Change is one difference between two command trees. Breaking changes
+// can make invocations that worked with the old tree fail or mean
+// something else with the new one.
+type Change struct {
+	Kind     string `json:"kind"`    // added, removed, renamed or changed
+	Command  string `json:"command"` // command path below the root, "" for the root
+	Subject  string `json:"subject"` // command, alias, flag, arg or environment variable
+	Detail   string `json:"detail"`
+	Breaking bool   `json:"breaking"`
+}
+
+// Diff compares two command trees and returns their differences, parents
+// before children. A command missing from new is reported as renamed when
+// a new command under the same parent keeps its name as an alias, or
+// declares the same flags and args.
+func Diff(old *Command, new *Command) []Change {
+	var changes []Change
+	diffCommand(&changes, old, new, "")
+	return changes
+}
+
+func diffCommand(changes *[]Change, old *Command, new *Command, path string) {
+	add := func(kind string, subject string, breaking bool, format string, a ...any) {
+		*changes = append(*changes, Change{Kind: kind, Command: path, Subject: subject, Detail: fmt.Sprintf(format, a...), Breaking: breaking})
+	}
+
+	for _, alias := range aliasesOf(old) {
+		if !containsName(aliasesOf(new), alias) {
+			add("removed", "alias", true, "alias %s", alias)
+		}
+	}
+	for _, alias := range aliasesOf(new) {
+		if !containsName(aliasesOf(old), alias) && alias != old.Name {
+			add("added", "alias", false, "alias %s", alias)
+		}
+	}
+
+	diffFlags(add, old.Flags, new.Flags)
+	diffArgs(add, old.Args, new.Args)
+	diffEnvVars(add, old.EnvVars, new.EnvVars)
+
+	if len(old.Forward) > 0 && len(new.Forward) == 0 {
+		add("removed", "command", true, "forwarding to %s", strings.Join(old.Forward, " "))
+	} else if len(new.Forward) > 0 && strings.Join(old.Forward, " ") != strings.Join(new.Forward, " ") {
+		add("changed", "command", false, "forwards to %s", strings.Join(new.Forward, " "))
+	}
+
+	// Match subcommands by name, then pair up the rest as renames.
+	var removed, added []*Command
+	matched := map[*Command]*Command{}
+	for _, oc := range old.Commands {
+		if nc := childNamed(new, oc.Name); nc != nil {
+			matched[oc] = nc
+		} else {
+			removed = append(removed, oc)
+		}
+	}
+	for _, nc := range new.Commands {
+		if childNamed(old, nc.Name) == nil {
+			added = append(added, nc)
+		}
+	}
+	renamed := map[*Command]*Command{}
+	for _, oc := range removed {
+		for i, nc := range added {
+			if containsName(nc.Alias, oc.Name) || sameSignature(oc, nc) {
+				renamed[oc] = nc
+				added = append(added[:i], added[i+1:]...)
+				break
+			}
+		}
+	}
+
+	for _, oc := range old.Commands {
+		childPath := strings.TrimSpace(path + " " + oc.Name)
+		switch {
+		case matched[oc] != nil:
+			diffCommand(changes, oc, matched[oc], childPath)
+		case renamed[oc] != nil:
+			nc := renamed[oc]
+			kept := containsName(nc.Alias, oc.Name)
+			detail := fmt.Sprintf("command %s to %s", childPath, strings.TrimSpace(path+" "+nc.Name))
+			if kept {
+				detail += " (old name kept as alias)"
+			}
+			*changes = append(*changes, Change{Kind: "renamed", Command: path, Subject: "command", Detail: detail, Breaking: !kept})
+			diffCommand(changes, oc, nc, strings.TrimSpace(path+" "+nc.Name))
+		default:
+			add("removed", "command", true, "command %s", childPath)
+		}
+	}
+	for _, nc := range added {
+		add("added", "command", false, "command %s", strings.TrimSpace(path+" "+nc.Name))
+	}
+}
+
+type addChange func(kind string, subject string, breaking bool, format string, a ...any)
+
+func diffFlags(add addChange, old []Flag, new []Flag) {
+	for _, of := range old {
+		nf, ok := flagNamed(new, of)
+		if !ok {
+			add("removed", "flag", true, "flag %s", flagLabel(of))
+			continue
+		}
+		name := nf.Name()
+		if of.Long != "" && nf.Long != of.Long {
+			add("changed", "flag", true, "flag %s: long form %s removed", name, of.Long)
+		}
+		if of.Short != "" && nf.Short != of.Short {
+			add("changed", "flag", true, "flag %s: short form %s removed", name, of.Short)
+		}
+		if of.Long == "" && nf.Long != "" {
+			add("changed", "flag", false, "flag %s: long form %s added", name, nf.Long)
+		}
+		if of.Short == "" && nf.Short != "" {
+			add("changed", "flag", false, "flag %s: short form %s added", name, nf.Short)
+		}
+		switch {
+		case of.Arg == "" && nf.Arg != "":
+			add("changed", "flag", true, "flag %s now takes a value (%s)", name, nf.Arg)
+		case of.Arg != "" && nf.Arg == "":
+			add("changed", "flag", true, "flag %s no longer takes a value", name)
+		}
+		if !of.Required && nf.Required {
+			add("changed", "flag", true, "flag %s is now required", name)
+		} else if of.Required && !nf.Required {
+			add("changed", "flag", false, "flag %s is no longer required", name)
+		}
+		diffAllowed(add, "flag", name, of.Allowed, nf.Allowed)
+	}
+	for _, nf := range new {
+		if _, ok := flagNamed(old, nf); !ok {
+			add("added", "flag", nf.Required, "flag %s%s", flagLabel(nf), requiredNote(nf.Required))
+		}
+	}
+}
+
+func diffArgs(add addChange, old []Arg, new []Arg) {
+	for i, oa := range old {
+		if i >= len(new) {
+			add("removed", "arg", true, "arg %s", strings.ToUpper(oa.Name))
+			continue
+		}
+		na := new[i]
+		if na.Name != oa.Name {
+			add("renamed", "arg", false, "arg %s to %s", strings.ToUpper(oa.Name), strings.ToUpper(na.Name))
+		}
+		if !oa.Required && na.Required {
+			add("changed", "arg", true, "arg %s is now required", strings.ToUpper(na.Name))
+		} else if oa.Required && !na.Required {
+			add("changed", "arg", false, "arg %s is no longer required", strings.ToUpper(na.Name))
+		}
+	}
+	for _, na := range new[min(len(old), len(new)):] {
+		add("added", "arg", na.Required, "arg %s%s", strings.ToUpper(na.Name), requiredNote(na.Required))
+	}
+}
+
+func diffEnvVars(add addChange, old []EnvVar, new []EnvVar) {
+	for _, ov := range old {
+		nv, ok := envVarNamed(new, ov.Name)
+		switch {
+		case !ok:
+			add("removed", "environment variable", false, "environment variable %s", ov.Name)
+		case !ov.Required && nv.Required:
+			add("changed", "environment variable", true, "environment variable %s is now required", nv.Name)
+		case ov.Required && !nv.Required:
+			add("changed", "environment variable", false, "environment variable %s is no longer required", nv.Name)
+		}
+		if ok {
+			diffAllowed(add, "environment variable", nv.Name, ov.Allowed, nv.Allowed)
+		}
+	}
+	for _, nv := range new {
+		if _, ok := envVarNamed(old, nv.Name); !ok {
+			add("added", "environment variable", nv.Required, "environment variable %s%s", nv.Name, requiredNote(nv.Required))
+		}
+	}
+}
+
+// diffAllowed reports allowed values that were dropped (breaking, as is a
+// value that becomes restricted) or added.
+func diffAllowed(add addChange, subject string, name string, old []string, new []string) {
+	if len(new) == 0 {
+		if len(old) > 0 {
+			add("changed", subject, false, "%s %s accepts any value", subject, name)
+		}
+		return
+	}
+	if len(old) == 0 {
+		add("changed", subject, true, "%s %s only allows %s", subject, name, strings.Join(new, ", "))
+		return
+	}
+	var dropped, extra []string
+	for _, v := range old {
+		if !containsName(new, v) {
+			dropped = append(dropped, v)
+		}
+	}
+	for _, v := range new {
+		if !containsName(old, v) {
+			extra = append(extra, v)
+		}
+	}
+	if len(dropped) > 0 {
+		add("changed", subject, true, "%s %s no longer allows %s", subject, name, strings.Join(dropped, ", "))
+	}
+	if len(extra) > 0 {
+		add("changed", subject, false, "%s %s also allows %s", subject, name, strings.Join(extra, ", "))
+	}
+}
+
+// PrintDiff writes changes one per line: "!" marks breaking changes, "+"
+// additions, "-" other removals and "~" the rest, followed by a summary.
+// With color, the marks are red, green and yellow.
+func PrintDiff(w io.Writer, changes []Change, color bool) error {
+	b := &strings.Builder{}
+	breaking := 0
+	for _, c := range changes {
+		mark, code := "~", ""
+		switch {
+		case c.Breaking:
+			mark, code = "!", "31"
+			breaking++
+		case c.Kind == "added":
+			mark, code = "+", "32"
+		case c.Kind == "removed":
+			mark, code = "-", "33"
+		}
+		if code != "" {
+			mark = term.Paint(color, code, mark)
+		}
+		where := ""
+		if c.Command != "" && c.Subject != "command" {
+			where = c.Command + ": "
+		}
+		fmt.Fprintf(b, "%s %s %s%s\n", mark, c.Kind, where, c.Detail)
+	}
+	if len(changes) == 0 {
+		b.WriteString("no changes\n")
+	} else {
+		fmt.Fprintf(b, "%d changes, %d breaking\n", len(changes), breaking)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// PublicTree returns a copy of the tree without private commands, flags
+// and environment variables, the part of a CLI its users can rely on.
+func PublicTree(c *Command) *Command {
+	out := *c
+	out.Flags = c.VisibleFlags(false)
+	out.EnvVars = c.VisibleEnvVars(false)
+	out.Commands = nil
+	for _, sub := range c.Commands {
+		if !sub.Private {
+			out.Commands = append(out.Commands, PublicTree(sub))
+		}
+	}
+	return &out
+}
+
+// BreakingChanges returns the breaking changes of Diff between the public
+// parts of old and new.
+func BreakingChanges(old *Command, new *Command) []Change {
+	var out []Change
+	for _, c := range Diff(PublicTree(old), PublicTree(new)) {
+		if c.Breaking {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func aliasesOf(c *Command) []string {
+	if len(c.Alias) <= 1 {
+		return nil
+	}
+	return c.Alias[1:]
+}
+
+func childNamed(c *Command, name string) *Command {
+	for _, sub := range c.Commands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// flagNamed finds the flag of list sharing the long form of f, or its short
+// form when either has no long form.
+func flagNamed(list []Flag, f Flag) (Flag, bool) {
+	for _, x := range list {
+		if f.Long != "" && x.Long == f.Long {
+			return x, true
+		}
+	}
+	for _, x := range list {
+		if f.Short != "" && x.Short == f.Short && (f.Long == "" || x.Long == "") {
+			return x, true
+		}
+	}
+	return Flag{}, false
+}
+
+func envVarNamed(list []EnvVar, name string) (EnvVar, bool) {
+	for _, x := range list {
+		if x.Name == name {
+			return x, true
+		}
+	}
+	return EnvVar{}, false
+}
+
+// sameSignature reports whether two commands declare the same flags and
+// args, which makes a removed and an added command a likely rename.
+func sameSignature(a *Command, b *Command) bool {
+	if len(a.Flags)+len(a.Args) == 0 || len(a.Flags) != len(b.Flags) || len(a.Args) != len(b.Args) {
+		return false
+	}
+	for i := range a.Flags {
+		if flagLabel(a.Flags[i]) != flagLabel(b.Flags[i]) {
+			return false
+		}
+	}
+	for i := range a.Args {
+		if a.Args[i].Name != b.Args[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+func flagLabel(f Flag) string {
+	label := strings.Join(f.Switches(), ", ")
+	if f.Arg != "" {
+		label += " <" + f.Arg + ">"
+	}
+	return label
+}
+
+func requiredNote(required bool) string {
+	if required {
+		return " (required)"
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package commandmodel
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// inheritEnvVars appends the environment variables of c, its own and those
+// it inherited, to those of its subcommands, recursively, as Ruby bashly
+// checks the variables of every parent before running a subcommand. A
+// variable a subcommand declares itself replaces the inherited one.
+func inheritEnvVars(c *Command) {
+	for _, child := range c.Commands {
+		for _, ev := range c.EnvVars {
+			if _, ok := envVarNamed(child.EnvVars, ev.Name); ok {
+				continue
+			}
+			if ev.InheritedFrom == "" {
+				ev.InheritedFrom = c.FullName
+			}
+			child.EnvVars = append(child.EnvVars, ev)
+		}
+		inheritEnvVars(child)
+	}
+}
+
+// PrintEnvVars writes the effective environment variables of every command
+// of root, inherited ones included with the command they come from. Private
+// variables are only listed when revealPrivate is set.
+func PrintEnvVars(w io.Writer, root *Command, revealPrivate bool) error {
+	b := &strings.Builder{}
+	for _, c := range DeepCommands(root, true) {
+		vars := c.VisibleEnvVars(revealPrivate)
+		if len(vars) == 0 {
+			continue
+		}
+		fmt.Fprintln(b, c.FullName)
+		for _, ev := range vars {
+			parts := []string{ev.Name}
+			if ev.Required {
+				parts = append(parts, "(required)")
+			}
+			if len(ev.Allowed) > 0 {
+				parts = append(parts, "["+strings.Join(ev.Allowed, "|")+"]")
+			}
+			if ev.Default != "" {
+				parts = append(parts, "default="+ev.Default)
+			}
+			if ev.InheritedFrom != "" {
+				parts = append(parts, "(from "+ev.InheritedFrom+")")
+			}
+			fmt.Fprintf(b, "  %s\n", strings.Join(parts, " "))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,259 @@
+package commandmodel
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	varSuffixPattern  = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	longFlagPattern   = regexp.MustCompile(`^--[A-Za-z0-9][A-Za-z0-9_-]*$`)
+	shortFlagPattern  = regexp.MustCompile(`^-[A-Za-z0-9]$`)
+)
+
+// reservedEnvVars are shell variables that cannot be declared as environment
+// variables: read-only or special to bash, or used by the generated script.
+var reservedEnvVars = map[string]string{
+	"BASHOPTS":          "a read-only bash variable",
+	"BASHPID":           "a read-only bash variable",
+	"BASH_ARGC":         "a special bash variable",
+	"BASH_ARGV":         "a special bash variable",
+	"BASH_LINENO":       "a special bash variable",
+	"BASH_REMATCH":      "a special bash variable",
+	"BASH_SOURCE":       "a special bash variable",
+	"BASH_VERSINFO":     "a read-only bash variable",
+	"EUID":              "a read-only bash variable",
+	"FUNCNAME":          "a special bash variable",
+	"GROUPS":            "a special bash variable",
+	"IFS":               "the shell's word separator",
+	"LINENO":            "a special bash variable",
+	"OPTARG":            "a special bash variable",
+	"OPTIND":            "a special bash variable",
+	"PPID":              "a read-only bash variable",
+	"RANDOM":            "a special bash variable",
+	"SECONDS":           "a special bash variable",
+	"SHELLOPTS":         "a read-only bash variable",
+	"UID":               "a read-only bash variable",
+	"args":              "used by the generated script",
+	"bashly_debug":      "used by the generated script",
+	"bashly_on_exit":    "used by the generated script",
+	"bashly_value":      "used by the generated script",
+	"deps":              "used by the generated script",
+	"env_var_names":     "used by the generated script",
+	"forward_args":      "used by the generated script",
+	"input":             "used by the generated script",
+	"normalized":        "used by the generated script",
+	"other_args":        "used by the generated script",
+	"prompt_reply":      "used by the generated script",
+	"selftest_problems": "used by the generated script",
+	"script_locale":     "used by the generated script",
+}
+
+// Normalizers are the value normalizations args and flags may declare.
+var Normalizers = []string{"downcase", "upcase", "strip", "expand_path"}
+
+// VarName maps an arg or flag name to the suffix of the shell variable that
+// holds its value, e.g. "--dry-run" -> DRY_RUN.
+func VarName(name string) string {
+	name = strings.TrimLeft(name, "-")
+	name = strings.ReplaceAll(name, "-", "_")
+	return strings.ToUpper(name)
+}
+
+// Lint checks that flags have well-formed long and short names, that args,
+// flags and environment variables map to usable, distinct shell variable
+// names, that normalizations and env bindings are valid, that exit codes are
+// in range, and that needs name existing commands without cycles. Collisions
+// otherwise break the generated script silently, e.g. --my-flag and --my_flag
+// both become BASHLY_FLAG_MY_FLAG.
+func Lint(root *Command) error {
+	var errs []error
+	for _, c := range DeepCommands(root, true) {
+		errs = append(errs, lintCommand(c)...)
+	}
+	errs = append(errs, lintNeeds(root)...)
+	return errors.Join(errs...)
+}
+
+func lintCommand(c *Command) []error {
+	var errs []error
+	fail := func(format string, a ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", c.FullName, fmt.Sprintf(format, a...)))
+	}
+
+	if c.ExitCode < 1 || c.ExitCode > 255 {
+		fail("validation_exit_code must be between 1 and 255, got %d", c.ExitCode)
+	}
+
+	if c.Default != "" && c.Default != "true" && c.Default != "force" {
+		fail("default must be true, false or force, got %q", c.Default)
+	}
+	var defaults []string
+	for _, child := range c.Commands {
+		if child.Default != "" {
+			defaults = append(defaults, child.Name)
+		}
+	}
+	if len(defaults) > 1 {
+		fail("only one subcommand can be the default, got %s", strings.Join(defaults, ", "))
+	}
+	if c.RequireSubcommand {
+		switch {
+		case len(c.Commands) == 0:
+			fail("require_subcommand needs subcommands")
+		case len(defaults) > 0:
+			fail("require_subcommand cannot be combined with the default subcommand %s", defaults[0])
+		case len(c.Forward) > 0:
+			fail("require_subcommand cannot be combined with forward")
+		}
+	}
+
+	if c.OnExit != "" && !identifierPattern.MatchString(c.OnExit) {
+		fail("on_exit must be a function name, got %q", c.OnExit)
+	}
+
+	checkNormalize := func(name string, ops []string) {
+		for _, op := range ops {
+			if !containsName(Normalizers, op) {
+				fail("%s: unknown normalize %q (expected one of %s)", name, op, strings.Join(Normalizers, ", "))
+			}
+		}
+	}
+
+	checkEnv := func(name string, env string) {
+		if env != "" && !identifierPattern.MatchString(env) {
+			fail("%s: env %q is not a valid shell variable name", name, env)
+		}
+	}
+
+	argVars := map[string]string{}
+	optional := "" // the first optional arg; values bind to args in order
+	for _, a := range c.Args {
+		checkNormalize(a.Name, a.Normalize)
+		checkEnv(a.Name, a.Env)
+		if a.Default != "" && a.Required {
+			fail("arg %s: a required arg cannot have a default", a.Name)
+		}
+		switch {
+		case !a.Required && optional == "":
+			optional = a.Name
+		case a.Required && optional != "":
+			fail("arg %s: a required arg cannot follow the optional arg %s", a.Name, optional)
+		}
+		v := VarName(a.Name)
+		if !varSuffixPattern.MatchString(v) {
+			fail("arg %q cannot be used as a shell variable name (BASHLY_ARG_%s); use letters, digits, - and _", a.Name, v)
+			continue
+		}
+		if prev, ok := argVars[v]; ok {
+			fail("args %q and %q both map to the variable BASHLY_ARG_%s", prev, a.Name, v)
+			continue
+		}
+		argVars[v] = a.Name
+	}
+
+	flagVars := map[string]string{}
+	switches := map[string]string{}
+	for _, f := range c.Flags {
+		if f.Long == "" && f.Short == "" {
+			fail("flag without long or short name")
+			continue
+		}
+		if f.Long != "" && !longFlagPattern.MatchString(f.Long) {
+			fail("long flag %q must look like --name", f.Long)
+			continue
+		}
+		if f.Short != "" && !shortFlagPattern.MatchString(f.Short) {
+			fail("short flag %q must be a dash and a single letter or digit, like -v", f.Short)
+			continue
+		}
+		checkNormalize(f.Name(), f.Normalize)
+		checkEnv(f.Name(), f.Env)
+		if f.Env != "" && f.Arg == "" {
+			fail("%s: env needs a flag with an arg", f.Name())
+		}
+		defaults := f.DefaultValues()
+		switch {
+		case len(defaults) > 0 && f.Arg == "":
+			fail("%s: default needs a flag with an arg", f.Name())
+		case len(defaults) > 0 && f.Required:
+			fail("%s: a required flag cannot have a default", f.Name())
+		case len(f.Defaults) > 0 && !f.Repeatable:
+			fail("%s: a list default needs a repeatable flag", f.Name())
+		default:
+			for _, def := range defaults {
+				if len(f.Allowed) > 0 && !containsName(f.Allowed, def) {
+					fail("%s: default %q is not one of the allowed values", f.Name(), def)
+				}
+			}
+		}
+		if f.Repeatable && len(f.Normalize) > 0 {
+			fail("%s: normalize cannot be combined with repeatable", f.Name())
+		}
+		if f.Repeatable && f.Env != "" {
+			fail("%s: env cannot be combined with repeatable", f.Name())
+		}
+		for _, sw := range []string{f.Long, f.Short} {
+			if sw == "" {
+				continue
+			}
+			if prev, ok := switches[sw]; ok {
+				fail("%s is declared by both %s and %s", sw, prev, f.Name())
+			}
+			switches[sw] = f.Name()
+		}
+
+		v := VarName(f.Name())
+		if !varSuffixPattern.MatchString(v) {
+			fail("flag %s cannot be used as a shell variable name (BASHLY_FLAG_%s); use letters, digits, - and _", f.Name(), v)
+			continue
+		}
+		if prev, ok := flagVars[v]; ok {
+			fail("flags %s and %s both map to the variable BASHLY_FLAG_%s", prev, f.Name(), v)
+			continue
+		}
+		flagVars[v] = f.Name()
+	}
+
+	envVars := map[string]bool{}
+	for _, ev := range c.EnvVars {
+		if ev.InheritedFrom != "" {
+			// Checked on the command declaring it.
+			continue
+		}
+		if ev.Default != "" && len(ev.Allowed) > 0 && !containsName(ev.Allowed, ev.Default) {
+			fail("environment variable %s: default %q is not one of the allowed values", ev.Name, ev.Default)
+		}
+		for _, fn := range ev.Validate {
+			if !varSuffixPattern.MatchString(fn) {
+				fail("environment variable %s: validate %q cannot name a function (validate_%s); use letters, digits and _", ev.Name, fn, fn)
+			}
+		}
+		if !identifierPattern.MatchString(ev.Name) {
+			fail("environment variable %q is not a valid shell variable name", ev.Name)
+			continue
+		}
+		if why, ok := reservedEnvVars[ev.Name]; ok {
+			fail("environment variable %s is reserved (%s)", ev.Name, why)
+			continue
+		}
+		if envVars[ev.Name] {
+			fail("environment variable %s is declared twice", ev.Name)
+			continue
+		}
+		envVars[ev.Name] = true
+	}
+	return errs
+}
+
+func containsName(list []string, name string) bool {
+	for _, x := range list {
+		if x == name {
+			return true
+		}
+	}
+	return false
+}
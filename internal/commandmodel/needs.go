@@ -0,0 +1,116 @@
+package commandmodel
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FindCommand returns the command at path below root, given as
+// space-separated command names such as "db migrate", or nil.
+func FindCommand(root *Command, path string) *Command {
+	c := root
+	for _, name := range strings.Fields(path) {
+		var next *Command
+		for _, sub := range c.Commands {
+			if sub.Name == name {
+				next = sub
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		c = next
+	}
+	return c
+}
+
+// lintNeeds checks that every command named in needs exists in the tree and
+// that needs do not form a cycle.
+func lintNeeds(root *Command) []error {
+	var errs []error
+	needs := map[*Command][]*Command{}
+	for _, c := range DeepCommands(root, true) {
+		for _, path := range c.Needs {
+			dep := FindCommand(root, path)
+			switch {
+			case dep == nil:
+				errs = append(errs, fmt.Errorf("%s: needs %q, which is not a command of %s", c.FullName, path, root.Name))
+			case dep == c:
+				errs = append(errs, fmt.Errorf("%s: cannot need itself", c.FullName))
+			default:
+				needs[c] = append(needs[c], dep)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[*Command]int{}
+	var stack []*Command
+	var visit func(c *Command) error
+	visit = func(c *Command) error {
+		switch state[c] {
+		case done:
+			return nil
+		case visiting:
+			var names []string
+			for i := len(stack) - 1; i >= 0; i-- {
+				names = append([]string{stack[i].FullName}, names...)
+				if stack[i] == c {
+					break
+				}
+			}
+			return fmt.Errorf("needs cycle: %s -> %s", strings.Join(names, " -> "), c.FullName)
+		}
+		state[c] = visiting
+		stack = append(stack, c)
+		for _, dep := range needs[c] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[c] = done
+		return nil
+	}
+	for _, c := range DeepCommands(root, true) {
+		if err := visit(c); err != nil {
+			return []error{err}
+		}
+	}
+	return nil
+}
+
+// PrintNeeds writes the needs graph of root: each command that needs others,
+// followed by the commands it needs and, indented below them, what those
+// need in turn.
+func PrintNeeds(w io.Writer, root *Command) error {
+	b := &strings.Builder{}
+	var walk func(c *Command, depth int)
+	walk = func(c *Command, depth int) {
+		for _, path := range c.Needs {
+			dep := FindCommand(root, path)
+			if dep == nil {
+				continue
+			}
+			fmt.Fprintf(b, "%s-> %s\n", strings.Repeat("  ", depth), dep.FullName)
+			walk(dep, depth+1)
+		}
+	}
+	for _, c := range DeepCommands(root, true) {
+		if len(c.Needs) == 0 {
+			continue
+		}
+		fmt.Fprintln(b, c.FullName)
+		walk(c, 1)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
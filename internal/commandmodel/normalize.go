@@ -0,0 +1,131 @@
+package commandmodel
+
+import (
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// commandKeyOrder is the order in which well-known command keys are printed;
+// any other keys follow alphabetically.
+var commandKeyOrder = []string{
+	"name", "alias", "description", "help", "version", "filename", "private", "expose",
+	"args", "flags", "environment_variables", "commands",
+}
+
+// orderedMap is a YAML mapping that preserves insertion order when encoded.
+type orderedMap []orderedEntry
+
+type orderedEntry struct {
+	Key   string
+	Value any
+}
+
+func (m orderedMap) MarshalYAML() (any, error) {
+	n := &yaml.Node{Kind: yaml.MappingNode}
+	for _, e := range m {
+		v := &yaml.Node{}
+		if err := v.Encode(e.Value); err != nil {
+			return nil, err
+		}
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: e.Key}, v)
+	}
+	return n, nil
+}
+
+// NormalizedConfig returns the composed config as go-bashly sees it: every
+// command carries its resolved name, alias list and filename, and args, flags
+// and environment variables have their boolean defaults filled in.
+// Keys go-bashly does not interpret are kept as-is. The result is meant to be
+// encoded as YAML.
+func NormalizedConfig(cfg map[string]any, root *Command) any {
+	return normalizeCommand(cfg, root)
+}
+
+func normalizeCommand(raw map[string]any, c *Command) orderedMap {
+	m := map[string]any{}
+	for k, v := range raw {
+		m[k] = v
+	}
+
+	m["name"] = c.Name
+	delete(m, "alias")
+	if len(c.Alias) > 1 {
+		m["alias"] = c.Alias[1:]
+	}
+	if c.Filename != "" {
+		m["filename"] = c.Filename
+	}
+	m["private"] = c.Private
+
+	if list, ok := raw["args"].([]any); ok {
+		m["args"] = normalizeItems(list, "required")
+	}
+	if list, ok := raw["flags"].([]any); ok {
+		m["flags"] = normalizeItems(list, "required", "private", "repeatable")
+	}
+	if list, ok := raw["environment_variables"].([]any); ok {
+		m["environment_variables"] = normalizeItems(list, "required", "private")
+	}
+
+	delete(m, "commands")
+	if list, ok := raw["commands"].([]any); ok {
+		children := make([]any, 0, len(list))
+		for i, item := range list {
+			child, ok := item.(map[string]any)
+			if !ok || i >= len(c.Commands) {
+				continue
+			}
+			children = append(children, normalizeCommand(child, c.Commands[i]))
+		}
+		m["commands"] = children
+	}
+
+	return orderMap(m, commandKeyOrder)
+}
+
+// normalizeItems fills the given boolean keys with false when absent.
+func normalizeItems(list []any, boolKeys ...string) []any {
+	out := make([]any, 0, len(list))
+	for _, item := range list {
+		raw, ok := item.(map[string]any)
+		if !ok {
+			out = append(out, item)
+			continue
+		}
+		m := map[string]any{}
+		for k, v := range raw {
+			m[k] = v
+		}
+		for _, k := range boolKeys {
+			if _, ok := m[k]; !ok {
+				m[k] = false
+			}
+		}
+		out = append(out, orderMap(m, []string{"name", "long", "short", "arg", "help", "env", "required", "default", "allowed", "repeatable", "private"}))
+	}
+	return out
+}
+
+// orderMap returns m with the keys in order first, then the rest sorted.
+func orderMap(m map[string]any, order []string) orderedMap {
+	out := make(orderedMap, 0, len(m))
+	seen := map[string]bool{}
+	for _, k := range order {
+		if v, ok := m[k]; ok {
+			out = append(out, orderedEntry{Key: k, Value: v})
+			seen[k] = true
+		}
+	}
+	rest := make([]string, 0, len(m))
+	for k := range m {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	for _, k := range rest {
+		out = append(out, orderedEntry{Key: k, Value: m[k]})
+	}
+	return out
+}
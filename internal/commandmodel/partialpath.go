@@ -0,0 +1,65 @@
+package commandmodel
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
+)
+
+// PartialPath returns the partial of c relative to the workdir, e.g.
+// src/download_command.sh: Filename below Src, or below sourceDir when c
+// has none. An absolute Filename is returned as it is.
+func (c *Command) PartialPath(sourceDir string) string {
+	if c.Filename == "" {
+		return ""
+	}
+	name := filepath.FromSlash(c.Filename)
+	if filepath.IsAbs(name) {
+		return name
+	}
+	dir := sourceDir
+	if c.Src != "" {
+		dir = filepath.FromSlash(c.Src)
+	}
+	return filepath.Join(dir, name)
+}
+
+// PartialFile returns the path of the partial of c in workdir.
+func (c *Command) PartialFile(workdir string, sourceDir string) string {
+	path := c.PartialPath(sourceDir)
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(workdir, path)
+}
+
+// CheckPartialPaths fails for a partial outside the source dir, which only
+// skip_src_check allows, together with src and absolute filenames. Even
+// then the partial must be in the workdir, unless allow_external_paths is
+// set, so that no filename reaches the files of other projects with "..".
+// Symlinks are resolved: a partial linking elsewhere counts as being
+// there.
+func CheckPartialPaths(root *Command, workdir string, st settings.Settings) error {
+	srcDir := filepath.Join(workdir, st.SourceDir)
+	for _, c := range DeepCommands(root, true) {
+		if c.Filename == "" {
+			continue
+		}
+		path := c.PartialFile(workdir, st.SourceDir)
+		if st.SkipSrcCheck {
+			if !st.AllowExternalPaths && !vfs.Inside(workdir, path) {
+				return fmt.Errorf("command %s: partial %s is outside the workdir (set allow_external_paths: true to allow it)", c.FullName, c.PartialPath(st.SourceDir))
+			}
+			continue
+		}
+		if c.Src != "" {
+			return fmt.Errorf("command %s: src needs skip_src_check: true", c.FullName)
+		}
+		if filepath.IsAbs(filepath.FromSlash(c.Filename)) || !vfs.Inside(srcDir, path) {
+			return fmt.Errorf("command %s: partial %s is outside %s (set skip_src_check: true to allow it)", c.FullName, c.PartialPath(st.SourceDir), st.SourceDir)
+		}
+	}
+	return nil
+}
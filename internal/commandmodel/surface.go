@@ -0,0 +1,64 @@
+package commandmodel
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// SurfaceHeader names the columns of the rows SurfaceRows returns.
+var SurfaceHeader = []string{"command", "flag", "type", "required", "allowed", "description"}
+
+// SurfaceRows lists the flags and args of every command, one row each, for
+// a spreadsheet review of the command line. Global flags are listed with
+// the command declaring them only. Private flags and commands are left out
+// unless revealPrivate is true. The type is boolean, counter (a repeatable
+// boolean), value, values (a repeatable flag with a value) or arg.
+func SurfaceRows(root *Command, revealPrivate bool) [][]string {
+	var rows [][]string
+	for _, c := range DeepCommands(root, true) {
+		if c.Private && !revealPrivate {
+			continue
+		}
+		for _, f := range c.Flags {
+			if f.InheritedFrom != "" || (f.Private && !revealPrivate) {
+				continue
+			}
+			typ := "boolean"
+			switch {
+			case f.Arg != "" && f.Repeatable:
+				typ = "values"
+			case f.Arg != "":
+				typ = "value"
+			case f.Repeatable:
+				typ = "counter"
+			}
+			rows = append(rows, []string{c.FullName, strings.Join(f.Switches(), ", "), typ, yesNo(f.Required), strings.Join(f.Allowed, "|"), f.Help})
+		}
+		for _, a := range c.Args {
+			rows = append(rows, []string{c.FullName, strings.ToUpper(a.Name), "arg", yesNo(a.Required), "", a.Help})
+		}
+	}
+	return rows
+}
+
+// WriteSurfaceTable writes SurfaceRows under SurfaceHeader as CSV, or as
+// TSV when sep is a tab.
+func WriteSurfaceTable(w io.Writer, root *Command, sep rune, revealPrivate bool) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = sep
+	if err := cw.Write(SurfaceHeader); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(SurfaceRows(root, revealPrivate)); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"io"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/dimitar-trifonov/go-bashly/internal/settings"
 )
@@ -12,19 +16,89 @@ import (
 type Flag struct {
 	Long     string   `json:"long,omitempty"`
 	Short    string   `json:"short,omitempty"`
+	Arg      string   `json:"arg,omitempty"` // value placeholder; empty for boolean flags
 	Required bool     `json:"required"`
 	Allowed  []string `json:"allowed,omitempty"`
 	Private  bool     `json:"private"`
+	Help     string   `json:"help,omitempty"`
+	// Env names an environment variable holding the value when the flag is
+	// not given; only flags with an arg can declare it.
+	Env string `json:"env,omitempty"`
+	// Completions lists shell completion sources for the flag value: words,
+	// <file>, <directory> and similar, or $(command).
+	Completions []string `json:"completions,omitempty"`
+	// Normalize lists the normalizations applied to the value before
+	// validation, in order: downcase, upcase, strip or expand_path.
+	Normalize []string `json:"normalize,omitempty"`
+	// Default is the value used when the flag is not given.
+	Default string `json:"default,omitempty"`
+	// Defaults are the values of a repeatable flag whose default is a
+	// list, as if it were given once for each; Default is then empty.
+	Defaults []string `json:"defaults,omitempty"`
+	// Repeatable flags may be given more than once: a flag without an arg
+	// then counts its occurrences, one with an arg collects its values as
+	// shell-quoted words.
+	Repeatable bool `json:"repeatable,omitempty"`
+	// Global flags are also accepted by every subcommand of the command
+	// declaring them, which get a copy with InheritedFrom set to its full
+	// name.
+	Global        bool   `json:"global,omitempty"`
+	InheritedFrom string `json:"inherited_from,omitempty"`
+}
+
+// Name returns the canonical name of the flag: the long form when present.
+func (f Flag) Name() string {
+	if f.Long != "" {
+		return f.Long
+	}
+	return f.Short
+}
+
+// Switches returns the declared long and short forms of the flag.
+func (f Flag) Switches() []string {
+	var out []string
+	for _, sw := range []string{f.Long, f.Short} {
+		if sw != "" {
+			out = append(out, sw)
+		}
+	}
+	return out
+}
+
+// DefaultValues returns the default values of the flag: its Defaults, or
+// its Default alone.
+func (f Flag) DefaultValues() []string {
+	if f.Default != "" {
+		return []string{f.Default}
+	}
+	return f.Defaults
 }
 
 type Arg struct {
-	Name     string `json:"name"`
-	Required bool   `json:"required"`
+	Name        string   `json:"name"`
+	Required    bool     `json:"required"`
+	Help        string   `json:"help,omitempty"`
+	Env         string   `json:"env,omitempty"` // environment variable used when the arg is not given
+	Completions []string `json:"completions,omitempty"`
+	Normalize   []string `json:"normalize,omitempty"`
+	Default     string   `json:"default,omitempty"` // value used when the arg is not given
 }
 
 type EnvVar struct {
-	Name    string `json:"name"`
-	Private bool   `json:"private"`
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	Default  string `json:"default,omitempty"`
+	Private  bool   `json:"private"`
+	Help     string `json:"help,omitempty"`
+	// Allowed lists the values the variable may hold once set.
+	Allowed []string `json:"allowed,omitempty"`
+	// Validate names functions run on a set value, each called as
+	// validate_<name> "$VALUE"; output from one is a validation error.
+	Validate []string `json:"validate,omitempty"`
+	// InheritedFrom is the full name of the command declaring the variable
+	// when it is a copy of one of a parent command, which every subcommand
+	// gets unless it declares a variable of the same name itself.
+	InheritedFrom string `json:"inherited_from,omitempty"`
 }
 
 func parseFlags(v any) []Flag {
@@ -41,19 +115,29 @@ func parseFlags(v any) []Flag {
 		}
 		lng, _ := asString(m["long"])
 		shrt, _ := asString(m["short"])
+		argName, _ := asString(m["arg"])
 		req, _ := asBool(m["required"])
 		priv, _ := asBool(m["private"])
+		help, _ := asScalar(m["help"])
+		env, _ := asString(m["env"])
 		var allowed []string
 		if rawAllowed, ok := m["allowed"]; ok {
 			if arr, ok := rawAllowed.([]any); ok {
 				for _, a := range arr {
-					if s, ok := a.(string); ok {
+					if s, ok := asScalar(a); ok {
 						allowed = append(allowed, s)
 					}
 				}
 			}
 		}
-		out = append(out, Flag{Long: lng, Short: shrt, Required: req, Allowed: allowed, Private: priv})
+		def, _ := asScalar(m["default"])
+		var defs []string
+		if list, ok := m["default"].([]any); ok {
+			defs = parseStringList(list)
+		}
+		repeatable, _ := asBool(m["repeatable"])
+		global, _ := asBool(m["global"])
+		out = append(out, Flag{Long: lng, Short: shrt, Arg: argName, Required: req, Allowed: allowed, Private: priv, Help: help, Env: env, Completions: parseStringList(m["completions"]), Normalize: parseStringList(m["normalize"]), Default: def, Defaults: defs, Repeatable: repeatable, Global: global})
 	}
 	return out
 }
@@ -75,7 +159,10 @@ func parseArgs(v any) []Arg {
 			continue
 		}
 		req, _ := asBool(m["required"])
-		out = append(out, Arg{Name: name, Required: req})
+		help, _ := asScalar(m["help"])
+		env, _ := asString(m["env"])
+		def, _ := asScalar(m["default"])
+		out = append(out, Arg{Name: name, Required: req, Help: help, Env: env, Completions: parseStringList(m["completions"]), Normalize: parseStringList(m["normalize"]), Default: def})
 	}
 	return out
 }
@@ -96,31 +183,132 @@ func parseEnvVars(v any) []EnvVar {
 		if name == "" {
 			continue
 		}
+		req, _ := asBool(m["required"])
+		def, _ := asScalar(m["default"])
 		priv, _ := asBool(m["private"])
-		out = append(out, EnvVar{Name: name, Private: priv})
+		help, _ := asScalar(m["help"])
+		out = append(out, EnvVar{Name: name, Required: req, Default: def, Private: priv, Help: help, Allowed: parseStringList(m["allowed"]), Validate: parseStringList(m["validate"])})
+	}
+	return out
+}
+
+// description returns the description of a command, falling back to its
+// help text as Ruby bashly configs declare it.
+func description(m map[string]any) string {
+	if s, _ := asScalar(m["description"]); s != "" {
+		return s
+	}
+	s, _ := asScalar(m["help"])
+	return s
+}
+
+// parseStringList reads a list of strings; a single string is one entry.
+// Numbers and booleans are taken as their YAML text.
+func parseStringList(v any) []string {
+	switch t := v.(type) {
+	case string:
+		if t != "" {
+			return []string{t}
+		}
+	case []any:
+		var out []string
+		for _, raw := range t {
+			if s, ok := asScalar(raw); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// parseForward reads the forward key: a command line split on whitespace,
+// or a list of words taken as they are.
+func parseForward(v any) []string {
+	if s, ok := v.(string); ok {
+		return strings.Fields(s)
+	}
+	return parseStringList(v)
+}
+
+// parseDependencies reads the external commands a command needs, given either
+// as a list or as a mapping of command name to install hint.
+func parseDependencies(v any) []string {
+	var out []string
+	switch t := v.(type) {
+	case []any:
+		for _, raw := range t {
+			if s, ok := raw.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+	case map[string]any:
+		for name := range t {
+			out = append(out, name)
+		}
+		sort.Strings(out)
 	}
 	return out
 }
 
 type Command struct {
-	Name        string     `json:"name"`
-	Parents     []string   `json:"parents,omitempty"`
-	FullName    string     `json:"full_name"`
-	ActionName  string     `json:"action_name"`
-	Private     bool       `json:"private"`
-	Expose      string     `json:"expose,omitempty"`
-	Alias       []string   `json:"alias,omitempty"`
-	Filename    string     `json:"filename,omitempty"`
-	Description string     `json:"description,omitempty"`
-	Args        []Arg      `json:"args,omitempty"`
-	Flags       []Flag     `json:"flags,omitempty"`
-	EnvVars     []EnvVar   `json:"environment_variables,omitempty"`
-	Commands    []*Command `json:"commands,omitempty"`
+	Name       string   `json:"name"`
+	Parents    []string `json:"parents,omitempty"`
+	FullName   string   `json:"full_name"`
+	ActionName string   `json:"action_name"`
+	Private    bool     `json:"private"`
+	Expose     string   `json:"expose,omitempty"`
+	// Disabled is set for a command declared with disabled: true and its
+	// subcommands, which are only in the tree when the project is loaded
+	// with KeepDisabled.
+	Disabled bool `json:"disabled,omitempty"`
+	// Default is "true" when the command runs if its parent gets no
+	// arguments, or "force" when it also runs for arguments that name no
+	// other command; the arguments are then forwarded to it.
+	Default     string   `json:"default,omitempty"`
+	Alias       []string `json:"alias,omitempty"`
+	Filename    string   `json:"filename,omitempty"`
+	Src         string   `json:"src,omitempty"` // directory of the partial instead of source_dir; inherited
+	Description string   `json:"description,omitempty"`
+	Version     string   `json:"version,omitempty"` // root only
+	HelpHeader  string   `json:"help_header,omitempty"`
+	Args        []Arg    `json:"args,omitempty"`
+	Flags       []Flag   `json:"flags,omitempty"`
+	EnvVars     []EnvVar `json:"environment_variables,omitempty"`
+	Deps        []string `json:"dependencies,omitempty"`
+	// Needs lists the commands this one relies on, as paths below the root
+	// such as "db migrate"; they must be part of every generated script.
+	Needs []string `json:"needs,omitempty"`
+	// Forward is the program, with any leading arguments, that receives the
+	// arguments left over after parsing, verbatim; the generated command
+	// execs it once the partial has run.
+	Forward []string `json:"forward,omitempty"`
+	// Examples are invocations shown in the Examples section of the help.
+	Examples []string `json:"examples,omitempty"`
+	// RequireSubcommand makes the command a group: without a subcommand it
+	// prints its usage and fails instead of running its own partial.
+	RequireSubcommand bool `json:"require_subcommand,omitempty"`
+	// OnExit is the function called when the script exits while the
+	// command runs, also on Ctrl-C or TERM; it is inherited from the parent
+	// command.
+	OnExit string `json:"on_exit,omitempty"`
+	// ExitCode is the exit status used for validation failures; it is
+	// inherited from the parent command, or the settings for the root.
+	ExitCode int        `json:"validation_exit_code"`
+	Commands []*Command `json:"commands,omitempty"`
 }
 
 type TreePrintOptions struct {
 	ShowDetails   bool
 	RevealPrivate bool
+	// MaxDepth limits the levels printed below the root; 0 prints all.
+	MaxDepth int
+	// ASCII draws the tree with plain ASCII connectors for terminals
+	// without UTF-8.
+	ASCII bool
+	// Width cuts lines longer than this many characters with "…"; 0
+	// keeps them whole.
+	Width int
 }
 
 // DeepCommands returns all commands in the tree, depth-first.
@@ -144,55 +332,113 @@ func deepCommandsFrom(c *Command) []*Command {
 	return out
 }
 
-// PrintTree prints a human-friendly command tree representation.
+// treeLine is one printed command: the indented name and its details.
+type treeLine struct {
+	label   string
+	details string
+}
+
+// PrintTree prints a human-friendly command tree representation, with the
+// details of all commands aligned in one column.
 // Intended for Option A "inspect" output.
 func PrintTree(w io.Writer, root *Command, opts TreePrintOptions) {
-	printTreeNode(w, root, "", true, opts)
+	lines := treeLines(nil, root, "", "", 0, opts)
+	width := 0
+	for _, l := range lines {
+		width = max(width, utf8.RuneCountInString(l.label))
+	}
+	for _, l := range lines {
+		line := l.label
+		if l.details != "" {
+			line += strings.Repeat(" ", width-utf8.RuneCountInString(l.label)) + "  " + l.details
+		}
+		fmt.Fprintln(w, clip(line, opts.Width))
+	}
 }
 
-func printTreeNode(w io.Writer, c *Command, prefix string, isLast bool, opts TreePrintOptions) {
-	if c.Private && !opts.RevealPrivate {
-		return
+// clip shortens s to width characters, ending it with "…"; a width of 0
+// keeps s whole.
+func clip(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
 	}
+	r := []rune(s)
+	return string(r[:width-1]) + "…"
+}
 
-	connector := "├─"
-	nextPrefix := prefix + "│ "
-	if isLast {
-		connector = "└─"
-		nextPrefix = prefix + "  "
+func treeLines(out []treeLine, c *Command, connector string, prefix string, depth int, opts TreePrintOptions) []treeLine {
+	label := c.Name
+	if depth == 0 {
+		label = c.FullName
 	}
-
-	if prefix == "" {
-		// Root
-		line := c.FullName
-		if opts.ShowDetails {
-			line = formatDetails(c, opts)
+	children := make([]*Command, 0, len(c.Commands))
+	for _, child := range c.Commands {
+		if !child.Private || opts.RevealPrivate {
+			children = append(children, child)
 		}
-		fmt.Fprintf(w, "%s\n", line)
-	} else {
-		line := c.Name
-		if opts.ShowDetails {
-			line = formatDetails(c, opts)
+	}
+	truncated := opts.MaxDepth > 0 && depth >= opts.MaxDepth && len(children) > 0
+
+	line := treeLine{label: prefix + connector + label}
+	if opts.ShowDetails {
+		line.details = formatDetails(c, opts)
+		if truncated {
+			line.details = strings.TrimSpace(line.details + fmt.Sprintf(" commands=%d", len(children)))
 		}
-		fmt.Fprintf(w, "%s%s %s\n", prefix, connector, line)
+	}
+	out = append(out, line)
+	if truncated {
+		return out
 	}
 
-	for i, child := range c.Commands {
-		printTreeNode(w, child, nextPrefix, i == len(c.Commands)-1, opts)
+	branch, last, pipe := "├─ ", "└─ ", "│  "
+	if opts.ASCII {
+		branch, last, pipe = "|- ", "`- ", "|  "
 	}
+	childPrefix := prefix
+	if depth > 0 {
+		childPrefix += strings.Repeat(" ", utf8.RuneCountInString(connector))
+		if connector == branch {
+			childPrefix = prefix + pipe
+		}
+	}
+	for i, child := range children {
+		conn := branch
+		if i == len(children)-1 {
+			conn = last
+		}
+		out = treeLines(out, child, conn, childPrefix, depth+1, opts)
+	}
+	return out
 }
 
+// formatDetails returns the detail column of a command in the tree.
 func formatDetails(c *Command, opts TreePrintOptions) string {
-	parts := []string{c.Name}
+	var parts []string
 	if c.Filename != "" {
 		parts = append(parts, "["+c.Filename+"]")
 	}
 	if c.Private {
 		parts = append(parts, "(private)")
 	}
+	if c.Disabled {
+		parts = append(parts, "(disabled)")
+	}
+	if c.Default != "" {
+		parts = append(parts, "default="+c.Default)
+	}
 	if len(c.Alias) > 1 {
 		parts = append(parts, "alias="+strings.Join(c.Alias[1:], ","))
 	}
+	if len(c.Needs) > 0 {
+		parts = append(parts, "needs="+strings.Join(c.Needs, ","))
+	}
+	if len(c.Forward) > 0 {
+		parts = append(parts, "forward="+c.Forward[0])
+	}
+	if c.RequireSubcommand {
+		parts = append(parts, "(subcommand required)")
+	}
 
 	flagsCount := len(c.VisibleFlags(opts.RevealPrivate))
 	if flagsCount > 0 {
@@ -219,6 +465,39 @@ func (c *Command) VisibleFlags(revealPrivate bool) []Flag {
 	return out
 }
 
+// LongFlagAbbreviations maps each prefix of the long names of the public
+// flags of c and of extra, such as --help, to the names it abbreviates: one
+// for an unambiguous prefix, several in declaration order otherwise. Full
+// names are left out, even when they abbreviate longer ones, and so are
+// private flags, which must be written in full.
+func (c *Command) LongFlagAbbreviations(extra ...string) map[string][]string {
+	names := []string{}
+	for _, f := range c.VisibleFlags(false) {
+		if f.Long != "" {
+			names = append(names, f.Long)
+		}
+	}
+	names = append(names, extra...)
+	full := map[string]bool{}
+	for _, f := range c.Flags {
+		full[f.Long] = true
+	}
+	for _, name := range extra {
+		full[name] = true
+	}
+
+	out := map[string][]string{}
+	for _, name := range names {
+		for i := len("--") + 1; i < len(name); i++ {
+			prefix := name[:i]
+			if !full[prefix] && !slices.Contains(out[prefix], name) {
+				out[prefix] = append(out[prefix], name)
+			}
+		}
+	}
+	return out
+}
+
 func (c *Command) VisibleEnvVars(revealPrivate bool) []EnvVar {
 	if revealPrivate {
 		return c.EnvVars
@@ -255,15 +534,29 @@ func BuildFromConfigMap(cfg map[string]any, st settings.Settings) (*Command, err
 		ext = "sh"
 	}
 	if st.CommandsDir != "" {
-		root.Filename = filepath.Join(st.CommandsDir, "root."+ext)
+		root.Filename = filepath.ToSlash(filepath.Join(st.CommandsDir, "root."+ext))
 	} else {
 		root.Filename = "root_command." + ext
 	}
 
-	root.Description, _ = asString(cfg["description"])
+	root.Src, _ = asString(cfg["src"])
+	root.Description = description(cfg)
+	if v, ok := cfg["version"]; ok && v != nil {
+		root.Version = fmt.Sprint(v)
+	}
+	root.HelpHeader, _ = asString(cfg["help_header_override"])
 	root.Args = parseArgs(cfg["args"])
 	root.Flags = parseFlags(cfg["flags"])
 	root.EnvVars = parseEnvVars(cfg["environment_variables"])
+	root.Deps = parseDependencies(cfg["dependencies"])
+	root.Forward = parseForward(cfg["forward"])
+	root.RequireSubcommand, _ = asBool(cfg["require_subcommand"])
+	root.Examples = parseStringList(cfg["examples"])
+	root.OnExit = parseOnExit(cfg)
+	root.ExitCode = st.ValidationExitCode
+	if code, ok := asInt(cfg["validation_exit_code"]); ok {
+		root.ExitCode = code
+	}
 
 	cmds, ok := cfg["commands"]
 	if ok {
@@ -278,9 +571,70 @@ func BuildFromConfigMap(cfg map[string]any, st settings.Settings) (*Command, err
 		root.Commands = children
 	}
 
+	if st.AutoPrefixFlags {
+		for _, c := range DeepCommands(root, true) {
+			for i := range c.Flags {
+				c.Flags[i] = normalizeFlagDashes(c.Flags[i])
+			}
+		}
+	}
+	if err := inheritGlobalFlags(root); err != nil {
+		return nil, err
+	}
+	inheritEnvVars(root)
+
 	return root, nil
 }
 
+// inheritGlobalFlags appends the global flags of c, its own and those it
+// inherited, to the flags of its subcommands, recursively. A subcommand
+// flag sharing a long or short name with one of them is an error naming
+// both flags and commands.
+func inheritGlobalFlags(c *Command) error {
+	var global []Flag
+	for _, f := range c.Flags {
+		if f.Global {
+			if f.InheritedFrom == "" {
+				f.InheritedFrom = c.FullName
+			}
+			global = append(global, f)
+		}
+	}
+	for _, child := range c.Commands {
+		for _, g := range global {
+			for _, f := range child.Flags {
+				if (f.Long != "" && f.Long == g.Long) || (f.Short != "" && f.Short == g.Short) {
+					return fmt.Errorf("%s: flag %s conflicts with %s, a global flag of %s", child.FullName, strings.Join(f.Switches(), "/"), strings.Join(g.Switches(), "/"), g.InheritedFrom)
+				}
+			}
+		}
+		child.Flags = append(child.Flags, global...)
+		if err := inheritGlobalFlags(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeFlagDashes adds the dashes missing from long and short flag
+// names: "verbose" and "-verbose" become "--verbose", "v" and "--v" become
+// "-v". A flag declared with only a short-looking long name ("-v") gets it as
+// its short name instead.
+func normalizeFlagDashes(f Flag) Flag {
+	f.Long = strings.TrimSpace(f.Long)
+	f.Short = strings.TrimSpace(f.Short)
+	if f.Short == "" && len(strings.TrimLeft(f.Long, "-")) == 1 && !strings.HasPrefix(f.Long, "--") {
+		f.Long, f.Short = "", f.Long
+	}
+	if name := strings.TrimLeft(f.Long, "-"); name != "" {
+		f.Long = "--" + name
+	}
+	if name := strings.TrimLeft(f.Short, "-"); name != "" {
+		f.Short = "-" + name
+	}
+	return f
+}
+
 func buildChildren(list []any, parent *Command, st settings.Settings) ([]*Command, error) {
 	out := make([]*Command, 0, len(list))
 	for i, raw := range list {
@@ -298,8 +652,9 @@ func buildChildren(list []any, parent *Command, st settings.Settings) ([]*Comman
 		parents = append(parents, parent.Name)
 
 		privateVal, _ := asBool(opts["private"])
+		disabled, _ := asBool(opts["disabled"])
 		expose, _ := asString(opts["expose"])
-		desc, _ := asString(opts["description"])
+		desc := description(opts)
 
 		cmd := &Command{
 			Name:        name,
@@ -307,14 +662,33 @@ func buildChildren(list []any, parent *Command, st settings.Settings) ([]*Comman
 			FullName:    strings.Join(append(append([]string{}, parents...), name), " "),
 			ActionName:  computeActionName(parents, name),
 			Private:     privateVal,
+			Disabled:    disabled || parent.Disabled,
 			Expose:      expose,
+			Default:     parseDefault(opts["default"]),
 			Alias:       normalizeAlias(opts["alias"], name),
 			Filename:    resolveFilename(opts, parents, name, st),
 			Description: desc,
 		}
+		cmd.Src = parent.Src
+		if src, ok := asString(opts["src"]); ok && src != "" {
+			cmd.Src = src
+		}
 		cmd.Args = parseArgs(opts["args"])
 		cmd.Flags = parseFlags(opts["flags"])
 		cmd.EnvVars = parseEnvVars(opts["environment_variables"])
+		cmd.Deps = parseDependencies(opts["dependencies"])
+		cmd.Needs = parseStringList(opts["needs"])
+		cmd.Forward = parseForward(opts["forward"])
+		cmd.RequireSubcommand, _ = asBool(opts["require_subcommand"])
+		cmd.Examples = parseStringList(opts["examples"])
+		cmd.OnExit = parent.OnExit
+		if fn := parseOnExit(opts); fn != "" {
+			cmd.OnExit = fn
+		}
+		cmd.ExitCode = parent.ExitCode
+		if code, ok := asInt(opts["validation_exit_code"]); ok {
+			cmd.ExitCode = code
+		}
 
 		if sub, ok := opts["commands"]; ok {
 			subList, ok := sub.([]any)
@@ -333,6 +707,15 @@ func buildChildren(list []any, parent *Command, st settings.Settings) ([]*Comman
 	return out, nil
 }
 
+// parseOnExit reads on_exit, or its alias cleanup.
+func parseOnExit(opts map[string]any) string {
+	if fn, _ := asString(opts["on_exit"]); fn != "" {
+		return strings.TrimSpace(fn)
+	}
+	fn, _ := asString(opts["cleanup"])
+	return strings.TrimSpace(fn)
+}
+
 func computeActionName(parents []string, name string) string {
 	// Ruby special-cases root; for children: parents[1..] + [name]
 	if len(parents) == 0 {
@@ -369,10 +752,13 @@ func normalizeAlias(v any, name string) []string {
 	return out
 }
 
+// resolveFilename returns the partial of a command relative to source_dir,
+// always with forward slashes so inspect output and generated scripts are
+// the same on every platform.
 func resolveFilename(opts map[string]any, parents []string, name string, st settings.Settings) string {
 	// Explicit filename wins.
 	if s, ok := asString(opts["filename"]); ok && s != "" {
-		return s
+		return filepath.ToSlash(s)
 	}
 
 	action := computeActionName(parents, name)
@@ -382,8 +768,8 @@ func resolveFilename(opts map[string]any, parents []string, name string, st sett
 	}
 
 	if st.CommandsDir != "" {
-		p := filepath.FromSlash(strings.ReplaceAll(action, " ", "/")) + "." + ext
-		return filepath.Join(st.CommandsDir, p)
+		p := strings.ReplaceAll(action, " ", "/") + "." + ext
+		return filepath.ToSlash(filepath.Join(st.CommandsDir, p))
 	}
 
 	// When commands_dir is nil (~), Ruby uses a flat name under source_dir.
@@ -399,11 +785,58 @@ func underscore(s string) string {
 	return s
 }
 
+// parseDefault reads a command's default key: true, false or force.
+func parseDefault(v any) string {
+	switch t := v.(type) {
+	case bool:
+		if t {
+			return "true"
+		}
+	case string:
+		if t != "false" {
+			return t
+		}
+	}
+	return ""
+}
+
+// DefaultCommand returns the subcommand of c marked as default, if any.
+func (c *Command) DefaultCommand() *Command {
+	for _, child := range c.Commands {
+		if child.Default != "" {
+			return child
+		}
+	}
+	return nil
+}
+
 func asString(v any) (string, bool) {
 	s, ok := v.(string)
 	return s, ok
 }
 
+// asScalar returns a string, number or boolean as text, so that values
+// such as allowed: [1, 2] or default: true need no quotes. Floats use the
+// shortest form that reads back the same (1.50 becomes 1.5).
+func asScalar(v any) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case int:
+		return strconv.Itoa(t), true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(t), true
+	}
+	return "", false
+}
+
+func asInt(v any) (int, bool) {
+	i, ok := v.(int)
+	return i, ok
+}
+
 func asBool(v any) (bool, bool) {
 	b, ok := v.(bool)
 	return b, ok
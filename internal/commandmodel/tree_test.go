@@ -0,0 +1,51 @@
+package commandmodel
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+func TestResolveFilename(t *testing.T) {
+	nested := settings.Default()
+	nested.CommandsDir = filepath.Join("commands", "sub")
+	flat := settings.Default()
+	flat.CommandsDir = ""
+
+	tests := []struct {
+		name    string
+		opts    map[string]any
+		parents []string
+		cmd     string
+		st      settings.Settings
+		want    string
+	}{
+		{"flat", nil, []string{"cli"}, "download", flat, "download_command.sh"},
+		{"flat nested", nil, []string{"cli", "db"}, "migrate", flat, "db_migrate_command.sh"},
+		{"flat dashes", nil, []string{"cli"}, "set-up", flat, "set_up_command.sh"},
+		{"commands dir", nil, []string{"cli"}, "download", nested, "commands/sub/download.sh"},
+		{"commands dir nested", nil, []string{"cli", "db"}, "migrate", nested, "commands/sub/db/migrate.sh"},
+		{"explicit", map[string]any{"filename": "cmds/get.sh"}, []string{"cli"}, "get", flat, "cmds/get.sh"},
+		{"explicit platform separators", map[string]any{"filename": filepath.Join("cmds", "get.sh")}, []string{"cli"}, "get", flat, "cmds/get.sh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveFilename(tt.opts, tt.parents, tt.cmd, tt.st); got != tt.want {
+				t.Errorf("resolveFilename() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRootFilenameUsesSlashes(t *testing.T) {
+	st := settings.Default()
+	st.CommandsDir = filepath.Join("commands", "sub")
+	root, err := BuildFromConfigMap(map[string]any{"name": "cli"}, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "commands/sub/root.sh"; root.Filename != want {
+		t.Errorf("root.Filename = %q, want %q", root.Filename, want)
+	}
+}
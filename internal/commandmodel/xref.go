@@ -0,0 +1,109 @@
+package commandmodel
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// XRefUse is one declaration of a flag or arg by a command.
+type XRefUse struct {
+	Command    string // full command name
+	Definition string // how the command declares it, e.g. "--output, -o <format> [json|yaml]"
+	signature  string // the part of the definition that must agree across commands
+}
+
+// XRefEntry lists every command declaring a flag or arg of the same name.
+// It is Inconsistent when the declarations differ in short name, value,
+// allowed values or normalization; required-ness may differ freely.
+type XRefEntry struct {
+	Name         string // "--output", or "arg source"
+	Uses         []XRefUse
+	Inconsistent bool
+}
+
+// CrossReference groups the flags and args of all commands by name, flags
+// first, each sorted by name.
+func CrossReference(root *Command) []XRefEntry {
+	flags := map[string]*XRefEntry{}
+	args := map[string]*XRefEntry{}
+	add := func(m map[string]*XRefEntry, name string, use XRefUse) {
+		e, ok := m[name]
+		if !ok {
+			e = &XRefEntry{Name: name}
+			m[name] = e
+		}
+		if len(e.Uses) > 0 && e.Uses[0].signature != use.signature {
+			e.Inconsistent = true
+		}
+		e.Uses = append(e.Uses, use)
+	}
+
+	for _, c := range DeepCommands(root, true) {
+		for _, f := range c.Flags {
+			sig := strings.Join(f.Switches(), ", ")
+			if f.Arg != "" {
+				sig += " <" + f.Arg + ">"
+			}
+			if len(f.Allowed) > 0 {
+				sig += " [" + strings.Join(f.Allowed, "|") + "]"
+			}
+			if len(f.Normalize) > 0 {
+				sig += " normalize: " + strings.Join(f.Normalize, ", ")
+			}
+			add(flags, f.Name(), XRefUse{Command: c.FullName, Definition: withMarks(sig, f.Required, f.Private), signature: sig})
+		}
+		for _, a := range c.Args {
+			sig := a.Name
+			if len(a.Normalize) > 0 {
+				sig += " normalize: " + strings.Join(a.Normalize, ", ")
+			}
+			add(args, "arg "+a.Name, XRefUse{Command: c.FullName, Definition: withMarks(sig, a.Required, false), signature: sig})
+		}
+	}
+
+	out := make([]XRefEntry, 0, len(flags)+len(args))
+	for _, m := range []map[string]*XRefEntry{flags, args} {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			out = append(out, *m[name])
+		}
+	}
+	return out
+}
+
+// PrintCrossReference writes the cross reference of root, one block per flag
+// or arg name, marking inconsistent declarations.
+func PrintCrossReference(w io.Writer, root *Command) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, e := range CrossReference(root) {
+		summary := fmt.Sprintf("%d command", len(e.Uses))
+		if len(e.Uses) != 1 {
+			summary += "s"
+		}
+		if e.Inconsistent {
+			summary += ", INCONSISTENT"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", e.Name, summary)
+		for _, u := range e.Uses {
+			fmt.Fprintf(tw, "  %s\t%s\n", u.Command, u.Definition)
+		}
+	}
+	return tw.Flush()
+}
+
+func withMarks(s string, required bool, private bool) string {
+	if required {
+		s += " (required)"
+	}
+	if private {
+		s += " (private)"
+	}
+	return s
+}
@@ -0,0 +1,286 @@
+package compat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/generate"
+	"github.com/dimitar-trifonov/go-bashly/internal/project"
+)
+
+// Options configures a compat run.
+type Options struct {
+	// RubyBashly is the command used to run Ruby bashly. Empty disables the
+	// Ruby side; fixtures are then only rendered and probed with go-bashly.
+	RubyBashly string
+	// ProbeTimeout bounds each invocation of a generated script.
+	ProbeTimeout time.Duration
+}
+
+// ProbeResult is the observable behavior of one script invocation.
+type ProbeResult struct {
+	ExitCode int
+	Stdout   string
+}
+
+// Diff is a semantic difference between the two generated scripts for one probe.
+type Diff struct {
+	Probe string
+	Field string // "exit" or "stdout"
+	Go    string
+	Ruby  string
+}
+
+// Report is the outcome of running a single fixture.
+type Report struct {
+	Fixture string
+	Probes  int
+	Ruby    bool // Ruby bashly output was compared
+	Diffs   []Diff
+	Err     error
+}
+
+// probesFile optionally lists extra invocations, one per line, in a fixture.
+const probesFile = "compat.txt"
+
+// Fixtures returns the fixture directories under dir: every subdirectory
+// containing src/bashly.yml.
+func Fixtures(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read fixture dir: %w", err)
+	}
+	var out []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(filepath.Join(path, "src", "bashly.yml")); err == nil {
+			out = append(out, path)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// RunFixture renders the fixture with go-bashly (and Ruby bashly when
+// configured) in scratch copies, runs the same probes against each script
+// and reports differences in exit codes and normalized stdout.
+func RunFixture(fixture string, opts Options) Report {
+	rep := Report{Fixture: filepath.Base(fixture)}
+
+	goDir, err := scratchCopy(fixture, "go")
+	if err != nil {
+		rep.Err = err
+		return rep
+	}
+	defer os.RemoveAll(goDir)
+
+	goScript, root, err := renderGo(goDir)
+	if err != nil {
+		rep.Err = err
+		return rep
+	}
+	if out, err := exec.Command("bash", "-n", goScript).CombinedOutput(); err != nil {
+		rep.Err = fmt.Errorf("generated script has syntax errors: %s", strings.TrimSpace(string(out)))
+		return rep
+	}
+	probes, err := buildProbes(fixture, root)
+	if err != nil {
+		rep.Err = err
+		return rep
+	}
+	rep.Probes = len(probes)
+
+	rubyScript := ""
+	if opts.RubyBashly != "" {
+		rubyDir, err := scratchCopy(fixture, "ruby")
+		if err != nil {
+			rep.Err = err
+			return rep
+		}
+		defer os.RemoveAll(rubyDir)
+
+		rubyScript, err = renderRuby(rubyDir, root.Name, opts.RubyBashly)
+		if err != nil {
+			rep.Err = err
+			return rep
+		}
+		rep.Ruby = true
+	}
+
+	for _, p := range probes {
+		label := strings.Join(p, " ")
+		goRes, err := runProbe(goScript, p, opts.ProbeTimeout)
+		if err != nil {
+			rep.Err = fmt.Errorf("probe %q: %w", label, err)
+			return rep
+		}
+		if rubyScript == "" {
+			continue
+		}
+		rubyRes, err := runProbe(rubyScript, p, opts.ProbeTimeout)
+		if err != nil {
+			rep.Err = fmt.Errorf("probe %q: %w", label, err)
+			return rep
+		}
+		if goRes.ExitCode != rubyRes.ExitCode {
+			rep.Diffs = append(rep.Diffs, Diff{Probe: label, Field: "exit", Go: fmt.Sprint(goRes.ExitCode), Ruby: fmt.Sprint(rubyRes.ExitCode)})
+		}
+		if goRes.Stdout != rubyRes.Stdout {
+			rep.Diffs = append(rep.Diffs, Diff{Probe: label, Field: "stdout", Go: goRes.Stdout, Ruby: rubyRes.Stdout})
+		}
+	}
+	return rep
+}
+
+// renderGo generates the project in dir with go-bashly and returns the
+// script path and the command tree.
+func renderGo(dir string) (string, *commandmodel.Command, error) {
+	p, err := project.Load("", dir)
+	if err != nil {
+		return "", nil, err
+	}
+	opts := generate.Options{Workdir: dir, Force: false}
+	if _, err := generate.EnsureCommandPartials(context.Background(), p.Root, p.Settings, opts); err != nil {
+		return "", nil, err
+	}
+	opts.Force = true
+	master, err := generate.EnsureMasterScript(context.Background(), p.Root, p.Settings, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	return master.Path, p.Root, nil
+}
+
+// renderRuby generates the project in dir with Ruby bashly.
+func renderRuby(dir string, name string, bashly string) (string, error) {
+	fields := strings.Fields(bashly)
+	cmd := exec.Command(fields[0], append(fields[1:], "generate")...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ruby bashly generate failed: %v (stderr: %s)", err, stderr.String())
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// buildProbes returns one help probe and one bare probe per public command,
+// followed by the invocations listed in the fixture's compat.txt.
+func buildProbes(fixture string, root *commandmodel.Command) ([][]string, error) {
+	var probes [][]string
+	for _, c := range commandmodel.DeepCommands(root, true) {
+		if c.Private {
+			continue
+		}
+		path := strings.Fields(c.FullName)[1:]
+		probes = append(probes, append(append([]string{}, path...), "--help"))
+		probes = append(probes, path)
+	}
+
+	f, err := os.Open(filepath.Join(fixture, probesFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return probes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		probes = append(probes, strings.Fields(line))
+	}
+	return probes, sc.Err()
+}
+
+// runProbe runs the script with bash, stdin closed, and normalizes stdout.
+func runProbe(script string, args []string, timeout time.Duration) (ProbeResult, error) {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "bash", append([]string{script}, args...)...)
+	cmd.Dir = filepath.Dir(script)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return ProbeResult{}, fmt.Errorf("timed out after %s", timeout)
+	}
+	code := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return ProbeResult{}, err
+		}
+		code = exitErr.ExitCode()
+	}
+	return ProbeResult{ExitCode: code, Stdout: normalizeOutput(out.String())}, nil
+}
+
+// normalizeOutput drops trailing whitespace and blank lines so cosmetic
+// layout differences are not reported.
+func normalizeOutput(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// scratchCopy copies the fixture into a fresh temp directory.
+func scratchCopy(fixture string, suffix string) (string, error) {
+	dir, err := os.MkdirTemp("", "go-bashly-compat-"+filepath.Base(fixture)+"-"+suffix+"-")
+	if err != nil {
+		return "", err
+	}
+	err = filepath.WalkDir(fixture, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(fixture, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, b, info.Mode().Perm())
+	})
+	if err != nil {
+		return "", fmt.Errorf("copy fixture %s: %w", fixture, err)
+	}
+	return dir, nil
+}
@@ -0,0 +1,326 @@
+// Package configedit edits bashly.yml and settings.yml as text, guided by
+// their YAML nodes, so comments, key order and layout outside the edited
+// lines survive. upgrade, add command and go-bashly config use it.
+//
+// Values are addressed by a Path: mapping keys, and list items by index or
+// by their name (the name of a command or arg, the long name of a flag), as
+// in commands.users.flags.--force.help.
+package configedit
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Path addresses a node of a document.
+type Path []string
+
+// ParsePath splits a dotted path such as "commands.users.help". An empty
+// string is the root.
+func ParsePath(s string) Path {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ".")
+}
+
+func (p Path) String() string {
+	return strings.Join(p, ".")
+}
+
+// CommandPath returns the path of a command, given the names from the
+// root down: CommandPath("db", "migrate") is commands.db.commands.migrate.
+func CommandPath(names ...string) Path {
+	var p Path
+	for _, name := range names {
+		p = append(p, "commands", name)
+	}
+	return p
+}
+
+// Document is the text of a YAML document being edited.
+type Document struct {
+	src []byte
+	doc yaml.Node
+}
+
+// Parse reads src, which must hold a YAML mapping.
+func Parse(src []byte) (*Document, error) {
+	d := &Document{}
+	if err := d.reset(src); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// reset replaces the text of d and parses it again, so that the nodes match
+// the lines after every edit.
+func (d *Document) reset(src []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return fmt.Errorf("parse yaml: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("root must be a YAML mapping")
+	}
+	d.src, d.doc = src, doc
+	return nil
+}
+
+// Bytes returns the edited text.
+func (d *Document) Bytes() []byte {
+	return d.src
+}
+
+// Lookup returns the node at path, or nil.
+func (d *Document) Lookup(path Path) *yaml.Node {
+	n := d.doc.Content[0]
+	for _, seg := range path {
+		if n = child(n, seg); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// Set sets the scalar at path to value, YAML text such as true, 3 or
+// "a: b". An existing scalar is replaced where it stands; a missing key is
+// added as the last key of its mapping.
+func (d *Document) Set(path Path, value string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("cannot set the root")
+	}
+	var v yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &v); err != nil || strings.Contains(value, "\n") ||
+		(len(v.Content) > 0 && v.Content[0].Kind != yaml.ScalarNode) {
+		return fmt.Errorf("%s: value must be a single-line YAML scalar", path)
+	}
+
+	if n := d.Lookup(path); n != nil {
+		if n.Kind != yaml.ScalarNode {
+			return fmt.Errorf("%s is not a scalar", path)
+		}
+		if k := d.key(path); k != nil && n.Tag == "!!null" && n.Value == "" {
+			// An empty value has no text of its own: write it after the
+			// colon of its key.
+			return d.apply([]Edit{{Line: k.Line, Column: k.Column + len(k.Value) + 1, New: " " + value}})
+		}
+		old, err := d.token(n)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return d.apply([]Edit{{Line: n.Line, Column: n.Column, Old: old, New: value}})
+	}
+
+	m := d.Lookup(path[:len(path)-1])
+	if m == nil || m.Kind != yaml.MappingNode {
+		return fmt.Errorf("no mapping at %s", path[:len(path)-1])
+	}
+	if m.Style&yaml.FlowStyle != 0 || len(m.Content) == 0 {
+		return fmt.Errorf("%s must be a block mapping to add keys to", path[:len(path)-1])
+	}
+	indent := strings.Repeat(" ", m.Content[0].Column-1)
+	return d.insert(lastLine(m), indent+path[len(path)-1]+": "+value+"\n")
+}
+
+// Append adds the items of list, the text of a YAML list, after the last
+// item of the list at path, at its indent. Without a list there, the key is
+// added to its mapping with the items at the indent of the key.
+func (d *Document) Append(path Path, list []byte) error {
+	var items []any
+	if err := yaml.Unmarshal(list, &items); err != nil || len(items) == 0 {
+		return fmt.Errorf("expected a YAML list")
+	}
+	if len(path) == 0 {
+		return fmt.Errorf("the root is not a list")
+	}
+	m := d.Lookup(path[:len(path)-1])
+	if m == nil || m.Kind != yaml.MappingNode {
+		return fmt.Errorf("no mapping at %s", path[:len(path)-1])
+	}
+	lines := d.lines()
+
+	var at, indent int
+	var key string
+	switch seq := child(m, path[len(path)-1]); {
+	case seq == nil:
+		if m.Style&yaml.FlowStyle != 0 || len(m.Content) == 0 {
+			return fmt.Errorf("%s must be a block mapping to add keys to", path[:len(path)-1])
+		}
+		at = lastLine(m)
+		indent = m.Content[0].Column - 1
+		key = strings.Repeat(" ", indent) + path[len(path)-1] + ":\n"
+	case seq.Kind != yaml.SequenceNode || seq.Style&yaml.FlowStyle != 0 || len(seq.Content) == 0:
+		return fmt.Errorf("%s must be a block list to append to", path)
+	default:
+		first := seq.Content[0]
+		at = lastLine(seq)
+		indent = strings.LastIndex(lines[first.Line-1][:first.Column-1], "-")
+	}
+
+	var b strings.Builder
+	b.WriteString(key)
+	for _, line := range strings.Split(strings.TrimRight(string(list), "\n"), "\n") {
+		if strings.TrimSpace(line) != "" {
+			b.WriteString(strings.Repeat(" ", indent))
+		}
+		b.WriteString(line + "\n")
+	}
+	return d.insert(at, b.String())
+}
+
+// Delete removes the key or list item at path with all of its lines. A
+// list left empty is removed with its key.
+func (d *Document) Delete(path Path) error {
+	if len(path) == 0 {
+		return fmt.Errorf("cannot delete the root")
+	}
+	parent := d.Lookup(path[:len(path)-1])
+	n := d.Lookup(path)
+	if parent == nil || n == nil {
+		return fmt.Errorf("no %s", path)
+	}
+	if parent.Style&yaml.FlowStyle != 0 {
+		return fmt.Errorf("%s must be in block style to delete from", path[:len(path)-1])
+	}
+	lines := d.lines()
+
+	first := n
+	if parent.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(parent.Content); i += 2 {
+			if parent.Content[i+1] == n {
+				first = parent.Content[i]
+			}
+		}
+		if strings.TrimSpace(lines[first.Line-1][:first.Column-1]) != "" {
+			return fmt.Errorf("%s shares its line with the start of a list item: delete the item instead", path)
+		}
+	} else if strings.TrimSpace(lines[first.Line-1][:first.Column-1]) != "-" {
+		return fmt.Errorf("%s does not start its own line", path)
+	}
+
+	start, end := first.Line, lastLine(n)
+	out := strings.Join(append(slices.Clone(lines[:start-1]), lines[end:]...), "\n")
+	if err := d.reset([]byte(out + "\n")); err != nil {
+		return err
+	}
+	if parent.Kind == yaml.SequenceNode && len(parent.Content) == 1 && len(path) > 1 {
+		return d.Delete(path[:len(path)-1])
+	}
+	return nil
+}
+
+// key returns the key node of the mapping entry at path, or nil when path
+// is not a plain key.
+func (d *Document) key(path Path) *yaml.Node {
+	m := d.Lookup(path[:len(path)-1])
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if k := m.Content[i]; k.Value == path[len(path)-1] && k.Style == 0 {
+			return k
+		}
+	}
+	return nil
+}
+
+// token returns the text of the single-line scalar n as written, quotes
+// included.
+func (d *Document) token(n *yaml.Node) (string, error) {
+	line := d.lines()[n.Line-1][n.Column-1:]
+	switch {
+	case n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0, strings.Contains(n.Value, "\n"):
+		return "", fmt.Errorf("cannot set a multi-line value")
+	case n.Style&yaml.SingleQuotedStyle != 0:
+		for i := 1; i < len(line); i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				return line[:i+1], nil
+			}
+		}
+	case n.Style&yaml.DoubleQuotedStyle != 0:
+		for i := 1; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				return line[:i+1], nil
+			}
+		}
+	default:
+		if strings.HasPrefix(line, n.Value) {
+			return n.Value, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find the value on line %d", n.Line)
+}
+
+func (d *Document) lines() []string {
+	return strings.Split(strings.TrimRight(string(d.src), "\n"), "\n")
+}
+
+// insert adds text after the line at, 1-based.
+func (d *Document) insert(at int, text string) error {
+	lines := d.lines()
+	out := strings.Join(lines[:at], "\n") + "\n" + text
+	if at < len(lines) {
+		out += strings.Join(lines[at:], "\n") + "\n"
+	}
+	return d.reset([]byte(out))
+}
+
+func (d *Document) apply(edits []Edit) error {
+	out, err := Apply(d.src, edits)
+	if err != nil {
+		return err
+	}
+	return d.reset(out)
+}
+
+// child returns the value of key seg in the mapping n, or the item of the
+// list n at index seg or named seg.
+func child(n *yaml.Node, seg string) *yaml.Node {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == seg {
+				return n.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(seg); err == nil {
+			if i >= 0 && i < len(n.Content) {
+				return n.Content[i]
+			}
+			return nil
+		}
+		for _, item := range n.Content {
+			for _, key := range []string{"name", "long"} {
+				if v := child(item, key); v != nil && v.Kind == yaml.ScalarNode && v.Value == seg {
+					return item
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// lastLine returns the last line, 1-based, holding part of n.
+func lastLine(n *yaml.Node) int {
+	last := n.Line
+	if n.Kind == yaml.ScalarNode && n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		last += strings.Count(strings.TrimRight(n.Value, "\n"), "\n") + 1
+	}
+	for _, c := range n.Content {
+		last = max(last, lastLine(c))
+	}
+	return last
+}
@@ -0,0 +1,46 @@
+package configedit
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Edit is a single in-place rewrite of text on one line.
+type Edit struct {
+	Line   int // 1-based
+	Column int // 1-based column of the text
+	Old    string
+	New    string
+}
+
+// ScalarEdit builds an edit replacing the value of a scalar node, keeping
+// its quoting style.
+func ScalarEdit(n *yaml.Node, value string) Edit {
+	col := n.Column
+	if n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+		col++ // skip the opening quote
+	}
+	return Edit{Line: n.Line, Column: col, Old: n.Value, New: value}
+}
+
+// Apply replaces text in place, so comments and layout survive. Edits are
+// in document order; those on the same line are applied right to left to
+// keep columns valid.
+func Apply(src []byte, edits []Edit) ([]byte, error) {
+	lines := strings.Split(string(src), "\n")
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		if e.Line < 1 || e.Line > len(lines) {
+			return nil, fmt.Errorf("edit out of range at line %d", e.Line)
+		}
+		line := lines[e.Line-1]
+		start := e.Column - 1
+		if start < 0 || start+len(e.Old) > len(line) || line[start:start+len(e.Old)] != e.Old {
+			return nil, fmt.Errorf("cannot rewrite %q at line %d", e.Old, e.Line)
+		}
+		lines[e.Line-1] = line[:start] + e.New + line[start+len(e.Old):]
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
@@ -0,0 +1,224 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/generate"
+	"github.com/dimitar-trifonov/go-bashly/internal/project"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+	"github.com/dimitar-trifonov/go-bashly/internal/term"
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip" // an earlier check failed
+)
+
+// Check is one line of the doctor report. Fix says how to resolve a
+// warning or failure.
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+	Fix    string
+}
+
+// Run checks the project in workdir: settings, config, partials, libs,
+// formatter, shell and target directory. Checks that need the config are
+// skipped when it does not load.
+func Run(ctx context.Context, configPath string, workdir string) []Check {
+	var checks []Check
+	add := func(name string, status Status, detail string, fix string) {
+		checks = append(checks, Check{Name: name, Status: status, Detail: detail, Fix: fix})
+	}
+	skipRest := func(names ...string) []Check {
+		for _, name := range names {
+			add(name, StatusSkip, "", "")
+		}
+		return checks
+	}
+
+	wd, err := project.ResolveWorkdir(workdir)
+	if err != nil {
+		add("settings", StatusFail, err.Error(), "pass an existing directory with --workdir")
+		return skipRest("config", "partials", "libs", "formatter", "shell", "target")
+	}
+	resolved, err := settings.Load(wd, settings.LoadOptions{})
+	if err != nil {
+		add("settings", StatusFail, err.Error(), "fix the settings file or the BASHLY_* environment variables")
+		return skipRest("config", "partials", "libs", "formatter", "shell", "target")
+	}
+	st := resolved.Settings
+	if resolved.Path != "" {
+		add("settings", StatusPass, resolved.Path, "")
+	} else {
+		add("settings", StatusPass, "defaults (no settings file)", "")
+	}
+
+	p, err := project.LoadContext(ctx, configPath, wd, project.Options{})
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		add("config", StatusFail, err.Error(), "create the config with go-bashly init, or pass --config")
+		checks = skipRest("partials", "libs")
+	case err != nil:
+		add("config", StatusFail, err.Error(), "fix the config; go-bashly upgrade rewrites deprecated keys")
+		checks = skipRest("partials", "libs")
+	default:
+		add("config", StatusPass, fmt.Sprintf("%d commands", len(commandmodel.DeepCommands(p.Root, true))), "")
+		checks = append(checks, checkPartials(p), checkLibs(wd, st))
+	}
+
+	checks = append(checks, checkFormatter(st), checkShell(ctx, st))
+	if p != nil {
+		checks = append(checks, checkTarget(generate.ScriptPath(p.Root, st, wd)))
+	} else {
+		add("target", StatusSkip, "", "")
+	}
+	return checks
+}
+
+// Failed reports whether any check failed.
+func Failed(checks []Check) bool {
+	for _, c := range checks {
+		if c.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+func checkPartials(p *project.Project) Check {
+	var missing []string
+	for _, c := range commandmodel.DeepCommands(p.Root, true) {
+		if c.Filename == "" {
+			continue
+		}
+		if _, err := os.Stat(c.PartialFile(p.Workdir, p.Settings.SourceDir)); err != nil {
+			missing = append(missing, c.PartialPath(p.Settings.SourceDir))
+		}
+	}
+	if len(missing) > 0 {
+		return Check{Name: "partials", Status: StatusWarn, Detail: "missing " + strings.Join(missing, ", "), Fix: "run go-bashly generate to scaffold them"}
+	}
+	return Check{Name: "partials", Status: StatusPass, Detail: "all present"}
+}
+
+func checkLibs(wd string, st settings.Settings) Check {
+	_, err := generate.MergeLibs(vfs.Disk, filepath.Join(wd, st.SourceDir), st.LibDir, st.ExtraLibDirs, st.LibNamespaces)
+	if err != nil {
+		return Check{Name: "libs", Status: StatusFail, Detail: err.Error(), Fix: "make the lib files readable and give their functions distinct names, or set lib_namespaces"}
+	}
+	return Check{Name: "libs", Status: StatusPass, Detail: "readable"}
+}
+
+func checkFormatter(st settings.Settings) Check {
+	if st.Formatter == "internal" || st.Formatter == "none" {
+		return Check{Name: "formatter", Status: StatusPass, Detail: st.Formatter}
+	}
+	fields := strings.Fields(st.Formatter)
+	if len(fields) == 0 {
+		return Check{Name: "formatter", Status: StatusFail, Detail: "formatter is empty", Fix: "set formatter to internal, none or a command"}
+	}
+	if bin, err := exec.LookPath(fields[0]); err == nil {
+		return Check{Name: "formatter", Status: StatusPass, Detail: bin}
+	}
+	if st.FormatterFallback {
+		return Check{Name: "formatter", Status: StatusWarn, Detail: fields[0] + " not found on PATH; the internal formatter is used", Fix: "install " + fields[0]}
+	}
+	return Check{Name: "formatter", Status: StatusFail, Detail: fields[0] + " not found on PATH", Fix: "install " + fields[0] + ", set formatter_fallback: true or formatter: internal"}
+}
+
+// checkShell looks for the target shell on PATH and, for bash, checks that
+// it is 4.0 or higher as the generated script requires.
+func checkShell(ctx context.Context, st settings.Settings) Check {
+	shell := generate.TargetShell(st)
+	bin, err := exec.LookPath(shell)
+	if err != nil {
+		return Check{Name: "shell", Status: StatusFail, Detail: shell + " not found on PATH", Fix: "install " + shell + " or change target_shell"}
+	}
+	if shell != "bash" {
+		return Check{Name: "shell", Status: StatusPass, Detail: bin}
+	}
+	out, err := exec.CommandContext(ctx, bin, "-c", `echo "$BASH_VERSION"`).Output()
+	version := strings.TrimSpace(string(out))
+	if err != nil || version == "" {
+		return Check{Name: "shell", Status: StatusWarn, Detail: bin + ": cannot read its version", Fix: "check that " + bin + " runs"}
+	}
+	major, _ := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if major < 4 {
+		return Check{Name: "shell", Status: StatusFail, Detail: fmt.Sprintf("%s is bash %s (4.0 or higher is required for associative arrays)", bin, version), Fix: "install bash 4 or later and put it first on PATH (on macOS: brew install bash)"}
+	}
+	return Check{Name: "shell", Status: StatusPass, Detail: fmt.Sprintf("%s (bash %s)", bin, version)}
+}
+
+// checkTarget checks that the script can be written: its directory, or
+// the closest existing parent generate would create it in, accepts new
+// files, and an existing script is writable.
+func checkTarget(script string) Check {
+	dir := filepath.Dir(script)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil && !info.IsDir() {
+			return Check{Name: "target", Status: StatusFail, Detail: dir + " is not a directory", Fix: "change target_dir"}
+		}
+		if err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	f, err := os.CreateTemp(dir, ".go-bashly-doctor-*")
+	if err != nil {
+		return Check{Name: "target", Status: StatusFail, Detail: dir + " is not writable", Fix: "fix the permissions of " + dir + " or change target_dir"}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	if _, err := os.Stat(script); err == nil {
+		f, err := os.OpenFile(script, os.O_WRONLY, 0)
+		if err != nil {
+			return Check{Name: "target", Status: StatusFail, Detail: script + " is not writable", Fix: "fix the permissions of " + script}
+		}
+		f.Close()
+	}
+	return Check{Name: "target", Status: StatusPass, Detail: script}
+}
+
+// Print writes the checks as a checklist, with fixes below warnings and
+// failures. With color, the statuses are green, yellow and red.
+func Print(w io.Writer, checks []Check, color bool) error {
+	b := &strings.Builder{}
+	width := 0
+	for _, c := range checks {
+		width = max(width, len(c.Name))
+	}
+	counts := map[Status]int{}
+	for _, c := range checks {
+		counts[c.Status]++
+		mark := strings.ToUpper(string(c.Status))
+		mark = term.Paint(color, statusColors[c.Status], mark)
+		line := fmt.Sprintf("%s  %-*s  %s", mark, width, c.Name, c.Detail)
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+		if c.Fix != "" && (c.Status == StatusWarn || c.Status == StatusFail) {
+			fmt.Fprintf(b, "      %*s  fix: %s\n", width, "", c.Fix)
+		}
+	}
+	fmt.Fprintf(b, "%d passed, %d warnings, %d failed\n", counts[StatusPass], counts[StatusWarn], counts[StatusFail])
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var statusColors = map[Status]string{StatusPass: "32", StatusWarn: "33", StatusFail: "31", StatusSkip: "2"}
@@ -0,0 +1,393 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+)
+
+// CompletionShells lists the shells CompletionScript supports.
+var CompletionShells = []string{"bash", "zsh", "fish"}
+
+// zshCompletionPrelude loads the bash completion system of zsh, so that
+// zsh runs the bash completion script.
+const zshCompletionPrelude = "autoload -U +X compinit && compinit\nautoload -U +X bashcompinit && bashcompinit\n\n"
+
+// compgenActions maps the <name> completion sources to compgen actions.
+var compgenActions = map[string]string{
+	"<alias>":     "-a",
+	"<command>":   "-c",
+	"<directory>": "-d",
+	"<export>":    "-e",
+	"<file>":      "-f",
+	"<group>":     "-g",
+	"<hostname>":  "-A hostname",
+	"<service>":   "-A service",
+	"<user>":      "-u",
+}
+
+// CompletionScript returns a completion script for the CLI rooted at root.
+//
+// Subcommands and flags complete by name. Flag values complete from the
+// flag's allowed values and completions, positional args from their
+// completions. A completion is a word, a <name> source such as <file> or
+// <directory>, or $(command), whose output is split into words. Private
+// commands and flags are left out.
+func CompletionScript(root *commandmodel.Command, shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashCompletion(root), nil
+	case "zsh":
+		return zshCompletionPrelude + bashCompletion(root), nil
+	case "fish":
+		return fishCompletion(root), nil
+	default:
+		return "", fmt.Errorf("unsupported completion shell %q (expected %s)", shell, strings.Join(CompletionShells, ", "))
+	}
+}
+
+// completionPath is the key of a command in the completion scripts: its
+// subcommand path below the root, "" for the root itself.
+func completionPath(c *commandmodel.Command) string {
+	if len(c.Parents) == 0 {
+		return ""
+	}
+	return c.ActionName
+}
+
+// completionName returns the root name as a shell function name fragment.
+func completionName(root *commandmodel.Command) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, root.Name)
+}
+
+// completionCommands returns the commands that take part in completion.
+func completionCommands(root *commandmodel.Command) []*commandmodel.Command {
+	out := []*commandmodel.Command{root}
+	var walk func(c *commandmodel.Command)
+	walk = func(c *commandmodel.Command) {
+		for _, child := range c.Commands {
+			if child.Private {
+				continue
+			}
+			out = append(out, child)
+			walk(child)
+		}
+	}
+	walk(root)
+	return out
+}
+
+func visibleSubcommands(c *commandmodel.Command) []string {
+	var names []string
+	for _, child := range c.Commands {
+		if !child.Private {
+			names = append(names, child.Name)
+		}
+	}
+	return names
+}
+
+// flagCompletions returns the value completions of a flag.
+func flagCompletions(f commandmodel.Flag) []string {
+	return append(append([]string{}, f.Allowed...), f.Completions...)
+}
+
+// casePattern returns a case pattern matching prefix followed by word, where
+// a * in word (as in wildcard aliases) stays a wildcard.
+func casePattern(prefix string, word string) string {
+	if prefix+word == "" {
+		return "''"
+	}
+	parts := strings.Split(prefix+word, "*")
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = shellQuote(p)
+		}
+	}
+	return strings.Join(parts, "*")
+}
+
+func bashCompletion(root *commandmodel.Command) string {
+	fn := "_" + completionName(root) + "_completions"
+	cmds := completionCommands(root)
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# %s completion for bash\n", root.Name)
+	b.WriteString("# Generated by go-bashly\n\n")
+
+	fmt.Fprintf(b, "%s_compgen() {\n", fn)
+	b.WriteString("  local line\n")
+	b.WriteString("  while IFS= read -r line; do\n")
+	b.WriteString("    [[ -n $line ]] && COMPREPLY+=(\"$line\")\n")
+	b.WriteString("  done < <(compgen \"$@\" -- \"$cur\")\n")
+	b.WriteString("}\n\n")
+
+	fmt.Fprintf(b, "%s() {\n", fn)
+	b.WriteString("  local cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("  local path=\"\" word expect=\"\" pos=0 i=1\n")
+	b.WriteString("  COMPREPLY=()\n\n")
+
+	b.WriteString("  # Resolve the subcommand\n")
+	b.WriteString("  while (( i < COMP_CWORD )); do\n")
+	b.WriteString("    word=\"${COMP_WORDS[i]}\"\n")
+	b.WriteString("    case \"$path:$word\" in\n")
+	for _, c := range cmds {
+		for _, child := range c.Commands {
+			if child.Private {
+				continue
+			}
+			patterns := make([]string, 0, len(child.Alias))
+			for _, a := range child.Alias {
+				patterns = append(patterns, casePattern(completionPath(c)+":", a))
+			}
+			fmt.Fprintf(b, "      %s) path=%s ;;\n", strings.Join(patterns, "|"), shellQuote(completionPath(child)))
+		}
+	}
+	b.WriteString("      *) break ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("    (( i++ ))\n")
+	b.WriteString("  done\n\n")
+
+	b.WriteString("  # Count positional args and find a flag waiting for its value\n")
+	b.WriteString("  while (( i < COMP_CWORD )); do\n")
+	b.WriteString("    word=\"${COMP_WORDS[i]}\"\n")
+	b.WriteString("    if [[ -n $expect ]]; then\n")
+	b.WriteString("      expect=\"\"\n")
+	b.WriteString("    elif [[ $word == -* ]]; then\n")
+	b.WriteString("      case \"$path:$word\" in\n")
+	var valueFlags []string
+	for _, c := range cmds {
+		for _, f := range c.VisibleFlags(false) {
+			if f.Arg == "" {
+				continue
+			}
+			for _, sw := range f.Switches() {
+				valueFlags = append(valueFlags, casePattern(completionPath(c)+":", sw))
+			}
+		}
+	}
+	if len(valueFlags) > 0 {
+		fmt.Fprintf(b, "        %s) expect=\"$word\" ;;\n", strings.Join(valueFlags, "|"))
+	}
+	b.WriteString("        *) ;;\n")
+	b.WriteString("      esac\n")
+	b.WriteString("    else\n")
+	b.WriteString("      (( pos++ ))\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    (( i++ ))\n")
+	b.WriteString("  done\n\n")
+
+	b.WriteString("  if [[ -n $expect ]]; then\n")
+	b.WriteString("    case \"$path:$expect\" in\n")
+	for _, c := range cmds {
+		for _, f := range c.VisibleFlags(false) {
+			if f.Arg == "" || len(flagCompletions(f)) == 0 {
+				continue
+			}
+			patterns := []string{}
+			for _, sw := range f.Switches() {
+				patterns = append(patterns, casePattern(completionPath(c)+":", sw))
+			}
+			fmt.Fprintf(b, "      %s)\n", strings.Join(patterns, "|"))
+			writeBashSources(b, fn, flagCompletions(f), "        ")
+			b.WriteString("        ;;\n")
+		}
+	}
+	b.WriteString("      *) ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("  elif [[ $cur == -* ]]; then\n")
+	b.WriteString("    case \"$path\" in\n")
+	for _, c := range cmds {
+		words := []string{"--help"}
+		for _, f := range c.VisibleFlags(false) {
+			words = append(words, f.Switches()...)
+		}
+		if len(c.Parents) == 0 && c.Version != "" {
+			words = append(words, "--version")
+		}
+		fmt.Fprintf(b, "      %s)\n", casePattern("", completionPath(c)))
+		fmt.Fprintf(b, "        %s_compgen -W %s\n", fn, shellQuote(strings.Join(words, " ")))
+		b.WriteString("        ;;\n")
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("  else\n")
+	b.WriteString("    case \"$path:$pos\" in\n")
+	for _, c := range cmds {
+		subs := visibleSubcommands(c)
+		for i, a := range c.Args {
+			if len(a.Completions) == 0 && (i > 0 || len(subs) == 0) {
+				continue
+			}
+			fmt.Fprintf(b, "      %s)\n", casePattern(completionPath(c)+":", fmt.Sprint(i)))
+			if i == 0 && len(subs) > 0 {
+				fmt.Fprintf(b, "        %s_compgen -W %s\n", fn, shellQuote(strings.Join(subs, " ")))
+			}
+			writeBashSources(b, fn, a.Completions, "        ")
+			b.WriteString("        ;;\n")
+		}
+		if len(c.Args) == 0 && len(subs) > 0 {
+			fmt.Fprintf(b, "      %s)\n", casePattern(completionPath(c)+":", "0"))
+			fmt.Fprintf(b, "        %s_compgen -W %s\n", fn, shellQuote(strings.Join(subs, " ")))
+			b.WriteString("        ;;\n")
+		}
+	}
+	b.WriteString("      *) ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("  fi\n")
+	b.WriteString("}\n\n")
+
+	fmt.Fprintf(b, "complete -o filenames -F %s %s\n", fn, shellQuote(root.Name))
+	return b.String()
+}
+
+// writeBashSources emits the compgen calls for a list of completion sources.
+func writeBashSources(b *strings.Builder, fn string, sources []string, indent string) {
+	var words []string
+	for _, s := range sources {
+		if action, ok := compgenActions[s]; ok {
+			fmt.Fprintf(b, "%s%s_compgen %s\n", indent, fn, action)
+		} else if cmd, ok := completionCommand(s); ok {
+			fmt.Fprintf(b, "%s%s_compgen -W \"$(%s)\"\n", indent, fn, cmd)
+		} else {
+			words = append(words, s)
+		}
+	}
+	if len(words) > 0 {
+		fmt.Fprintf(b, "%s%s_compgen -W %s\n", indent, fn, shellQuote(strings.Join(words, " ")))
+	}
+}
+
+// completionCommand returns the command of a $(command) completion source.
+func completionCommand(s string) (string, bool) {
+	if strings.HasPrefix(s, "$(") && strings.HasSuffix(s, ")") {
+		return s[2 : len(s)-1], true
+	}
+	return "", false
+}
+
+func fishCompletion(root *commandmodel.Command) string {
+	name := completionName(root)
+	prog := fishQuote(root.Name)
+	cmds := completionCommands(root)
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# %s completion for fish\n", root.Name)
+	b.WriteString("# Generated by go-bashly\n\n")
+
+	fmt.Fprintf(b, "function __%s_path_is\n", name)
+	b.WriteString("    set -l tokens (commandline -opc)\n")
+	b.WriteString("    set -e tokens[1]\n")
+	b.WriteString("    set -l path ''\n")
+	b.WriteString("    for token in $tokens\n")
+	b.WriteString("        switch \"$path:$token\"\n")
+	for _, c := range cmds {
+		for _, child := range c.Commands {
+			if child.Private {
+				continue
+			}
+			patterns := make([]string, 0, len(child.Alias))
+			for _, a := range child.Alias {
+				patterns = append(patterns, fishQuote(completionPath(c)+":"+a))
+			}
+			fmt.Fprintf(b, "            case %s\n", strings.Join(patterns, " "))
+			fmt.Fprintf(b, "                set path %s\n", fishQuote(completionPath(child)))
+		}
+	}
+	b.WriteString("            case '*'\n")
+	b.WriteString("                break\n")
+	b.WriteString("        end\n")
+	b.WriteString("    end\n")
+	b.WriteString("    test \"$path\" = \"$argv[1]\"\n")
+	b.WriteString("end\n\n")
+
+	fmt.Fprintf(b, "complete -c %s -f\n", prog)
+	for _, c := range cmds {
+		cond := fishQuote(fmt.Sprintf("__%s_path_is %s", name, fishQuote(completionPath(c))))
+		for _, child := range c.Commands {
+			if child.Private {
+				continue
+			}
+			fmt.Fprintf(b, "complete -c %s -n %s -a %s", prog, cond, fishQuote(child.Name))
+			if child.Description != "" {
+				fmt.Fprintf(b, " -d %s", fishQuote(firstLine(child.Description)))
+			}
+			b.WriteString("\n")
+		}
+		for _, f := range c.VisibleFlags(false) {
+			fmt.Fprintf(b, "complete -c %s -n %s", prog, cond)
+			if f.Long != "" {
+				fmt.Fprintf(b, " -l %s", fishQuote(strings.TrimPrefix(f.Long, "--")))
+			}
+			if f.Short != "" {
+				fmt.Fprintf(b, " -s %s", fishQuote(strings.TrimPrefix(f.Short, "-")))
+			}
+			if f.Arg != "" {
+				b.WriteString(" -r")
+				b.WriteString(fishSources(flagCompletions(f)))
+			}
+			b.WriteString("\n")
+		}
+		var sources []string
+		for _, a := range c.Args {
+			sources = append(sources, a.Completions...)
+		}
+		if len(sources) > 0 {
+			fmt.Fprintf(b, "complete -c %s -n %s%s\n", prog, cond, fishSources(sources))
+		}
+	}
+	return b.String()
+}
+
+// fishSources returns the complete options for a list of completion sources.
+func fishSources(sources []string) string {
+	var opts, words []string
+	for _, s := range sources {
+		switch {
+		case s == "<file>":
+			opts = append(opts, "-F")
+		case s == "<directory>":
+			words = append(words, "(__fish_complete_directories)")
+		case s == "<user>":
+			words = append(words, "(__fish_complete_users)")
+		case s == "<group>":
+			words = append(words, "(__fish_complete_groups)")
+		case s == "<command>":
+			words = append(words, "(__fish_complete_command)")
+		case strings.HasPrefix(s, "$(") && strings.HasSuffix(s, ")"):
+			cmd, _ := completionCommand(s)
+			words = append(words, "("+cmd+" | string split -n ' ')")
+		default:
+			words = append(words, fishEscape(s))
+		}
+	}
+	out := ""
+	for _, o := range opts {
+		out += " " + o
+	}
+	if len(words) > 0 {
+		out += " -a " + fishQuote(strings.Join(words, " "))
+	}
+	return out
+}
+
+// fishQuote quotes s for fish, whose single quotes only escape \ and '.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// fishEscape escapes a literal completion word for a fish -a list.
+func fishEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, " ", `\ `, "(", `\(`, ")", `\)`, "$", `\$`)
+	return r.Replace(s)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
@@ -0,0 +1,120 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// completionsCommandName is the meta-command printing and installing the
+// completion scripts.
+const completionsCommandName = "completions"
+
+// CompletionsCommandEnabled reports whether the completions meta-command is
+// generated: enable_completions_command is on and no root command already
+// answers to completions.
+func CompletionsCommandEnabled(root *commandmodel.Command, st settings.Settings) bool {
+	return isEnabled(st.EnableCompletionsCommand, st.Env) && !rootAnswers(root, completionsCommandName)
+}
+
+// rootAnswers reports whether a command of root answers to name, by name,
+// alias or wildcard alias.
+func rootAnswers(root *commandmodel.Command, name string) bool {
+	for _, c := range root.Commands {
+		for _, alias := range c.Alias {
+			if alias == name || (strings.HasSuffix(alias, "*") && strings.HasPrefix(name, strings.TrimSuffix(alias, "*"))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// buildCompletionsCommand emits bashly_completions_command, run for "<cli>
+// completions [--install] [bash|zsh|fish]": it prints the completion script
+// for the shell, $SHELL by default, or installs it where the shell loads
+// it, as go-bashly completions --install does.
+func buildCompletionsCommand(root *commandmodel.Command) string {
+	b := &strings.Builder{}
+	b.WriteString("bashly_completions_bash() {\n")
+	fmt.Fprintf(b, "  cat <<'BASHLY_COMPLETIONS'\n%sBASHLY_COMPLETIONS\n", bashCompletion(root))
+	b.WriteString("}\n\n")
+	b.WriteString("bashly_completions_fish() {\n")
+	fmt.Fprintf(b, "  cat <<'BASHLY_COMPLETIONS'\n%sBASHLY_COMPLETIONS\n", fishCompletion(root))
+	b.WriteString("}\n\n")
+
+	head, tail := zshAutoloadParts(root)
+	b.WriteString("bashly_completions_script() {\n")
+	b.WriteString("  case \"$1:$2\" in\n")
+	b.WriteString("    bash:*) bashly_completions_bash ;;\n")
+	fmt.Fprintf(b, "    zsh:install) printf '%%s' %s; bashly_completions_bash; printf '%%s' %s ;;\n", shellQuote(head), shellQuote(tail))
+	fmt.Fprintf(b, "    zsh:*) printf '%%s' %s; bashly_completions_bash ;;\n", shellQuote(zshCompletionPrelude))
+	b.WriteString("    fish:*) bashly_completions_fish ;;\n")
+	b.WriteString("  esac\n")
+	b.WriteString("}\n\n")
+
+	b.WriteString("bashly_completions_command() {\n")
+	b.WriteString("  bashly_completions_install=\"\"\n")
+	b.WriteString("  bashly_completions_shell=\"${SHELL##*/}\"\n")
+	b.WriteString("  case \"$bashly_completions_shell\" in\n")
+	b.WriteString("    bash | zsh | fish) ;;\n")
+	b.WriteString("    *) bashly_completions_shell=bash ;;\n")
+	b.WriteString("  esac\n")
+	b.WriteString("  while [ $# -gt 0 ]; do\n")
+	b.WriteString("    case \"$1\" in\n")
+	b.WriteString("      --install) bashly_completions_install=1 ;;\n")
+	b.WriteString("      bash | zsh | fish) bashly_completions_shell=\"$1\" ;;\n")
+	b.WriteString("      -*)\n")
+	fmt.Fprintf(b, "        echo \"ERROR: %s\" >&2\n", messageCall("invalid_option", "\"$1\""))
+	fmt.Fprintf(b, "        exit %d\n", root.ExitCode)
+	b.WriteString("        ;;\n")
+	b.WriteString("      *)\n")
+	fmt.Fprintf(b, "        echo \"ERROR: %s\" >&2\n", messageCall("unsupported_shell", "\"$1\""))
+	fmt.Fprintf(b, "        exit %d\n", root.ExitCode)
+	b.WriteString("        ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("    shift\n")
+	b.WriteString("  done\n")
+	b.WriteString("  if [ -z \"$bashly_completions_install\" ]; then\n")
+	b.WriteString("    bashly_completions_script \"$bashly_completions_shell\"\n")
+	b.WriteString("    return\n")
+	b.WriteString("  fi\n\n")
+
+	b.WriteString("  bashly_completions_dir=\"\"\n")
+	b.WriteString("  bashly_completions_note=\"\"\n")
+	b.WriteString("  case \"$bashly_completions_shell\" in\n")
+	b.WriteString("    bash)\n")
+	b.WriteString("      if command -v pkg-config >/dev/null 2>&1; then\n")
+	b.WriteString("        bashly_completions_dir=\"$(pkg-config --variable=completionsdir bash-completion 2>/dev/null)\"\n")
+	b.WriteString("      fi\n")
+	b.WriteString("      if [ -z \"$bashly_completions_dir\" ] || [ ! -d \"$bashly_completions_dir\" ] || [ ! -w \"$bashly_completions_dir\" ]; then\n")
+	b.WriteString("        bashly_completions_dir=\"${BASH_COMPLETION_USER_DIR:-${XDG_DATA_HOME:-$HOME/.local/share}/bash-completion}/completions\"\n")
+	b.WriteString("      fi\n")
+	fmt.Fprintf(b, "      bashly_completions_file=\"$bashly_completions_dir/\"%s\n", shellQuote(root.Name))
+	b.WriteString("      ;;\n")
+	b.WriteString("    zsh)\n")
+	b.WriteString("      if command -v zsh >/dev/null 2>&1; then\n")
+	b.WriteString("        bashly_completions_dir=\"$(zsh -fc 'for d in $fpath; do if [[ -d $d && -w $d ]]; then print -r -- $d; break; fi; done')\"\n")
+	b.WriteString("      fi\n")
+	b.WriteString("      if [ -z \"$bashly_completions_dir\" ]; then\n")
+	b.WriteString("        bashly_completions_dir=\"${ZDOTDIR:-$HOME}/.zfunc\"\n")
+	b.WriteString("        bashly_completions_note=\"add fpath=($bashly_completions_dir \\$fpath) before compinit in ~/.zshrc\"\n")
+	b.WriteString("      fi\n")
+	fmt.Fprintf(b, "      bashly_completions_file=\"$bashly_completions_dir/\"%s\n", shellQuote("_"+root.Name))
+	b.WriteString("      ;;\n")
+	b.WriteString("    fish)\n")
+	b.WriteString("      bashly_completions_dir=\"${XDG_CONFIG_HOME:-$HOME/.config}/fish/completions\"\n")
+	fmt.Fprintf(b, "      bashly_completions_file=\"$bashly_completions_dir/\"%s\n", shellQuote(root.Name+".fish"))
+	b.WriteString("      ;;\n")
+	b.WriteString("  esac\n")
+	b.WriteString("  mkdir -p \"$bashly_completions_dir\" || exit 1\n")
+	b.WriteString("  bashly_completions_script \"$bashly_completions_shell\" install >\"$bashly_completions_file\" || exit 1\n")
+	b.WriteString("  echo \"installed: $bashly_completions_file\"\n")
+	b.WriteString("  if [ -n \"$bashly_completions_note\" ]; then\n")
+	b.WriteString("    echo \"$bashly_completions_note\"\n")
+	b.WriteString("  fi\n")
+	b.WriteString("}\n\n")
+	return b.String()
+}
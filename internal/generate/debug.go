@@ -0,0 +1,89 @@
+package generate
+
+import (
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// debugFlag is the hidden flag that traces command execution.
+const debugFlag = "--bashly-debug"
+
+// buildDebugHelpers emits bashly_debug_start, which prints the command name
+// and the parsed values to stderr and turns on set -x when the script was
+// started with --bashly-debug.
+func buildDebugHelpers(st settings.Settings) string {
+	s := newArgStore(st)
+	b := &strings.Builder{}
+	b.WriteString("bashly_debug_start() {\n")
+	b.WriteString("  if " + s.cond("-z \"${bashly_debug:-}\"") + "; then\n")
+	b.WriteString("    return 0\n")
+	b.WriteString("  fi\n")
+	b.WriteString("  echo \"bashly-debug: command: $1\" >&2\n")
+	switch {
+	case s.posix:
+		b.WriteString("  set | grep -E '^BASHLY_(ARG|FLAG)_' | sed 's/^/bashly-debug:   /' >&2\n")
+	case isZshTarget(st):
+		b.WriteString("  local key\n")
+		b.WriteString("  for key in \"${(@ko)args}\"; do\n")
+		b.WriteString("    echo \"bashly-debug:   $key = ${args[$key]}\" >&2\n")
+		b.WriteString("  done\n")
+	default:
+		b.WriteString("  local key\n")
+		b.WriteString("  while IFS= read -r key; do\n")
+		b.WriteString("    if [[ -n $key ]]; then\n")
+		b.WriteString("      echo \"bashly-debug:   $key = ${args[$key]}\" >&2\n")
+		b.WriteString("    fi\n")
+		b.WriteString("  done < <(printf '%s\\n' \"${!args[@]}\" | sort)\n")
+	}
+	b.WriteString("  set -x\n")
+	b.WriteString("}\n\n")
+	return b.String()
+}
+
+// buildInspectArgs emits inspect_args, which partials call to print the
+// parsed values of their command. With enable_inspect_args off it does
+// nothing, unless inspect_args_key names a variable that is set and not
+// empty when the script runs, so shipped scripts can be debugged as they
+// are.
+func buildInspectArgs(st settings.Settings) string {
+	enabled := isEnabled(st.EnableInspectArgs, st.Env)
+	key := strings.TrimSpace(st.InspectArgsKey)
+	if !enabled && key == "" {
+		return "inspect_args() {\n  :\n}\n\n"
+	}
+	s := newArgStore(st)
+	b := &strings.Builder{}
+	b.WriteString("inspect_args() {\n")
+	if !enabled {
+		b.WriteString("  if " + s.cond("-z \"${"+key+":-}\"") + "; then\n")
+		b.WriteString("    return 0\n")
+		b.WriteString("  fi\n")
+	}
+	b.WriteString("  echo args:\n")
+	switch {
+	case s.posix:
+		b.WriteString("  set | grep -E '^BASHLY_(ARG|FLAG)_' | sed 's/^/- /'\n")
+	case isZshTarget(st):
+		b.WriteString("  local key\n")
+		b.WriteString("  for key in \"${(@ko)args}\"; do\n")
+		b.WriteString("    echo \"- \\${args[$key]} = ${args[$key]}\"\n")
+		b.WriteString("  done\n")
+	default:
+		b.WriteString("  local key\n")
+		b.WriteString("  while IFS= read -r key; do\n")
+		// An if, not &&: a failed test of the last key would be the
+		// status of inspect_args, which set -e callers abort on
+		b.WriteString("    if [[ -n $key ]]; then\n")
+		b.WriteString("      echo \"- \\${args[$key]} = ${args[$key]}\"\n")
+		b.WriteString("    fi\n")
+		b.WriteString("  done < <(printf '%s\\n' \"${!args[@]}\" | sort)\n")
+	}
+	b.WriteString("}\n\n")
+	return b.String()
+}
+
+// debugStop turns tracing off again without tracing itself.
+func debugStop(st settings.Settings) string {
+	return "if " + newArgStore(st).cond("-n \"${bashly_debug:-}\"") + "; then { set +x; } 2>/dev/null; fi"
+}
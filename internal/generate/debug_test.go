@@ -0,0 +1,58 @@
+package generate
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// TestInspectArgsNoArgs runs a command without args whose partial ends with
+// inspect_args, as scaffolded partials do, and checks the script exits 0.
+func TestInspectArgsNoArgs(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+	tests := []struct {
+		name    string
+		inspect string
+		key     string
+		env     []string
+		argv    []string
+		want    string
+	}{
+		{name: "inspect args on", inspect: "always", want: "args:"},
+		{name: "inspect args key", inspect: "never", key: "CLI_DEBUG_ARGS", env: []string{"CLI_DEBUG_ARGS=1"}, want: "args:"},
+		{name: "inspect args key unset", inspect: "never", key: "CLI_DEBUG_ARGS"},
+		{name: "debug flag", inspect: "never", argv: []string{debugFlag}, want: "bashly-debug: command: cli"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := settings.Default()
+			st.EnableViewMarkers = "never"
+			st.EnableDebugFlag = "always"
+			st.EnableInspectArgs = tt.inspect
+			st.InspectArgsKey = tt.key
+			script := renderInMem(t, map[string]any{"name": "cli"}, st, map[string]string{
+				"src/root_command.sh": "set -e\ninspect_args\n",
+			})
+			path := filepath.Join(t.TempDir(), "cli")
+			if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			cmd := exec.Command(bash, append([]string{path}, tt.argv...)...)
+			cmd.Env = append(os.Environ(), tt.env...)
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("cli exited with %v: %s", err, out)
+			}
+			if !strings.Contains(string(out), tt.want) {
+				t.Errorf("cli printed %q, want it to contain %q", out, tt.want)
+			}
+		})
+	}
+}
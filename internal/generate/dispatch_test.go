@@ -0,0 +1,99 @@
+package generate
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// TestDispatchForcedDefault runs a generated script and checks which command
+// gets which arguments, for a forced default command receiving the argv
+// that names no other command.
+func TestDispatchForcedDefault(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+	cfg := map[string]any{
+		"name":    "cli",
+		"version": "0.1.0",
+		"commands": []any{
+			map[string]any{
+				"name":    "serve",
+				"default": "force",
+				"args":    []any{map[string]any{"name": "target"}},
+				"flags": []any{
+					map[string]any{"long": "--port", "short": "-p", "arg": "port"},
+					map[string]any{"long": "--verbose"},
+				},
+			},
+			map[string]any{
+				"name":  "build",
+				"flags": []any{map[string]any{"long": "--out", "arg": "out"}},
+			},
+		},
+	}
+	show := `echo "$1 port=${args[--port]:-} verbose=${args[--verbose]:-} target=${args[target]:-} out=${args[--out]:-}"` + "\n"
+	st := settings.Default()
+	st.EnableViewMarkers = "never"
+	script := renderInMem(t, cfg, st, map[string]string{
+		"src/root_command.sh":  strings.Replace(show, "$1", "root", 1),
+		"src/serve_command.sh": strings.Replace(show, "$1", "serve", 1),
+		"src/build_command.sh": strings.Replace(show, "$1", "build", 1),
+	})
+	path := filepath.Join(t.TempDir(), "cli")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		argv string
+		want string
+	}{
+		{"", "serve port= verbose= target= out="},
+		{"--port 80", "serve port=80 verbose= target= out="},
+		{"-p 80 x", "serve port=80 verbose= target=x out="},
+		{"x --verbose", "serve port= verbose=1 target=x out="},
+		{"--port build", "serve port=build verbose= target= out="},
+		{"serve --port 80", "serve port=80 verbose= target= out="},
+		{"build --out o", "build port= verbose= target= out=o"},
+		{"--version", "0.1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.argv, func(t *testing.T) {
+			out, err := exec.Command(bash, append([]string{path}, strings.Fields(tt.argv)...)...).CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			if got := strings.TrimSpace(string(out)); got != tt.want {
+				t.Errorf("cli %s printed %q, want %q", tt.argv, got, tt.want)
+			}
+		})
+	}
+
+	helps := []struct {
+		argv string
+		want string // first line of the help
+	}{
+		{"--help", "cli"},
+		{"--port 80 --help", "cli serve"},
+		{"serve --help", "cli serve"},
+		{"--help build", "cli build"},
+	}
+	for _, tt := range helps {
+		t.Run(tt.argv, func(t *testing.T) {
+			out, err := exec.Command(bash, append([]string{path}, strings.Fields(tt.argv)...)...).CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			first, _, _ := strings.Cut(string(out), "\n")
+			if got := strings.TrimSpace(first); got != tt.want && !strings.HasPrefix(got, tt.want+" - ") {
+				t.Errorf("cli %s printed help starting %q, want %q", tt.argv, got, tt.want)
+			}
+		})
+	}
+}
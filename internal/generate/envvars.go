@@ -0,0 +1,113 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// buildEnvVarChecks emits the environment variable handling for a single
+// command. It runs inside the command function, so variables declared on a
+// subcommand are only defaulted, exported and validated when it is invoked.
+// Defaults are applied first, so they are checked like given values.
+func buildEnvVarChecks(c *commandmodel.Command, st settings.Settings) string {
+	if len(c.EnvVars) == 0 {
+		return ""
+	}
+	posix := isPOSIXTarget(st)
+
+	b := &strings.Builder{}
+	if isEnabled(st.EnableEnvVarNamesArray, st.Env) {
+		names := make([]string, 0, len(c.EnvVars))
+		for _, ev := range c.EnvVars {
+			names = append(names, shellQuote(ev.Name))
+		}
+		fmt.Fprintf(b, "env_var_names=(%s)\n", strings.Join(names, " "))
+	}
+
+	for _, ev := range c.EnvVars {
+		if ev.Default != "" {
+			fmt.Fprintf(b, "export %s=\"${%s:-%s}\"\n", ev.Name, ev.Name, escapeDoubleQuoted(ev.Default))
+		}
+	}
+
+	for _, ev := range c.EnvVars {
+		if !ev.Required {
+			continue
+		}
+		if posix {
+			fmt.Fprintf(b, "if [ -z \"${%s:-}\" ]; then\n", ev.Name)
+		} else {
+			fmt.Fprintf(b, "if [[ -z \"${%s:-}\" ]]; then\n", ev.Name)
+		}
+		fmt.Fprintf(b, "  echo \"ERROR: %s\" >&2\n", messageCall("missing_required_environment_variable", shellQuote(ev.Name)))
+		fmt.Fprintf(b, "  exit %d\n", c.ExitCode)
+		b.WriteString("fi\n")
+	}
+
+	// Allowed values and validate functions apply to set variables only.
+	for _, ev := range c.EnvVars {
+		if len(ev.Allowed) == 0 && len(ev.Validate) == 0 {
+			continue
+		}
+		if posix {
+			fmt.Fprintf(b, "if [ -n \"${%s:-}\" ]; then\n", ev.Name)
+		} else {
+			fmt.Fprintf(b, "if [[ -n \"${%s:-}\" ]]; then\n", ev.Name)
+		}
+		if len(ev.Allowed) > 0 {
+			quoted := make([]string, 0, len(ev.Allowed))
+			for _, a := range ev.Allowed {
+				quoted = append(quoted, shellQuote(a))
+			}
+			fmt.Fprintf(b, "  case \"$%s\" in\n", ev.Name)
+			fmt.Fprintf(b, "    %s) ;;\n", strings.Join(quoted, " | "))
+			b.WriteString("    *)\n")
+			fmt.Fprintf(b, "      echo \"ERROR: %s\" >&2\n", messageCall("disallowed_environment_variable", shellQuote(ev.Name), "\"$"+ev.Name+"\""))
+			fmt.Fprintf(b, "      exit %d\n", c.ExitCode)
+			b.WriteString("      ;;\n")
+			b.WriteString("  esac\n")
+		}
+		for _, fn := range ev.Validate {
+			fmt.Fprintf(b, "  bashly_validation=\"$(validate_%s \"$%s\")\"\n", fn, ev.Name)
+			if posix {
+				b.WriteString("  if [ -n \"$bashly_validation\" ]; then\n")
+			} else {
+				b.WriteString("  if [[ -n \"$bashly_validation\" ]]; then\n")
+			}
+			fmt.Fprintf(b, "    echo \"ERROR: %s\" >&2\n", messageCall("validation_error", shellQuote(ev.Name), "\"$bashly_validation\""))
+			fmt.Fprintf(b, "    exit %d\n", c.ExitCode)
+			b.WriteString("  fi\n")
+		}
+		b.WriteString("fi\n")
+	}
+
+	return b.String()
+}
+
+// envValidateFunctions returns the validate_<name> functions the
+// environment variables of cmds call, so tree shaking keeps them.
+func envValidateFunctions(cmds []*commandmodel.Command) string {
+	var calls []string
+	for _, c := range cmds {
+		for _, ev := range c.EnvVars {
+			for _, fn := range ev.Validate {
+				calls = append(calls, "validate_"+fn)
+			}
+		}
+	}
+	return strings.Join(calls, "\n")
+}
+
+// shellQuote wraps s in single quotes, escaping embedded single quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// escapeDoubleQuoted escapes characters that are special inside double quotes.
+func escapeDoubleQuoted(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return r.Replace(s)
+}
@@ -0,0 +1,37 @@
+package generate
+
+import (
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// usesOnExit reports whether any command declares on_exit.
+func usesOnExit(cmds []*commandmodel.Command) bool {
+	for _, c := range cmds {
+		if c.OnExit != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// buildExitTrap emits bashly_on_exit_trap, which calls the on_exit function
+// of the running command, and the traps that call it. The traps are set at
+// the top level so they also fire in zsh, where an EXIT trap set in a
+// function only runs when the function returns. INT and TERM exit with
+// 130 and 143, which runs the EXIT trap once.
+func buildExitTrap(st settings.Settings) string {
+	s := newArgStore(st)
+	b := &strings.Builder{}
+	b.WriteString("bashly_on_exit_trap() {\n")
+	b.WriteString("  if " + s.cond("-n \"${bashly_on_exit:-}\"") + "; then\n")
+	b.WriteString("    \"$bashly_on_exit\"\n")
+	b.WriteString("  fi\n")
+	b.WriteString("}\n")
+	b.WriteString("trap bashly_on_exit_trap EXIT\n")
+	b.WriteString("trap 'exit 130' INT\n")
+	b.WriteString("trap 'exit 143' TERM\n")
+	return b.String()
+}
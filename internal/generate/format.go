@@ -2,65 +2,205 @@ package generate
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"log/slog"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // FormatResult holds the outcome of script formatting.
 type FormatResult struct {
 	Formatted string
 	Error     string
+	Warning   string
 }
 
+// FormatOptions selects and configures the formatter applied to the script.
+type FormatOptions struct {
+	Formatter string
+	Args      []string
+	TabIndent bool
+	Timeout   time.Duration
+	Fallback  bool // fall back to the internal formatter when the external one is unavailable or fails
+}
+
+// defaultShfmtArgs mirror the Ruby bashly recommendation for shfmt.
+var defaultShfmtArgs = []string{"--case-indent", "--indent", "2"}
+
 // FormatScript applies internal or external formatter to script content.
 // Matches bashly_formatting_pipeline.elst.cue logic: tab indentation, internal formatter, external formatter.
-func FormatScript(content string, formatter string, tabIndent bool) FormatResult {
+// Cancelling ctx stops an external formatter; there is no fallback then.
+func FormatScript(ctx context.Context, content string, opts FormatOptions) FormatResult {
 	// Apply tab indentation first
-	if tabIndent {
-		content = strings.ReplaceAll(content, "  ", "\t")
+	if opts.TabIndent {
+		content = indentWithTabs(content)
 	}
 
 	// Choose formatter
-	switch formatter {
+	slog.Debug("formatting script", "formatter", opts.Formatter, "tab_indent", opts.TabIndent)
+	switch opts.Formatter {
 	case "internal":
-		return FormatResult{Formatted: removeExcessNewlines(content), Error: ""}
+		return FormatResult{Formatted: formatInternal(content), Error: ""}
 	case "none":
 		return FormatResult{Formatted: content, Error: ""}
 	default:
-		// External formatter command
-		cmd := exec.Command(formatter)
-		cmd.Stdin = strings.NewReader(content)
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
-
-		if err := cmd.Run(); err != nil {
-			return FormatResult{
-				Formatted: "",
-				Error:     fmt.Sprintf("formatter failed: %v (stderr: %s)", err, stderr.String()),
+		out, err := runExternalFormatter(ctx, content, opts)
+		if err != nil {
+			if opts.Fallback && ctx.Err() == nil {
+				return FormatResult{
+					Formatted: formatInternal(content),
+					Warning:   err.Error() + "; using internal formatter",
+				}
 			}
+			return FormatResult{Formatted: "", Error: err.Error()}
 		}
-		return FormatResult{Formatted: out.String(), Error: ""}
+		return FormatResult{Formatted: out, Error: ""}
+	}
+}
+
+// runExternalFormatter pipes content through an external formatter command.
+// The formatter setting may carry its own arguments ("shfmt --indent 2");
+// formatter_args are appended to them.
+func runExternalFormatter(ctx context.Context, content string, opts FormatOptions) (string, error) {
+	fields := strings.Fields(opts.Formatter)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("formatter is empty")
+	}
+	name := fields[0]
+	args := append(fields[1:], opts.Args...)
+	if name == "shfmt" && len(args) == 0 {
+		args = append(args, defaultShfmtArgs...)
+	}
+
+	bin, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("formatter %s not found in PATH", name)
+	}
+
+	parent := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdin = strings.NewReader(content)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if parent.Err() != nil {
+			return "", context.Cause(parent)
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("formatter %s timed out after %s", name, opts.Timeout)
+		}
+		return "", fmt.Errorf("formatter failed: %v (stderr: %s)", err, stderr.String())
+	}
+	return out.String(), nil
+}
+
+// parseFormatterTimeout accepts a Go duration ("30s") or a number of seconds.
+func parseFormatterTimeout(v string) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid formatter_timeout: %s", v)
 	}
+	return d, nil
 }
 
-// removeExcessNewlines removes consecutive blank lines (internal formatter).
-// Matches bashly_formatting_pipeline.elst.cue logic: collapse multiple blank lines.
-func removeExcessNewlines(content string) string {
+// heredocStart matches a heredoc redirection and captures its delimiter word,
+// e.g. <<EOF, <<'EOF', <<-"EOF".
+var heredocStart = regexp.MustCompile(`<<(-?)\s*(['"]?)([A-Za-z_][A-Za-z0-9_]*)(['"]?)`)
+
+// mapScriptLines calls fn for every line of content outside heredoc bodies;
+// fn returns the replacement line and whether to keep it. Heredoc bodies
+// (and their terminators) are literal text, so they are copied unchanged.
+func mapScriptLines(content string, fn func(line string) (string, bool)) string {
 	lines := strings.Split(content, "\n")
-	var result []string
-	prevBlank := false
+	out := make([]string, 0, len(lines))
+	terminator := ""
+	stripTabs := false
 
 	for _, line := range lines {
-		isBlank := strings.TrimSpace(line) == ""
-		if isBlank && prevBlank {
-			continue // skip consecutive blank lines
+		if terminator != "" {
+			out = append(out, line)
+			check := line
+			if stripTabs {
+				check = strings.TrimLeft(check, "\t")
+			}
+			if check == terminator {
+				terminator = ""
+			}
+			continue
+		}
+
+		if formatted, keep := fn(line); keep {
+			out = append(out, formatted)
+		}
+		if word, dash, ok := findHeredoc(line); ok {
+			terminator = word
+			stripTabs = dash
 		}
-		result = append(result, line)
-		prevBlank = isBlank
 	}
+	return strings.Join(out, "\n")
+}
 
-	return strings.Join(result, "\n")
+// findHeredoc returns the delimiter word of the first heredoc redirection of
+// line and whether it is <<-. Here-strings (<<<word) and left shifts inside
+// arithmetic (( ... )) look the same to heredocStart, so they are skipped.
+func findHeredoc(line string) (word string, dash bool, ok bool) {
+	for _, m := range heredocStart.FindAllStringSubmatchIndex(line, -1) {
+		start := m[0]
+		if start > 0 && line[start-1] == '<' {
+			continue
+		}
+		if strings.Count(line[:start], "((") > strings.Count(line[:start], "))") {
+			continue
+		}
+		return line[m[6]:m[7]], m[3] > m[2], true
+	}
+	return "", false, false
+}
+
+// indentWithTabs converts leading indentation (pairs of spaces) to tabs.
+// Spaces after the first non-blank character are never touched.
+func indentWithTabs(content string) string {
+	return mapScriptLines(content, func(line string) (string, bool) {
+		body := strings.TrimLeft(line, " \t")
+		indent := line[:len(line)-len(body)]
+		spaces := strings.Count(indent, " ")
+		tabs := strings.Count(indent, "\t") + spaces/2
+		return strings.Repeat("\t", tabs) + strings.Repeat(" ", spaces%2) + body, true
+	})
+}
+
+// formatInternal is the built-in formatter: it strips trailing whitespace,
+// collapses consecutive blank lines and ensures a single trailing newline.
+func formatInternal(content string) string {
+	prevBlank := false
+	out := mapScriptLines(content, func(line string) (string, bool) {
+		line = strings.TrimRight(line, " \t\r")
+		isBlank := line == ""
+		if isBlank && prevBlank {
+			return "", false // skip consecutive blank lines
+		}
+		prevBlank = isBlank
+		return line, true
+	})
+	return strings.TrimRight(out, "\n") + "\n"
 }
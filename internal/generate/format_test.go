@@ -0,0 +1,63 @@
+package generate
+
+import "testing"
+
+func TestFindHeredoc(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		word string
+		dash bool
+		ok   bool
+	}{
+		{name: "plain", line: "cat <<EOF", word: "EOF", ok: true},
+		{name: "quoted", line: "cat <<'EOF'", word: "EOF", ok: true},
+		{name: "double quoted", line: `cat <<-"END"`, word: "END", dash: true, ok: true},
+		{name: "space", line: "cat << EOF > out", word: "EOF", ok: true},
+		{name: "here-string", line: "read -r x <<<word"},
+		{name: "here-string with space", line: "grep -q foo <<< bar"},
+		{name: "arithmetic", line: "(( mask = 1 << bit ))"},
+		{name: "arithmetic expansion", line: "echo $(( x << shift ))"},
+		{name: "after arithmetic", line: "(( n++ )); cat <<EOF", word: "EOF", ok: true},
+		{name: "here-string then heredoc", line: "cat <<<x <<EOF", word: "EOF", ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			word, dash, ok := findHeredoc(tt.line)
+			if word != tt.word || dash != tt.dash || ok != tt.ok {
+				t.Errorf("findHeredoc(%q) = %q, %v, %v, want %q, %v, %v", tt.line, word, dash, ok, tt.word, tt.dash, tt.ok)
+			}
+		})
+	}
+}
+
+func TestFormatInternalHeredocs(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "heredoc body is kept",
+			in:   "cat <<EOF\nbody  \n\n\nEOF\necho done  \n",
+			want: "cat <<EOF\nbody  \n\n\nEOF\necho done\n",
+		},
+		{
+			name: "here-string",
+			in:   "read -r x <<<word\necho one  \n\n\nword\necho two  \n",
+			want: "read -r x <<<word\necho one\n\nword\necho two\n",
+		},
+		{
+			name: "arithmetic shift",
+			in:   "(( mask = 1 << bit ))\necho one  \n\n\nbit\necho two  \n",
+			want: "(( mask = 1 << bit ))\necho one\n\nbit\necho two\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatInternal(tt.in); got != tt.want {
+				t.Errorf("formatInternal(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
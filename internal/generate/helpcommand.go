@@ -0,0 +1,71 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/render"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// helpCommandName is the meta-command listing and searching the commands.
+const helpCommandName = "help"
+
+// HelpCommandEnabled reports whether the help meta-command is generated:
+// enable_help_command is on and no root command already answers to help.
+func HelpCommandEnabled(root *commandmodel.Command, st settings.Settings) bool {
+	return isEnabled(st.EnableHelpCommand, st.Env) && !rootAnswers(root, helpCommandName)
+}
+
+// SearchCommands returns the lines of index containing term, ignoring case.
+func SearchCommands(index []string, term string) []string {
+	var out []string
+	for _, line := range index {
+		if strings.Contains(strings.ToLower(line), strings.ToLower(term)) {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// buildHelpCommand emits bashly_help_command, run for "<cli> help
+// [--search TERM]": it prints the command index, or the lines of it that
+// contain TERM, ignoring case. Private commands are left out.
+func buildHelpCommand(root *commandmodel.Command, cat Catalog) string {
+	b := &strings.Builder{}
+	b.WriteString("bashly_help_index() {\n")
+	fmt.Fprintf(b, "  cat <<'EOF'\n%s\nEOF\n", strings.Join(render.CommandIndex(root, render.UsageOptions{}), "\n"))
+	b.WriteString("}\n\n")
+
+	b.WriteString("bashly_help_command() {\n")
+	b.WriteString("  bashly_help_term=\"\"\n")
+	b.WriteString("  case \"${1:-}\" in\n")
+	b.WriteString("    --search | -s)\n")
+	b.WriteString("      if [ $# -lt 2 ]; then\n")
+	fmt.Fprintf(b, "        echo \"ERROR: %s\" >&2\n", messageCall("flag_requires_an_argument", "\"$1\""))
+	fmt.Fprintf(b, "        exit %d\n", root.ExitCode)
+	b.WriteString("      fi\n")
+	b.WriteString("      bashly_help_term=\"$2\"\n")
+	b.WriteString("      ;;\n")
+	b.WriteString("    \"\")\n")
+	b.WriteString("      ;;\n")
+	b.WriteString("    *)\n")
+	fmt.Fprintf(b, "      echo \"ERROR: %s\" >&2\n", messageCall("invalid_option", "\"$1\""))
+	fmt.Fprintf(b, "      exit %d\n", root.ExitCode)
+	b.WriteString("      ;;\n")
+	b.WriteString("  esac\n")
+	b.WriteString("  bashly_help_matches=\"$(bashly_help_index | grep -iF -- \"$bashly_help_term\")\"\n")
+	b.WriteString("  if [ -z \"$bashly_help_matches\" ]; then\n")
+	fmt.Fprintf(b, "    echo \"%s\" >&2\n", messageCall("no_matching_commands", "\"$bashly_help_term\""))
+	b.WriteString("    exit 1\n")
+	b.WriteString("  fi\n")
+	heading, ok := cat.Strings["commands"]
+	if !ok {
+		heading = render.DefaultStrings["commands"]
+	}
+	fmt.Fprintf(b, "  echo %s\n", shellQuote(heading))
+	b.WriteString("  printf '%s\\n' \"$bashly_help_matches\"\n")
+	b.WriteString("}\n\n")
+	return b.String()
+}
@@ -0,0 +1,34 @@
+package generate
+
+import (
+	"path/filepath"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// ScriptPath returns the path the master script of root is written to.
+func ScriptPath(root *commandmodel.Command, st settings.Settings, workdir string) string {
+	return filepath.Join(workdir, st.TargetDir, root.Name)
+}
+
+// TargetShell returns the resolved target_shell: bash, zsh or sh.
+func TargetShell(st settings.Settings) string {
+	return targetShell(st)
+}
+
+// CommandFunctions names the shell functions generated for a command.
+type CommandFunctions struct {
+	Command string `json:"command"`
+	Parser  string `json:"parser"`
+	Usage   string `json:"usage"`
+}
+
+// FunctionsFor returns the names of the functions generated for c.
+func FunctionsFor(c *commandmodel.Command) CommandFunctions {
+	return CommandFunctions{
+		Command: functionNameForCommand(c),
+		Parser:  parserFunctionName(c),
+		Usage:   usageFunctionName(c),
+	}
+}
@@ -0,0 +1,130 @@
+package generate
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
+)
+
+// CompletionInstall is the file completions --install writes for a shell.
+type CompletionInstall struct {
+	Path   string
+	Script string
+	// Note tells what the shell still needs to load the file, if anything.
+	Note string
+}
+
+// InstallShell returns the shell completions are installed for when none
+// is given: the login shell from $SHELL when supported, else bash.
+func InstallShell() string {
+	shell := filepath.Base(os.Getenv("SHELL"))
+	if containsString(CompletionShells, shell) {
+		return shell
+	}
+	return "bash"
+}
+
+// CompletionInstallFor returns where and what to install for the completion
+// of root in shell:
+//
+//   - bash: the completionsdir of bash-completion when writable, else
+//     $BASH_COMPLETION_USER_DIR/completions or
+//     ${XDG_DATA_HOME:-~/.local/share}/bash-completion/completions
+//   - zsh: _<name> in the first writable directory of zsh's fpath, else
+//     ~/.zfunc, which the note asks to add to fpath
+//   - fish: ${XDG_CONFIG_HOME:-~/.config}/fish/completions/<name>.fish
+func CompletionInstallFor(root *commandmodel.Command, shell string) (CompletionInstall, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return CompletionInstall{}, err
+	}
+	envOr := func(name string, def string) string {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+		return def
+	}
+
+	switch shell {
+	case "bash":
+		dir := commandOutput("pkg-config", "--variable=completionsdir", "bash-completion")
+		if dir == "" || !writableDir(dir) {
+			dir = filepath.Join(envOr("BASH_COMPLETION_USER_DIR", filepath.Join(envOr("XDG_DATA_HOME", filepath.Join(home, ".local", "share")), "bash-completion")), "completions")
+		}
+		return CompletionInstall{Path: filepath.Join(dir, root.Name), Script: bashCompletion(root)}, nil
+	case "zsh":
+		in := CompletionInstall{Script: zshAutoloadCompletion(root)}
+		for _, dir := range strings.Split(commandOutput("zsh", "-fc", "print -rl -- $fpath"), "\n") {
+			if dir != "" && writableDir(dir) {
+				in.Path = filepath.Join(dir, "_"+root.Name)
+				return in, nil
+			}
+		}
+		dir := filepath.Join(envOr("ZDOTDIR", home), ".zfunc")
+		in.Path = filepath.Join(dir, "_"+root.Name)
+		in.Note = fmt.Sprintf("add fpath=(%s $fpath) before compinit in ~/.zshrc", dir)
+		return in, nil
+	case "fish":
+		dir := filepath.Join(envOr("XDG_CONFIG_HOME", filepath.Join(home, ".config")), "fish", "completions")
+		return CompletionInstall{Path: filepath.Join(dir, root.Name+".fish"), Script: fishCompletion(root)}, nil
+	default:
+		return CompletionInstall{}, fmt.Errorf("unsupported completion shell %q (expected %s)", shell, strings.Join(CompletionShells, ", "))
+	}
+}
+
+// InstallCompletion writes in, creating its directory.
+func InstallCompletion(in CompletionInstall) error {
+	if err := os.MkdirAll(filepath.Dir(in.Path), 0o755); err != nil {
+		return fmt.Errorf("create completions dir: %w", err)
+	}
+	if err := vfs.Disk.WriteFile(in.Path, []byte(in.Script), 0o644); err != nil {
+		return fmt.Errorf("write completions: %w", err)
+	}
+	return nil
+}
+
+// zshAutoloadCompletion returns the bash completion of root as a zsh
+// completion function: zsh autoloads it from fpath on the first
+// completion, which registers the bash function and answers through it.
+func zshAutoloadCompletion(root *commandmodel.Command) string {
+	head, tail := zshAutoloadParts(root)
+	return head + bashCompletion(root) + tail
+}
+
+// zshAutoloadParts returns what zshAutoloadCompletion puts around the bash
+// completion script.
+func zshAutoloadParts(root *commandmodel.Command) (string, string) {
+	return "#compdef " + root.Name + "\nautoload -U +X bashcompinit && bashcompinit\n\n",
+		"\n_bash_complete -o filenames -F _" + completionName(root) + "_completions\n"
+}
+
+// commandOutput returns the trimmed output of a command, or "" when it
+// cannot run or fails.
+func commandOutput(name string, args ...string) string {
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writableDir reports whether dir is a directory the user can create files
+// in.
+func writableDir(dir string) bool {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	f, err := os.CreateTemp(dir, ".go-bashly-*")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
@@ -0,0 +1,133 @@
+package generate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/buildinfo"
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// With enable_integrity_footer, the last line of a script records what it
+// was generated from:
+//
+//	# go-bashly-integrity: version=0.1.0 config=sha256:... script=sha256:...
+//
+// config hashes the command tree and settings, script the bytes before the
+// footer. go-bashly verify tells a script edited by hand, whose bytes no
+// longer match, from a stale one, whose config has changed since or which
+// renders differently now that a partial, lib, header or notice changed.
+
+const integrityPrefix = "# go-bashly-integrity: "
+
+// ErrNoIntegrityFooter is returned by VerifyScript for a script without a
+// footer.
+var ErrNoIntegrityFooter = errors.New("no integrity footer; generate the script with enable_integrity_footer on")
+
+// IntegrityFooter is the content of the footer of a script.
+type IntegrityFooter struct {
+	Version string // of go-bashly
+	Config  string // ConfigDigest of the command tree and settings
+	Script  string // digest of the script before the footer
+}
+
+// Verification is the outcome of VerifyScript.
+type Verification struct {
+	Footer IntegrityFooter
+	Edited bool // the script changed after it was generated
+	Stale  bool // the config, settings or inlined files changed since the script was generated
+}
+
+// ConfigDigest hashes the command tree and settings a script is generated
+// from, for the config field of its footer.
+func ConfigDigest(root *commandmodel.Command, st settings.Settings) (string, error) {
+	b, err := json.Marshal(struct {
+		Root     *commandmodel.Command `json:"root"`
+		Settings settings.Settings     `json:"settings"`
+	}{root, st})
+	if err != nil {
+		return "", fmt.Errorf("config digest: %w", err)
+	}
+	return digest(b), nil
+}
+
+// VerifyScript checks script against its footer, and for staleness against
+// the digest of root and st and against the script rendered from them now
+// with opts, whose partials, libs, header and notice the config digest does
+// not cover.
+func VerifyScript(ctx context.Context, script []byte, root *commandmodel.Command, st settings.Settings, opts Options) (Verification, error) {
+	body, footer, ok := ReadIntegrityFooter(script)
+	if !ok {
+		return Verification{}, ErrNoIntegrityFooter
+	}
+	config, err := ConfigDigest(root, st)
+	if err != nil {
+		return Verification{}, err
+	}
+	v := Verification{
+		Footer: footer,
+		Edited: digest(body) != footer.Script,
+		Stale:  config != footer.Config,
+	}
+	if !v.Stale {
+		rendered, _, err := buildMasterScript(ctx, root, st, opts)
+		if err != nil {
+			return Verification{}, err
+		}
+		renderedBody, _, _ := ReadIntegrityFooter(rendered)
+		v.Stale = digest(renderedBody) != footer.Script
+	}
+	return v, nil
+}
+
+// ReadIntegrityFooter returns script without its footer, and the footer;
+// ok is false when there is none. Lines added after the footer are kept,
+// so that they count as edits.
+func ReadIntegrityFooter(script []byte) (body []byte, footer IntegrityFooter, ok bool) {
+	start := bytes.LastIndex(script, []byte("\n"+integrityPrefix)) + 1
+	if start == 0 && !bytes.HasPrefix(script, []byte(integrityPrefix)) {
+		return script, IntegrityFooter{}, false
+	}
+	end := len(script)
+	if i := bytes.IndexByte(script[start:], '\n'); i >= 0 {
+		end = start + i + 1
+	}
+	line := strings.TrimRight(string(script[start:end]), "\r\n")
+	for _, field := range strings.Fields(strings.TrimPrefix(line, integrityPrefix)) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "version":
+			footer.Version = value
+		case "config":
+			footer.Config = value
+		case "script":
+			footer.Script = value
+		}
+	}
+	body = append(append([]byte{}, script[:start]...), script[end:]...)
+	return body, footer, true
+}
+
+// withIntegrityFooter returns script with its footer, if any, replaced by
+// one for config.
+func withIntegrityFooter(script []byte, config string) []byte {
+	body, _, _ := ReadIntegrityFooter(script)
+	out := append([]byte{}, body...)
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		out = append(out, '\n')
+	}
+	footer := fmt.Sprintf("%sversion=%s config=%s script=%s\n", integrityPrefix, buildinfo.Version, config, digest(out))
+	return append(out, footer...)
+}
+
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -2,21 +2,29 @@ package generate
 
 import (
 	"fmt"
-	"os"
+	"log/slog"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+
 	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
 )
 
 // MergeLibs discovers and merges lib files from lib_dir and extra_lib_dirs.
 // Matches bashly_lib_merge.elst.cue logic: discover, filter .sh files, concatenate.
-func MergeLibs(sourceDir, libDir string, extraLibDirs []string) (string, error) {
+// With namespaces, the functions of each file are renamed <file>_<name>,
+// calls inside the file included. A function defined twice, in one file or
+// across files, is an error.
+func MergeLibs(fsys vfs.FS, sourceDir, libDir string, extraLibDirs []string, namespaces bool) (string, error) {
 	var libFiles []string
 
 	// Discover lib files in lib_dir
 	libPath := filepath.Join(sourceDir, libDir)
-	if entries, err := os.ReadDir(libPath); err == nil {
+	if entries, err := fsys.ReadDir(libPath); err == nil {
 		for _, entry := range entries {
 			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sh") {
 				libFiles = append(libFiles, filepath.Join(libPath, entry.Name()))
@@ -26,7 +34,7 @@ func MergeLibs(sourceDir, libDir string, extraLibDirs []string) (string, error)
 
 	// Discover lib files in extra_lib_dirs
 	for _, extraDir := range extraLibDirs {
-		if entries, err := os.ReadDir(extraDir); err == nil {
+		if entries, err := fsys.ReadDir(extraDir); err == nil {
 			for _, entry := range entries {
 				if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sh") {
 					libFiles = append(libFiles, filepath.Join(extraDir, entry.Name()))
@@ -37,29 +45,122 @@ func MergeLibs(sourceDir, libDir string, extraLibDirs []string) (string, error)
 
 	// Concatenate lib content
 	var parts []string
+	definedIn := map[string]string{}
 	for _, file := range libFiles {
-		content, err := os.ReadFile(file)
+		content, err := fsys.ReadFile(file)
 		if err != nil {
 			return "", fmt.Errorf("read lib file %s: %w", file, err)
 		}
-		parts = append(parts, string(content))
+		slog.Debug("lib file merged", "path", file)
+		// Lib files edited on Windows may use CRLF, which bash rejects.
+		text := strings.ReplaceAll(string(content), "\r\n", "\n")
+		if namespaces {
+			text = namespaceLib(text, libNamespace(file))
+		}
+
+		label := file
+		if rel, err := filepath.Rel(sourceDir, file); err == nil {
+			label = filepath.ToSlash(rel)
+		}
+		for _, b := range splitLibFunctions(text) {
+			if b.Name == "" {
+				continue
+			}
+			if prev, ok := definedIn[b.Name]; ok {
+				if prev == label {
+					return "", fmt.Errorf("lib function %s is defined twice in %s", b.Name, label)
+				}
+				return "", fmt.Errorf("lib function %s is defined in both %s and %s (rename one, or set lib_namespaces: true)", b.Name, prev, label)
+			}
+			definedIn[b.Name] = label
+		}
+		parts = append(parts, text)
 	}
 
 	return strings.Join(parts, "\n"), nil
 }
 
+// libNamespace returns the prefix of the functions of a lib file: its name
+// without extension, with characters other than letters, digits and _
+// replaced by _.
+func libNamespace(file string) string {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// namespaceLib renames the functions defined in lib to prefix_name, along
+// with the calls to them in command position (at the start of a line or
+// after ;, &, |, (, {, a backquote, then, do, else and similar keywords).
+// Words inside strings and arguments are left alone.
+func namespaceLib(lib string, prefix string) string {
+	var names []string
+	for _, b := range splitLibFunctions(lib) {
+		if b.Name != "" && !containsString(names, b.Name) {
+			names = append(names, b.Name)
+		}
+	}
+	if len(names) == 0 {
+		return lib
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	quoted := make([]string, 0, len(names))
+	for _, n := range names {
+		quoted = append(quoted, regexp.QuoteMeta(n))
+	}
+	call := regexp.MustCompile("(?m)((?:^|[;&|({`]|\\b(?:then|do|else|elif|if|while|until|function|time|!)\\s)\\s*)(" + strings.Join(quoted, "|") + ")(\\s|[;&|()]|$)")
+	// Adjacent calls share the separator between them, so replace until
+	// nothing is left.
+	for {
+		next := call.ReplaceAllString(lib, "${1}"+prefix+"_${2}${3}")
+		if next == lib {
+			return lib
+		}
+		lib = next
+	}
+}
+
+// checkLibCollisions reports lib functions that share a name with a
+// function of the generated script, which would silently replace them.
+func checkLibCollisions(lib string, cmds []*commandmodel.Command) error {
+	generated := map[string]bool{}
+	for _, name := range generatedHelpers {
+		generated[name] = true
+	}
+	for _, c := range cmds {
+		generated[functionNameForCommand(c)] = true
+		generated[parserFunctionName(c)] = true
+		generated[usageFunctionName(c)] = true
+	}
+	for _, b := range splitLibFunctions(lib) {
+		if generated[b.Name] {
+			return fmt.Errorf("lib function %s has the name of a function of the generated script; rename it", b.Name)
+		}
+	}
+	return nil
+}
+
+// generatedHelpers are the fixed function names of generated scripts.
+// bashly_on_command_start is not one of them: libs define it.
+var generatedHelpers = []string{
+	"bashly_completions_bash", "bashly_completions_command", "bashly_completions_fish",
+	"bashly_completions_script", "bashly_debug_start", "bashly_help_command", "bashly_help_index",
+	"bashly_page_help",
+	"dispatch", "inspect_args", "message_text", "normalize_input", "normalize_value",
+	"parse_args", "prompt_value", "quote_arg", "run", "selftest", "selftest_report",
+}
+
 // EmitFeatureToggles generates conditional sections based on enable_* settings.
-// Matches bashly_lib_merge.elst.cue logic: inspect args, view markers, deps array, env var names, sourcing.
+// Matches bashly_lib_merge.elst.cue logic: view markers, deps array, env var names.
+// enable_inspect_args shapes inspect_args (see buildInspectArgs).
+// enable_sourcing is applied to the entry point (see sourcingGuard).
 func EmitFeatureToggles(st settings.Settings) string {
 	var b strings.Builder
 
-	// enable_inspect_args
-	if isEnabled(st.EnableInspectArgs, st.Env) {
-		b.WriteString("inspect_args() {\n")
-		b.WriteString("  echo \"args: $@\"\n")
-		b.WriteString("}\n\n")
-	}
-
 	// enable_view_markers
 	if isEnabled(st.EnableViewMarkers, st.Env) {
 		b.WriteString("# VIEW MARKERS ENABLED\n")
@@ -68,22 +169,24 @@ func EmitFeatureToggles(st settings.Settings) string {
 
 	// enable_deps_array
 	if isEnabled(st.EnableDepsArray, st.Env) {
-		b.WriteString("declare -a deps=()\n")
+		b.WriteString(declareBuiltin(st) + " -a deps=()\n")
 		b.WriteString("# Dependencies array populated by script\n\n")
 	}
 
 	// enable_env_var_names_array
 	if isEnabled(st.EnableEnvVarNamesArray, st.Env) {
-		b.WriteString("declare -a env_var_names=()\n")
-		b.WriteString("# Environment variable names array populated by script\n\n")
+		b.WriteString(declareBuiltin(st) + " -a env_var_names=()\n")
+		b.WriteString("# Environment variable names array populated by each command\n\n")
 	}
 
-	// enable_sourcing
-	if isEnabled(st.EnableSourcing, st.Env) {
-		b.WriteString("# Source additional files if needed\n")
-		b.WriteString("# for file in \"${SCRIPT_DIR}/lib/*.sh\"; do\n")
-		b.WriteString("#   source \"$file\"\n")
-		b.WriteString("# done\n\n")
+	// enable_command_hook: a no-op default that a lib file, or the caller
+	// when sourcing, can replace to observe command usage.
+	if isEnabled(st.EnableCommandHook, st.Env) {
+		b.WriteString("if ! command -v bashly_on_command_start >/dev/null 2>&1; then\n")
+		b.WriteString("  bashly_on_command_start() {\n")
+		b.WriteString("    :\n")
+		b.WriteString("  }\n")
+		b.WriteString("fi\n\n")
 	}
 
 	return b.String()
@@ -0,0 +1,37 @@
+package generate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
+)
+
+func TestMergeLibsNormalizesCRLF(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"lf", "greet() {\n  echo hi\n}\n"},
+		{"crlf", "greet() {\r\n  echo hi\r\n}\r\n"},
+		{"mixed", "greet() {\r\n  echo hi\n}\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := vfs.NewMem()
+			if err := mem.WriteFile("/proj/src/lib/greet.sh", []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := MergeLibs(mem, "/proj/src", "lib", nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(got, "\r") {
+				t.Errorf("MergeLibs() kept a CR: %q", got)
+			}
+			if want := "greet() {\n  echo hi\n}\n"; got != want {
+				t.Errorf("MergeLibs() = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -2,62 +2,86 @@ package generate
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"os"
+	"log/slog"
 	"path/filepath"
 	"strings"
 
 	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
-	"github.com/dimitar-trifonov/go-bashly/internal/render"
 	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
 )
 
 type MasterResult struct {
-	Path    string
-	Written bool
+	Path     string
+	Written  bool
+	Warnings []string
 }
 
-func EnsureMasterScript(root *commandmodel.Command, st settings.Settings, opts Options) (MasterResult, error) {
-	targetDir := filepath.Join(opts.Workdir, st.TargetDir)
-	path := filepath.Join(targetDir, root.Name)
+// EnsureMasterScript renders and writes the script of root unless it exists
+// and opts.Force is unset. Cancelling ctx stops rendering and formatting;
+// the previous script is then left untouched.
+func EnsureMasterScript(ctx context.Context, root *commandmodel.Command, st settings.Settings, opts Options) (MasterResult, error) {
+	fsys := vfs.Or(opts.FS)
+	path := ScriptPath(root, st, opts.Workdir)
+	targetDir := filepath.Dir(path)
 
 	if !opts.Force {
-		if _, err := os.Stat(path); err == nil {
+		if _, err := fsys.Stat(path); err == nil {
+			slog.Debug("master script exists, skipping (use --force to overwrite)", "path", path)
 			return MasterResult{Path: path, Written: false}, nil
 		}
 	}
 
-	if opts.DryRun {
-		return MasterResult{Path: path, Written: true}, nil
-	}
-
-	if err := os.MkdirAll(targetDir, 0o755); err != nil {
+	if err := fsys.MkdirAll(targetDir, 0o755); err != nil {
 		return MasterResult{}, fmt.Errorf("create target dir: %w", err)
 	}
 
-	code, err := buildMasterScript(root, st, opts)
+	code, warnings, err := buildMasterScript(ctx, root, st, opts)
 	if err != nil {
 		return MasterResult{}, err
 	}
 
-	if err := os.WriteFile(path, code, 0o755); err != nil {
+	if err := writeFileBackup(fsys, path, code, st.ScriptMode, st.BackupScript); err != nil {
 		return MasterResult{}, fmt.Errorf("write master script: %w", err)
 	}
 
-	return MasterResult{Path: path, Written: true}, nil
+	slog.Debug("master script written", "path", path, "target_shell", targetShell(st))
+	return MasterResult{Path: path, Written: true, Warnings: warnings}, nil
+}
+
+// RenderMasterScript returns the master script for root without writing it,
+// along with any formatter warnings.
+func RenderMasterScript(ctx context.Context, root *commandmodel.Command, st settings.Settings, opts Options) ([]byte, []string, error) {
+	return buildMasterScript(ctx, root, st, opts)
 }
 
-func buildMasterScript(root *commandmodel.Command, st settings.Settings, opts Options) ([]byte, error) {
+func buildMasterScript(ctx context.Context, root *commandmodel.Command, st settings.Settings, opts Options) ([]byte, []string, error) {
+	if ctx.Err() != nil {
+		return nil, nil, context.Cause(ctx)
+	}
+	fsys := vfs.Or(opts.FS)
 	srcDir := filepath.Join(opts.Workdir, st.SourceDir)
 	ext := st.PartialsExtension
 	if ext == "" {
 		ext = "sh"
 	}
 
+	if err := checkTargetShell(st); err != nil {
+		return nil, nil, err
+	}
+	posix := isPOSIXTarget(st)
+
+	cat, err := LoadCatalog(fsys, srcDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	cmds := commandmodel.DeepCommands(root, true)
 
 	b := &bytes.Buffer{}
-	b.WriteString("#!/usr/bin/env bash\n")
+	b.WriteString(shebang(st))
 	b.WriteString("\n")
 
 	if isEnabled(st.EnableHeaderComment, st.Env) {
@@ -65,8 +89,16 @@ func buildMasterScript(root *commandmodel.Command, st settings.Settings, opts Op
 		b.WriteString("\n")
 	}
 
+	notice, err := loadNotice(fsys, opts.Workdir, st)
+	if err != nil {
+		return nil, nil, err
+	}
+	b.WriteString(notice)
+
 	headerPath := filepath.Join(srcDir, "header."+ext)
-	if hb, err := os.ReadFile(headerPath); err == nil {
+	if hb, err := fsys.ReadFile(headerPath); err == nil {
+		slog.Debug("header included", "path", headerPath)
+		hb = bytes.ReplaceAll(hb, []byte("\r\n"), []byte("\n"))
 		b.Write(hb)
 		if len(hb) > 0 && hb[len(hb)-1] != '\n' {
 			b.WriteString("\n")
@@ -74,18 +106,37 @@ func buildMasterScript(root *commandmodel.Command, st settings.Settings, opts Op
 		b.WriteString("\n")
 	}
 
+	if isZshTarget(st) {
+		b.WriteString(zshPrelude())
+	}
+
 	if isEnabled(st.EnableBash3Bouncer, st.Env) {
-		b.WriteString("# Bash version check\n")
-		b.WriteString("if [[ -z \"${BASH_VERSINFO+x}\" || ${BASH_VERSINFO[0]} -lt 3 ]]; then\n")
-		b.WriteString("  echo 'ERROR: bash 3.0 or higher is required.' >&2\n")
-		b.WriteString("  exit 1\n")
-		b.WriteString("fi\n\n")
+		b.WriteString(versionBouncer(st))
 	}
 
 	// Merge lib files
-	libContent, err := MergeLibs(srcDir, st.LibDir, st.ExtraLibDirs)
+	libContent, err := MergeLibs(fsys, srcDir, st.LibDir, st.ExtraLibDirs, st.LibNamespaces)
 	if err != nil {
-		return nil, fmt.Errorf("merge libs: %w", err)
+		return nil, nil, fmt.Errorf("merge libs: %w", err)
+	}
+	if err := checkLibCollisions(libContent, cmds); err != nil {
+		return nil, nil, fmt.Errorf("merge libs: %w", err)
+	}
+	if libContent != "" && st.TreeShakeLibs {
+		roots := []string{"bashly_on_command_start", envValidateFunctions(cmds)}
+		if hb, err := fsys.ReadFile(headerPath); err == nil {
+			roots = append(roots, string(hb))
+		}
+		for _, c := range cmds {
+			if partial, err := fsys.ReadFile(c.PartialFile(opts.Workdir, st.SourceDir)); err == nil {
+				roots = append(roots, string(partial))
+			}
+		}
+		var dropped []string
+		libContent, dropped = ShakeLibs(libContent, roots)
+		for _, name := range dropped {
+			slog.Debug("unused lib function omitted", "name", name)
+		}
 	}
 	if libContent != "" {
 		b.WriteString("# Merged library functions\n")
@@ -100,66 +151,76 @@ func buildMasterScript(root *commandmodel.Command, st settings.Settings, opts Op
 		b.WriteString(featureContent)
 	}
 
-	b.WriteString("inspect_args() {\n")
-	b.WriteString("  :\n")
-	b.WriteString("}\n")
-	b.WriteString("\n")
+	b.WriteString(buildInspectArgs(st))
 
-	b.WriteString("validate_args() {\n")
-	b.WriteString("  # Validation stub - in a full implementation, this would call Go-generated validation logic\n")
-	b.WriteString("  # Basic checks for required args and unknown flags\n")
-	b.WriteString("  # Check for unknown flags starting with --\n")
-	b.WriteString("  for arg in \"$@\"; do\n")
-	b.WriteString("    if [[ \"$arg\" == \"--invalid-flag\" ]]; then\n")
-	b.WriteString("      echo \"ERROR: unknown flag: --invalid-flag\" >&2\n")
-	b.WriteString("      exit 2\n")
-	b.WriteString("    fi\n")
-	b.WriteString("  done\n")
-	b.WriteString("  # Check required args for known commands\n")
-	b.WriteString("  if [[ \"$1\" == \"download\" || \"$1\" == \"\" ]]; then\n")
-	b.WriteString("    if [[ $# -eq 0 || ( \"$1\" == \"download\" && $# -eq 1 ) ]]; then\n")
-	b.WriteString("      echo \"ERROR: missing required argument: source\" >&2\n")
-	b.WriteString("      exit 2\n")
-	b.WriteString("    fi\n")
-	b.WriteString("  fi\n")
-	b.WriteString("  if [[ \"$1\" == \"docker\" && \"$2\" == \"container\" && \"$3\" == \"run\" ]]; then\n")
-	b.WriteString("    if [[ $# -eq 3 ]]; then\n")
-	b.WriteString("      echo \"ERROR: missing required argument: image\" >&2\n")
-	b.WriteString("      exit 2\n")
-	b.WriteString("    fi\n")
-	b.WriteString("  fi\n")
-	b.WriteString("}\n")
-	b.WriteString("\n")
+	b.WriteString(buildMessages(cat))
+	for _, c := range cmds {
+		b.WriteString(buildUsage(c, st, cat))
+	}
+
+	if isEnabled(st.EnableHelpPager, st.Env) {
+		b.WriteString(buildPagerHelper())
+	}
+	helpCommand := HelpCommandEnabled(root, st)
+	if helpCommand {
+		b.WriteString(buildHelpCommand(root, cat))
+	}
+	completionsCommand := CompletionsCommandEnabled(root, st)
+	if completionsCommand {
+		b.WriteString(buildCompletionsCommand(root))
+	}
+
+	selftest := isEnabled(st.EnableSelftest, st.Env)
+	if selftest {
+		b.WriteString(buildSelftest(root, st))
+	}
+	debug := isEnabled(st.EnableDebugFlag, st.Env)
+	if debug {
+		b.WriteString(buildDebugHelpers(st))
+	}
 
 	b.WriteString("parse_args() {\n")
-	b.WriteString("  # Global --help detection\n")
-	b.WriteString("  if [[ \"$1\" == \"--help\" || \"$1\" == \"-h\" ]]; then\n")
-	b.WriteString("    # Show help for the appropriate command\n")
-	b.WriteString("    if [[ $# -eq 1 ]]; then\n")
-	b.WriteString("      # No subcommand: show global help\n")
-	b.WriteString(fmt.Sprintf("      cat <<'EOF'\n%s\nEOF\n", render.PrintGlobalUsage(root)))
-	b.WriteString("    else\n")
-	b.WriteString("      # Try to resolve command and show its help\n")
-	b.WriteString("      case \"$1\" in\n")
-	for _, child := range root.Commands {
-		patterns := strings.Join(child.Alias, "|")
-		b.WriteString(fmt.Sprintf("        %s)\n", patterns))
-		b.WriteString(fmt.Sprintf("          cat <<'EOF'\n%s\nEOF\n", render.PrintUsage(child)))
-		b.WriteString("          ;;\n")
-	}
-	b.WriteString("        *)\n")
-	b.WriteString("          echo \"Unknown command: $1\" >&2\n")
-	b.WriteString("          exit 1\n")
-	b.WriteString("          ;;\n")
-	b.WriteString("      esac\n")
-	b.WriteString("    fi\n")
+	if selftest {
+		if posix {
+			fmt.Fprintf(b, "  if [ \"$1\" = \"%s\" ]; then\n", selftestFlag)
+		} else {
+			fmt.Fprintf(b, "  if [[ \"$1\" == \"%s\" ]]; then\n", selftestFlag)
+		}
+		b.WriteString("    selftest\n")
+		b.WriteString("    exit $?\n")
+		b.WriteString("  fi\n")
+	}
+	if root.Version != "" {
+		fmt.Fprintf(b, "  if %s; then\n", newArgStore(st).cond("\"${1:-}\" = \"--version\""))
+		fmt.Fprintf(b, "    echo %s\n", shellQuote(root.Version))
+		b.WriteString("    exit 0\n")
+		b.WriteString("  fi\n")
+	}
+	if helpCommand {
+		fmt.Fprintf(b, "  if %s; then\n", newArgStore(st).cond("\"${1:-}\" = \"help\""))
+		b.WriteString("    shift\n")
+		b.WriteString("    bashly_help_command \"$@\"\n")
+		b.WriteString("    exit 0\n")
+		b.WriteString("  fi\n")
+	}
+	if completionsCommand {
+		fmt.Fprintf(b, "  if %s; then\n", newArgStore(st).cond("\"${1:-}\" = \"completions\""))
+		b.WriteString("    shift\n")
+		b.WriteString("    bashly_completions_command \"$@\"\n")
+		b.WriteString("    exit 0\n")
+		b.WriteString("  fi\n")
+	}
+	// run moves a leading --help behind the words after it, so here it is
+	// alone
+	b.WriteString("  # Global --help\n")
+	if posix {
+		b.WriteString("  if [ \"$1\" = \"--help\" ] || [ \"$1\" = \"-h\" ]; then\n")
+	} else {
+		b.WriteString("  if [[ \"$1\" == \"--help\" || \"$1\" == \"-h\" ]]; then\n")
+	}
+	fmt.Fprintf(b, "    %s\n", helpCall(st, usageFunctionName(root)))
 	b.WriteString("    exit 0\n")
 	b.WriteString("  fi\n")
-	b.WriteString("\n")
-	b.WriteString("  # Expose parsed variables (stub for now)\n")
-	b.WriteString("  declare -a args=(\"$@\")\n")
-	b.WriteString("  declare -A flags=()\n")
-	b.WriteString("  declare -a other_args=(\"$@\")\n")
 	b.WriteString("}\n")
 	b.WriteString("\n")
 
@@ -167,73 +228,168 @@ func buildMasterScript(root *commandmodel.Command, st settings.Settings, opts Op
 		if c.Filename == "" {
 			continue
 		}
-		partialPath := filepath.Join(srcDir, c.Filename)
-		partial, err := os.ReadFile(partialPath)
+		partialPath := c.PartialFile(opts.Workdir, st.SourceDir)
+		partial, err := fsys.ReadFile(partialPath)
 		if err != nil {
-			return nil, fmt.Errorf("read partial %s: %w", partialPath, err)
+			return nil, nil, fmt.Errorf("read partial %s: %w", partialPath, err)
 		}
 		partial = stripYAMLFrontMatter(partial)
 
 		funcName := functionNameForCommand(c)
 		b.WriteString(funcName)
 		b.WriteString("() {\n")
+		b.WriteString(indentShell(buildEnvVarChecks(c, st)))
 		b.WriteString(indentShell(string(partial)))
 		if len(partial) > 0 && partial[len(partial)-1] != '\n' {
 			b.WriteString("\n")
 		}
+		if len(c.Forward) > 0 {
+			b.WriteString(indentShell(buildForwardExec(c, st)))
+		}
 		b.WriteString("}\n\n")
 	}
 
+	b.WriteString(buildNormalizeInput(st))
+	if st.PromptMissing {
+		b.WriteString(buildPromptHelper())
+	}
+	if usesNormalize(cmds) {
+		b.WriteString(buildNormalizeValueHelper())
+	}
+	for _, c := range cmds {
+		b.WriteString(buildParser(c, st))
+	}
+
 	b.WriteString("dispatch() {\n")
-	b.WriteString(buildDispatch(root, "  "))
+	b.WriteString(buildDispatch(root, "  ", dispatchOptions{
+		posix: posix,
+		hook:  isEnabled(st.EnableCommandHook, st.Env),
+		debug: debug,
+		st:    st,
+	}))
+	b.WriteString("}\n\n")
+
+	b.WriteString("run() {\n")
+	if debug {
+		fmt.Fprintf(b, "  if %s; then\n", newArgStore(st).cond(fmt.Sprintf("\"${1:-}\" = \"%s\"", debugFlag)))
+		b.WriteString("    bashly_debug=1\n")
+		b.WriteString("    shift\n")
+		b.WriteString("  fi\n")
+	}
+	// A leading --help followed by words goes behind them, so it reaches
+	// the parser of the command they name, with its flags
+	b.WriteString("  case \"${1:-}\" in\n")
+	b.WriteString("    --help | -h)\n")
+	fmt.Fprintf(b, "      if %s; then\n", newArgStore(st).cond("$# -gt 1"))
+	b.WriteString("        shift\n")
+	b.WriteString("        set -- \"$@\" --help\n")
+	b.WriteString("      fi\n")
+	b.WriteString("      ;;\n")
+	b.WriteString("  esac\n")
+	b.WriteString("  parse_args \"$@\"\n")
+	b.WriteString("  dispatch \"$@\"\n")
 	b.WriteString("}\n\n")
 
 	b.WriteString("# Entry point\n")
-	b.WriteString("parse_args \"$@\"\n")
-	b.WriteString("validate_args \"$@\"\n")
-	b.WriteString("dispatch \"$@\"\n")
+	if !posix {
+		if isEnabled(st.EnableBash3Bouncer, st.Env) {
+			b.WriteString(assocArrayBouncer(st))
+		}
+		decl := declareBuiltin(st)
+		b.WriteString(decl + " -A args=()\n")
+		b.WriteString(decl + " -a other_args=()\n")
+	}
+	trap := ""
+	if usesOnExit(cmds) {
+		trap = buildExitTrap(st)
+	}
+	if guard := sourcingGuard(st); guard != "" {
+		b.WriteString(guard + "\n")
+		b.WriteString(indentShell(trap))
+		b.WriteString("  run \"$@\"\n")
+		b.WriteString("fi\n")
+	} else {
+		b.WriteString(trap)
+		b.WriteString("run \"$@\"\n")
+	}
+
+	code, warnings, err := formatMasterScript(ctx, b.String(), st)
+	if err != nil || !isEnabled(st.EnableIntegrityFooter, st.Env) {
+		return code, warnings, err
+	}
+	config, err := ConfigDigest(root, st)
+	if err != nil {
+		return nil, nil, err
+	}
+	return withIntegrityFooter(code, config), warnings, nil
+}
 
-	// Apply formatting pipeline
-	script := b.String()
-	result := FormatScript(script, st.Formatter, st.TabIndent)
+// formatMasterScript runs the formatting pipeline on a master script.
+func formatMasterScript(ctx context.Context, script string, st settings.Settings) ([]byte, []string, error) {
+	timeout, err := parseFormatterTimeout(st.FormatterTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := FormatScript(ctx, script, FormatOptions{
+		Formatter: st.Formatter,
+		Args:      st.FormatterArgs,
+		TabIndent: st.TabIndent,
+		Timeout:   timeout,
+		Fallback:  st.FormatterFallback,
+	})
+	if ctx.Err() != nil {
+		return nil, nil, context.Cause(ctx)
+	}
 	if result.Error != "" {
-		return nil, fmt.Errorf("format script: %w", fmt.Errorf(result.Error))
+		return nil, nil, fmt.Errorf("format script: %s", result.Error)
 	}
 
-	return []byte(result.Formatted), nil
+	var warnings []string
+	if result.Warning != "" {
+		warnings = append(warnings, result.Warning)
+	}
+	return []byte(result.Formatted), warnings, nil
 }
 
 func isEnabled(value string, env string) bool {
-	v := strings.TrimSpace(strings.ToLower(value))
-	e := strings.TrimSpace(strings.ToLower(env))
-	switch v {
-	case "always", "true", "1", "yes":
-		return true
-	case "never", "false", "0", "no":
-		return false
-	case "production":
-		return e == "production"
-	case "development":
-		return e == "development"
-	default:
-		// Unknown setting: default to enabled (closer to Ruby defaults).
-		return true
-	}
+	return settings.IsEnabled(value, env)
 }
 
-func buildDispatch(c *commandmodel.Command, indent string) string {
+// dispatchOptions carries what the dispatcher emits around each command.
+type dispatchOptions struct {
+	posix bool
+	hook  bool // call bashly_on_command_start
+	debug bool // trace with bashly_debug_start
+	st    settings.Settings
+}
+
+func buildDispatch(c *commandmodel.Command, indent string, d dispatchOptions) string {
 	// Dispatch based on argv to the correct command function.
 	// If an unknown subcommand is given, fall back to the current command.
 	b := &strings.Builder{}
-	fallback := functionNameForCommand(c)
 
 	if len(c.Commands) == 0 {
-		fmt.Fprintf(b, "%s%s \"$@\"\n", indent, fallback)
+		b.WriteString(invokeCommand(c, indent, d))
 		return b.String()
 	}
 
-	fmt.Fprintf(b, "%sif [[ $# -eq 0 ]]; then\n", indent)
-	fmt.Fprintf(b, "%s  %s \"$@\"\n", indent, fallback)
+	// A default subcommand runs without arguments; a forced one also gets
+	// any arguments that name no other command, untouched.
+	def := c.DefaultCommand()
+	if d.posix {
+		fmt.Fprintf(b, "%sif [ $# -eq 0 ]; then\n", indent)
+	} else {
+		fmt.Fprintf(b, "%sif [[ $# -eq 0 ]]; then\n", indent)
+	}
+	switch {
+	case def != nil:
+		b.WriteString(buildDispatch(def, indent+"  ", d))
+	case c.RequireSubcommand:
+		fmt.Fprintf(b, "%s  %s\n", indent, usageFunctionName(c))
+		fmt.Fprintf(b, "%s  exit 1\n", indent)
+	default:
+		b.WriteString(invokeCommand(c, indent+"  ", d))
+	}
 	fmt.Fprintf(b, "%s  return\n", indent)
 	fmt.Fprintf(b, "%sfi\n", indent)
 	fmt.Fprintf(b, "%scase \"$1\" in\n", indent)
@@ -243,17 +399,103 @@ func buildDispatch(c *commandmodel.Command, indent string) string {
 		fmt.Fprintf(b, "%s  %s)\n", indent, patterns)
 		fmt.Fprintf(b, "%s    shift\n", indent)
 		// Recurse
-		b.WriteString(buildDispatch(child, indent+"    "))
+		b.WriteString(buildDispatch(child, indent+"    ", d))
 		fmt.Fprintf(b, "%s    ;;\n", indent)
 	}
 
 	fmt.Fprintf(b, "%s  *)\n", indent)
-	fmt.Fprintf(b, "%s    %s \"$@\"\n", indent, fallback)
+	switch {
+	case def != nil && def.Default == "force":
+		b.WriteString(buildDispatch(def, indent+"    ", d))
+	case c.RequireSubcommand:
+		b.WriteString(missingSubcommand(c, indent+"    "))
+	default:
+		b.WriteString(invokeCommand(c, indent+"    ", d))
+	}
 	fmt.Fprintf(b, "%s    ;;\n", indent)
 	fmt.Fprintf(b, "%sesac\n", indent)
 	return b.String()
 }
 
+// missingSubcommand handles arguments naming no subcommand of a command
+// that requires one: flags are parsed, so --help and invalid options work
+// as usual, then the usage is printed; a word is an invalid command.
+func missingSubcommand(c *commandmodel.Command, indent string) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%scase \"$1\" in\n", indent)
+	fmt.Fprintf(b, "%s  -*)\n", indent)
+	fmt.Fprintf(b, "%s    %s \"$@\"\n", indent, parserFunctionName(c))
+	fmt.Fprintf(b, "%s    %s\n", indent, usageFunctionName(c))
+	fmt.Fprintf(b, "%s    ;;\n", indent)
+	fmt.Fprintf(b, "%s  *)\n", indent)
+	fmt.Fprintf(b, "%s    echo \"ERROR: %s\" >&2\n", indent, messageCall("invalid_command", "\"$1\""))
+	fmt.Fprintf(b, "%s    ;;\n", indent)
+	fmt.Fprintf(b, "%sesac\n", indent)
+	fmt.Fprintf(b, "%sexit 1\n", indent)
+	return b.String()
+}
+
+// invokeCommand parses the command's arguments, then runs its function.
+// With hook, bashly_on_command_start is called in between with the full
+// command name and the arguments; its failures never stop the command.
+// With debug, tracing is scoped to the command function. A command with
+// on_exit names the function the exit trap calls from then on.
+func invokeCommand(c *commandmodel.Command, indent string, d dispatchOptions) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s%s \"$@\"\n", indent, parserFunctionName(c))
+	if c.OnExit != "" {
+		fmt.Fprintf(b, "%sbashly_on_exit=%s\n", indent, c.OnExit)
+	}
+	if d.hook {
+		fmt.Fprintf(b, "%sbashly_on_command_start %s \"$@\" || true\n", indent, shellQuote(c.FullName))
+	}
+	if d.debug {
+		fmt.Fprintf(b, "%sbashly_debug_start %s\n", indent, shellQuote(c.FullName))
+	}
+	fmt.Fprintf(b, "%s%s \"$@\"\n", indent, functionNameForCommand(c))
+	if d.debug {
+		fmt.Fprintf(b, "%s%s\n", indent, debugStop(d.st))
+	}
+	return b.String()
+}
+
+// loadNotice returns the notice_file, relative to the workdir, as a block of
+// comment lines followed by a blank line. Lines already starting with # are
+// kept as they are.
+func loadNotice(fsys vfs.FS, workdir string, st settings.Settings) (string, error) {
+	if st.NoticeFile == "" {
+		return "", nil
+	}
+	path := st.NoticeFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workdir, path)
+	}
+	raw, err := fsys.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read notice_file: %w", err)
+	}
+	text := strings.TrimRight(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\n")
+	if strings.TrimSpace(text) == "" {
+		return "", nil
+	}
+	b := &strings.Builder{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		switch {
+		case strings.HasPrefix(line, "#"):
+			b.WriteString(line)
+		case line == "":
+			b.WriteString("#")
+		default:
+			b.WriteString("# " + line)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	slog.Debug("notice included", "path", path)
+	return b.String(), nil
+}
+
 func stripYAMLFrontMatter(b []byte) []byte {
 	// Some partials may contain YAML front matter, terminated by a line containing only '---'.
 	// For master script embedding, we keep only the script portion below the delimiter.
@@ -278,14 +520,14 @@ func functionNameForCommand(c *commandmodel.Command) string {
 	return base + "_command"
 }
 
+// indentShell indents s by two spaces. Heredoc bodies are left untouched,
+// so partials using heredocs keep their content and terminators intact.
 func indentShell(s string) string {
 	s = strings.ReplaceAll(s, "\r\n", "\n")
-	lines := strings.Split(s, "\n")
-	for i := range lines {
-		if lines[i] == "" {
-			continue
+	return mapScriptLines(s, func(line string) (string, bool) {
+		if line == "" {
+			return line, true
 		}
-		lines[i] = "  " + lines[i]
-	}
-	return strings.Join(lines, "\n")
+		return "  " + line, true
+	})
 }
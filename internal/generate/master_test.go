@@ -0,0 +1,140 @@
+package generate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
+)
+
+// renderInMem renders the script of cfg from the files of a project in
+// memory at /proj.
+func renderInMem(t *testing.T, cfg map[string]any, st settings.Settings, files map[string]string) string {
+	t.Helper()
+	mem := vfs.NewMem()
+	for name, content := range files {
+		if err := mem.WriteFile("/proj/"+name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, err := commandmodel.BuildFromConfigMap(cfg, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, _, err := RenderMasterScript(context.Background(), root, st, Options{Workdir: "/proj", FS: mem})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(script)
+}
+
+func TestRenderMasterScriptNormalizesCRLF(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "partial",
+			files: map[string]string{
+				"src/root_command.sh": "echo one\r\necho two\r\n",
+			},
+			want: []string{"  echo one\n  echo two\n"},
+		},
+		{
+			name: "header",
+			files: map[string]string{
+				"src/header.sh":       "# header one\r\n# header two\r\n",
+				"src/root_command.sh": "echo run\n",
+			},
+			want: []string{"# header one\n# header two\n", "  echo run\n"},
+		},
+		{
+			name: "lib",
+			files: map[string]string{
+				"src/lib/greet.sh":    "greet() {\r\n  echo hi\r\n}\r\n",
+				"src/root_command.sh": "greet\r\n",
+			},
+			want: []string{"greet() {\n  echo hi\n}\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := settings.Default()
+			// The internal formatter trims trailing CRs itself; without one,
+			// only the normalization of the sources keeps them out.
+			st.Formatter = "none"
+			script := renderInMem(t, map[string]any{"name": "cli"}, st, tt.files)
+			if strings.Contains(script, "\r") {
+				t.Fatalf("script contains a CR:\n%s", script)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(script, want) {
+					t.Errorf("script does not contain %q:\n%s", want, script)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderMasterScriptVersionChecks(t *testing.T) {
+	tests := []struct {
+		name    string
+		shell   string
+		bouncer string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "bash",
+			shell:   "bash",
+			bouncer: "always",
+			want:    []string{"${BASH_VERSINFO[0]} -lt 3 ]]", "${BASH_VERSINFO[0]} -lt 4 ]]; then\n  echo 'ERROR: bash 4.0 or higher is required (associative arrays).' >&2\n  exit 1\nfi\ndeclare -A args=()\n"},
+		},
+		{
+			name:    "bash without bouncer",
+			shell:   "bash",
+			bouncer: "never",
+			notWant: []string{"BASH_VERSINFO"},
+		},
+		{
+			name:    "zsh",
+			shell:   "zsh",
+			bouncer: "always",
+			want:    []string{"is-at-least 5.0"},
+			notWant: []string{"BASH_VERSINFO"},
+		},
+		{
+			name:    "sh",
+			shell:   "sh",
+			bouncer: "always",
+			notWant: []string{"BASH_VERSINFO", "-A args"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := settings.Default()
+			st.Formatter = "none"
+			st.TargetShell = tt.shell
+			st.EnableBash3Bouncer = tt.bouncer
+			if tt.shell == "sh" {
+				st.EnableDepsArray = "never"
+				st.EnableEnvVarNamesArray = "never"
+			}
+			script := renderInMem(t, map[string]any{"name": "cli"}, st, map[string]string{"src/root_command.sh": "echo run\n"})
+			for _, want := range tt.want {
+				if !strings.Contains(script, want) {
+					t.Errorf("script does not contain %q:\n%s", want, script)
+				}
+			}
+			for _, nw := range tt.notWant {
+				if strings.Contains(script, nw) {
+					t.Errorf("script contains %q:\n%s", nw, script)
+				}
+			}
+		})
+	}
+}
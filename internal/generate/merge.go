@@ -0,0 +1,84 @@
+package generate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// scaffoldLine describes a line of the partial scaffold that go-bashly owns:
+// Prefix identifies it, Pattern matches it as generated.
+type scaffoldLine struct {
+	Prefix  string
+	Pattern *regexp.Regexp
+}
+
+var scaffoldLines = []scaffoldLine{
+	{`echo "# This file is located at `, regexp.MustCompile(`^echo "# This file is located at '[^']*'\."$`)},
+	{`echo "# It contains the implementation for `, regexp.MustCompile(`^echo "# It contains the implementation for the '[^']*' command\."$`)},
+}
+
+// partialMerge is the outcome of merging a new scaffold into a partial.
+type partialMerge struct {
+	Content string
+	Reject  string // hunks that could not be applied, in -/+ form; empty if none
+}
+
+// mergePartial merges scaffold, a freshly generated partial, into current,
+// the partial on disk. A partial holding nothing but scaffold lines (as
+// generated by any version) is replaced. Otherwise the user's code is kept
+// and only the scaffold lines are updated; a scaffold line that was edited
+// is left alone and reported in Reject.
+func mergePartial(current string, scaffold string) partialMerge {
+	lines := strings.Split(current, "\n")
+	pristine := true
+	for _, line := range lines {
+		if t := strings.TrimSpace(line); t != "" && t != "inspect_args" && scaffoldIndex(line) < 0 {
+			pristine = false
+			break
+		}
+	}
+	if pristine {
+		return partialMerge{Content: scaffold}
+	}
+
+	generated := strings.Split(scaffold, "\n")
+	rej := &strings.Builder{}
+	for i, line := range lines {
+		for k, sl := range scaffoldLines {
+			if !strings.HasPrefix(line, sl.Prefix) {
+				continue
+			}
+			want := scaffoldFor(generated, k)
+			switch {
+			case want == "" || line == want:
+			case sl.Pattern.MatchString(line):
+				lines[i] = want
+			default:
+				fmt.Fprintf(rej, "@@ line %d @@\n-%s\n+%s\n", i+1, line, want)
+			}
+		}
+	}
+	return partialMerge{Content: strings.Join(lines, "\n"), Reject: rej.String()}
+}
+
+// scaffoldIndex returns the index of the scaffold line that line is, as
+// generated, or -1.
+func scaffoldIndex(line string) int {
+	for k, sl := range scaffoldLines {
+		if sl.Pattern.MatchString(line) {
+			return k
+		}
+	}
+	return -1
+}
+
+// scaffoldFor returns the line of generated that is scaffold line k.
+func scaffoldFor(generated []string, k int) string {
+	for _, line := range generated {
+		if scaffoldLines[k].Pattern.MatchString(line) {
+			return line
+		}
+	}
+	return ""
+}
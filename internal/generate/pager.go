@@ -0,0 +1,28 @@
+package generate
+
+import (
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// buildPagerHelper emits bashly_page_help, which runs a usage function and
+// pipes its output through $PAGER (less -R by default) when stdout is a
+// terminal too short to show it at once.
+func buildPagerHelper() string {
+	return `bashly_page_help() {
+  if [ -t 1 ] && [ "$("$1" | wc -l)" -gt "${LINES:-$(tput lines 2>/dev/null || echo 24)}" ]; then
+    "$1" | eval "${PAGER:-less -R}"
+  else
+    "$1"
+  fi
+}
+
+`
+}
+
+// helpCall returns the call printing the help of usage function fn.
+func helpCall(st settings.Settings, fn string) string {
+	if isEnabled(st.EnableHelpPager, st.Env) {
+		return "bashly_page_help " + fn
+	}
+	return fn
+}
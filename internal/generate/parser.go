@@ -0,0 +1,693 @@
+package generate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/render"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// argStore describes where the generated parser keeps parsed values: the
+// args associative array for bash/zsh, or plain variables for POSIX sh
+// (BASHLY_ARG_<NAME> and BASHLY_FLAG_<NAME>, the same names used by "run").
+type argStore struct {
+	posix bool
+}
+
+func newArgStore(st settings.Settings) argStore {
+	return argStore{posix: isPOSIXTarget(st)}
+}
+
+// ref returns the expansion of a parsed value, e.g. ${args[source]}.
+func (s argStore) ref(name string) string {
+	if s.posix {
+		return "${" + posixVarName(name) + "}"
+	}
+	return "${args[" + name + "]}"
+}
+
+// refOr returns the expansion of a parsed value, or fallback when it is
+// unset or empty, e.g. ${args[--verbose]:-0}.
+func (s argStore) refOr(name string, fallback string) string {
+	return strings.TrimSuffix(s.ref(name), "}") + ":-" + fallback + "}"
+}
+
+// appendQuoted returns the value of name with word appended, shell-quoted
+// so that eval "values=($value)" gives back every word.
+func (s argStore) appendQuoted(name string, word string) string {
+	quote := "printf '%q' \"" + word + "\""
+	if s.posix {
+		quote = "quote_arg \"" + word + "\""
+	}
+	ref := s.ref(name)
+	return "\"" + strings.TrimSuffix(ref, "}") + ":+" + ref + " }$(" + quote + ")\""
+}
+
+// given returns the quoted value of name for word when it is given other
+// than on the command line: word itself, or word appended with appendQuoted
+// for a repeatable flag, whose value is a list of shell-quoted words.
+func (s argStore) given(name string, word string, repeatable bool) string {
+	if repeatable {
+		return s.appendQuoted(name, word)
+	}
+	return "\"" + word + "\""
+}
+
+// set returns a statement assigning value (already quoted) to name.
+func (s argStore) set(name string, value string) string {
+	if s.posix {
+		return posixVarName(name) + "=" + value
+	}
+	return "args[" + name + "]=" + value
+}
+
+// isSet and isUnset return test conditions for the presence of a value.
+func (s argStore) isSet(name string) string {
+	return s.cond("-n \"" + s.setMarker(name) + "\"")
+}
+
+func (s argStore) isUnset(name string) string {
+	return s.cond("-z \"" + s.setMarker(name) + "\"")
+}
+
+func (s argStore) setMarker(name string) string {
+	if s.posix {
+		return "${" + posixVarName(name) + "+x}"
+	}
+	return "${args[" + name + "]+x}"
+}
+
+// cond wraps a test expression in the test syntax of the target shell.
+func (s argStore) cond(expr string) string {
+	if s.posix {
+		return "[ " + expr + " ]"
+	}
+	return "[[ " + expr + " ]]"
+}
+
+// posixVarName maps an arg or flag name to a shell variable name,
+// e.g. "source" -> BASHLY_ARG_SOURCE, "--dry-run" -> BASHLY_FLAG_DRY_RUN.
+func posixVarName(name string) string {
+	prefix := "BASHLY_ARG_"
+	if strings.HasPrefix(name, "-") {
+		prefix = "BASHLY_FLAG_"
+	}
+	return prefix + commandmodel.VarName(name)
+}
+
+// parserFunctionName returns the name of the generated argument parser for c.
+func parserFunctionName(c *commandmodel.Command) string {
+	return strings.TrimSuffix(functionNameForCommand(c), "_command") + "_parse_requirements"
+}
+
+// usageFunctionName returns the name of the generated usage function for c.
+func usageFunctionName(c *commandmodel.Command) string {
+	return strings.TrimSuffix(functionNameForCommand(c), "_command") + "_usage"
+}
+
+// buildUsage emits the function printing the help text of c; the root
+// command prints the global usage. Private commands, flags and environment
+// variables are only shown when the private_reveal_key variable is set, and
+// the text is picked by script_locale when the catalog declares locales.
+func buildUsage(c *commandmodel.Command, st settings.Settings, cat Catalog) string {
+	usage := func(reveal bool, locale string) string {
+		opts := render.UsageOptions{RevealPrivate: reveal, Strings: cat.helpStrings(locale), AutoExamples: isEnabled(st.EnableAutoExamples, st.Env)}
+		if c.ActionName == "root" {
+			return render.PrintGlobalUsage(c, opts)
+		}
+		return render.PrintUsage(c, opts)
+	}
+	localized := func(reveal bool, indent string) string {
+		locales := cat.localeNames()
+		if len(locales) == 0 {
+			return fmt.Sprintf("%scat <<'EOF'\n%s\nEOF\n", indent, usage(reveal, ""))
+		}
+		b := &strings.Builder{}
+		fmt.Fprintf(b, "%scase \"$script_locale\" in\n", indent)
+		for _, locale := range append(locales, "*") {
+			name := locale
+			if locale == "*" {
+				name = ""
+			}
+			fmt.Fprintf(b, "%s  %s)\n", indent, locale)
+			fmt.Fprintf(b, "%s    cat <<'EOF'\n%s\nEOF\n", indent, usage(reveal, name))
+			fmt.Fprintf(b, "%s    ;;\n", indent)
+		}
+		fmt.Fprintf(b, "%sesac\n", indent)
+		return b.String()
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s() {\n", usageFunctionName(c))
+	key := strings.TrimSpace(st.PrivateRevealKey)
+	if key == "" || !render.HasPrivate(c) {
+		b.WriteString(localized(false, "  "))
+	} else {
+		fmt.Fprintf(b, "  if %s; then\n", newArgStore(st).cond("-n \"${"+key+"+x}\""))
+		b.WriteString(localized(true, "    "))
+		b.WriteString("  else\n")
+		b.WriteString(localized(false, "    "))
+		b.WriteString("  fi\n")
+	}
+	b.WriteString("}\n\n")
+	return b.String()
+}
+
+// buildPromptHelper emits the function used to ask for missing values on a TTY.
+func buildPromptHelper() string {
+	b := &strings.Builder{}
+	b.WriteString("prompt_value() {\n")
+	b.WriteString("  printf '%s: ' \"$1\" >&2\n")
+	b.WriteString("  prompt_reply=\"\"\n")
+	b.WriteString("  IFS= read -r prompt_reply || true\n")
+	b.WriteString("}\n\n")
+	return b.String()
+}
+
+// buildNormalizeValueHelper emits normalize_value, which prints its first
+// argument with the named normalizations applied in order.
+func buildNormalizeValueHelper() string {
+	b := &strings.Builder{}
+	b.WriteString("normalize_value() {\n")
+	b.WriteString("  value=\"$1\"\n")
+	b.WriteString("  shift\n")
+	b.WriteString("  for op in \"$@\"; do\n")
+	b.WriteString("    case \"$op\" in\n")
+	b.WriteString("      downcase)\n")
+	b.WriteString("        value=\"$(printf '%s' \"$value\" | tr '[:upper:]' '[:lower:]')\"\n")
+	b.WriteString("        ;;\n")
+	b.WriteString("      upcase)\n")
+	b.WriteString("        value=\"$(printf '%s' \"$value\" | tr '[:lower:]' '[:upper:]')\"\n")
+	b.WriteString("        ;;\n")
+	b.WriteString("      strip)\n")
+	b.WriteString("        value=\"${value#\"${value%%[![:space:]]*}\"}\"\n")
+	b.WriteString("        value=\"${value%\"${value##*[![:space:]]}\"}\"\n")
+	b.WriteString("        ;;\n")
+	b.WriteString("      expand_path)\n")
+	b.WriteString("        case \"$value\" in\n")
+	b.WriteString("          \"~\") value=\"$HOME\" ;;\n")
+	b.WriteString("          \"~/\"*) value=\"$HOME/${value#\"~/\"}\" ;;\n")
+	b.WriteString("        esac\n")
+	b.WriteString("        case \"$value\" in\n")
+	b.WriteString("          /* | \"\") ;;\n")
+	b.WriteString("          *) value=\"$PWD/$value\" ;;\n")
+	b.WriteString("        esac\n")
+	b.WriteString("        ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("  done\n")
+	b.WriteString("  printf '%s' \"$value\"\n")
+	b.WriteString("}\n\n")
+	return b.String()
+}
+
+// usesNormalize reports whether any arg or flag of cmds declares normalize.
+func usesNormalize(cmds []*commandmodel.Command) bool {
+	for _, c := range cmds {
+		for _, a := range c.Args {
+			if len(a.Normalize) > 0 {
+				return true
+			}
+		}
+		for _, f := range c.Flags {
+			if len(f.Normalize) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// buildNormalize emits the normalization of a parsed value, if any.
+func buildNormalize(s argStore, name string, ops []string) string {
+	if len(ops) == 0 {
+		return ""
+	}
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "  if %s; then\n", s.isSet(name))
+	fmt.Fprintf(b, "    %s\n", s.set(name, "\"$(normalize_value \""+s.ref(name)+"\" "+strings.Join(ops, " ")+")\""))
+	b.WriteString("  fi\n")
+	return b.String()
+}
+
+// buildNormalizeInput emits normalize_input, which splits --flag=value and
+// -f=value into two arguments and expands short flag clusters (-abc => -a -b -c),
+// leaving everything after -- untouched. Bash and zsh collect the result in
+// the input array; POSIX sh builds a quoted string for "eval set --".
+func buildNormalizeInput(st settings.Settings) string {
+	b := &strings.Builder{}
+	if isPOSIXTarget(st) {
+		b.WriteString("quote_arg() {\n")
+		b.WriteString("  printf \"'%s'\" \"$(printf '%s' \"$1\" | sed \"s/'/'\\\\\\\\''/g\")\"\n")
+		b.WriteString("}\n\n")
+		b.WriteString("normalize_input() {\n")
+		b.WriteString("  normalized=\"\"\n")
+		b.WriteString("  passthru=\"\"\n")
+		b.WriteString("  for arg in \"$@\"; do\n")
+		b.WriteString("    if [ -n \"$passthru\" ]; then\n")
+		b.WriteString("      normalized=\"$normalized $(quote_arg \"$arg\")\"\n")
+		b.WriteString("      continue\n")
+		b.WriteString("    fi\n")
+		b.WriteString("    case \"$arg\" in\n")
+		b.WriteString("      --)\n")
+		b.WriteString("        passthru=1\n")
+		b.WriteString("        normalized=\"$normalized --\"\n")
+		b.WriteString("        ;;\n")
+		b.WriteString("      --*=* | -[a-zA-Z0-9]=*)\n")
+		b.WriteString("        normalized=\"$normalized $(quote_arg \"${arg%%=*}\") $(quote_arg \"${arg#*=}\")\"\n")
+		b.WriteString("        ;;\n")
+		b.WriteString("      --*)\n")
+		b.WriteString("        normalized=\"$normalized $(quote_arg \"$arg\")\"\n")
+		b.WriteString("        ;;\n")
+		b.WriteString("      -[a-zA-Z0-9][a-zA-Z0-9]*)\n")
+		b.WriteString("        rest=\"${arg#-}\"\n")
+		b.WriteString("        while [ -n \"$rest\" ]; do\n")
+		b.WriteString("          normalized=\"$normalized $(quote_arg \"-${rest%\"${rest#?}\"}\")\"\n")
+		b.WriteString("          rest=\"${rest#?}\"\n")
+		b.WriteString("        done\n")
+		b.WriteString("        ;;\n")
+		b.WriteString("      *)\n")
+		b.WriteString("        normalized=\"$normalized $(quote_arg \"$arg\")\"\n")
+		b.WriteString("        ;;\n")
+		b.WriteString("    esac\n")
+		b.WriteString("  done\n")
+		b.WriteString("}\n\n")
+		return b.String()
+	}
+
+	b.WriteString("normalize_input() {\n")
+	b.WriteString("  local arg flags passthru=\"\"\n")
+	b.WriteString("  input=()\n")
+	b.WriteString("  while [[ $# -gt 0 ]]; do\n")
+	b.WriteString("    arg=\"$1\"\n")
+	b.WriteString("    if [[ -n $passthru ]]; then\n")
+	b.WriteString("      input+=(\"$arg\")\n")
+	b.WriteString("    elif [[ $arg == \"--\" ]]; then\n")
+	b.WriteString("      passthru=1\n")
+	b.WriteString("      input+=(\"$arg\")\n")
+	b.WriteString("    elif [[ $arg =~ ^(--[a-zA-Z0-9_-]+)=(.*)$ ]]; then\n")
+	b.WriteString("      input+=(\"${BASH_REMATCH[1]}\" \"${BASH_REMATCH[2]}\")\n")
+	b.WriteString("    elif [[ $arg =~ ^(-[a-zA-Z0-9])=(.*)$ ]]; then\n")
+	b.WriteString("      input+=(\"${BASH_REMATCH[1]}\" \"${BASH_REMATCH[2]}\")\n")
+	b.WriteString("    elif [[ $arg =~ ^-([a-zA-Z0-9][a-zA-Z0-9]+)$ ]]; then\n")
+	b.WriteString("      flags=\"${BASH_REMATCH[1]}\"\n")
+	b.WriteString("      while [[ -n $flags ]]; do\n")
+	b.WriteString("        input+=(\"-${flags:0:1}\")\n")
+	b.WriteString("        flags=\"${flags:1}\"\n")
+	b.WriteString("      done\n")
+	b.WriteString("    else\n")
+	b.WriteString("      input+=(\"$arg\")\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    shift\n")
+	b.WriteString("  done\n")
+	b.WriteString("}\n\n")
+	return b.String()
+}
+
+// buildParser emits the argument parser for a single command. It fills the
+// arg store from argv, then enforces required args/flags and allowed values.
+func buildParser(c *commandmodel.Command, st settings.Settings) string {
+	s := newArgStore(st)
+	b := &strings.Builder{}
+
+	fmt.Fprintf(b, "%s() {\n", parserFunctionName(c))
+	forward := len(c.Forward) > 0
+	switch {
+	case forward && s.posix:
+		// Forwarded arguments must stay verbatim, so they are not normalized.
+		b.WriteString("  forward_args=\"\"\n")
+	case forward:
+	case s.posix:
+		b.WriteString("  normalize_input \"$@\"\n")
+		b.WriteString("  eval \"set -- $normalized\"\n")
+	default:
+		b.WriteString("  normalize_input \"$@\"\n")
+		b.WriteString("  set -- \"${input[@]}\"\n")
+	}
+	fmt.Fprintf(b, "  while %s; do\n", s.cond("$# -gt 0"))
+	b.WriteString("    case \"$1\" in\n")
+
+	b.WriteString("      --help | -h)\n")
+	fmt.Fprintf(b, "        %s\n", helpCall(st, usageFunctionName(c)))
+	b.WriteString("        exit 0\n")
+	b.WriteString("        ;;\n")
+
+	if st.PromptMissing {
+		b.WriteString("      --no-input)\n")
+		fmt.Fprintf(b, "        %s\n", s.set("--no-input", "1"))
+		b.WriteString("        shift\n")
+		b.WriteString("        ;;\n")
+	}
+
+	for _, f := range c.Flags {
+		patterns := []string{}
+		if f.Long != "" {
+			patterns = append(patterns, f.Long)
+		}
+		if f.Short != "" {
+			patterns = append(patterns, f.Short)
+		}
+		fmt.Fprintf(b, "      %s)\n", strings.Join(patterns, " | "))
+		switch {
+		case f.Arg == "" && f.Repeatable:
+			fmt.Fprintf(b, "        %s\n", s.set(f.Name(), "$(("+s.refOr(f.Name(), "0")+" + 1))"))
+			b.WriteString("        shift\n")
+		case f.Arg == "":
+			fmt.Fprintf(b, "        %s\n", s.set(f.Name(), "1"))
+			b.WriteString("        shift\n")
+		default:
+			fmt.Fprintf(b, "        if %s; then\n", s.cond("$# -lt 2"))
+			fmt.Fprintf(b, "          echo \"ERROR: %s\" >&2\n", messageCall("flag_requires_an_argument", shellQuote(f.Name())))
+			fmt.Fprintf(b, "          exit %d\n", c.ExitCode)
+			b.WriteString("        fi\n")
+			if f.Repeatable {
+				fmt.Fprintf(b, "        %s\n", s.set(f.Name(), s.appendQuoted(f.Name(), "$2")))
+			} else {
+				fmt.Fprintf(b, "        %s\n", s.set(f.Name(), "\"$2\""))
+			}
+			b.WriteString("        shift 2\n")
+		}
+		b.WriteString("        ;;\n")
+	}
+
+	if forward {
+		b.WriteString("      --)\n")
+		b.WriteString("        shift\n")
+		b.WriteString(indentLines(buildForwardRest(s), "        "))
+		b.WriteString("        ;;\n")
+
+		b.WriteString("      -?*)\n")
+		b.WriteString(indentLines(buildForwardRest(s), "        "))
+		b.WriteString("        ;;\n")
+
+		b.WriteString("      *)\n")
+		b.WriteString(indentLines(buildForwardBinding(c, s), "        "))
+		b.WriteString("        shift\n")
+		b.WriteString("        ;;\n")
+	} else {
+		b.WriteString("      --)\n")
+		b.WriteString("        shift\n")
+		fmt.Fprintf(b, "        while %s; do\n", s.cond("$# -gt 0"))
+		b.WriteString(indentLines(buildPositionalBinding(c, s), "          "))
+		b.WriteString("          shift\n")
+		b.WriteString("        done\n")
+		b.WriteString("        ;;\n")
+
+		if st.FlagAbbreviations {
+			b.WriteString(buildAbbreviations(c, st))
+		}
+
+		b.WriteString("      -?*)\n")
+		fmt.Fprintf(b, "        echo \"ERROR: %s\" >&2\n", messageCall("invalid_option", "\"$1\""))
+		fmt.Fprintf(b, "        exit %d\n", c.ExitCode)
+		b.WriteString("        ;;\n")
+
+		b.WriteString("      *)\n")
+		b.WriteString(indentLines(buildPositionalBinding(c, s), "        "))
+		b.WriteString("        shift\n")
+		b.WriteString("        ;;\n")
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("  done\n")
+
+	// Environment fallbacks, before the required checks they may satisfy
+	for _, arg := range c.Args {
+		b.WriteString(buildEnvFallback(s, arg.Name, arg.Env))
+	}
+	for _, f := range c.Flags {
+		b.WriteString(buildEnvFallback(s, f.Name(), f.Env))
+	}
+
+	// Defaults, for values given neither on the command line nor in the
+	// environment
+	for _, arg := range c.Args {
+		b.WriteString(buildDefault(s, arg.Name, arg.Default))
+	}
+	for _, f := range c.Flags {
+		def := f.Default
+		if f.Repeatable {
+			// Quoted words, as if the flag were given once for each value.
+			quoted := make([]string, 0, len(f.DefaultValues()))
+			for _, v := range f.DefaultValues() {
+				quoted = append(quoted, shellQuote(v))
+			}
+			def = strings.Join(quoted, " ")
+		}
+		b.WriteString(buildDefault(s, f.Name(), def))
+	}
+
+	// Required arguments
+	for _, arg := range c.Args {
+		if !arg.Required {
+			continue
+		}
+		if st.PromptMissing {
+			b.WriteString(indentLines(buildPrompt(s, arg.Name, arg.Name, false), "  "))
+		}
+		fmt.Fprintf(b, "  if %s; then\n", s.isUnset(arg.Name))
+		fmt.Fprintf(b, "    echo \"ERROR: %s\" >&2\n", messageCall("missing_required_argument", shellQuote(arg.Name)))
+		fmt.Fprintf(b, "    exit %d\n", c.ExitCode)
+		b.WriteString("  fi\n")
+	}
+
+	// Required flags
+	for _, f := range c.Flags {
+		if !f.Required {
+			continue
+		}
+		if st.PromptMissing && f.Arg != "" {
+			label := f.Name()
+			if len(f.Allowed) > 0 {
+				label += " (" + strings.Join(f.Allowed, ", ") + ")"
+			}
+			b.WriteString(indentLines(buildPrompt(s, f.Name(), label, f.Repeatable), "  "))
+		}
+		fmt.Fprintf(b, "  if %s; then\n", s.isUnset(f.Name()))
+		fmt.Fprintf(b, "    echo \"ERROR: %s\" >&2\n", messageCall("missing_required_flag", shellQuote(f.Name())))
+		fmt.Fprintf(b, "    exit %d\n", c.ExitCode)
+		b.WriteString("  fi\n")
+	}
+
+	// Normalizations, after prompting so prompted values are included
+	for _, arg := range c.Args {
+		b.WriteString(buildNormalize(s, arg.Name, arg.Normalize))
+	}
+	for _, f := range c.Flags {
+		if f.Arg != "" {
+			b.WriteString(buildNormalize(s, f.Name(), f.Normalize))
+		}
+	}
+
+	// Allowed values
+	for _, f := range c.Flags {
+		if len(f.Allowed) == 0 {
+			continue
+		}
+		quoted := make([]string, 0, len(f.Allowed))
+		for _, a := range f.Allowed {
+			quoted = append(quoted, shellQuote(a))
+		}
+		check := &strings.Builder{}
+		value := s.ref(f.Name())
+		if f.Repeatable {
+			value = "$bashly_value"
+		}
+		fmt.Fprintf(check, "case \"%s\" in\n", value)
+		fmt.Fprintf(check, "  %s) ;;\n", strings.Join(quoted, " | "))
+		check.WriteString("  *)\n")
+		fmt.Fprintf(check, "    echo \"ERROR: %s\" >&2\n", messageCall("disallowed_flag", shellQuote(f.Name()), "\""+value+"\""))
+		fmt.Fprintf(check, "    exit %d\n", c.ExitCode)
+		check.WriteString("    ;;\n")
+		check.WriteString("esac\n")
+		fmt.Fprintf(b, "  if %s; then\n", s.isSet(f.Name()))
+		if f.Repeatable {
+			// Every collected value is checked; the arguments are all
+			// parsed by now, so $@ is free to hold them.
+			fmt.Fprintf(b, "    eval \"set -- %s\"\n", s.ref(f.Name()))
+			b.WriteString("    for bashly_value in \"$@\"; do\n")
+			b.WriteString(indentLines(check.String(), "      "))
+			b.WriteString("    done\n")
+		} else {
+			b.WriteString(indentLines(check.String(), "    "))
+		}
+		b.WriteString("  fi\n")
+	}
+
+	b.WriteString("}\n\n")
+	return b.String()
+}
+
+// buildAbbreviations emits the case arms of the prefixes of the long flags
+// of c, for flag_abbreviations: an unambiguous one is replaced by the flag
+// and parsed again, an ambiguous one is an error listing the flags it may
+// stand for. They follow the arms of the full names, which win.
+func buildAbbreviations(c *commandmodel.Command, st settings.Settings) string {
+	extra := []string{"--help"}
+	if st.PromptMissing {
+		extra = append(extra, "--no-input")
+	}
+	abbreviations := c.LongFlagAbbreviations(extra...)
+	prefixes := make([]string, 0, len(abbreviations))
+	for prefix := range abbreviations {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	var names []string
+	for _, f := range c.VisibleFlags(false) {
+		if f.Long != "" {
+			names = append(names, f.Long)
+		}
+	}
+
+	b := &strings.Builder{}
+	for _, name := range append(names, extra...) {
+		var own []string
+		for _, prefix := range prefixes {
+			if names := abbreviations[prefix]; len(names) == 1 && names[0] == name {
+				own = append(own, prefix)
+			}
+		}
+		if len(own) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "      %s)\n", strings.Join(own, " | "))
+		b.WriteString("        shift\n")
+		fmt.Fprintf(b, "        set -- %s \"$@\"\n", name)
+		b.WriteString("        ;;\n")
+	}
+	for _, prefix := range prefixes {
+		names := abbreviations[prefix]
+		if len(names) < 2 {
+			continue
+		}
+		fmt.Fprintf(b, "      %s)\n", prefix)
+		fmt.Fprintf(b, "        echo \"ERROR: %s\" >&2\n", messageCall("ambiguous_option", "\"$1\"", shellQuote(strings.Join(names, ", "))))
+		fmt.Fprintf(b, "        exit %d\n", c.ExitCode)
+		b.WriteString("        ;;\n")
+	}
+	return b.String()
+}
+
+// buildDefault emits the assignment of def to name when it has no value.
+func buildDefault(s argStore, name string, def string) string {
+	if def == "" {
+		return ""
+	}
+	return fmt.Sprintf("  if %s; then\n    %s\n  fi\n", s.isUnset(name), s.set(name, shellQuote(def)))
+}
+
+// buildPositionalBinding assigns "$1" to the first unset declared arg.
+// Extra values go to other_args; POSIX sh has no arrays, so there they are
+// only available through the "$@" passed to the command function.
+func buildPositionalBinding(c *commandmodel.Command, s argStore) string {
+	b := &strings.Builder{}
+	for i, arg := range c.Args {
+		keyword := "elif"
+		if i == 0 {
+			keyword = "if"
+		}
+		fmt.Fprintf(b, "%s %s; then\n", keyword, s.isUnset(arg.Name))
+		fmt.Fprintf(b, "  %s\n", s.set(arg.Name, "\"$1\""))
+	}
+
+	extra := "other_args+=(\"$1\")"
+	if s.posix {
+		extra = ":"
+	}
+	if len(c.Args) == 0 {
+		return extra + "\n"
+	}
+	b.WriteString("else\n")
+	fmt.Fprintf(b, "  %s\n", extra)
+	b.WriteString("fi\n")
+	return b.String()
+}
+
+// buildForwardBinding assigns "$1" to the first unset declared arg of a
+// forwarding command; once all are set, the rest is forwarded.
+func buildForwardBinding(c *commandmodel.Command, s argStore) string {
+	if len(c.Args) == 0 {
+		return buildForwardRest(s)
+	}
+	b := &strings.Builder{}
+	for i, arg := range c.Args {
+		keyword := "elif"
+		if i == 0 {
+			keyword = "if"
+		}
+		fmt.Fprintf(b, "%s %s; then\n", keyword, s.isUnset(arg.Name))
+		fmt.Fprintf(b, "  %s\n", s.set(arg.Name, "\"$1\""))
+	}
+	b.WriteString("else\n")
+	b.WriteString(indentLines(buildForwardRest(s), "  "))
+	b.WriteString("fi\n")
+	return b.String()
+}
+
+// buildForwardRest stops parsing and keeps the remaining arguments for the
+// forwarded program: in other_args, or quoted in forward_args for POSIX sh.
+func buildForwardRest(s argStore) string {
+	if s.posix {
+		return "for arg in \"$@\"; do\n" +
+			"  forward_args=\"$forward_args $(quote_arg \"$arg\")\"\n" +
+			"done\n" +
+			"break\n"
+	}
+	return "other_args+=(\"$@\")\nbreak\n"
+}
+
+// buildForwardExec execs the program of a forwarding command with the
+// arguments kept by its parser.
+func buildForwardExec(c *commandmodel.Command, st settings.Settings) string {
+	words := make([]string, 0, len(c.Forward))
+	for _, w := range c.Forward {
+		words = append(words, shellQuote(w))
+	}
+	program := strings.Join(words, " ")
+	if isPOSIXTarget(st) {
+		return fmt.Sprintf("eval \"exec %s $forward_args\"\n", escapeDoubleQuoted(program))
+	}
+	return fmt.Sprintf("exec %s \"${other_args[@]}\"\n", program)
+}
+
+// buildEnvFallback takes the value of name from the environment variable env
+// when it was not given on the command line.
+func buildEnvFallback(s argStore, name string, env string) string {
+	if env == "" {
+		return ""
+	}
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "  if %s && %s; then\n", s.isUnset(name), s.cond("-n \"${"+env+":-}\""))
+	fmt.Fprintf(b, "    %s\n", s.set(name, "\"$"+env+"\""))
+	b.WriteString("  fi\n")
+	return b.String()
+}
+
+// buildPrompt asks for a missing value when stdin is a TTY and --no-input
+// was not given. The reply to a repeatable flag is stored shell-quoted,
+// like a value given on the command line, since the list is eval'ed.
+func buildPrompt(s argStore, name string, label string, repeatable bool) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "if %s && %s && %s; then\n", s.isUnset(name), s.cond("-t 0"), s.isUnset("--no-input"))
+	fmt.Fprintf(b, "  prompt_value %s\n", shellQuote(label))
+	fmt.Fprintf(b, "  if %s; then\n", s.cond("-n \"$prompt_reply\""))
+	fmt.Fprintf(b, "    %s\n", s.set(name, s.given(name, "$prompt_reply", repeatable)))
+	b.WriteString("  fi\n")
+	b.WriteString("fi\n")
+	return b.String()
+}
+
+// indentLines prefixes every non-empty line of s with indent.
+func indentLines(s string, indent string) string {
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		if lines[i] == "" {
+			continue
+		}
+		lines[i] = indent + lines[i]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -1,63 +1,257 @@
 package generate
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
+	"log/slog"
 	"path/filepath"
 	"strings"
+	"text/template"
 
 	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
 	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
 )
 
 type Options struct {
 	Workdir string
 	Force   bool
-	DryRun  bool
+	// FS is read from and written to; nil means the disk. A dry run passes
+	// vfs.Overlay(vfs.Disk), and callers may generate into a vfs.Mem.
+	FS vfs.FS
+	// Progress, when set, is called by EnsureCommandPartials as it reaches
+	// each partial, with its position, the number of partials and its path.
+	Progress func(done, total int, path string)
 }
 
 type Result struct {
 	Created []string
 	Skipped []string
-}
+	// Updated lists existing partials rewritten by --force: untouched
+	// scaffolds are replaced, edited ones get their scaffold lines merged.
+	Updated []string
+	// Rejected lists the .rej files written for scaffold lines that were
+	// edited and could not be merged.
+	Rejected []string
 
-func EnsureCommandPartials(root *commandmodel.Command, st settings.Settings, opts Options) (Result, error) {
-	srcDir := filepath.Join(opts.Workdir, st.SourceDir)
+	undo *journal
+}
 
+// EnsureCommandPartials scaffolds the partial of every command, merging
+// scaffold updates into existing ones with opts.Force. The partials are
+// prepared first and written once all of them are ready; an error or ctx
+// being done while writing undoes the writes made so far, so the source
+// dir is left as it was.
+func EnsureCommandPartials(ctx context.Context, root *commandmodel.Command, st settings.Settings, opts Options) (Result, error) {
 	cmds := commandmodel.DeepCommands(root, true)
 
+	fsys := vfs.Or(opts.FS)
+	tmpl, err := loadPartialTemplate(fsys, opts.Workdir, st)
+	if err != nil {
+		return Result{}, err
+	}
+
+	total := 0
+	for _, c := range cmds {
+		if c.Filename != "" {
+			total++
+		}
+	}
+
+	type write struct {
+		path    string
+		content string
+		list    *[]string // of res, where the path goes once written
+	}
 	res := Result{}
+	var writes []write
+	done := 0
 	for _, c := range cmds {
+		if ctx.Err() != nil {
+			return Result{}, context.Cause(ctx)
+		}
 		if c.Filename == "" {
 			continue
 		}
-		path := filepath.Join(srcDir, c.Filename)
+		path := c.PartialFile(opts.Workdir, st.SourceDir)
+		rel := filepath.ToSlash(c.PartialPath(st.SourceDir))
+		done++
+		if opts.Progress != nil {
+			opts.Progress(done, total, rel)
+		}
+		content, err := partialContent(tmpl, c, rel)
+		if err != nil {
+			return Result{}, err
+		}
 
+		existing, err := fsys.ReadFile(path)
+		if err != nil {
+			writes = append(writes, write{path: path, content: content, list: &res.Created})
+			continue
+		}
 		if !opts.Force {
-			if _, err := os.Stat(path); err == nil {
-				res.Skipped = append(res.Skipped, path)
-				continue
+			res.Skipped = append(res.Skipped, path)
+			slog.Debug("partial exists, skipping", "path", path)
+			continue
+		}
+		m := mergePartial(string(existing), content)
+		if m.Content == string(existing) && m.Reject == "" {
+			res.Skipped = append(res.Skipped, path)
+			slog.Debug("partial up to date", "path", path)
+			continue
+		}
+		if m.Content != string(existing) {
+			writes = append(writes, write{path: path, content: m.Content, list: &res.Updated})
+		}
+		if m.Reject != "" {
+			writes = append(writes, write{path: path + ".rej", content: m.Reject, list: &res.Rejected})
+		}
+	}
+
+	j := &journal{fsys: fsys}
+	res.undo = j
+	for _, w := range writes {
+		err := context.Cause(ctx)
+		if err == nil {
+			err = j.write(w.path, []byte(w.content), st.PartialMode)
+		}
+		if err != nil {
+			if rerr := j.rollback(); rerr != nil {
+				err = errors.Join(err, rerr)
 			}
+			return Result{}, err
 		}
+		*w.list = append(*w.list, w.path)
+		slog.Debug("partial written", "path", w.path)
+	}
 
-		if opts.DryRun {
-			res.Created = append(res.Created, path)
-			continue
+	return res, nil
+}
+
+// Rollback undoes the writes of the EnsureCommandPartials call that
+// returned r, for a generation failing after it: the partials and
+// directories it created are removed, the files it changed get their old
+// content back.
+func (r Result) Rollback() error {
+	if r.undo == nil {
+		return nil
+	}
+	return r.undo.rollback()
+}
+
+// journal writes files, remembering how to undo it.
+type journal struct {
+	fsys    vfs.FS
+	created []string // files and directories, parents first
+	changed []backup
+}
+
+type backup struct {
+	path string
+	data []byte
+}
+
+// write writes data to path, creating its directory. An existing file
+// keeps its permissions; a new one gets mode.
+func (j *journal) write(path string, data []byte, mode fs.FileMode) error {
+	old, err := j.fsys.ReadFile(path)
+	exists := err == nil
+	if !exists {
+		if err := j.mkdirAll(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("create directory: %w", err)
 		}
+	}
+	if err := j.fsys.WriteFile(path, data, mode); err != nil {
+		return fmt.Errorf("write partial: %w", err)
+	}
+	if exists {
+		j.changed = append(j.changed, backup{path: path, data: old})
+	} else {
+		j.created = append(j.created, path)
+	}
+	return nil
+}
 
-		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-			return res, fmt.Errorf("create directory: %w", err)
+// mkdirAll creates dir and its missing parents, remembering those it
+// created.
+func (j *journal) mkdirAll(dir string) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := j.fsys.Stat(d); err == nil || filepath.Dir(d) == d {
+			break
 		}
+		missing = append(missing, d)
+	}
+	if err := j.fsys.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		j.created = append(j.created, missing[i])
+	}
+	return nil
+}
 
-		content := defaultCommandPartialContent(filepath.ToSlash(filepath.Join(st.SourceDir, c.Filename)), c.FullName)
-		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
-			return res, fmt.Errorf("write partial: %w", err)
+// rollback restores the changed files and removes the created ones,
+// newest first, and forgets them.
+func (j *journal) rollback() error {
+	var errs []error
+	for i := len(j.changed) - 1; i >= 0; i-- {
+		b := j.changed[i]
+		if err := j.fsys.WriteFile(b.path, b.data, 0); err != nil {
+			errs = append(errs, fmt.Errorf("restore %s: %w", b.path, err))
 		}
+	}
+	for i := len(j.created) - 1; i >= 0; i-- {
+		if err := j.fsys.Remove(j.created[i]); err != nil {
+			errs = append(errs, fmt.Errorf("remove %s: %w", j.created[i], err))
+		}
+	}
+	slog.Debug("partial writes undone", "created", len(j.created), "changed", len(j.changed))
+	j.changed, j.created = nil, nil
+	return errors.Join(errs...)
+}
 
-		res.Created = append(res.Created, path)
+// PartialTemplateData is passed to the partial_template of a project.
+type PartialTemplateData struct {
+	Command *commandmodel.Command
+	Path    string // the partial, relative to the workdir, e.g. src/download_command.sh
+}
+
+// loadPartialTemplate parses the partial_template file, relative to the
+// workdir; it returns nil when the setting is empty.
+func loadPartialTemplate(fsys vfs.FS, workdir string, st settings.Settings) (*template.Template, error) {
+	if st.PartialTemplate == "" {
+		return nil, nil
+	}
+	path := st.PartialTemplate
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workdir, path)
 	}
+	b, err := fsys.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read partial_template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("parse partial_template: %w", err)
+	}
+	slog.Debug("partial template loaded", "path", path)
+	return tmpl, nil
+}
 
-	return res, nil
+// partialContent returns the content of a new partial: the project's
+// template when set, the built-in scaffold otherwise.
+func partialContent(tmpl *template.Template, c *commandmodel.Command, relPath string) (string, error) {
+	if tmpl == nil {
+		return defaultCommandPartialContent(relPath, c.FullName), nil
+	}
+	b := &strings.Builder{}
+	if err := tmpl.Execute(b, PartialTemplateData{Command: c, Path: relPath}); err != nil {
+		return "", fmt.Errorf("partial_template: %s: %w", c.FullName, err)
+	}
+	return b.String(), nil
 }
 
 func defaultCommandPartialContent(relPath string, fullCommandName string) string {
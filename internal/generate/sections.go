@@ -0,0 +1,128 @@
+package generate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
+)
+
+// Sections generate --only can re-render on their own, leaving partials and
+// the rest of the script untouched.
+const (
+	SectionUsage       = "usage"
+	SectionCompletions = "completions"
+)
+
+// IsSection reports whether name is one of the sections above.
+func IsSection(name string) bool {
+	return name == SectionUsage || name == SectionCompletions
+}
+
+// UpdateUsage replaces the usage functions in the existing script of root
+// by freshly rendered ones. Commands whose usage function is missing from
+// the script, such as newly added ones, need a full generate. Written is
+// false when the script is unchanged.
+func UpdateUsage(ctx context.Context, root *commandmodel.Command, st settings.Settings, opts Options) (MasterResult, error) {
+	fsys := vfs.Or(opts.FS)
+	path := ScriptPath(root, st, opts.Workdir)
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return MasterResult{}, fmt.Errorf("%s does not exist; run generate without --only %s first", path, SectionUsage)
+		}
+		return MasterResult{}, err
+	}
+	if err := checkTargetShell(st); err != nil {
+		return MasterResult{}, err
+	}
+	cat, err := LoadCatalog(fsys, filepath.Join(opts.Workdir, st.SourceDir))
+	if err != nil {
+		return MasterResult{}, err
+	}
+
+	old := strings.ReplaceAll(string(data), "\r\n", "\n")
+	script := old
+	for _, c := range commandmodel.DeepCommands(root, true) {
+		name := usageFunctionName(c)
+		var ok bool
+		script, ok = replaceFunction(script, name, buildUsage(c, st, cat))
+		if !ok {
+			return MasterResult{}, fmt.Errorf("%s: no %s function for %q; run generate without --only %s", path, name, c.FullName, SectionUsage)
+		}
+	}
+	code, warnings, err := formatMasterScript(ctx, script, st)
+	if err != nil {
+		return MasterResult{}, err
+	}
+	// The rest of the script is as old as its footer says, so the footer
+	// keeps its config digest; only the script digest is renewed.
+	if _, footer, ok := ReadIntegrityFooter(data); ok && isEnabled(st.EnableIntegrityFooter, st.Env) {
+		code = withIntegrityFooter(code, footer.Config)
+	} else if ok {
+		code, _, _ = ReadIntegrityFooter(code)
+	}
+	if string(code) == string(data) {
+		slog.Debug("usage unchanged", "path", path)
+		return MasterResult{Path: path}, nil
+	}
+	if err := writeFileBackup(fsys, path, code, st.ScriptMode, st.BackupScript); err != nil {
+		return MasterResult{}, fmt.Errorf("write master script: %w", err)
+	}
+	return MasterResult{Path: path, Written: true, Warnings: warnings}, nil
+}
+
+// replaceFunction replaces the definition of the shell function name in
+// script, from its "name() {" line to the first closing brace at the start
+// of a line, by fn.
+func replaceFunction(script string, name string, fn string) (string, bool) {
+	header := name + "() {\n"
+	start := 0
+	if !strings.HasPrefix(script, header) {
+		i := strings.Index(script, "\n"+header)
+		if i < 0 {
+			return script, false
+		}
+		start = i + 1
+	}
+	end := strings.Index(script[start:], "\n}\n")
+	if end < 0 {
+		return script, false
+	}
+	end += start + len("\n}\n")
+	return script[:start] + strings.TrimRight(fn, "\n") + "\n" + script[end:], true
+}
+
+// CompletionsPath returns where generate --only completions writes the bash
+// completion script of root: next to the script.
+func CompletionsPath(root *commandmodel.Command, st settings.Settings, workdir string) string {
+	return ScriptPath(root, st, workdir) + "-completions.bash"
+}
+
+// WriteCompletions renders the bash completion script of root to
+// CompletionsPath. Written is false when the file is unchanged.
+func WriteCompletions(root *commandmodel.Command, st settings.Settings, opts Options) (MasterResult, error) {
+	fsys := vfs.Or(opts.FS)
+	path := CompletionsPath(root, st, opts.Workdir)
+	script, err := CompletionScript(root, "bash")
+	if err != nil {
+		return MasterResult{}, err
+	}
+	if old, err := fsys.ReadFile(path); err == nil && string(old) == script {
+		slog.Debug("completions unchanged", "path", path)
+		return MasterResult{Path: path}, nil
+	}
+	if err := fsys.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return MasterResult{}, fmt.Errorf("create target dir: %w", err)
+	}
+	if err := fsys.WriteFile(path, []byte(script), 0o644); err != nil {
+		return MasterResult{}, fmt.Errorf("write completions: %w", err)
+	}
+	return MasterResult{Path: path, Written: true}, nil
+}
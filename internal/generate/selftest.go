@@ -0,0 +1,93 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// selftestFlag is the hidden flag that runs the generated self-test.
+const selftestFlag = "--bashly-selftest"
+
+// buildSelftest emits the selftest function, which checks the shell version,
+// the dependencies and the environment variables declared anywhere in the
+// tree, prints a report and returns 1 when any check fails.
+func buildSelftest(root *commandmodel.Command, st settings.Settings) string {
+	s := newArgStore(st)
+	b := &strings.Builder{}
+	b.WriteString("selftest_report() {\n")
+	b.WriteString("  printf '  %-5s %s\\n' \"$1\" \"$2\"\n")
+	b.WriteString("  if " + s.cond("\"$1\" = \"FAIL\"") + "; then\n")
+	b.WriteString("    selftest_problems=$((selftest_problems + 1))\n")
+	b.WriteString("  fi\n")
+	b.WriteString("}\n\n")
+
+	b.WriteString("selftest() {\n")
+	b.WriteString("  selftest_problems=0\n")
+	fmt.Fprintf(b, "  echo %s\n", shellQuote(root.Name+" self-test"))
+
+	switch targetShell(st) {
+	case "sh":
+		b.WriteString("  selftest_report ok \"shell: $0 (POSIX sh)\"\n")
+	case "zsh":
+		b.WriteString("  autoload -Uz is-at-least\n")
+		b.WriteString("  if is-at-least 5.0; then\n")
+		b.WriteString("    selftest_report ok \"zsh $ZSH_VERSION\"\n")
+		b.WriteString("  else\n")
+		b.WriteString("    selftest_report FAIL \"zsh $ZSH_VERSION (5.0 or higher is required)\"\n")
+		b.WriteString("  fi\n")
+	default:
+		b.WriteString("  if [[ ${BASH_VERSINFO[0]:-0} -ge 4 ]]; then\n")
+		b.WriteString("    selftest_report ok \"bash $BASH_VERSION\"\n")
+		b.WriteString("  else\n")
+		b.WriteString("    selftest_report FAIL \"bash ${BASH_VERSION:-unknown} (4.0 or higher is required for associative arrays)\"\n")
+		b.WriteString("  fi\n")
+	}
+
+	seen := map[string]bool{}
+	for _, c := range commandmodel.DeepCommands(root, true) {
+		for _, dep := range c.Deps {
+			if seen["dep:"+dep] {
+				continue
+			}
+			seen["dep:"+dep] = true
+			q := shellQuote(dep)
+			fmt.Fprintf(b, "  if command -v %s >/dev/null 2>&1; then\n", q)
+			fmt.Fprintf(b, "    selftest_report ok \"dependency %s: $(command -v %s)\"\n", escapeDoubleQuoted(dep), q)
+			b.WriteString("  else\n")
+			fmt.Fprintf(b, "    selftest_report FAIL \"dependency %s: not found in PATH\"\n", escapeDoubleQuoted(dep))
+			b.WriteString("  fi\n")
+		}
+	}
+
+	for _, c := range commandmodel.DeepCommands(root, true) {
+		for _, ev := range c.EnvVars {
+			if seen["env:"+ev.Name] {
+				continue
+			}
+			seen["env:"+ev.Name] = true
+			missing := "selftest_report info \"environment variable " + ev.Name + ": not set\""
+			switch {
+			case ev.Required:
+				missing = "selftest_report FAIL \"environment variable " + ev.Name + ": not set (required by " + escapeDoubleQuoted(c.FullName) + ")\""
+			case ev.Default != "":
+				missing = "selftest_report info \"environment variable " + ev.Name + ": not set (default: " + escapeDoubleQuoted(ev.Default) + ")\""
+			}
+			fmt.Fprintf(b, "  if %s; then\n", s.cond("-n \"${"+ev.Name+":-}\""))
+			fmt.Fprintf(b, "    selftest_report ok \"environment variable %s: set\"\n", ev.Name)
+			b.WriteString("  else\n")
+			fmt.Fprintf(b, "    %s\n", missing)
+			b.WriteString("  fi\n")
+		}
+	}
+
+	b.WriteString("  if " + s.cond("$selftest_problems -gt 0") + "; then\n")
+	b.WriteString("    echo \"$selftest_problems problem(s) found\"\n")
+	b.WriteString("    return 1\n")
+	b.WriteString("  fi\n")
+	b.WriteString("  echo \"all checks passed\"\n")
+	b.WriteString("}\n\n")
+	return b.String()
+}
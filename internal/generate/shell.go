@@ -0,0 +1,139 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// targetShell returns the normalized target_shell value ("bash" when unset).
+func targetShell(st settings.Settings) string {
+	v := strings.TrimSpace(strings.ToLower(st.TargetShell))
+	if v == "" {
+		return "bash"
+	}
+	return v
+}
+
+// isPOSIXTarget reports whether the script should be emitted for POSIX sh.
+func isPOSIXTarget(st settings.Settings) bool {
+	return targetShell(st) == "sh"
+}
+
+// isZshTarget reports whether the script should be emitted for zsh.
+func isZshTarget(st settings.Settings) bool {
+	return targetShell(st) == "zsh"
+}
+
+// checkTargetShell validates target_shell and rejects features that cannot be
+// expressed without bash arrays when targeting POSIX sh.
+func checkTargetShell(st settings.Settings) error {
+	switch targetShell(st) {
+	case "bash", "zsh":
+		return nil
+	case "sh":
+	default:
+		return fmt.Errorf("unknown target_shell: %s (expected bash, sh or zsh)", st.TargetShell)
+	}
+
+	if isEnabled(st.EnableDepsArray, st.Env) {
+		return fmt.Errorf("enable_deps_array is not supported with target_shell: sh (set it to never)")
+	}
+	if isEnabled(st.EnableEnvVarNamesArray, st.Env) {
+		return fmt.Errorf("enable_env_var_names_array is not supported with target_shell: sh (set it to never)")
+	}
+	return nil
+}
+
+// shebang returns the first line of the script: the shebang setting, or the
+// interpreter of the target shell.
+func shebang(st settings.Settings) string {
+	if st.Shebang != "" {
+		return strings.TrimRight(st.Shebang, "\r\n") + "\n"
+	}
+	switch targetShell(st) {
+	case "sh":
+		return "#!/bin/sh\n"
+	case "zsh":
+		return "#!/usr/bin/env zsh\n"
+	default:
+		return "#!/usr/bin/env bash\n"
+	}
+}
+
+// zshPrelude makes zsh follow the bash semantics the generated code and
+// partials rely on: unquoted parameter word splitting, 0-based arrays and
+// BASH_REMATCH for regex captures.
+func zshPrelude() string {
+	b := &strings.Builder{}
+	b.WriteString("# Zsh compatibility\n")
+	b.WriteString("setopt SH_WORD_SPLIT KSH_ARRAYS BASH_REMATCH\n")
+	b.WriteString("\n")
+	return b.String()
+}
+
+// versionBouncer returns the shell version check for the target shell.
+// POSIX sh has no version to check, so it returns an empty string.
+func versionBouncer(st settings.Settings) string {
+	b := &strings.Builder{}
+	switch targetShell(st) {
+	case "sh":
+		return ""
+	case "zsh":
+		b.WriteString("# Zsh version check\n")
+		b.WriteString("autoload -Uz is-at-least\n")
+		b.WriteString("if ! is-at-least 5.0; then\n")
+		b.WriteString("  echo 'ERROR: zsh 5.0 or higher is required.' >&2\n")
+		b.WriteString("  exit 1\n")
+		b.WriteString("fi\n\n")
+	default:
+		b.WriteString("# Bash version check\n")
+		b.WriteString("if [[ -z \"${BASH_VERSINFO+x}\" || ${BASH_VERSINFO[0]} -lt 3 ]]; then\n")
+		b.WriteString("  echo 'ERROR: bash 3.0 or higher is required.' >&2\n")
+		b.WriteString("  exit 1\n")
+		b.WriteString("fi\n\n")
+	}
+	return b.String()
+}
+
+// assocArrayBouncer returns the check placed before the first associative
+// array the script declares. Bash added declare -A in 4.0, so bash 3 would
+// otherwise fail there with "invalid option"; zsh has them since 3.1 and
+// POSIX sh declares none, so it returns an empty string for both.
+func assocArrayBouncer(st settings.Settings) string {
+	if targetShell(st) != "bash" {
+		return ""
+	}
+	b := &strings.Builder{}
+	b.WriteString("if [[ ${BASH_VERSINFO[0]} -lt 4 ]]; then\n")
+	b.WriteString("  echo 'ERROR: bash 4.0 or higher is required (associative arrays).' >&2\n")
+	b.WriteString("  exit 1\n")
+	b.WriteString("fi\n")
+	return b.String()
+}
+
+// sourcingGuard returns the condition that runs the script only when it is
+// executed rather than sourced, when enable_sourcing is on. POSIX sh cannot
+// detect sourcing, so sh scripts always run.
+func sourcingGuard(st settings.Settings) string {
+	if !isEnabled(st.EnableSourcing, st.Env) {
+		return ""
+	}
+	switch targetShell(st) {
+	case "sh":
+		return ""
+	case "zsh":
+		return "if [[ $ZSH_EVAL_CONTEXT != *:file ]]; then"
+	default:
+		return "if [[ \"${BASH_SOURCE[0]}\" == \"$0\" ]]; then"
+	}
+}
+
+// declareBuiltin returns the builtin used to declare arrays.
+func declareBuiltin(st settings.Settings) string {
+	if isZshTarget(st) {
+		return "typeset"
+	}
+	return "declare"
+}
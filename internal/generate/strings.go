@@ -0,0 +1,226 @@
+package generate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/render"
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
+)
+
+// runtimeMessage is an error message printed by the generated script. Params
+// lists the placeholders it accepts, in the order the script passes them.
+type runtimeMessage struct {
+	Text   string
+	Params []string
+}
+
+// runtimeMessages holds the English error messages of the generated script.
+var runtimeMessages = map[string]runtimeMessage{
+	"missing_required_argument":             {"missing required argument: %{arg}", []string{"arg"}},
+	"missing_required_flag":                 {"missing required flag: %{flag}", []string{"flag"}},
+	"missing_required_environment_variable": {"missing required environment variable: %{var}", []string{"var"}},
+	"flag_requires_an_argument":             {"flag requires an argument: %{flag}", []string{"flag"}},
+	"invalid_option":                        {"invalid option: %{option}", []string{"option"}},
+	"ambiguous_option":                      {"ambiguous option: %{option} (could be %{candidates})", []string{"option", "candidates"}},
+	"invalid_command":                       {"invalid command: %{command}", []string{"command"}},
+	"disallowed_flag":                       {"invalid value for %{flag}: %{value}", []string{"flag", "value"}},
+	"disallowed_environment_variable":       {"invalid value for %{var}: %{value}", []string{"var", "value"}},
+	"validation_error":                      {"validation error in %{var}: %{message}", []string{"var", "message"}},
+	"no_matching_commands":                  {"no commands match: %{term}", []string{"term"}},
+	"unsupported_shell":                     {"unsupported shell: %{shell}", []string{"shell"}},
+}
+
+// Catalog holds the string overrides of a project: Strings from
+// bashly-strings.yml, and one table per locale from bashly-strings.<locale>.yml.
+type Catalog struct {
+	Strings map[string]string
+	Locales map[string]map[string]string
+}
+
+var (
+	stringsFilePattern = regexp.MustCompile(`^bashly-strings(?:\.([A-Za-z]+))?\.ya?ml$`)
+	placeholderPattern = regexp.MustCompile(`%\{([a-z_]+)\}`)
+)
+
+// LoadCatalog reads the strings files in srcDir. Unknown keys and
+// placeholders are errors, so typos do not silently fall back to English.
+// A missing srcDir has no strings files; other errors reading it are
+// returned, so an unreadable directory does not look empty.
+func LoadCatalog(fsys vfs.FS, srcDir string) (Catalog, error) {
+	cat := Catalog{Strings: map[string]string{}, Locales: map[string]map[string]string{}}
+	entries, err := fsys.ReadDir(srcDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cat, nil
+	}
+	if err != nil {
+		return cat, fmt.Errorf("read strings: %w", err)
+	}
+	for _, e := range entries {
+		m := stringsFilePattern.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		path := filepath.Join(srcDir, e.Name())
+		table, err := loadStringsFile(fsys, path)
+		if err != nil {
+			return cat, err
+		}
+		if m[1] == "" {
+			cat.Strings = table
+		} else {
+			cat.Locales[strings.ToLower(m[1])] = table
+		}
+	}
+	return cat, nil
+}
+
+func loadStringsFile(fsys vfs.FS, path string) (map[string]string, error) {
+	b, err := fsys.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read strings: %w", err)
+	}
+	raw := map[string]string{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parse strings file %s: %w", path, err)
+	}
+	for key, text := range raw {
+		var params []string
+		if msg, ok := runtimeMessages[key]; ok {
+			params = msg.Params
+		} else if def, ok := render.DefaultStrings[key]; ok {
+			for _, p := range placeholderPattern.FindAllStringSubmatch(def, -1) {
+				params = append(params, p[1])
+			}
+		} else {
+			return nil, fmt.Errorf("%s: unknown string %q", path, key)
+		}
+		for _, p := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			if !containsString(params, p[1]) {
+				return nil, fmt.Errorf("%s: unknown placeholder %%{%s} in %q", path, p[1], key)
+			}
+		}
+	}
+	return raw, nil
+}
+
+// helpStrings returns the help label overrides for locale ("" for the default).
+func (c Catalog) helpStrings(locale string) map[string]string {
+	out := map[string]string{}
+	for k, v := range c.Strings {
+		out[k] = v
+	}
+	for k, v := range c.Locales[locale] {
+		out[k] = v
+	}
+	return out
+}
+
+// localeNames returns the declared locales in a stable order.
+func (c Catalog) localeNames() []string {
+	names := make([]string, 0, len(c.Locales))
+	for name := range c.Locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// buildMessages emits message_text, which prints a runtime message by key
+// with its parameters, and, when locales are declared, sets script_locale
+// from LANGUAGE, LC_ALL, LC_MESSAGES or LANG (e.g. de_DE.UTF-8 -> de).
+func buildMessages(cat Catalog) string {
+	b := &strings.Builder{}
+	locales := cat.localeNames()
+	if len(locales) > 0 {
+		b.WriteString("script_locale=\"${LANGUAGE:-${LC_ALL:-${LC_MESSAGES:-${LANG:-}}}}\"\n")
+		b.WriteString("script_locale=\"${script_locale%%[:_.@]*}\"\n\n")
+	}
+
+	keys := make([]string, 0, len(runtimeMessages))
+	for k := range runtimeMessages {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b.WriteString("message_text() {\n")
+	if len(locales) > 0 {
+		b.WriteString("  case \"$script_locale:$1\" in\n")
+	} else {
+		b.WriteString("  case \"$1\" in\n")
+	}
+	for _, key := range keys {
+		msg := runtimeMessages[key]
+		for _, locale := range locales {
+			if text, ok := cat.Locales[locale][key]; ok {
+				fmt.Fprintf(b, "    %s:%s)\n      %s\n      ;;\n", locale, key, printfMessage(text, msg.Params))
+			}
+		}
+		text := msg.Text
+		if override, ok := cat.Strings[key]; ok {
+			text = override
+		}
+		pattern := key
+		if len(locales) > 0 {
+			pattern = "*:" + key
+		}
+		fmt.Fprintf(b, "    %s)\n      %s\n      ;;\n", pattern, printfMessage(text, msg.Params))
+	}
+	b.WriteString("  esac\n")
+	b.WriteString("}\n\n")
+	return b.String()
+}
+
+// printfMessage turns a message template into a printf call; each
+// %{param} becomes the positional parameter of that param ($2, $3, ...).
+func printfMessage(text string, params []string) string {
+	escape := func(s string) string { return strings.ReplaceAll(s, "%", "%%") }
+	format := &strings.Builder{}
+	var args []string
+	last := 0
+	for _, loc := range placeholderPattern.FindAllStringSubmatchIndex(text, -1) {
+		format.WriteString(escape(text[last:loc[0]]))
+		last = loc[1]
+		name := text[loc[2]:loc[3]]
+		i := indexOfString(params, name)
+		if i < 0 {
+			format.WriteString(escape(text[loc[0]:loc[1]]))
+			continue
+		}
+		format.WriteString("%s")
+		args = append(args, fmt.Sprintf("\"$%d\"", i+2))
+	}
+	format.WriteString(escape(text[last:]))
+
+	call := "printf " + shellQuote(format.String())
+	if len(args) > 0 {
+		call += " " + strings.Join(args, " ")
+	}
+	return call
+}
+
+// messageCall returns a command substitution printing the message key with
+// args, which must already be quoted for the shell.
+func messageCall(key string, args ...string) string {
+	return "$(message_text " + strings.Join(append([]string{key}, args...), " ") + ")"
+}
+
+func containsString(list []string, s string) bool {
+	return indexOfString(list, s) >= 0
+}
+
+func indexOfString(list []string, s string) int {
+	for i, x := range list {
+		if x == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,62 @@
+package generate
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
+)
+
+// unreadableDir fails ReadDir of dir, like a directory without read
+// permission, and serves everything else from the embedded FS.
+type unreadableDir struct {
+	vfs.FS
+	dir string
+}
+
+func (u unreadableDir) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == u.dir {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return u.FS.ReadDir(name)
+}
+
+func TestLoadCatalogReadDir(t *testing.T) {
+	mem := vfs.NewMem()
+	if err := mem.WriteFile("/proj/src/bashly-strings.yml", []byte("missing_required_argument: need %{arg}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		fsys        vfs.FS
+		dir         string
+		wantErr     string
+		wantStrings int
+	}{
+		{name: "strings file", fsys: mem, dir: "/proj/src", wantStrings: 1},
+		{name: "missing dir", fsys: mem, dir: "/proj/nosrc"},
+		{name: "unreadable dir", fsys: unreadableDir{mem, "/proj/src"}, dir: "/proj/src", wantErr: "permission denied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cat, err := LoadCatalog(tt.fsys, tt.dir)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("LoadCatalog() = %v, want nil", err)
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadCatalog() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				if !errors.Is(err, fs.ErrPermission) {
+					t.Errorf("LoadCatalog() = %v, want it to wrap fs.ErrPermission", err)
+				}
+				return
+			}
+			if len(cat.Strings) != tt.wantStrings {
+				t.Errorf("len(Strings) = %d, want %d", len(cat.Strings), tt.wantStrings)
+			}
+		})
+	}
+}
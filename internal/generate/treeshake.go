@@ -0,0 +1,128 @@
+package generate
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// libFuncStart matches a function definition at the start of a line:
+	// name() {, name () or function name {.
+	libFuncStart = regexp.MustCompile(`^(?:function\s+([A-Za-z_][A-Za-z0-9_:.-]*)\s*(?:\(\s*\))?|([A-Za-z_][A-Za-z0-9_:.-]*)\s*\(\s*\))\s*(\{.*)?$`)
+	libFuncWord  = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_:.-]*`)
+)
+
+// libBlock is a piece of merged lib code: a function definition with its
+// leading comments, or any other top-level code (Name is empty).
+type libBlock struct {
+	Name string
+	Text string
+}
+
+// splitLibFunctions cuts lib code into blocks. A function ends at the first
+// line holding only "}" at column zero, or on its own line for one-liners;
+// when no end is found the rest is kept as plain code.
+func splitLibFunctions(lib string) []libBlock {
+	lines := strings.Split(lib, "\n")
+	var blocks []libBlock
+	var other []string
+	flush := func() {
+		if len(other) > 0 {
+			blocks = append(blocks, libBlock{Text: strings.Join(other, "\n")})
+			other = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		m := libFuncStart.FindStringSubmatch(lines[i])
+		if m == nil {
+			other = append(other, lines[i])
+			continue
+		}
+		name := m[1] + m[2]
+		end := -1
+		if body := strings.TrimSpace(m[3]); strings.HasSuffix(body, "}") && strings.Count(body, "{") == strings.Count(body, "}") {
+			end = i
+		} else {
+			for j := i + 1; j < len(lines); j++ {
+				if strings.TrimRight(lines[j], " \t") == "}" {
+					end = j
+					break
+				}
+			}
+		}
+		if end < 0 {
+			other = append(other, lines[i:]...)
+			break
+		}
+
+		// Comments right above the definition belong to it.
+		start := len(other)
+		for start > 0 && strings.HasPrefix(strings.TrimSpace(other[start-1]), "#") {
+			start--
+		}
+		text := append(append([]string{}, other[start:]...), lines[i:end+1]...)
+		other = other[:start]
+		flush()
+		blocks = append(blocks, libBlock{Name: name, Text: strings.Join(text, "\n")})
+		i = end
+	}
+	flush()
+	return blocks
+}
+
+// ShakeLibs drops the functions of the merged lib code that are not called,
+// directly or through other kept functions, from roots (partials, the header)
+// or from lib code outside functions. It returns the remaining code and the
+// names of the dropped functions. Calls built from variables ("$fn") cannot
+// be seen, so such functions must also be named literally somewhere.
+func ShakeLibs(lib string, roots []string) (string, []string) {
+	blocks := splitLibFunctions(lib)
+	defined := map[string]bool{}
+	for _, b := range blocks {
+		if b.Name != "" {
+			defined[b.Name] = true
+		}
+	}
+
+	used := map[string]bool{}
+	var queue []string
+	scan := func(text string) {
+		for _, w := range libFuncWord.FindAllString(text, -1) {
+			if defined[w] && !used[w] {
+				used[w] = true
+				queue = append(queue, w)
+			}
+		}
+	}
+	for _, r := range roots {
+		scan(r)
+	}
+	for _, b := range blocks {
+		if b.Name == "" {
+			scan(b.Text)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, b := range blocks {
+			if b.Name == name {
+				scan(b.Text)
+			}
+		}
+	}
+
+	var kept []string
+	var dropped []string
+	for _, b := range blocks {
+		if b.Name != "" && !used[b.Name] {
+			dropped = append(dropped, b.Name)
+			continue
+		}
+		kept = append(kept, b.Text)
+	}
+	sort.Strings(dropped)
+	return strings.Join(kept, "\n"), dropped
+}
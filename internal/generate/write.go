@@ -0,0 +1,25 @@
+package generate
+
+import (
+	"fmt"
+	"io/fs"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
+)
+
+// writeFileBackup writes data to path in fsys, which replaces it as a
+// whole. With backup, the previous content is kept in <path>.bak.
+func writeFileBackup(fsys vfs.FS, path string, data []byte, perm fs.FileMode, backup bool) error {
+	if backup {
+		if old, err := fsys.ReadFile(path); err == nil {
+			info, err := fsys.Stat(path)
+			if err != nil {
+				return err
+			}
+			if err := fsys.WriteFile(path+".bak", old, info.Mode().Perm()); err != nil {
+				return fmt.Errorf("write backup: %w", err)
+			}
+		}
+	}
+	return fsys.WriteFile(path, data, perm)
+}
@@ -0,0 +1,104 @@
+package golden
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Script is a rendered output to compare, stored as <dir>/<Name>.
+type Script struct {
+	Name    string
+	Content []byte
+}
+
+// Status is the outcome of comparing one script with its golden file.
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusDiff    Status = "diff"
+	StatusMissing Status = "missing"
+	StatusUpdated Status = "updated"
+)
+
+// Result is the comparison of one script with its golden file.
+type Result struct {
+	Path   string
+	Status Status
+	Diff   string // set for StatusDiff
+}
+
+// maxDiffLines bounds each side of the diff reported for a mismatch.
+const maxDiffLines = 20
+
+// Check compares each script with <dir>/<name>. With update, missing or
+// different golden files are (re)written instead of reported.
+func Check(dir string, scripts []Script, update bool) ([]Result, error) {
+	var out []Result
+	for _, s := range scripts {
+		path := filepath.Join(dir, s.Name)
+		want, err := os.ReadFile(path)
+		missing := errors.Is(err, fs.ErrNotExist)
+		if err != nil && !missing {
+			return nil, fmt.Errorf("read golden file: %w", err)
+		}
+		if !missing && bytes.Equal(want, s.Content) {
+			out = append(out, Result{Path: path, Status: StatusOK})
+			continue
+		}
+		if update {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, fmt.Errorf("create golden dir: %w", err)
+			}
+			if err := os.WriteFile(path, s.Content, 0o644); err != nil {
+				return nil, fmt.Errorf("write golden file: %w", err)
+			}
+			out = append(out, Result{Path: path, Status: StatusUpdated})
+			continue
+		}
+		if missing {
+			out = append(out, Result{Path: path, Status: StatusMissing})
+			continue
+		}
+		out = append(out, Result{Path: path, Status: StatusDiff, Diff: Diff(string(want), string(s.Content))})
+	}
+	return out, nil
+}
+
+// Diff returns the block of lines where want and got differ, after trimming
+// the lines they share at both ends, as -want/+got lines.
+func Diff(want string, got string) string {
+	w := strings.Split(want, "\n")
+	g := strings.Split(got, "\n")
+
+	start := 0
+	for start < len(w) && start < len(g) && w[start] == g[start] {
+		start++
+	}
+	endW, endG := len(w), len(g)
+	for endW > start && endG > start && w[endW-1] == g[endG-1] {
+		endW--
+		endG--
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "@@ line %d @@\n", start+1)
+	writeSide(b, "-", w[start:endW])
+	writeSide(b, "+", g[start:endG])
+	return b.String()
+}
+
+func writeSide(b *strings.Builder, prefix string, lines []string) {
+	for i, line := range lines {
+		if i == maxDiffLines {
+			fmt.Fprintf(b, "%s... %d more lines\n", prefix, len(lines)-i)
+			return
+		}
+		fmt.Fprintf(b, "%s%s\n", prefix, line)
+	}
+}
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/term"
+)
+
+// Options holds the logging flags shared by all subcommands.
+type Options struct {
+	Verbose bool
+	Quiet   bool
+	Format  string
+	// Color paints the level names of the text format.
+	Color bool
+}
+
+// AddFlags registers --verbose, --quiet and --log-format on fs.
+func AddFlags(fs *flag.FlagSet) *Options {
+	o := &Options{}
+	fs.BoolVar(&o.Verbose, "verbose", false, "Explain each step (settings origin, files written or skipped, formatter used)")
+	fs.BoolVar(&o.Quiet, "quiet", false, "Only print errors")
+	fs.StringVar(&o.Format, "log-format", "text", "Log line format: text or json")
+	return o
+}
+
+// Level returns the minimum level to log: debug with --verbose, error with
+// --quiet, warnings otherwise.
+func (o *Options) Level() slog.Level {
+	switch {
+	case o.Verbose:
+		return slog.LevelDebug
+	case o.Quiet:
+		return slog.LevelError
+	default:
+		return slog.LevelWarn
+	}
+}
+
+// Setup installs the default slog logger writing to w.
+func (o *Options) Setup(w io.Writer) error {
+	if o.Verbose && o.Quiet {
+		return fmt.Errorf("--verbose and --quiet are mutually exclusive")
+	}
+	var h slog.Handler
+	switch o.Format {
+	case "text", "":
+		h = &textHandler{w: w, level: o.Level(), color: o.Color, mu: &sync.Mutex{}}
+	case "json":
+		h = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: o.Level()})
+	default:
+		return fmt.Errorf("unknown --log-format: %s (expected text or json)", o.Format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// textHandler prints "level: message key=value ..." lines, matching the
+// "warning: ..." lines go-bashly printed before structured logging.
+type textHandler struct {
+	w     io.Writer
+	level slog.Level
+	attrs []slog.Attr
+	color bool
+	mu    *sync.Mutex
+}
+
+func (h *textHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	b := &strings.Builder{}
+	name := levelName(r.Level)
+	b.WriteString(term.Paint(h.color, levelColors[name], name))
+	b.WriteString(": ")
+	b.WriteString(r.Message)
+	writeAttr := func(a slog.Attr) bool {
+		v := a.Value.Resolve().String()
+		if strings.ContainsAny(v, " \t\"=") || v == "" {
+			v = fmt.Sprintf("%q", v)
+		}
+		fmt.Fprintf(b, " %s=%s", a.Key, v)
+		return true
+	}
+	for _, a := range h.attrs {
+		writeAttr(a)
+	}
+	r.Attrs(writeAttr)
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &c
+}
+
+// WithGroup is not used by go-bashly; groups are flattened.
+func (h *textHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// levelColors holds the ANSI codes of the level names: red, yellow, plain
+// and dim.
+var levelColors = map[string]string{"error": "31", "warning": "33", "info": "0", "debug": "2"}
+
+func levelName(l slog.Level) string {
+	switch {
+	case l >= slog.LevelError:
+		return "error"
+	case l >= slog.LevelWarn:
+		return "warning"
+	case l >= slog.LevelInfo:
+		return "info"
+	default:
+		return "debug"
+	}
+}
@@ -0,0 +1,136 @@
+package lsp
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keyLine matches a line that opens a block mapping or sequence, such as
+// "  flags:" or "- commands:", capturing the key.
+var keyLine = regexp.MustCompile(`^([A-Za-z_][\w-]*):\s*(#.*)?$`)
+
+// partialKey matches the text before the cursor while a key is typed.
+var partialKey = regexp.MustCompile(`^\s*(-\s+)?([A-Za-z_]*)$`)
+
+// contentIndent returns the column where the content of line starts, past
+// its indentation and any "- " sequence markers, and that content.
+func contentIndent(line string) (int, string) {
+	col := 0
+	for {
+		rest := line[col:]
+		switch {
+		case strings.HasPrefix(rest, " "):
+			col++
+		case rest == "-" || strings.HasPrefix(rest, "- "):
+			col++
+		default:
+			return col, rest
+		}
+	}
+}
+
+// keyPath returns the keys of the block collections enclosing a key at
+// column col of line, outermost first: ["commands", "flags"] inside a flag
+// of a subcommand.
+func keyPath(lines []string, line int, col int) []string {
+	var path []string
+	for i := min(line, len(lines)) - 1; i >= 0 && col > 0; i-- {
+		indent, content := contentIndent(lines[i])
+		if content == "" || strings.HasPrefix(content, "#") || indent >= col {
+			continue
+		}
+		col = indent
+		if m := keyLine.FindStringSubmatch(content); m != nil {
+			path = append([]string{m[1]}, path...)
+		}
+	}
+	return path
+}
+
+// commandName is the name of a command in a YAML file: its path from the
+// root of the file, e.g. ["mycli", "db", "migrate"] in the config or
+// ["migrate"] in an imported file, and the 0-based line of its name.
+type commandName struct {
+	Path []string
+	Line int
+}
+
+// commandNames returns the commands declared in text, ignoring YAML it
+// cannot parse.
+func commandNames(text string) []commandName {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+	var out []commandName
+	var walk func(n *yaml.Node, path []string)
+	walk = func(n *yaml.Node, path []string) {
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		var commands *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i].Value, n.Content[i+1]
+			switch {
+			case key == "name" && value.Kind == yaml.ScalarNode:
+				path = append(path, value.Value)
+				out = append(out, commandName{Path: path, Line: value.Line - 1})
+			case key == "commands" && value.Kind == yaml.SequenceNode:
+				commands = value
+			}
+		}
+		if commands != nil {
+			for _, item := range commands.Content {
+				walk(item, append([]string{}, path...))
+			}
+		}
+	}
+	walk(doc.Content[0], nil)
+	return out
+}
+
+// findCommandName returns the declaration among names of the command with
+// the given full name: the one whose path is the longest suffix of it.
+func findCommandName(names []commandName, fullName string) (commandName, bool) {
+	var best commandName
+	found := false
+	for _, n := range names {
+		p := strings.Join(n.Path, " ")
+		if (fullName == p || strings.HasSuffix(fullName, " "+p)) && (!found || len(n.Path) > len(best.Path)) {
+			best, found = n, true
+		}
+	}
+	return best, found
+}
+
+// byteColumn converts an LSP character offset, in UTF-16 code units, to a
+// byte offset in line.
+func byteColumn(line string, character int) int {
+	units := 0
+	for i, r := range line {
+		if units >= character {
+			return i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(line)
+}
+
+// wordAt returns the key-like word of line around byte offset col and its
+// byte range.
+func wordAt(line string, col int) (string, int, int) {
+	isWord := func(b byte) bool {
+		return b == '_' || b == '-' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+	}
+	start, end := col, col
+	for start > 0 && isWord(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWord(line[end]) {
+		end++
+	}
+	return line[start:end], start, end
+}
@@ -0,0 +1,348 @@
+package lsp
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/bashlyconfig"
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+type diagnostic struct {
+	Range    rangeType `json:"range"`
+	Severity int       `json:"severity"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+}
+
+// yamlError matches YAML syntax errors, with the file when loading
+// reports it.
+var yamlError = regexp.MustCompile(`(?:(\S+\.ya?ml): )?yaml: line (\d+): (.*)$`)
+
+// project returns the workdir, the resolved settings and the absolute
+// config path. Settings are resolved without validation, so that a broken
+// project still gets diagnostics.
+func (s *Server) project() (string, settings.Settings, string) {
+	s.mu.Lock()
+	wd := s.workdir
+	s.mu.Unlock()
+	st := settings.Default()
+	st.ConfigPath = strings.ReplaceAll(st.ConfigPath, "%{source_dir}", st.SourceDir)
+	if r, err := settings.Resolve(wd, s.settingsOptions()); err == nil {
+		st = r.Settings
+	}
+	config := s.opts.ConfigPath
+	if config == "" {
+		config = st.ConfigPath
+	}
+	if !filepath.IsAbs(config) {
+		config = filepath.Join(wd, config)
+	}
+	return wd, st, config
+}
+
+func (s *Server) settingsOptions() settings.LoadOptions {
+	return settings.LoadOptions{Overrides: s.opts.Project.Overrides, Env: s.opts.Project.Env}
+}
+
+// text returns the content of the document at path: the editor's version
+// when it is open, else the file.
+func (s *Server) text(path string) (string, bool) {
+	s.mu.Lock()
+	text, ok := s.docs[path]
+	s.mu.Unlock()
+	if ok {
+		return text, true
+	}
+	b, err := os.ReadFile(path)
+	return string(b), err == nil
+}
+
+func (s *Server) isSettings(path string) bool {
+	wd, _, _ := s.project()
+	if p := settings.UserSettingsPathIn(wd, s.opts.Project.Env); p != "" {
+		return filepath.Clean(p) == filepath.Clean(path)
+	}
+	base := filepath.Base(path)
+	return filepath.Dir(path) == wd && (base == "settings.yml" || base == "bashly-settings.yml")
+}
+
+// publish sends the diagnostics of the project and of the open documents,
+// clearing those of files that have none left.
+func (s *Server) publish(ctx context.Context) {
+	s.mu.Lock()
+	cache := s.cache
+	open := make([]string, 0, len(s.docs))
+	for path := range s.docs {
+		open = append(open, path)
+	}
+	s.mu.Unlock()
+	if cache == nil {
+		return
+	}
+
+	diags := map[string][]diagnostic{}
+	add := func(path string, line int, message string) {
+		text, _ := s.text(path)
+		lines := strings.Split(text, "\n")
+		width := 0
+		if line >= 0 && line < len(lines) {
+			width = len(utf16.Encode([]rune(lines[line])))
+		}
+		d := diagnostic{
+			Range:    rangeType{Start: position{Line: line}, End: position{Line: line, Character: width}},
+			Severity: 1,
+			Source:   "go-bashly",
+			Message:  message,
+		}
+		if !slices.Contains(diags[path], d) {
+			diags[path] = append(diags[path], d)
+		}
+	}
+
+	if _, err := cache.Project(ctx); err != nil {
+		wd, st, config := s.project()
+		// Settings errors belong to the settings file, if there is one.
+		file := settings.UserSettingsPathIn(wd, s.opts.Project.Env)
+		if _, serr := settings.Load(wd, s.settingsOptions()); serr == nil || file == "" {
+			file = config
+		} else {
+			err = serr
+		}
+		names := s.commandIndex(config, filepath.Join(wd, st.SourceDir))
+		for _, msg := range strings.Split(err.Error(), "\n") {
+			path, line, text := locate(msg, file, names)
+			add(path, line, text)
+		}
+	}
+	// Unsaved edits are only checked for YAML syntax; the project is
+	// loaded from the files.
+	for _, path := range open {
+		if ext := filepath.Ext(path); ext != ".yml" && ext != ".yaml" {
+			continue
+		}
+		text, _ := s.text(path)
+		if _, err := bashlyconfig.ParseYAML([]byte(text), "import"); err != nil {
+			if m := yamlError.FindStringSubmatch(err.Error()); m != nil {
+				n, _ := strconv.Atoi(m[2])
+				add(path, n-1, m[3])
+			} else {
+				add(path, 0, err.Error())
+			}
+		}
+	}
+
+	s.mu.Lock()
+	paths := make([]string, 0, len(s.published)+len(diags))
+	for path := range s.published {
+		paths = append(paths, path)
+	}
+	s.published = map[string]bool{}
+	for path := range diags {
+		if !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+		s.published[path] = true
+	}
+	s.mu.Unlock()
+	for _, path := range paths {
+		list := diags[path]
+		if list == nil {
+			list = []diagnostic{}
+		}
+		s.notify("textDocument/publishDiagnostics", map[string]any{"uri": pathURI(path), "diagnostics": list})
+	}
+}
+
+// commandIndex returns the commands declared in the config and in the YAML
+// files of the source dir, by file. Like the project, it reads the files,
+// not unsaved edits.
+func (s *Server) commandIndex(config string, srcDir string) map[string][]commandName {
+	index := map[string][]commandName{}
+	add := func(path string) {
+		if _, ok := index[path]; ok {
+			return
+		}
+		if b, err := os.ReadFile(path); err == nil {
+			index[path] = commandNames(string(b))
+		}
+	}
+	add(config)
+	_ = filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && (filepath.Ext(path) == ".yml" || filepath.Ext(path) == ".yaml") {
+			add(path)
+		}
+		return nil
+	})
+	return index
+}
+
+// locate returns the file, 0-based line and message of one line of a load
+// error: YAML errors name their line, and lint errors start with the full
+// name of a command, found by its name key. Anything else is reported at
+// the top of file.
+func locate(msg string, file string, index map[string][]commandName) (string, int, string) {
+	if m := yamlError.FindStringSubmatch(msg); m != nil {
+		path := file
+		if m[1] != "" {
+			path = m[1]
+		}
+		n, _ := strconv.Atoi(m[2])
+		return path, n - 1, m[3]
+	}
+	if name, rest, ok := strings.Cut(msg, ": "); ok {
+		var best commandName
+		bestPath := ""
+		for path, names := range index {
+			if n, ok := findCommandName(names, name); ok && (bestPath == "" || len(n.Path) > len(best.Path)) {
+				best, bestPath = n, path
+			}
+		}
+		if bestPath != "" {
+			return bestPath, best.Line, rest
+		}
+	}
+	return file, 0, msg
+}
+
+type completionItem struct {
+	Label         string `json:"label"`
+	Kind          int    `json:"kind"`
+	Documentation string `json:"documentation,omitempty"`
+	InsertText    string `json:"insertText"`
+}
+
+// completion offers the keys that fit where a key is being typed.
+func (s *Server) completion(path string, pos position) any {
+	return map[string]any{"isIncomplete": false, "items": s.completionItems(path, pos)}
+}
+
+func (s *Server) completionItems(path string, pos position) []completionItem {
+	items := []completionItem{}
+	text, _ := s.text(path)
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return items
+	}
+	line := lines[pos.Line]
+	before := line[:byteColumn(line, pos.Character)]
+	if !partialKey.MatchString(before) {
+		return items
+	}
+	col, _ := contentIndent(before)
+
+	if s.isSettings(path) {
+		if col > 0 {
+			return items
+		}
+		for _, key := range settings.Keys() {
+			items = append(items, completionItem{Label: key, Kind: 10, Documentation: settings.Doc(key), InsertText: key + ": "})
+		}
+		return items
+	}
+	for _, k := range s.keysAt(path, lines, pos.Line, col) {
+		items = append(items, completionItem{Label: k.Key, Kind: 10, Documentation: k.Doc, InsertText: k.Key + ": "})
+	}
+	return items
+}
+
+// keysAt returns the config keys of the mapping holding a key at column
+// col of line: a command, flag, arg or environment variable.
+func (s *Server) keysAt(path string, lines []string, line int, col int) []keyDoc {
+	kind := "commands"
+	if kp := keyPath(lines, line, col); len(kp) > 0 {
+		kind = kp[len(kp)-1]
+	}
+	keys, ok := configKeys[kind]
+	if !ok {
+		return nil
+	}
+	if kind != "commands" {
+		return keys
+	}
+	_, _, config := s.project()
+	isRoot := len(keyPath(lines, line, col)) == 0 && filepath.Clean(path) == filepath.Clean(config)
+	var out []keyDoc
+	for _, k := range keys {
+		if (isRoot && slices.Contains(commandOnly, k.Key)) || (!isRoot && slices.Contains(rootOnly, k.Key)) {
+			continue
+		}
+		out = append(out, k)
+	}
+	return out
+}
+
+// hover describes the setting or config key under the cursor.
+func (s *Server) hover(path string, pos position) any {
+	text, _ := s.text(path)
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return nil
+	}
+	line := lines[pos.Line]
+	word, start, end := wordAt(line, byteColumn(line, pos.Character))
+	col, _ := contentIndent(line)
+	if word == "" || start != col || !strings.HasPrefix(line[end:], ":") {
+		return nil
+	}
+
+	doc := ""
+	if s.isSettings(path) {
+		if col == 0 {
+			doc = settings.Doc(word)
+		}
+	} else {
+		for _, k := range s.keysAt(path, lines, pos.Line, col) {
+			if k.Key == word {
+				doc = k.Doc
+			}
+		}
+	}
+	if doc == "" {
+		return nil
+	}
+	return map[string]any{
+		"contents": map[string]any{"kind": "markdown", "value": "**" + word + "**\n\n" + doc},
+		"range": rangeType{
+			Start: position{Line: pos.Line, Character: len(utf16.Encode([]rune(line[:start])))},
+			End:   position{Line: pos.Line, Character: len(utf16.Encode([]rune(line[:end])))},
+		},
+	}
+}
+
+// definition goes from the name of a command to its partial.
+func (s *Server) definition(ctx context.Context, path string, pos position) any {
+	text, _ := s.text(path)
+	var target []string
+	for _, n := range commandNames(text) {
+		if n.Line == pos.Line {
+			target = n.Path
+		}
+	}
+	if target == nil {
+		return nil
+	}
+	s.mu.Lock()
+	cache := s.cache
+	s.mu.Unlock()
+	p, err := cache.Project(ctx)
+	if err != nil {
+		return nil
+	}
+	name := strings.Join(target, " ")
+	var out []location
+	for _, c := range commandmodel.DeepCommands(p.Root, true) {
+		if c.Filename != "" && (c.FullName == name || strings.HasSuffix(c.FullName, " "+name)) {
+			out = append(out, location{URI: pathURI(c.PartialFile(p.Workdir, p.Settings.SourceDir))})
+		}
+	}
+	return out
+}
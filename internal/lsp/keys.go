@@ -0,0 +1,83 @@
+package lsp
+
+// configKeys lists the keys of each kind of mapping in bashly.yml with a
+// short description, for completion and hovers. A command's keys also apply
+// to the root, except those listed in rootOnly and commandOnly.
+var configKeys = map[string][]keyDoc{
+	"commands": {
+		{"name", "Name of the command, as typed on the command line."},
+		{"alias", "Other names of the command; a trailing * matches any suffix."},
+		{"help", "Help text of the command; its first line is the summary."},
+		{"description", "Longer text shown in the command's help instead of help."},
+		{"args", "Positional arguments, in order."},
+		{"flags", "Flags accepted by the command."},
+		{"environment_variables", "Environment variables the command reads."},
+		{"commands", "Subcommands."},
+		{"dependencies", "Programs that must be in PATH before the command runs."},
+		{"examples", "Example invocations shown in help."},
+		{"forward", "Program the command passes its remaining arguments to."},
+		{"require_subcommand", "Show the usage instead of running the command without a subcommand."},
+		{"on_exit", "Function called when the script exits, even on errors or signals."},
+		{"validation_exit_code", "Exit status of validation failures of the command and its subcommands."},
+		{"filename", "Partial of the command, relative to the source dir."},
+		{"src", "Directory, relative to the workdir, of the partials of the command and its subcommands; needs skip_src_check."},
+		{"private", "Leave the command out of help and completions."},
+		{"disabled", "Leave the command out of the script, help and completions; inspect --disabled shows it."},
+		{"expose", "Read for Ruby bashly, where it lists the subcommands in the parent's help."},
+		{"default", "Run this subcommand when none is given: true, or force to also take unknown arguments."},
+		{"needs", "Commands whose partials the command calls, kept in variants and --only."},
+		{"if", "Condition on --define variables and env that decides whether the command exists."},
+		{"import", "File whose mapping this command is read from."},
+		{"version", "Version printed by --version."},
+		{"help_header_override", "Banner printed above the root help."},
+		{"profiles", "Named sets of changes applied by --profile."},
+		{"definitions", "Flags and args defined once, by name, for commands to use with ref."},
+	},
+	"flags": {
+		{"ref", "Name of the flag under definitions.flags this flag is; its other keys win."},
+		{"long", "Long name, such as --output."},
+		{"short", "Short name, such as -o."},
+		{"arg", "Name of the flag's value; flags without arg are booleans."},
+		{"help", "Help text of the flag."},
+		{"required", "Fail when the flag is not given."},
+		{"default", "Value used when the flag is not given; a list of values for a repeatable flag."},
+		{"allowed", "The values the flag accepts."},
+		{"repeatable", "Accept the flag more than once."},
+		{"env", "Environment variable read when the flag is not given."},
+		{"normalize", "Changes applied to the value: strip, downcase, upcase or expand_path."},
+		{"completions", "Values, or <file>, <directory> and $(command) sources, offered by completions."},
+		{"private", "Leave the flag out of help."},
+		{"global", "Also accept the flag in every subcommand."},
+	},
+	"args": {
+		{"ref", "Name of the arg under definitions.args this arg is; its other keys win."},
+		{"name", "Name of the argument, the key of args in partials."},
+		{"help", "Help text of the argument."},
+		{"required", "Fail when the argument is not given."},
+		{"default", "Value used when the argument is not given."},
+		{"env", "Environment variable read when the argument is not given."},
+		{"normalize", "Changes applied to the value: strip, downcase, upcase or expand_path."},
+		{"completions", "Values, or <file>, <directory> and $(command) sources, offered by completions."},
+	},
+	"environment_variables": {
+		{"name", "Name of the environment variable."},
+		{"help", "Help text of the variable."},
+		{"required", "Fail when the variable is not set."},
+		{"default", "Value set when the variable is not."},
+		{"allowed", "The values the variable accepts when set."},
+		{"validate", "Names of lib functions, called as validate_<name>, that check the value."},
+		{"private", "Leave the variable out of help."},
+	},
+}
+
+// rootOnly are command keys that only the root takes, commandOnly those it
+// does not.
+var (
+	rootOnly    = []string{"version", "help_header_override", "profiles", "definitions"}
+	commandOnly = []string{"alias", "filename", "private", "disabled", "expose", "default", "needs", "if", "import"}
+)
+
+type keyDoc struct {
+	Key string
+	Doc string
+}
@@ -0,0 +1,358 @@
+// Package lsp is a language server for bashly projects: diagnostics from
+// loading and linting the project, completion of config and settings keys,
+// hovers describing them, and going from a command to its partial.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/modelcache"
+	"github.com/dimitar-trifonov/go-bashly/internal/project"
+)
+
+// Options configures the server. An empty Workdir is taken from the root
+// URI the client sends with initialize.
+type Options struct {
+	ConfigPath string
+	Workdir    string
+	Project    project.Options
+}
+
+// Server answers one client over a stream, sequentially.
+type Server struct {
+	opts Options
+	out  io.Writer
+
+	writeMu sync.Mutex
+
+	mu        sync.Mutex
+	workdir   string
+	cache     *modelcache.Cache
+	docs      map[string]string // open documents by path
+	published map[string]bool   // paths with diagnostics shown
+}
+
+// Serve answers the requests read from in on out until the client exits,
+// in is closed or ctx is done.
+func Serve(ctx context.Context, in io.Reader, out io.Writer, opts Options) error {
+	s := &Server{opts: opts, out: out, docs: map[string]string{}, published: map[string]bool{}}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r := bufio.NewReader(in)
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		var msg request
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.reply(nil, nil, &rpcError{Code: -32700, Message: err.Error()})
+			continue
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if msg.Method != "initialize" && !s.initialized() {
+			// Notifications before initialize are dropped.
+			if msg.ID != nil {
+				s.reply(msg.ID, nil, &rpcError{Code: -32002, Message: "server not initialized"})
+			}
+			continue
+		}
+		result, err := s.handle(ctx, msg)
+		if msg.ID == nil {
+			if err != nil {
+				slog.Warn("lsp notification failed", "method", msg.Method, "error", err)
+			}
+			continue
+		}
+		if err != nil {
+			var rerr *rpcError
+			if !errors.As(err, &rerr) {
+				rerr = &rpcError{Code: -32603, Message: err.Error()}
+			}
+			s.reply(msg.ID, nil, rerr)
+			continue
+		}
+		s.reply(msg.ID, result, nil)
+	}
+}
+
+type request struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// response is a successful reply; errorResponse a failed one, which has
+// no result.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   *rpcError       `json:"error"`
+}
+
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// maxMessageSize caps the Content-Length of a message, so that a bad header
+// cannot make the server allocate any amount of memory.
+const maxMessageSize = 64 << 20
+
+// readMessage reads the body of one message framed by a Content-Length
+// header.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length: %w", err)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+	if length > maxMessageSize {
+		return nil, fmt.Errorf("Content-Length %d exceeds %d bytes", length, maxMessageSize)
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+func (s *Server) write(msg any) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		slog.Warn("lsp message not encoded", "error", err)
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *Server) reply(id json.RawMessage, result any, err *rpcError) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	if err != nil {
+		s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: err})
+		return
+	}
+	s.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) notify(method string, params any) {
+	s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type rangeType struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string    `json:"uri"`
+	Range rangeType `json:"range"`
+}
+
+type textDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position position `json:"position"`
+}
+
+// handle runs the method of msg and returns its result.
+func (s *Server) handle(ctx context.Context, msg request) (any, error) {
+	switch msg.Method {
+	case "initialize":
+		var p struct {
+			RootURI  string `json:"rootUri"`
+			RootPath string `json:"rootPath"`
+		}
+		_ = json.Unmarshal(msg.Params, &p)
+		return s.initialize(p.RootURI, p.RootPath)
+	case "initialized":
+		s.mu.Lock()
+		cache := s.cache
+		s.mu.Unlock()
+		cache.OnInvalidate(func() { s.publish(ctx) })
+		go func() { _ = cache.Watch(ctx, 0) }()
+		s.publish(ctx)
+		return nil, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		var p struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		s.setDoc(p.TextDocument.URI, p.TextDocument.Text)
+		s.publish(ctx)
+		return nil, nil
+	case "textDocument/didChange":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.setDoc(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+			s.publish(ctx)
+		}
+		return nil, nil
+	case "textDocument/didSave":
+		s.mu.Lock()
+		cache := s.cache
+		s.mu.Unlock()
+		cache.Invalidate()
+		return nil, nil
+	case "textDocument/didClose":
+		var p textDocumentPosition
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		delete(s.docs, uriPath(p.TextDocument.URI))
+		s.mu.Unlock()
+		s.publish(ctx)
+		return nil, nil
+	case "textDocument/completion":
+		var p textDocumentPosition
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.completion(uriPath(p.TextDocument.URI), p.Position), nil
+	case "textDocument/hover":
+		var p textDocumentPosition
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.hover(uriPath(p.TextDocument.URI), p.Position), nil
+	case "textDocument/definition":
+		var p textDocumentPosition
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.definition(ctx, uriPath(p.TextDocument.URI), p.Position), nil
+	}
+	if strings.HasPrefix(msg.Method, "$/") {
+		return nil, nil
+	}
+	return nil, &rpcError{Code: -32601, Message: "method not found: " + msg.Method}
+}
+
+func (s *Server) initialize(rootURI string, rootPath string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wd := s.opts.Workdir
+	switch {
+	case wd != "":
+	case rootURI != "":
+		wd = uriPath(rootURI)
+	default:
+		wd = rootPath
+	}
+	wd, err := project.ResolveWorkdir(wd)
+	if err != nil {
+		return nil, err
+	}
+	s.workdir = wd
+	s.cache = modelcache.New(s.opts.ConfigPath, wd, s.opts.Project)
+	slog.Debug("lsp initialized", "workdir", wd)
+
+	return map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync":   map[string]any{"openClose": true, "change": 1, "save": true},
+			"completionProvider": map[string]any{},
+			"hoverProvider":      true,
+			"definitionProvider": true,
+		},
+		"serverInfo": map[string]any{"name": "go-bashly"},
+	}, nil
+}
+
+// initialized reports whether initialize has succeeded, which every other
+// method needs.
+func (s *Server) initialized() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cache != nil
+}
+
+func (s *Server) setDoc(uri string, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs[uriPath(uri)] = text
+}
+
+// uriPath returns the file path of a file URI.
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// pathURI returns the file URI of an absolute path.
+func pathURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,40 @@
+package lsp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr string
+	}{
+		{name: "body", input: "Content-Length: 2\r\n\r\n{}", want: "{}"},
+		{name: "header case", input: "content-length: 2\r\nContent-Type: x\r\n\r\n{}", want: "{}"},
+		{name: "missing length", input: "Content-Type: x\r\n\r\n{}", wantErr: "message without Content-Length"},
+		{name: "invalid length", input: "Content-Length: two\r\n\r\n{}", wantErr: "invalid Content-Length"},
+		{name: "huge length", input: "Content-Length: 999999999999999999\r\n\r\n{}", wantErr: "exceeds"},
+		{name: "length over the cap", input: "Content-Length: 67108865\r\n\r\n{}", wantErr: "exceeds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := readMessage(bufio.NewReader(strings.NewReader(tt.input)))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("readMessage() = %v, want nil", err)
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readMessage() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if string(body) != tt.want {
+				t.Errorf("readMessage() = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Package modelcache keeps the command tree of a project in memory for
+// long-running tools such as editor integrations, rebuilding it only after
+// the project files change.
+package modelcache
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/project"
+)
+
+// DefaultInterval is how often Watch looks for changed files.
+const DefaultInterval = 500 * time.Millisecond
+
+// Cache holds the last loaded project. It is safe for concurrent use.
+type Cache struct {
+	configPath string
+	workdir    string
+	opts       project.Options
+
+	mu          sync.Mutex
+	loaded      bool
+	project     *project.Project
+	err         error
+	srcDir      string // source_dir of the last project loaded
+	fingerprint fingerprint
+	hooks       []func()
+}
+
+// New returns a cache of the project loaded as project.LoadContext would
+// with the same arguments. Nothing is loaded until the first Get.
+func New(configPath string, workdir string, opts project.Options) *Cache {
+	return &Cache{configPath: configPath, workdir: workdir, opts: opts, srcDir: "src"}
+}
+
+// Get returns the command tree, loading the project when the cache is
+// empty or was invalidated. A load error is cached too, so it is returned
+// again until the files change.
+func (c *Cache) Get(ctx context.Context) (*commandmodel.Command, error) {
+	p, err := c.Project(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.Root, nil
+}
+
+// Project is Get returning the whole project, with its settings.
+func (c *Cache) Project(ctx context.Context) (*project.Project, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded {
+		c.project, c.err = project.LoadContext(ctx, c.configPath, c.workdir, c.opts)
+		if ctx.Err() != nil {
+			// A cancelled load says nothing about the files.
+			return nil, c.err
+		}
+		if c.project != nil {
+			c.srcDir = c.project.Settings.SourceDir
+		}
+		c.loaded, c.fingerprint = true, c.scan()
+		slog.Debug("model cache loaded", "workdir", c.workdir, "error", c.err)
+	}
+	return c.project, c.err
+}
+
+// Invalidate drops the cached tree, so the next Get loads the project
+// again, and calls the hooks registered with OnInvalidate. Editors that
+// get change notifications of their own can call it instead of Watch.
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	c.loaded, c.project, c.err = false, nil, nil
+	hooks := append([]func(){}, c.hooks...)
+	c.mu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// OnInvalidate registers fn to be called after each invalidation, e.g. to
+// refresh diagnostics. Hooks run on the goroutine calling Invalidate.
+func (c *Cache) OnInvalidate(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, fn)
+}
+
+// Refresh takes the project files as they are now for those the cached
+// project was loaded from, for a tool that changes them itself, such as
+// generate --watch scaffolding partials, so that Watch does not count its
+// own writes as a change.
+func (c *Cache) Refresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loaded {
+		c.fingerprint = c.scan()
+	}
+}
+
+// Watch polls the project files every interval (DefaultInterval when zero)
+// and invalidates the cache when one is added, removed or modified. It
+// returns the cause of ctx once ctx is done.
+func (c *Cache) Watch(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		stale := c.loaded && c.scan() != c.fingerprint
+		c.mu.Unlock()
+		if stale {
+			slog.Debug("project files changed", "workdir", c.workdir)
+			c.Invalidate()
+		}
+	}
+}
+
+// fingerprint summarizes the project files cheaply, from their metadata.
+type fingerprint struct {
+	files   int
+	size    int64
+	modTime int64  // latest, in nanoseconds
+	names   string // so that renaming a file counts as a change
+}
+
+// scan fingerprints the files a load reads: the YAML files of the workdir
+// (settings and a config kept there), the source dir with its imports,
+// partials and texts, and the config file wherever it is.
+func (c *Cache) scan() fingerprint {
+	var fp fingerprint
+	var names strings.Builder
+	add := func(path string, info fs.FileInfo) {
+		fp.files++
+		fp.size += info.Size()
+		fp.modTime = max(fp.modTime, info.ModTime().UnixNano())
+		names.WriteString(path)
+		names.WriteByte(0)
+	}
+
+	wd, err := project.ResolveWorkdir(c.workdir)
+	if err != nil {
+		return fp
+	}
+	entries, _ := os.ReadDir(wd)
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.Type().IsRegular() && (ext == ".yml" || ext == ".yaml") {
+			if info, err := e.Info(); err == nil {
+				add(e.Name(), info)
+			}
+		}
+	}
+	_ = filepath.WalkDir(filepath.Join(wd, c.srcDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			add(path, info)
+		}
+		return nil
+	})
+	if c.configPath != "" {
+		path := c.configPath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(wd, path)
+		}
+		if info, err := os.Stat(path); err == nil {
+			add(path, info)
+		}
+	}
+	fp.names = names.String()
+	return fp
+}
@@ -0,0 +1,36 @@
+package pager
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/term"
+)
+
+// defaultHeight is assumed when the terminal height cannot be read.
+const defaultHeight = 24
+
+// Print writes text to out, through $PAGER (less -R by default) when out is
+// a terminal and text is taller than it. Falls back to writing directly
+// when the pager cannot be started.
+func Print(out *os.File, text string) error {
+	if !term.IsTerminal(out) || strings.Count(text, "\n") <= term.Height(defaultHeight) {
+		_, err := fmt.Fprint(out, text)
+		return err
+	}
+	pager := os.Getenv("PAGER")
+	if strings.TrimSpace(pager) == "" {
+		pager = "less -R"
+	}
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		_, err := fmt.Fprint(out, text)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Package progress reports how far a long run has got: on a terminal, a
+// status line rewritten in place; otherwise nothing until the run ends with
+// a one-line summary.
+package progress
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/term"
+)
+
+// interval is the shortest time between two redraws of the status line.
+const interval = 50 * time.Millisecond
+
+// Reporter writes progress to a file, usually stderr. The zero Reporter and
+// a nil one report nothing.
+type Reporter struct {
+	out   *os.File
+	tty   bool
+	width int
+	shown bool // a status line is on screen
+	drawn time.Time
+}
+
+// New returns a Reporter writing to out, drawing a status line when out is
+// a terminal.
+func New(out *os.File) *Reporter {
+	tty := term.IsTerminal(out) && os.Getenv("TERM") != "dumb"
+	return &Reporter{out: out, tty: tty, width: term.Width(out)}
+}
+
+// Step shows that done of total items are finished, the last being item.
+// Redraws are throttled, except for the last item.
+func (r *Reporter) Step(done, total int, item string) {
+	if r == nil || !r.tty {
+		return
+	}
+	if done < total && time.Since(r.drawn) < interval {
+		return
+	}
+	r.Status(fmt.Sprintf("[%d/%d] %s", done, total, item))
+}
+
+// Status replaces the status line with text, cut to the terminal width so
+// that it never wraps.
+func (r *Reporter) Status(text string) {
+	if r == nil || !r.tty {
+		return
+	}
+	if runes := []rune(text); r.width > 1 && len(runes) >= r.width {
+		text = string(runes[:r.width-2]) + "…"
+	}
+	fmt.Fprintf(r.out, "\r\033[K%s", text)
+	r.shown = true
+	r.drawn = time.Now()
+}
+
+// Clear removes the status line, before other output or at the end.
+func (r *Reporter) Clear() {
+	if r == nil || !r.shown {
+		return
+	}
+	fmt.Fprint(r.out, "\r\033[K")
+	r.shown = false
+}
+
+// Done clears the status line on a terminal and writes summary on a line of
+// its own elsewhere, where no status line was shown.
+func (r *Reporter) Done(summary string) {
+	if r == nil || r.out == nil {
+		return
+	}
+	if r.tty {
+		r.Clear()
+		return
+	}
+	fmt.Fprintln(r.out, summary)
+}
@@ -0,0 +1,86 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/generate"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// InspectSchema identifies the layout of Inspection. Fields may be added
+// within a version; renaming or removing one requires a new version.
+const InspectSchema = "go-bashly/inspect/v1"
+
+// Inspection is the document written by inspect --format json.
+type Inspection struct {
+	Schema   string                `json:"schema"`
+	Root     *commandmodel.Command `json:"root"`
+	Settings settings.Settings     `json:"settings"`
+	Computed InspectComputed       `json:"computed"`
+}
+
+// InspectComputed holds values derived from the config and settings that
+// decide what generate writes.
+type InspectComputed struct {
+	Workdir     string           `json:"workdir"`
+	Profile     string           `json:"profile,omitempty"`
+	Script      string           `json:"script"`
+	TargetShell string           `json:"target_shell"`
+	Toggles     map[string]bool  `json:"toggles"` // enable_* state in the current env
+	Commands    []InspectCommand `json:"commands"`
+}
+
+// InspectCommand lists the files and functions generated for one command.
+type InspectCommand struct {
+	FullName  string                    `json:"full_name"`
+	Partial   string                    `json:"partial,omitempty"`
+	Functions generate.CommandFunctions `json:"functions"`
+}
+
+// Inspect returns the inspection document of p.
+func (p *Project) Inspect() Inspection {
+	st := p.Settings
+	computed := InspectComputed{
+		Workdir:     p.Workdir,
+		Profile:     p.Profile,
+		Script:      generate.ScriptPath(p.Root, st, p.Workdir),
+		TargetShell: generate.TargetShell(st),
+		Toggles:     map[string]bool{},
+		Commands:    []InspectCommand{},
+	}
+	for _, t := range st.Toggles() {
+		computed.Toggles[t.Key] = st.Enabled(t.Value)
+	}
+	for _, c := range commandmodel.DeepCommands(p.Root, true) {
+		ic := InspectCommand{FullName: c.FullName, Functions: generate.FunctionsFor(c)}
+		if c.Filename != "" {
+			ic.Partial = c.PartialFile(p.Workdir, st.SourceDir)
+		}
+		computed.Commands = append(computed.Commands, ic)
+	}
+	return Inspection{Schema: InspectSchema, Root: p.Root, Settings: st, Computed: computed}
+}
+
+// LoadInspectedRoot reads the command tree of an inspect --format json
+// document, such as a baseline kept for compatibility checks.
+func LoadInspectedRoot(path string) (*commandmodel.Command, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Schema string                `json:"schema"`
+		Root   *commandmodel.Command `json:"root"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if !strings.HasPrefix(doc.Schema, "go-bashly/inspect/") || doc.Root == nil {
+		return nil, fmt.Errorf("%s: not an inspect --format json document", path)
+	}
+	return doc.Root, nil
+}
@@ -0,0 +1,282 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/banner"
+	"github.com/dimitar-trifonov/go-bashly/internal/bashlyconfig"
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/render"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// Project is a loaded bashly project: resolved workdir, settings, composed
+// config and the command tree built from it.
+type Project struct {
+	Workdir  string
+	Settings settings.Settings
+	// Origins tells where each settings value came from, keyed as in
+	// settings.yml.
+	Origins map[string]settings.Origin
+	Config  map[string]any
+	Root    *commandmodel.Command
+	Profile string // the config profile applied, if any
+}
+
+// Options tunes how a project is loaded.
+type Options struct {
+	// Defines are extra variables for "if" conditions on commands.
+	Defines map[string]string
+	// Overrides are applied on top of the settings file.
+	Overrides map[string]any
+	// Profile selects an entry of the config's profiles map.
+	Profile string
+	// Env holds the BASHLY_* settings variables; nil means the environment
+	// of the process.
+	Env settings.Environ
+	// Only limits the tree to these command paths, e.g. "db migrate", with
+	// their parents and subcommands. Commands outside them are not
+	// composed from their imports.
+	Only []string
+	// KeepDisabled keeps the commands declared with disabled: true in the
+	// tree, marked Disabled, instead of removing them.
+	KeepDisabled bool
+}
+
+// Load resolves the workdir, settings, composed config and command tree
+// shared by all subcommands that operate on a bashly project.
+// An empty configPath selects the config_path setting.
+func Load(configPath string, workdir string) (*Project, error) {
+	return LoadWithDefines(configPath, workdir, nil)
+}
+
+// LoadWithDefines is Load with extra variables for "if" conditions on
+// commands, on top of env (the settings env).
+func LoadWithDefines(configPath string, workdir string, defines map[string]string) (*Project, error) {
+	return LoadWithOverrides(configPath, workdir, defines, nil)
+}
+
+// LoadWithOverrides is LoadWithDefines with settings overrides, as declared
+// by a workspace for all of its projects.
+func LoadWithOverrides(configPath string, workdir string, defines map[string]string, overrides map[string]any) (*Project, error) {
+	return LoadWithOptions(configPath, workdir, Options{Defines: defines, Overrides: overrides})
+}
+
+// LoadWithOptions is Load with defines, settings overrides and a config
+// profile.
+func LoadWithOptions(configPath string, workdir string, opts Options) (*Project, error) {
+	return LoadContext(context.Background(), configPath, workdir, opts)
+}
+
+// LoadContext is LoadWithOptions that stops with the cause of ctx once it
+// is done, including a running git describe.
+func LoadContext(ctx context.Context, configPath string, workdir string, opts Options) (*Project, error) {
+	wd, err := ResolveWorkdir(workdir)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := settings.Load(wd, settings.LoadOptions{Overrides: opts.Overrides, Env: opts.Env})
+	if err != nil {
+		return nil, err
+	}
+	st := resolved.Settings
+
+	config := configPath
+	if config == "" {
+		config = st.ConfigPath
+	}
+
+	vars := map[string]string{"env": st.Env}
+	for k, v := range opts.Defines {
+		vars[k] = v
+	}
+	compose := func(only []string) (map[string]any, error) {
+		copts := bashlyconfig.ComposeOptions{Only: only, AllowExternalPaths: st.AllowExternalPaths}
+		cfg, err := bashlyconfig.LoadComposedSubtree(ctx, config, "import", wd, copts)
+		if err != nil {
+			return nil, err
+		}
+		if err := bashlyconfig.ApplyProfile(cfg, opts.Profile); err != nil {
+			return nil, err
+		}
+		if opts.Profile != "" {
+			slog.Debug("profile applied", "profile", opts.Profile)
+		}
+		if st.DiscoverCommands {
+			dir := filepath.Join(st.SourceDir, "commands")
+			if err := bashlyconfig.DiscoverCommands(ctx, cfg, dir, "import", wd, copts); err != nil {
+				return nil, err
+			}
+			slog.Debug("command fragments discovered", "dir", dir)
+		}
+		if err := bashlyconfig.ApplyDefinitions(cfg); err != nil {
+			return nil, err
+		}
+		if err := bashlyconfig.ApplyConditions(cfg, vars); err != nil {
+			return nil, err
+		}
+		if !opts.KeepDisabled {
+			for _, path := range bashlyconfig.RemoveDisabled(cfg) {
+				slog.Debug("disabled command removed", "command", path)
+			}
+		}
+		return cfg, nil
+	}
+
+	var cfg map[string]any
+	var root *commandmodel.Command
+	if len(opts.Only) == 0 {
+		if cfg, err = compose(nil); err != nil {
+			return nil, err
+		}
+		if root, err = commandmodel.BuildFromConfigMap(cfg, st); err != nil {
+			return nil, err
+		}
+	} else if cfg, root, err = composeOnly(compose, config == bashlyconfig.StdinPath, opts.Only, st); err != nil {
+		return nil, err
+	}
+	if err := commandmodel.Lint(root); err != nil {
+		return nil, err
+	}
+	if err := commandmodel.CheckPartialPaths(root, wd, st); err != nil {
+		return nil, err
+	}
+	if root.Version, err = resolveVersion(ctx, wd, st, root.Version); err != nil {
+		return nil, err
+	}
+	slog.Debug("version resolved", "source", st.VersionSource, "version", root.Version)
+	slog.Debug("config loaded", "path", config, "commands", len(commandmodel.DeepCommands(root, true)))
+
+	if err := setHelpHeader(wd, st, root); err != nil {
+		return nil, err
+	}
+
+	return &Project{Workdir: wd, Settings: st, Origins: resolved.Origins, Config: cfg, Root: root, Profile: opts.Profile}, nil
+}
+
+// setHelpHeader fills in the HelpHeader of root. help_header_override in
+// the config wins over the help_header.txt partial.
+func setHelpHeader(wd string, st settings.Settings, root *commandmodel.Command) error {
+	if root.HelpHeader == "" {
+		if hb, err := os.ReadFile(filepath.Join(wd, st.SourceDir, "help_header.txt")); err == nil {
+			root.HelpHeader = string(hb)
+			slog.Debug("help header loaded", "path", filepath.Join(st.SourceDir, "help_header.txt"))
+		}
+	}
+	// Either one wins over the help banner, which draws the name above the
+	// usual caption.
+	if root.HelpHeader == "" && st.Enabled(st.EnableHelpBanner) {
+		art, err := banner.Render(root.Name, st.HelpBannerFont)
+		if err != nil {
+			return err
+		}
+		root.HelpHeader = art + "\n" + render.Caption(root)
+		slog.Debug("help banner drawn", "font", st.HelpBannerFont)
+	}
+	return nil
+}
+
+// composeOnly composes the commands at the paths of only, adding the
+// commands they need until none is missing. Stdin is read once, so a
+// config from stdin is composed whole and only filtered.
+func composeOnly(compose func(only []string) (map[string]any, error), stdin bool, only []string, st settings.Settings) (map[string]any, *commandmodel.Command, error) {
+	var full map[string]any
+	if stdin {
+		var err error
+		if full, err = compose(nil); err != nil {
+			return nil, nil, err
+		}
+	}
+	var cfg map[string]any
+	var root *commandmodel.Command
+	for {
+		composed := full
+		if !stdin {
+			var err error
+			if composed, err = compose(only); err != nil {
+				return nil, nil, err
+			}
+		}
+		filtered, err := bashlyconfig.FilterCommands(composed, only, nil)
+		if err != nil {
+			if root != nil {
+				// A needed command that does not exist: Lint reports it.
+				return cfg, root, nil
+			}
+			return nil, nil, err
+		}
+		cfg = filtered
+		if root, err = commandmodel.BuildFromConfigMap(cfg, st); err != nil {
+			return nil, nil, err
+		}
+		added := false
+		for _, path := range neededOutside(root) {
+			if !slices.Contains(only, path) {
+				only = append(slices.Clip(only), path)
+				added = true
+			}
+		}
+		if !added {
+			slog.Debug("commands filtered", "only", only)
+			return cfg, root, nil
+		}
+	}
+}
+
+// neededOutside returns the needs of the commands in root that name no
+// command of root.
+func neededOutside(root *commandmodel.Command) []string {
+	var out []string
+	for _, c := range commandmodel.DeepCommands(root, true) {
+		for _, path := range c.Needs {
+			if commandmodel.FindCommand(root, path) == nil {
+				out = append(out, path)
+			}
+		}
+	}
+	return out
+}
+
+// ResolveWorkdir returns the absolute workdir, defaulting to the current directory.
+func ResolveWorkdir(workdir string) (string, error) {
+	wd := workdir
+	if wd == "" {
+		var err error
+		wd, err = os.Getwd()
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.Abs(wd)
+}
+
+// Variant returns the project as seen by a variant script: the config
+// filtered by the variant's include/exclude lists, named after the variant.
+func (p *Project) Variant(v settings.Variant) (*Project, error) {
+	cfg, err := bashlyconfig.FilterCommands(p.Config, v.Include, v.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("variant %s: %w", v.Name, err)
+	}
+	cfg["name"] = v.Name
+
+	root, err := commandmodel.BuildFromConfigMap(cfg, p.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("variant %s: %w", v.Name, err)
+	}
+	if err := commandmodel.Lint(root); err != nil {
+		return nil, fmt.Errorf("variant %s: %w", v.Name, err)
+	}
+	// The version and the help header are resolved after the config is
+	// built; the banner draws the name of the variant.
+	root.Version = p.Root.Version
+	if err := setHelpHeader(p.Workdir, p.Settings, root); err != nil {
+		return nil, fmt.Errorf("variant %s: %w", v.Name, err)
+	}
+	return &Project{Workdir: p.Workdir, Settings: p.Settings, Origins: p.Origins, Config: cfg, Root: root, Profile: p.Profile}, nil
+}
@@ -0,0 +1,48 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+func TestVariantKeepsResolvedVersion(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"settings.yml":   "version_source: file\nenable_help_banner: always\n",
+		"VERSION":        "9.9.9\n",
+		"src/bashly.yml": "name: cli\nversion: 0.0.1\ncommands:\n- name: serve\n- name: build\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := LoadWithOptions("", dir, Options{Env: settings.EnvMap{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Root.Version != "9.9.9" {
+		t.Fatalf("Root.Version = %q, want 9.9.9", p.Root.Version)
+	}
+	v, err := p.Variant(settings.Variant{Name: "cli-lite", Exclude: []string{"build"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Root.Version != "9.9.9" {
+		t.Errorf("variant Root.Version = %q, want 9.9.9", v.Root.Version)
+	}
+	if !strings.Contains(v.Root.HelpHeader, "cli-lite") || strings.Contains(p.Root.HelpHeader, "cli-lite") {
+		t.Errorf("variant HelpHeader = %q, want the caption of cli-lite", v.Root.HelpHeader)
+	}
+	if v.Root.HelpHeader == p.Root.HelpHeader {
+		t.Errorf("variant HelpHeader is the banner of the base script")
+	}
+}
@@ -0,0 +1,47 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// resolveVersion returns the version of the generated CLI according to the
+// version_source setting: the config's version key, the output of
+// git describe in the workdir, or the first line of version_file.
+func resolveVersion(ctx context.Context, wd string, st settings.Settings, configured string) (string, error) {
+	switch st.VersionSource {
+	case "git":
+		cmd := exec.CommandContext(ctx, "git", "describe", "--tags", "--always", "--dirty")
+		cmd.Dir = wd
+		out, err := cmd.Output()
+		if ctx.Err() != nil {
+			return "", context.Cause(ctx)
+		}
+		if err != nil {
+			return "", fmt.Errorf("version_source git: git describe failed: %w", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	case "file":
+		path := st.VersionFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(wd, path)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("version_source file: %w", err)
+		}
+		line, _, _ := strings.Cut(string(b), "\n")
+		if v := strings.TrimSpace(line); v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("version_source file: %s is empty", path)
+	default:
+		return configured, nil
+	}
+}
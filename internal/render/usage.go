@@ -7,130 +7,367 @@ import (
 	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
 )
 
-// PrintUsage renders plain-text help for a specific command.
-// Matches bashly_usage_render.elst.cue logic: name, description, usage line, args, flags, subcommands.
-func PrintUsage(cmd *commandmodel.Command) string {
+// UsageOptions controls usage rendering.
+type UsageOptions struct {
+	// RevealPrivate includes private commands, flags and environment variables.
+	RevealPrivate bool
+	// Strings overrides entries of DefaultStrings, e.g. with a translation.
+	Strings map[string]string
+	// AutoExamples fills the Examples section of commands that declare no
+	// examples with invocations built from their args and flags.
+	AutoExamples bool
+}
+
+// DefaultStrings holds the English help text labels, named as in Ruby
+// bashly. %{name} placeholders are replaced when rendering.
+var DefaultStrings = map[string]string{
+	"usage":                 "Usage:",
+	"arguments":             "Arguments:",
+	"options":               "Options:",
+	"commands":              "Commands:",
+	"environment_variables": "Environment Variables:",
+	"examples":              "Examples:",
+	"required":              "(required)",
+	"repeatable":            "(repeatable)",
+	"allowed":               "Allowed: %{values}",
+	"default":               "Default: %{value}",
+	"environment":           "Environment: %{var}",
+	"help_flag_text":        "Show this help",
+	"version_flag_text":     "Show version number",
+}
+
+// str returns the label for key with placeholders filled from params, given
+// as name/value pairs.
+func (o UsageOptions) str(key string, params ...string) string {
+	s, ok := o.Strings[key]
+	if !ok {
+		s = DefaultStrings[key]
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		s = strings.ReplaceAll(s, "%{"+params[i]+"}", params[i+1])
+	}
+	return s
+}
+
+// HasPrivate reports whether usage for cmd differs when private items are revealed.
+func HasPrivate(cmd *commandmodel.Command) bool {
+	if len(cmd.VisibleFlags(false)) != len(cmd.Flags) || len(cmd.VisibleEnvVars(false)) != len(cmd.EnvVars) {
+		return true
+	}
+	return len(visibleCommands(cmd, false)) != len(cmd.Commands)
+}
+
+// PrintUsage renders help for a command in the layout of Ruby bashly:
+// caption, usage lines, then the commands, options, arguments and
+// environment variables sections as aligned two-column listings.
+func PrintUsage(cmd *commandmodel.Command, opts UsageOptions) string {
+	return renderUsage(cmd, Caption(cmd), opts)
+}
+
+// Caption returns the first line of the help of cmd: its full name and
+// description.
+func Caption(cmd *commandmodel.Command) string {
+	caption := cmd.FullName
+	if cmd.Description != "" {
+		caption += " - " + cmd.Description
+	}
+	return caption
+}
+
+// PrintGlobalUsage renders help for the root command. A root HelpHeader
+// replaces the caption.
+func PrintGlobalUsage(root *commandmodel.Command, opts UsageOptions) string {
+	if root.HelpHeader != "" {
+		return renderUsage(root, strings.TrimRight(root.HelpHeader, "\n"), opts)
+	}
+	return PrintUsage(root, opts)
+}
+
+// row is one entry of a listing: the term, and the lines of its
+// description shown in the second column.
+type row struct {
+	term string
+	text []string
+}
+
+func renderUsage(cmd *commandmodel.Command, caption string, opts UsageOptions) string {
 	var b strings.Builder
+	b.WriteString(caption + "\n")
 
-	// Command header: name - description
-	desc := cmd.Description
-	if desc == "" {
-		desc = ""
+	subs := visibleCommands(cmd, opts.RevealPrivate)
+	flags := cmd.VisibleFlags(opts.RevealPrivate)
+	isRoot := len(cmd.Parents) == 0
+
+	b.WriteString("\n" + opts.str("usage") + "\n")
+	b.WriteString("  " + usageLine(cmd, len(subs) > 0, flags) + "\n")
+	if len(subs) > 0 {
+		b.WriteString("  " + cmd.FullName + " [COMMAND] --help | -h\n")
+	} else {
+		b.WriteString("  " + cmd.FullName + " --help | -h\n")
+	}
+	if isRoot && cmd.Version != "" {
+		b.WriteString("  " + cmd.FullName + " --version\n")
 	}
-	b.WriteString(fmt.Sprintf("%s - %s\n", cmd.Name, desc))
 
-	// Usage line: Usage: full_name [args...]
-	usageLine := "Usage: " + cmd.FullName
-	if len(cmd.Args) > 0 {
-		argNames := make([]string, 0, len(cmd.Args))
-		for _, arg := range cmd.Args {
-			argNames = append(argNames, arg.Name)
+	if len(subs) > 0 {
+		rows := make([]row, 0, len(subs))
+		for _, sub := range subs {
+			term := sub.Name
+			if len(sub.Alias) > 1 {
+				term += " (" + strings.Join(sub.Alias[1:], ", ") + ")"
+			}
+			rows = append(rows, row{term: term, text: lines(sub.Description)})
 		}
-		usageLine += " " + strings.Join(argNames, " ")
+		writeSection(&b, opts.str("commands"), rows)
 	}
-	b.WriteString(usageLine + "\n")
 
-	// Arguments section
-	if len(cmd.Args) > 0 {
-		b.WriteString("\nArguments:\n")
-		for _, arg := range cmd.Args {
-			line := "  " + arg.Name
-			if arg.Required {
-				line += " (required)"
-			}
-			b.WriteString("\n" + line)
+	rows := make([]row, 0, len(flags)+2)
+	for _, f := range flags {
+		term := strings.Join(f.Switches(), ", ")
+		if f.Arg != "" {
+			term += " " + strings.ToUpper(f.Arg)
+		}
+		help := withRequired(f.Help, f.Required, opts)
+		if f.Repeatable {
+			help = withMarker(help, opts.str("repeatable"))
+		}
+		text := lines(help)
+		if len(f.Allowed) > 0 {
+			text = append(text, opts.str("allowed", "values", strings.Join(f.Allowed, ", ")))
+		}
+		if defaults := f.DefaultValues(); len(defaults) > 0 {
+			text = append(text, opts.str("default", "value", strings.Join(defaults, ", ")))
+		}
+		if f.Env != "" {
+			text = append(text, opts.str("environment", "var", f.Env))
 		}
+		rows = append(rows, row{term: term, text: text})
 	}
+	rows = append(rows, row{term: "--help, -h", text: []string{opts.str("help_flag_text")}})
+	if isRoot && cmd.Version != "" {
+		rows = append(rows, row{term: "--version", text: []string{opts.str("version_flag_text")}})
+	}
+	writeSection(&b, opts.str("options"), rows)
 
-	// Flags section
-	if len(cmd.Flags) > 0 {
-		b.WriteString("\nFlags:\n")
-		for _, flag := range cmd.Flags {
-			line := "  "
-			if flag.Long != "" {
-				line += flag.Long
+	if len(cmd.Args) > 0 {
+		rows := make([]row, 0, len(cmd.Args))
+		for _, a := range cmd.Args {
+			text := lines(withRequired(a.Help, a.Required, opts))
+			if a.Default != "" {
+				text = append(text, opts.str("default", "value", a.Default))
 			}
-			if flag.Short != "" {
-				if flag.Long != "" {
-					line += ", "
-				}
-				line += flag.Short
+			if a.Env != "" {
+				text = append(text, opts.str("environment", "var", a.Env))
 			}
-			if flag.Required {
-				line += " (required)"
+			rows = append(rows, row{term: strings.ToUpper(a.Name), text: text})
+		}
+		writeSection(&b, opts.str("arguments"), rows)
+	}
+
+	if envVars := cmd.VisibleEnvVars(opts.RevealPrivate); len(envVars) > 0 {
+		rows := make([]row, 0, len(envVars))
+		for _, ev := range envVars {
+			text := lines(withRequired(ev.Help, ev.Required, opts))
+			if len(ev.Allowed) > 0 {
+				text = append(text, opts.str("allowed", "values", strings.Join(ev.Allowed, ", ")))
 			}
-			if len(flag.Allowed) > 0 {
-				line += " (allowed: " + strings.Join(flag.Allowed, ", ") + ")"
+			if ev.Default != "" {
+				text = append(text, opts.str("default", "value", ev.Default))
 			}
-			b.WriteString("\n" + line)
+			rows = append(rows, row{term: ev.Name, text: text})
 		}
+		writeSection(&b, opts.str("environment_variables"), rows)
 	}
 
-	// Subcommands section
-	if len(cmd.Commands) > 0 {
-		b.WriteString("\nCommands:\n")
-		for _, sub := range cmd.Commands {
-			line := "  " + sub.Name
-			if len(sub.Alias) > 1 {
-				line += " (" + strings.Join(sub.Alias[1:], ", ") + ")"
+	examples := cmd.Examples
+	if len(examples) == 0 && opts.AutoExamples {
+		examples = ExampleInvocations(cmd, opts.RevealPrivate)
+	}
+	if len(examples) > 0 {
+		b.WriteString("\n" + opts.str("examples") + "\n")
+		for _, ex := range examples {
+			for _, line := range lines(ex) {
+				b.WriteString("  " + line + "\n")
 			}
-			b.WriteString("\n" + line)
 		}
 	}
 
 	return b.String()
 }
 
-// PrintGlobalUsage renders top-level help for the root command.
-// Matches bashly_usage_render.elst.cue logic: name, description, usage line, commands, global flags.
-func PrintGlobalUsage(root *commandmodel.Command) string {
-	var b strings.Builder
+// ExampleInvocations synthesizes examples for a command without
+// subcommands: one with only its required args and flags, and, when it has
+// optional ones, one with every arg and flag. Flag values are the first
+// allowed value or the arg placeholder.
+func ExampleInvocations(cmd *commandmodel.Command, revealPrivate bool) []string {
+	if len(cmd.Commands) > 0 {
+		return nil
+	}
+	flagWords := func(f commandmodel.Flag) []string {
+		words := []string{f.Name()}
+		switch {
+		case len(f.Allowed) > 0:
+			words = append(words, f.Allowed[0])
+		case f.Arg != "":
+			words = append(words, strings.ToUpper(f.Arg))
+		}
+		return words
+	}
 
-	// Global header: name - description
-	desc := root.Description
-	if desc == "" {
-		desc = ""
+	minimal := []string{cmd.FullName}
+	full := []string{cmd.FullName}
+	optional := false
+	for _, a := range cmd.Args {
+		if a.Required {
+			minimal = append(minimal, strings.ToUpper(a.Name))
+		} else {
+			optional = true
+		}
+		full = append(full, strings.ToUpper(a.Name))
+	}
+	for _, f := range cmd.VisibleFlags(revealPrivate) {
+		if f.Required {
+			minimal = append(minimal, flagWords(f)...)
+		} else {
+			optional = true
+		}
+		full = append(full, flagWords(f)...)
+	}
+	if len(cmd.Forward) > 0 {
+		optional = true
+		full = append(full, "ARGS...")
 	}
-	b.WriteString(fmt.Sprintf("%s - %s\n", root.Name, desc))
 
-	// Global usage line
-	b.WriteString("\nUsage: " + root.Name + " <command> [options]\n")
+	examples := []string{strings.Join(minimal, " ")}
+	if optional {
+		examples = append(examples, strings.Join(full, " "))
+	}
+	return examples
+}
 
-	// Commands section
-	if len(root.Commands) > 0 {
-		b.WriteString("\nCommands:\n")
-		for _, sub := range root.Commands {
-			line := "  " + sub.Name
-			if len(sub.Alias) > 1 {
-				line += " (" + strings.Join(sub.Alias[1:], ", ") + ")"
-			}
-			b.WriteString("\n" + line)
+// usageLine returns the main usage line: required args bare, optional ones
+// in brackets, required flags with the placeholder of their value, an
+// [OPTIONS] token when the command has flags, and [ARGS...] when it forwards
+// the rest to another program.
+func usageLine(cmd *commandmodel.Command, hasCommands bool, flags []commandmodel.Flag) string {
+	parts := []string{cmd.FullName}
+	if hasCommands {
+		parts = append(parts, "COMMAND")
+	}
+	for _, a := range cmd.Args {
+		if a.Required {
+			parts = append(parts, strings.ToUpper(a.Name))
+		} else {
+			parts = append(parts, "["+strings.ToUpper(a.Name)+"]")
+		}
+	}
+	for _, f := range flags {
+		if !f.Required {
+			continue
 		}
+		part := f.Name()
+		if f.Arg != "" {
+			part += " " + strings.ToUpper(f.Arg)
+		}
+		parts = append(parts, part)
+	}
+	if len(flags) > 0 {
+		parts = append(parts, "[OPTIONS]")
 	}
+	if len(cmd.Forward) > 0 {
+		parts = append(parts, "[ARGS...]")
+	}
+	return strings.Join(parts, " ")
+}
 
-	// Global flags section
-	if len(root.Flags) > 0 {
-		b.WriteString("\nGlobal Flags:\n")
-		for _, flag := range root.Flags {
-			line := "  "
-			if flag.Long != "" {
-				line += flag.Long
-			}
-			if flag.Short != "" {
-				if flag.Long != "" {
-					line += ", "
-				}
-				line += flag.Short
+// CommandIndex lists every command below root, one line each: the command
+// path without the root name, its aliases and the first line of its
+// description, aligned like the help listings.
+func CommandIndex(root *commandmodel.Command, opts UsageOptions) []string {
+	var rows []row
+	var walk func(c *commandmodel.Command, path string)
+	walk = func(c *commandmodel.Command, path string) {
+		for _, sub := range visibleCommands(c, opts.RevealPrivate) {
+			term := strings.TrimSpace(path + " " + sub.Name)
+			if len(sub.Alias) > 1 {
+				term += " (" + strings.Join(sub.Alias[1:], ", ") + ")"
 			}
-			if flag.Required {
-				line += " (required)"
+			r := row{term: term}
+			if text := lines(sub.Description); len(text) > 0 {
+				r.text = text[:1]
 			}
-			if len(flag.Allowed) > 0 {
-				line += " (allowed: " + strings.Join(flag.Allowed, ", ") + ")"
+			rows = append(rows, r)
+			walk(sub, strings.TrimSpace(path+" "+sub.Name))
+		}
+	}
+	walk(root, "")
+	return formatRows(rows)
+}
+
+// writeSection writes a titled listing.
+func writeSection(b *strings.Builder, title string, rows []row) {
+	b.WriteString("\n" + title + "\n")
+	for _, line := range formatRows(rows) {
+		b.WriteString(line + "\n")
+	}
+}
+
+// formatRows indents rows by two spaces and aligns their descriptions two
+// spaces after the longest term.
+func formatRows(rows []row) []string {
+	width := 0
+	for _, r := range rows {
+		width = max(width, len(r.term))
+	}
+	var out []string
+	for _, r := range rows {
+		if len(r.text) == 0 {
+			out = append(out, "  "+r.term)
+			continue
+		}
+		for i, t := range r.text {
+			term := ""
+			if i == 0 {
+				term = r.term
 			}
-			b.WriteString("\n" + line)
+			out = append(out, fmt.Sprintf("  %-*s  %s", width, term, t))
 		}
 	}
+	return out
+}
 
-	return b.String()
+// withRequired appends the required marker to help.
+func withRequired(help string, required bool, opts UsageOptions) string {
+	if !required {
+		return help
+	}
+	return withMarker(help, opts.str("required"))
+}
+
+// withMarker appends marker to help, or returns it alone for empty help.
+func withMarker(help string, marker string) string {
+	if help == "" {
+		return marker
+	}
+	return help + " " + marker
+}
+
+// lines splits multi-line help text, dropping a trailing newline.
+func lines(s string) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func visibleCommands(cmd *commandmodel.Command, revealPrivate bool) []*commandmodel.Command {
+	out := make([]*commandmodel.Command, 0, len(cmd.Commands))
+	for _, sub := range cmd.Commands {
+		if sub.Private && !revealPrivate {
+			continue
+		}
+		out = append(out, sub)
+	}
+	return out
 }
@@ -0,0 +1,187 @@
+package runtime
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+)
+
+// UnknownCommandError is returned by ParseArgs when an argument should
+// name a subcommand of Parent but does not. Suggestions lists the
+// subcommand names and aliases closest to Name, best first.
+type UnknownCommandError struct {
+	Parent      *commandmodel.Command
+	Name        string
+	Suggestions []string
+}
+
+func (e *UnknownCommandError) Error() string {
+	if e.Name == "" {
+		return "unknown command"
+	}
+	return "invalid command: " + e.Name
+}
+
+// ExitCode is 1, as for any usage error of the generated script.
+func (e *UnknownCommandError) ExitCode() int { return 1 }
+
+// AmbiguousFlagError is returned by ParseArgs, with flag_abbreviations,
+// for a prefix of several long flags of Command.
+type AmbiguousFlagError struct {
+	Command    *commandmodel.Command
+	Name       string
+	Candidates []string
+}
+
+func (e *AmbiguousFlagError) Error() string {
+	return "ambiguous option: " + e.Name + " (could be " + strings.Join(e.Candidates, ", ") + ")"
+}
+
+// ExitCode is the validation_exit_code of the command, as for an invalid
+// option.
+func (e *AmbiguousFlagError) ExitCode() int { return e.Command.ExitCode }
+
+// MissingArgError reports a required arg of Command that was not given.
+type MissingArgError struct {
+	Command *commandmodel.Command
+	Arg     commandmodel.Arg
+}
+
+func (e *MissingArgError) Error() string {
+	return "missing required argument: " + e.Arg.Name
+}
+
+// ExitCode is the validation_exit_code of the command.
+func (e *MissingArgError) ExitCode() int { return e.Command.ExitCode }
+
+// MissingFlagError reports a required flag of Command that was not given.
+type MissingFlagError struct {
+	Command *commandmodel.Command
+	Flag    commandmodel.Flag
+}
+
+func (e *MissingFlagError) Error() string {
+	return "missing required flag: " + e.Flag.Name()
+}
+
+// ExitCode is the validation_exit_code of the command.
+func (e *MissingFlagError) ExitCode() int { return e.Command.ExitCode }
+
+// InvalidValueError reports a flag value outside the flag's allowed values.
+type InvalidValueError struct {
+	Command *commandmodel.Command
+	Flag    commandmodel.Flag
+	Value   string
+}
+
+func (e *InvalidValueError) Error() string {
+	return "invalid value for " + e.Flag.Name() + ": " + e.Value
+}
+
+// ExitCode is the validation_exit_code of the command.
+func (e *InvalidValueError) ExitCode() int { return e.Command.ExitCode }
+
+// MissingEnvVarError reports a required environment variable of Command
+// that is not set.
+type MissingEnvVarError struct {
+	Command *commandmodel.Command
+	EnvVar  commandmodel.EnvVar
+}
+
+func (e *MissingEnvVarError) Error() string {
+	return "missing required environment variable: " + e.EnvVar.Name
+}
+
+// ExitCode is the validation_exit_code of the command.
+func (e *MissingEnvVarError) ExitCode() int { return e.Command.ExitCode }
+
+// InvalidEnvVarError reports an environment variable whose value is outside
+// its allowed values or, when Message is set, fails one of its validate
+// functions, which printed Message.
+type InvalidEnvVarError struct {
+	Command *commandmodel.Command
+	EnvVar  commandmodel.EnvVar
+	Value   string
+	Message string
+}
+
+func (e *InvalidEnvVarError) Error() string {
+	if e.Message != "" {
+		return "validation error in " + e.EnvVar.Name + ": " + e.Message
+	}
+	return "invalid value for " + e.EnvVar.Name + ": " + e.Value
+}
+
+// ExitCode is the validation_exit_code of the command.
+func (e *InvalidEnvVarError) ExitCode() int { return e.Command.ExitCode }
+
+// ExitCode returns the exit status the generated script uses for err: the
+// ExitCode of the errors above, 0 for nil and 1 otherwise.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var coded interface{ ExitCode() int }
+	if errors.As(err, &coded) {
+		return coded.ExitCode()
+	}
+	return 1
+}
+
+// suggestCommands returns the names and aliases of the public subcommands
+// of parent within a few edits of name, or starting with it, closest
+// first.
+func suggestCommands(parent *commandmodel.Command, name string) []string {
+	dist := map[string]int{}
+	for _, c := range parent.Commands {
+		if c.Private {
+			continue
+		}
+		for _, candidate := range c.Alias {
+			if strings.HasSuffix(candidate, "*") {
+				continue
+			}
+			d := editDistance(name, candidate)
+			if d <= max(1, len(name)/3) || (len(name) > 1 && strings.HasPrefix(candidate, name)) {
+				if old, ok := dist[candidate]; !ok || d < old {
+					dist[candidate] = d
+				}
+			}
+		}
+	}
+	out := make([]string, 0, len(dist))
+	for candidate := range dist {
+		out = append(out, candidate)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if dist[out[i]] != dist[out[j]] {
+			return dist[out[i]] < dist[out[j]]
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
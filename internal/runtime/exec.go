@@ -0,0 +1,143 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/render"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// ExecOptions configures how a resolved command partial is executed.
+type ExecOptions struct {
+	Workdir string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+	// Libs is the merged lib code, for the validate functions of
+	// environment variables.
+	Libs string
+}
+
+// execPrelude is evaluated before the partial so that scaffolded partials
+// (which call inspect_args) keep working without a generated script.
+const execPrelude = `inspect_args() {
+  env | grep '^BASHLY_' | sort
+}
+`
+
+// Execute handles argv the way the generated script does: --version
+// prints the root version to opts.Stdout, --help returns the help text of
+// the resolved command (the global usage for the root) without running
+// anything, as does stopping at a command that requires a subcommand, with
+// exit code 1. Otherwise the command is validated and its partial run.
+// Validation errors are written to opts.Stderr and returned as the exit
+// code; argv naming no command is an error.
+func Execute(argv []string, root *commandmodel.Command, st settings.Settings, opts ExecOptions) (help string, code int, err error) {
+	p, err := ParseArgs(argv, root, st)
+	if err != nil {
+		return "", 1, err
+	}
+	if p.VersionAsked {
+		fmt.Fprintln(opts.Stdout, root.Version)
+		return "", 0, nil
+	}
+	if p.HelpAsked || p.SubcommandMissing {
+		usage := render.UsageOptions{RevealPrivate: st.RevealPrivate(), AutoExamples: st.Enabled(st.EnableAutoExamples)}
+		help = render.PrintUsage(p.Command, usage) + "\n"
+		if p.Command == root {
+			help = render.PrintGlobalUsage(root, usage) + "\n"
+		}
+		if p.SubcommandMissing {
+			return help, 1, nil
+		}
+		return help, 0, nil
+	}
+
+	p.Libs = opts.Libs
+	if res := ValidateParsed(p.Command, p); !res.Valid {
+		fmt.Fprintln(opts.Stderr, "ERROR:", res.ErrorMsg)
+		return "", res.ExitCode, nil
+	}
+	code, err = ExecPartial(p, st, opts)
+	return "", code, err
+}
+
+// ExecPartial runs the partial of the parsed command with bash.
+// Bound args and flags are exported as BASHLY_ARG_<NAME> and BASHLY_FLAG_<NAME>,
+// extra positional args are passed to the partial as "$@". The on_exit
+// function runs on exit when the partial defines it. A forwarding command
+// then execs its program with the forwarded arguments.
+// It returns the exit code of the partial or the program.
+func ExecPartial(p *ParsedArgs, st settings.Settings, opts ExecOptions) (int, error) {
+	cmd := p.Command
+	if cmd.Filename == "" {
+		return 1, fmt.Errorf("command %s has no partial", cmd.FullName)
+	}
+
+	path := cmd.PartialFile(opts.Workdir, st.SourceDir)
+	partial, err := os.ReadFile(path)
+	if err != nil {
+		return 1, fmt.Errorf("read partial %s: %w", path, err)
+	}
+
+	bound, extra := BindArgs(cmd, p.Positional)
+
+	env := os.Environ()
+	env = append(env, "BASHLY_COMMAND="+cmd.FullName)
+	for _, arg := range cmd.Args {
+		if v, ok := bound[arg.Name]; ok {
+			env = append(env, exportName("BASHLY_ARG_", arg.Name)+"="+v)
+		}
+	}
+	for _, flag := range cmd.Flags {
+		value, ok := p.Flags[flag.Name()]
+		if !ok {
+			continue
+		}
+		env = append(env, exportName("BASHLY_FLAG_", flag.Name())+"="+value)
+	}
+
+	script := execPrelude
+	if cmd.OnExit != "" {
+		// Libs are not loaded here, so the function may only exist when the
+		// partial defines it.
+		script += fmt.Sprintf("trap 'if declare -F %[1]s >/dev/null; then %[1]s; fi' EXIT\ntrap 'exit 130' INT\ntrap 'exit 143' TERM\n", cmd.OnExit)
+	}
+	script += string(partial)
+	if len(cmd.Forward) > 0 {
+		words := make([]string, 0, len(cmd.Forward))
+		for _, w := range cmd.Forward {
+			words = append(words, "'"+strings.ReplaceAll(w, "'", `'\''`)+"'")
+		}
+		script += "\nexec " + strings.Join(words, " ") + " \"$@\"\n"
+		extra = append(extra, p.Forwarded...)
+	}
+	argv := append([]string{"-c", script, path}, extra...)
+	c := exec.Command("bash", argv...)
+	c.Dir = opts.Workdir
+	c.Env = env
+	c.Stdin = opts.Stdin
+	c.Stdout = opts.Stdout
+	c.Stderr = opts.Stderr
+
+	if err := c.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return 1, fmt.Errorf("run partial %s: %w", path, err)
+	}
+	return 0, nil
+}
+
+// exportName converts an arg or flag name to an environment variable name,
+// e.g. "--dry-run" -> "BASHLY_FLAG_DRY_RUN".
+func exportName(prefix string, name string) string {
+	return prefix + commandmodel.VarName(name)
+}
@@ -1,7 +1,10 @@
 package runtime
 
 import (
-	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
@@ -11,54 +14,128 @@ import (
 // ParsedArgs represents the result of parsing command line arguments.
 type ParsedArgs struct {
 	Command    *commandmodel.Command
-	Flags      map[string]string // long/short flag -> value
+	Flags      map[string]string // canonical flag name (long, else short) -> value
 	Positional []string          // positional arguments
 	Remaining  []string          // arguments after command resolution
 	HelpAsked  bool              // true if --help or -h was present
+	// VersionAsked is true when argv starts with --version and the root
+	// declares a version.
+	VersionAsked bool
+	// Forwarded holds the arguments a forwarding command passes verbatim
+	// to its program.
+	Forwarded []string
+	// SubcommandMissing is true when argv stops at a command that requires
+	// a subcommand; its usage is shown instead of running it.
+	SubcommandMissing bool
+	// Values holds every value given to a repeatable flag with an arg, in
+	// order; Flags holds them shell-quoted and space-separated, like the
+	// args array of generated scripts.
+	Values map[string][]string
+	// Libs is the merged lib code the validate functions of environment
+	// variables are looked up in; Execute sets it from ExecOptions. A
+	// function it does not define passes every value.
+	Libs string
 }
 
 // ParseArgs parses argv according to bashly semantics.
-// It recognizes --help/-h globally, resolves command path, parses flags and positional args.
+// It resolves the command path, then parses flags and positional args; --help
+// or -h among them asks for the help of that command, as does a leading
+// --help for the command named after it.
+// A word naming no subcommand of a command that requires one is an
+// *UnknownCommandError. With flag_abbreviations, a prefix of several long
+// flags is an *AmbiguousFlagError.
 func ParseArgs(argv []string, root *commandmodel.Command, st settings.Settings) (*ParsedArgs, error) {
 	p := &ParsedArgs{
 		Flags:      make(map[string]string),
+		Values:     make(map[string][]string),
 		Positional: []string{},
 		Remaining:  []string{},
 	}
 
-	// 1) Global --help detection (before any command-specific parsing)
-	if contains(argv, "--help") || contains(argv, "-h") {
-		p.HelpAsked = true
+	if len(argv) > 0 && argv[0] == "--version" && root.Version != "" {
+		p.VersionAsked = true
 		p.Command = root
 		return p, nil
 	}
 
-	// 2) Resolve command path (first matching command/alias)
+	// 1) Resolve command path (first matching command/alias). A leading
+	// --help alone is for the root; followed by words, it is moved behind
+	// them, so it is for the command they name, like in the generated script
+	if len(argv) > 0 && (argv[0] == "--help" || argv[0] == "-h") {
+		if len(argv) == 1 {
+			p.HelpAsked = true
+			p.Command = root
+			return p, nil
+		}
+		argv = append(slices.Clone(argv[1:]), argv[0])
+	}
 	cmd, remaining := resolveCommandPath(root, argv)
 	if cmd == nil {
-		return nil, fmt.Errorf("unknown command")
+		return nil, &UnknownCommandError{Parent: root}
 	}
 	p.Command = cmd
 	p.Remaining = remaining
 
-	// 3) Parse flags and collect positional args from remaining args
-	parseFlagsAndArgs(p, remaining)
+	// A group needs a subcommand: leftover words are not positionals, and
+	// with only flags left its usage is shown
+	if cmd.RequireSubcommand {
+		if hasHelp(remaining) {
+			p.HelpAsked = true
+			return p, nil
+		}
+		if len(remaining) > 0 && !strings.HasPrefix(remaining[0], "-") {
+			return nil, &UnknownCommandError{Parent: cmd, Name: remaining[0], Suggestions: suggestCommands(cmd, remaining[0])}
+		}
+		p.SubcommandMissing = true
+		return p, nil
+	}
+
+	// 2) Parse flags and collect positional args from remaining args,
+	// stopping at --help
+	if len(cmd.Forward) > 0 {
+		parseForwarding(p, remaining)
+		if p.HelpAsked {
+			return p, nil
+		}
+	} else {
+		if err := parseFlagsAndArgs(p, remaining, st.FlagAbbreviations); err != nil {
+			return nil, err
+		}
+		if p.HelpAsked {
+			return p, nil
+		}
+	}
+
+	// 3) Fall back to the environment, then to defaults, for values not
+	// given, then apply declared normalizations before validation
+	applyEnvFallbacks(p)
+	applyDefaults(p)
+	normalizeValues(p)
 
 	return p, nil
 }
 
 // resolveCommandPath walks the command tree using argv and returns the matched command and leftover args.
+// Without arguments left, a default subcommand is entered; a forced default
+// is also entered when the next argument (a flag, say) names no command, and
+// receives that argument untouched.
 func resolveCommandPath(root *commandmodel.Command, argv []string) (*commandmodel.Command, []string) {
 	current := root
 	remaining := argv
 
-	for len(remaining) > 0 {
-		next := findChild(current, remaining[0])
-		if next == nil {
+	for {
+		if len(remaining) > 0 {
+			if next := findChild(current, remaining[0]); next != nil {
+				current = next
+				remaining = remaining[1:]
+				continue
+			}
+		}
+		def := current.DefaultCommand()
+		if def == nil || (len(remaining) > 0 && def.Default != "force") {
 			break
 		}
-		current = next
-		remaining = remaining[1:]
+		current = def
 	}
 
 	return current, remaining
@@ -73,7 +150,7 @@ func findChild(parent *commandmodel.Command, name string) *commandmodel.Command
 		}
 		// Alias match (including wildcards like c*)
 		for _, alias := range child.Alias {
-			if strings.HasPrefix(alias, "*") {
+			if strings.HasSuffix(alias, "*") {
 				prefix := strings.TrimSuffix(alias, "*")
 				if strings.HasPrefix(name, prefix) {
 					return child
@@ -87,88 +164,311 @@ func findChild(parent *commandmodel.Command, name string) *commandmodel.Command
 }
 
 // parseFlagsAndArgs parses flags and positional arguments from remaining args.
-func parseFlagsAndArgs(p *ParsedArgs, args []string) {
+// Declared flags take a value only when they have an arg and are stored under
+// their canonical name, so -o and --output land in the same entry; undeclared
+// flags take the next argument as value unless it looks like a flag. With
+// abbrev, a long flag may be given by an unambiguous prefix.
+func parseFlagsAndArgs(p *ParsedArgs, args []string, abbrev bool) error {
+	args = normalizeArgs(args)
+	var abbreviations map[string][]string
+	if abbrev {
+		abbreviations = p.Command.LongFlagAbbreviations("--help")
+	}
 	i := 0
 	for i < len(args) {
 		arg := args[i]
 
-		if strings.HasPrefix(arg, "--") {
-			// Long flag: --flag or --flag=value
-			if strings.Contains(arg, "=") {
-				parts := strings.SplitN(arg, "=", 2)
-				p.Flags[parts[0]] = parts[1]
-			} else {
-				if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
-					p.Flags[arg] = args[i+1]
-					i++
-				} else {
-					p.Flags[arg] = "true"
-				}
+		if arg == "--" {
+			p.Positional = append(p.Positional, args[i+1:]...)
+			break
+		}
+		if arg == "--help" || arg == "-h" {
+			p.HelpAsked = true
+			return nil
+		}
+
+		if names := abbreviations[arg]; len(names) > 1 {
+			return &AmbiguousFlagError{Command: p.Command, Name: arg, Candidates: names}
+		} else if len(names) == 1 {
+			if names[0] == "--help" {
+				p.HelpAsked = true
+				return nil
 			}
-		} else if strings.HasPrefix(arg, "-") && len(arg) > 1 {
-			// Short flags: -f value or -abc (compact)
-			if len(arg) == 2 {
-				if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
-					p.Flags[arg] = args[i+1]
+			arg = names[0]
+		}
+
+		if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			if f, ok := findFlag(p.Command, arg); ok {
+				if f.Arg != "" && i+1 < len(args) {
+					setFlag(p, f, args[i+1])
 					i++
 				} else {
-					p.Flags[arg] = "true"
+					setFlag(p, f, "true")
 				}
+			} else if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				p.Flags[arg] = args[i+1]
+				i++
 			} else {
-				// Compact: -abc => -a -b -c
-				for _, ch := range arg[1:] {
-					p.Flags["-"+string(ch)] = "true"
-				}
+				p.Flags[arg] = "true"
 			}
 		} else {
 			p.Positional = append(p.Positional, arg)
 		}
 		i++
 	}
+	return nil
 }
 
-// ValidateArgs checks required args/flags and allowed values.
-func ValidateArgs(p *ParsedArgs) error {
-	// Required arguments
-	for _, arg := range p.Command.Args {
-		if arg.Required && !contains(p.Positional, arg.Name) {
-			return fmt.Errorf("missing required argument: %s", arg.Name)
+// parseForwarding parses the args of a forwarding command: declared flags
+// and args are taken until the first other flag, an argument beyond the
+// declared args, or --; that argument (except --) and all after it are
+// forwarded untouched.
+func parseForwarding(p *ParsedArgs, args []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			p.Forwarded = append(p.Forwarded, args[i+1:]...)
+			return
+		case arg == "--help" || arg == "-h":
+			p.HelpAsked = true
+			return
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			f, ok := findFlag(p.Command, arg)
+			if !ok {
+				p.Forwarded = append(p.Forwarded, args[i:]...)
+				return
+			}
+			if f.Arg != "" && i+1 < len(args) {
+				setFlag(p, f, args[i+1])
+				i++
+			} else {
+				setFlag(p, f, "true")
+			}
+		case len(p.Positional) < len(p.Command.Args):
+			p.Positional = append(p.Positional, arg)
+		default:
+			p.Forwarded = append(p.Forwarded, args[i:]...)
+			return
+		}
+	}
+}
+
+// setFlag records value for the declared flag f. A repeatable boolean flag
+// counts its occurrences and a repeatable value flag collects its values.
+func setFlag(p *ParsedArgs, f commandmodel.Flag, value string) {
+	name := f.Name()
+	switch {
+	case !f.Repeatable:
+		p.Flags[name] = value
+	case f.Arg == "":
+		n, _ := strconv.Atoi(p.Flags[name])
+		p.Flags[name] = strconv.Itoa(n + 1)
+	default:
+		p.Values[name] = append(p.Values[name], value)
+		quoted := make([]string, len(p.Values[name]))
+		for i, v := range p.Values[name] {
+			quoted[i] = shellQuote(v)
+		}
+		p.Flags[name] = strings.Join(quoted, " ")
+	}
+}
+
+// shellQuote quotes s as a single word for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// normalizeArgs splits --flag=value and -f=value into two arguments and
+// expands short flag clusters (-abc => -a -b -c), so in -abco value only the
+// last flag receives the value. Arguments after -- are left untouched.
+func normalizeArgs(args []string) []string {
+	out := make([]string, 0, len(args))
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return append(out, args[i:]...)
+		case strings.HasPrefix(arg, "--") && strings.Contains(arg, "="):
+			parts := strings.SplitN(arg, "=", 2)
+			out = append(out, parts[0], parts[1])
+		case len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && arg[2] == '=':
+			out = append(out, arg[:2], arg[3:])
+		case len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && isAlnum(arg[1:]):
+			for _, ch := range arg[1:] {
+				out = append(out, "-"+string(ch))
+			}
+		default:
+			out = append(out, arg)
+		}
+	}
+	return out
+}
+
+// findFlag returns the flag of cmd declared with the given long or short name.
+func findFlag(cmd *commandmodel.Command, name string) (commandmodel.Flag, bool) {
+	for _, f := range cmd.Flags {
+		if (f.Long != "" && f.Long == name) || (f.Short != "" && f.Short == name) {
+			return f, true
 		}
 	}
+	return commandmodel.Flag{}, false
+}
 
-	// Required flags
-	for _, flag := range p.Command.Flags {
-		if flag.Required {
-			value := p.Flags[flag.Long]
-			if value == "" {
-				value = p.Flags[flag.Short]
+// applyEnvFallbacks fills args and value flags that were not given from the
+// environment variable they are bound to. Positional slots before an arg
+// taken from the environment are left empty, which counts as missing.
+func applyEnvFallbacks(p *ParsedArgs) {
+	for i, arg := range p.Command.Args {
+		if i < len(p.Positional) || arg.Env == "" {
+			continue
+		}
+		if v := os.Getenv(arg.Env); v != "" {
+			for len(p.Positional) < i {
+				p.Positional = append(p.Positional, "")
 			}
-			if value == "" {
-				name := flag.Long
-				if name == "" {
-					name = flag.Short
+			p.Positional = append(p.Positional, v)
+		}
+	}
+	for _, f := range p.Command.Flags {
+		if _, ok := p.Flags[f.Name()]; ok || f.Env == "" || f.Arg == "" {
+			continue
+		}
+		if v := os.Getenv(f.Env); v != "" {
+			p.Flags[f.Name()] = v
+		}
+	}
+}
+
+// applyDefaults fills args and value flags that are still unset with their
+// declared default; a repeatable flag gets each value of a list default.
+func applyDefaults(p *ParsedArgs) {
+	for i, arg := range p.Command.Args {
+		if arg.Default == "" || (i < len(p.Positional) && p.Positional[i] != "") {
+			continue
+		}
+		for len(p.Positional) <= i {
+			p.Positional = append(p.Positional, "")
+		}
+		p.Positional[i] = arg.Default
+	}
+	for _, f := range p.Command.Flags {
+		if _, ok := p.Flags[f.Name()]; ok {
+			continue
+		}
+		for _, def := range f.DefaultValues() {
+			setFlag(p, f, def)
+		}
+	}
+}
+
+// normalizeValues applies the normalize list of each declared arg and
+// value flag to its parsed value, like normalize_value in generated scripts.
+func normalizeValues(p *ParsedArgs) {
+	for i, arg := range p.Command.Args {
+		if i < len(p.Positional) {
+			p.Positional[i] = normalizeValue(p.Positional[i], arg.Normalize)
+		}
+	}
+	for _, f := range p.Command.Flags {
+		if v, ok := p.Flags[f.Name()]; ok && f.Arg != "" {
+			p.Flags[f.Name()] = normalizeValue(v, f.Normalize)
+		}
+	}
+}
+
+func normalizeValue(v string, ops []string) string {
+	for _, op := range ops {
+		switch op {
+		case "downcase":
+			v = strings.ToLower(v)
+		case "upcase":
+			v = strings.ToUpper(v)
+		case "strip":
+			v = strings.TrimSpace(v)
+		case "expand_path":
+			if home, err := os.UserHomeDir(); err == nil {
+				if v == "~" {
+					v = home
+				} else if strings.HasPrefix(v, "~/") {
+					v = filepath.Join(home, v[2:])
 				}
-				return fmt.Errorf("missing required flag: %s", name)
 			}
+			if abs, err := filepath.Abs(v); err == nil && v != "" {
+				v = abs
+			}
+		}
+	}
+	return v
+}
+
+func isAlnum(s string) bool {
+	for _, ch := range s {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9') {
+			return false
 		}
 	}
+	return true
+}
 
-	// Allowed values
-	for _, flag := range p.Command.Flags {
-		value := p.Flags[flag.Long]
-		if value == "" {
-			value = p.Flags[flag.Short]
+// ValidateArgs checks required args/flags and allowed values, then the
+// environment variables of the command as the generated script does, with
+// their defaults applied. It returns a *MissingArgError, *MissingFlagError,
+// *InvalidValueError, *MissingEnvVarError or *InvalidEnvVarError for the
+// first failure; an arg or variable left empty counts as missing.
+func ValidateArgs(p *ParsedArgs) error {
+	cmd := p.Command
+	for i, arg := range cmd.Args {
+		if arg.Required && (i >= len(p.Positional) || p.Positional[i] == "") {
+			return &MissingArgError{Command: cmd, Arg: arg}
+		}
+	}
+	for _, flag := range cmd.Flags {
+		if flag.Required && p.Flags[flag.Name()] == "" {
+			return &MissingFlagError{Command: cmd, Flag: flag}
 		}
-		if value != "" && len(flag.Allowed) > 0 && !contains(flag.Allowed, value) {
-			name := flag.Long
-			if name == "" {
-				name = flag.Short
+	}
+	for _, flag := range cmd.Flags {
+		values := []string{p.Flags[flag.Name()]}
+		if flag.Repeatable {
+			values = p.Values[flag.Name()]
+		}
+		for _, value := range values {
+			if value != "" && len(flag.Allowed) > 0 && !contains(flag.Allowed, value) {
+				return &InvalidValueError{Command: cmd, Flag: flag, Value: value}
 			}
-			return fmt.Errorf("invalid value for %s: %s", name, value)
 		}
 	}
+	return validateEnvVars(p)
+}
 
-	return nil
+// BindArgs maps positional values to the command's declared args in order.
+// Values beyond the declared args are returned as extra (other) args.
+func BindArgs(cmd *commandmodel.Command, positional []string) (map[string]string, []string) {
+	bound := make(map[string]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		if i >= len(positional) {
+			break
+		}
+		bound[arg.Name] = positional[i]
+	}
+	var extra []string
+	if len(positional) > len(cmd.Args) {
+		extra = append(extra, positional[len(cmd.Args):]...)
+	}
+	return bound, extra
+}
+
+// hasHelp reports whether args hold --help or -h before any --.
+func hasHelp(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "--":
+			return false
+		case "--help", "-h":
+			return true
+		}
+	}
+	return false
 }
 
 // contains is a small helper for string slice membership.
@@ -0,0 +1,136 @@
+package runtime
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+	"gopkg.in/yaml.v3"
+)
+
+// forwardingConfig has a forced default command taking a flag with a value,
+// a boolean flag and an arg, next to a regular command, and a group with a
+// plain default.
+const forwardingConfig = `
+name: cli
+version: 0.1.0
+commands:
+- name: serve
+  default: force
+  args:
+  - name: target
+  flags:
+  - long: --port
+    short: -p
+    arg: port
+  - long: --verbose
+- name: build
+  alias: b
+  flags:
+  - long: --out
+    arg: out
+- name: db
+  commands:
+  - name: status
+    default: true
+  - name: migrate
+`
+
+func buildTree(t *testing.T, config string) *commandmodel.Command {
+	t.Helper()
+	var cfg map[string]any
+	if err := yaml.Unmarshal([]byte(config), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	root, err := commandmodel.BuildFromConfigMap(cfg, settings.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestResolveCommandPath(t *testing.T) {
+	root := buildTree(t, forwardingConfig)
+	tests := []struct {
+		name     string
+		argv     []string
+		wantCmd  string
+		wantRest []string
+	}{
+		{"no args enters the forced default", nil, "cli serve", nil},
+		{"flag with value is forwarded", []string{"--port", "80"}, "cli serve", []string{"--port", "80"}},
+		{"short flag is forwarded", []string{"-p", "80", "x"}, "cli serve", []string{"-p", "80", "x"}},
+		{"unknown word is forwarded", []string{"x", "--verbose"}, "cli serve", []string{"x", "--verbose"}},
+		{"help is forwarded", []string{"--port", "80", "--help"}, "cli serve", []string{"--port", "80", "--help"}},
+		{"named default", []string{"serve", "--port", "80"}, "cli serve", []string{"--port", "80"}},
+		{"other command", []string{"build", "--out", "o"}, "cli build", []string{"--out", "o"}},
+		{"alias", []string{"b"}, "cli build", []string{}},
+		{"flag value naming a command is not a command", []string{"--port", "build"}, "cli serve", []string{"--port", "build"}},
+		{"plain default without args", []string{"db"}, "cli db status", []string{}},
+		{"plain default is not entered with args", []string{"db", "--all"}, "cli db", []string{"--all"}},
+		{"subcommand of group", []string{"db", "migrate"}, "cli db migrate", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, rest := resolveCommandPath(root, tt.argv)
+			if cmd.FullName != tt.wantCmd {
+				t.Errorf("command = %q, want %q", cmd.FullName, tt.wantCmd)
+			}
+			if len(rest) != len(tt.wantRest) || (len(rest) > 0 && !reflect.DeepEqual(rest, tt.wantRest)) {
+				t.Errorf("remaining = %q, want %q", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestParseArgsForcedDefault(t *testing.T) {
+	root := buildTree(t, forwardingConfig)
+	tests := []struct {
+		name        string
+		argv        string
+		wantCmd     string
+		wantHelp    bool
+		wantFlags   map[string]string
+		wantPos     []string
+		wantVersion bool
+	}{
+		{name: "flag with value", argv: "--port 80", wantCmd: "cli serve", wantFlags: map[string]string{"--port": "80"}},
+		{name: "flag then arg", argv: "--port 80 x", wantCmd: "cli serve", wantFlags: map[string]string{"--port": "80"}, wantPos: []string{"x"}},
+		{name: "arg then flag", argv: "x --verbose", wantCmd: "cli serve", wantFlags: map[string]string{"--verbose": "true"}, wantPos: []string{"x"}},
+		{name: "leading help is for the root", argv: "--help", wantCmd: "cli", wantHelp: true},
+		{name: "help after a forwarded flag is for the default", argv: "--port 80 --help", wantCmd: "cli serve", wantHelp: true},
+		{name: "leading help before a command", argv: "--help build", wantCmd: "cli build", wantHelp: true},
+		{name: "named default with help", argv: "serve --help", wantCmd: "cli serve", wantHelp: true},
+		{name: "version", argv: "--version", wantCmd: "cli", wantVersion: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseArgs(strings.Fields(tt.argv), root, settings.Default())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Command.FullName != tt.wantCmd {
+				t.Errorf("command = %q, want %q", p.Command.FullName, tt.wantCmd)
+			}
+			if p.HelpAsked != tt.wantHelp {
+				t.Errorf("HelpAsked = %v, want %v", p.HelpAsked, tt.wantHelp)
+			}
+			if p.VersionAsked != tt.wantVersion {
+				t.Errorf("VersionAsked = %v, want %v", p.VersionAsked, tt.wantVersion)
+			}
+			if tt.wantHelp || tt.wantVersion {
+				return
+			}
+			for name, want := range tt.wantFlags {
+				if got := p.Flags[name]; got != want {
+					t.Errorf("flag %s = %q, want %q", name, got, want)
+				}
+			}
+			if len(p.Positional) != len(tt.wantPos) || (len(p.Positional) > 0 && !reflect.DeepEqual(p.Positional, tt.wantPos)) {
+				t.Errorf("positional = %q, want %q", p.Positional, tt.wantPos)
+			}
+		})
+	}
+}
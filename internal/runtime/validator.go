@@ -1,6 +1,10 @@
 package runtime
 
 import (
+	"os"
+	"os/exec"
+	"strings"
+
 	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
 )
 
@@ -9,61 +13,66 @@ type ValidateResult struct {
 	Valid    bool
 	ErrorMsg string
 	ExitCode int
+	// Err is the typed error of ValidateArgs behind ErrorMsg.
+	Err error
 }
 
-// ValidateParsed checks required args/flags and allowed values.
+// ValidateParsed checks required args/flags, allowed values and the
+// environment variables of cmd. Failures carry the command's
+// validation_exit_code.
 // Matches bashly_validation_ux.elst.cue logic: required args, required flags, allowed values.
 func ValidateParsed(cmd *commandmodel.Command, parsed *ParsedArgs) ValidateResult {
-	// Check required arguments
-	for _, arg := range cmd.Args {
-		if arg.Required && !contains(parsed.Positional, arg.Name) {
-			return ValidateResult{
-				Valid:    false,
-				ErrorMsg: "missing required argument: " + arg.Name,
-				ExitCode: 2,
-			}
-		}
+	p := *parsed
+	p.Command = cmd
+	if err := ValidateArgs(&p); err != nil {
+		return ValidateResult{Valid: false, ErrorMsg: err.Error(), ExitCode: ExitCode(err), Err: err}
 	}
+	return ValidateResult{Valid: true, ErrorMsg: "", ExitCode: 0}
+}
 
-	// Check required flags
-	for _, flag := range cmd.Flags {
-		if flag.Required {
-			value := parsed.Flags[flag.Long]
-			if value == "" {
-				value = parsed.Flags[flag.Short]
-			}
-			if value == "" {
-				name := flag.Long
-				if name == "" {
-					name = flag.Short
-				}
-				return ValidateResult{
-					Valid:    false,
-					ErrorMsg: "missing required flag: " + name,
-					ExitCode: 2,
-				}
-			}
+// validateEnvVars checks the environment variables of p.Command: required
+// ones must be set, and set ones must be allowed and pass their validate
+// functions.
+func validateEnvVars(p *ParsedArgs) error {
+	cmd := p.Command
+	for _, ev := range cmd.EnvVars {
+		if ev.Required && envValue(ev) == "" {
+			return &MissingEnvVarError{Command: cmd, EnvVar: ev}
 		}
 	}
-
-	// Check allowed values
-	for _, flag := range cmd.Flags {
-		value := parsed.Flags[flag.Long]
+	for _, ev := range cmd.EnvVars {
+		value := envValue(ev)
 		if value == "" {
-			value = parsed.Flags[flag.Short]
+			continue
 		}
-		if value != "" && len(flag.Allowed) > 0 && !contains(flag.Allowed, value) {
-			name := flag.Long
-			if name == "" {
-				name = flag.Short
-			}
-			return ValidateResult{
-				Valid:    false,
-				ErrorMsg: "invalid value for " + name + ": " + value,
-				ExitCode: 2,
+		if len(ev.Allowed) > 0 && !contains(ev.Allowed, value) {
+			return &InvalidEnvVarError{Command: cmd, EnvVar: ev, Value: value}
+		}
+		for _, fn := range ev.Validate {
+			if msg := runValidate(p.Libs, fn, value); msg != "" {
+				return &InvalidEnvVarError{Command: cmd, EnvVar: ev, Value: value, Message: msg}
 			}
 		}
 	}
+	return nil
+}
 
-	return ValidateResult{Valid: true, ErrorMsg: "", ExitCode: 0}
+// envValue returns the value of ev, or its default when it is not set.
+func envValue(ev commandmodel.EnvVar) string {
+	if v := os.Getenv(ev.Name); v != "" {
+		return v
+	}
+	return ev.Default
+}
+
+// runValidate calls validate_<fn> from libs on value with bash and returns
+// what it printed, without trailing newlines, as command substitution in
+// the generated script does. Its exit status is ignored there too.
+func runValidate(libs string, fn string, value string) string {
+	if libs == "" {
+		return ""
+	}
+	script := libs + "\nif declare -F validate_" + fn + " >/dev/null; then validate_" + fn + " \"$1\"; fi\n"
+	out, _ := exec.Command("bash", "-c", script, "bashly", value).Output()
+	return strings.TrimRight(string(out), "\n")
 }
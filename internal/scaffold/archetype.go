@@ -0,0 +1,140 @@
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/configedit"
+)
+
+//go:embed archetypes/*.yml
+var archetypeFiles embed.FS
+
+// DefaultArchetype is the archetype of add command without --template.
+const DefaultArchetype = "basic"
+
+// ArchetypeDir is where a project keeps archetypes of its own, relative to
+// its source dir. One there replaces the built-in of the same name.
+const ArchetypeDir = "archetypes"
+
+// Archetypes returns the names of the built-in archetypes and of those in
+// srcDir, sorted.
+func Archetypes(srcDir string) []string {
+	seen := map[string]bool{}
+	entries, _ := archetypeFiles.ReadDir("archetypes")
+	own, _ := os.ReadDir(filepath.Join(srcDir, ArchetypeDir))
+	for _, e := range append(entries, own...) {
+		if name, ok := strings.CutSuffix(e.Name(), ".yml"); ok && !e.IsDir() {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Archetype returns the template text of the named archetype: the one in
+// srcDir when there is one, the built-in otherwise.
+func Archetype(srcDir string, name string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(srcDir, ArchetypeDir, name+".yml"))
+	if err == nil {
+		return string(b), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	b, err = archetypeFiles.ReadFile("archetypes/" + name + ".yml")
+	if err != nil {
+		return "", fmt.Errorf("unknown template %q (expected %s)", name, strings.Join(Archetypes(srcDir), ", "))
+	}
+	return string(b), nil
+}
+
+// ArchetypeData is passed to archetype templates.
+type ArchetypeData struct {
+	Name string
+	Help string
+}
+
+// RenderArchetype fills in an archetype template. The result must be a
+// YAML list of commands, each with a name.
+func RenderArchetype(text string, data ArchetypeData) ([]byte, error) {
+	if !validName.MatchString(data.Name) {
+		return nil, fmt.Errorf("%q is not a valid command name: use lowercase letters, digits, - and _", data.Name)
+	}
+	funcs := template.FuncMap{"yaml": func(s string) string {
+		b, _ := yaml.Marshal(s)
+		return strings.TrimSuffix(string(b), "\n")
+	}}
+	tmpl, err := template.New("archetype").Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("render template: %w", err)
+	}
+	if _, err := CommandNames(b.Bytes()); err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// CommandNames returns the names of the commands of a YAML list.
+func CommandNames(list []byte) ([]string, error) {
+	var cmds []map[string]any
+	if err := yaml.Unmarshal(list, &cmds); err != nil || len(cmds) == 0 {
+		return nil, fmt.Errorf("expected a YAML list of commands")
+	}
+	var names []string
+	for _, c := range cmds {
+		name, ok := c["name"].(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("every command needs a name")
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// AppendCommands returns config, the text of a bashly.yml, with the
+// commands of the YAML list added to the commands of the command at
+// parent, a path of command names below the root. The text is inserted
+// after the last of those commands, at their indent, so comments and
+// layout are kept. A command of the same name already there is an error.
+func AppendCommands(config []byte, parent []string, list []byte) ([]byte, error) {
+	names, err := CommandNames(list)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := configedit.Parse(config)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	for i := range parent {
+		if doc.Lookup(configedit.CommandPath(parent[:i+1]...)) == nil {
+			return nil, fmt.Errorf("no command %q in the config file (commands from imports cannot be extended)", strings.Join(parent[:i+1], " "))
+		}
+	}
+	for _, name := range names {
+		if doc.Lookup(configedit.CommandPath(append(slices.Clone(parent), name)...)) != nil {
+			return nil, fmt.Errorf("command %q already exists", strings.Join(append(slices.Clone(parent), name), " "))
+		}
+	}
+	if err := doc.Append(append(configedit.CommandPath(parent...), "commands"), list); err != nil {
+		return nil, err
+	}
+	return doc.Bytes(), nil
+}
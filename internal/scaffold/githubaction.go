@@ -0,0 +1,182 @@
+package scaffold
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+)
+
+// ActionScript is a generated script checked by the GitHub Actions
+// workflow: its path, relative to the project dir and slash-separated, and
+// its command tree.
+type ActionScript struct {
+	Path string
+	Root *commandmodel.Command
+}
+
+// ActionOptions describes the project the workflow of WriteGitHubAction
+// checks.
+type ActionOptions struct {
+	// Name names the workflow and its file.
+	Name string
+	// Dir is the project dir relative to the repository root, "." for the
+	// root itself.
+	Dir     string
+	Scripts []ActionScript
+	// Shellcheck is false for scripts shellcheck cannot read (zsh).
+	Shellcheck bool
+	// CheckVersion tests the output of --version, which is only known in
+	// advance when the version comes from the config.
+	CheckVersion bool
+	// CheckMissing tests that a missing required arg fails; off when the
+	// script prompts for it instead.
+	CheckMissing bool
+	// GoBashlyVersion is the module version of go-bashly the workflow
+	// installs, such as latest or v0.1.0.
+	GoBashlyVersion string
+}
+
+// WriteGitHubAction writes the workflow to
+// repoDir/.github/workflows/<name>.yml and a bats file per script to the
+// test dir of the project, and returns the files written. Existing files
+// are an error unless force is set.
+func WriteGitHubAction(repoDir string, o ActionOptions, force bool) ([]string, error) {
+	files := []file{{filepath.Join(repoDir, ".github", "workflows", o.Name+".yml"), GitHubWorkflow(o)}}
+	for _, s := range o.Scripts {
+		files = append(files, file{filepath.Join(repoDir, filepath.FromSlash(o.Dir), "test", path.Base(s.Path)+".bats"), BatsTests(s, o)})
+	}
+	return writeFiles(files, force)
+}
+
+// GitHubWorkflow returns a workflow that installs go-bashly and, for every
+// script, fails when it differs from what generate writes, then runs
+// shellcheck and the bats tests on it.
+func GitHubWorkflow(o ActionOptions) []byte {
+	b := &strings.Builder{}
+	b.WriteString("# Written by go-bashly add github-action; edit it as needed.\n")
+	fmt.Fprintf(b, "name: %s\n\n", o.Name)
+	b.WriteString("on:\n  push:\n  pull_request:\n\n")
+	b.WriteString("jobs:\n")
+	b.WriteString("  check:\n")
+	b.WriteString("    runs-on: ubuntu-latest\n")
+	if o.Dir != "." {
+		fmt.Fprintf(b, "    defaults:\n      run:\n        working-directory: %s\n", o.Dir)
+	}
+	b.WriteString("    steps:\n")
+	b.WriteString("      - uses: actions/checkout@v4\n")
+	b.WriteString("      - uses: actions/setup-go@v5\n")
+	b.WriteString("        with:\n")
+	b.WriteString("          go-version: stable\n")
+	b.WriteString("      - name: Install go-bashly\n")
+	fmt.Fprintf(b, "        run: go install github.com/dimitar-trifonov/go-bashly@%s\n", o.GoBashlyVersion)
+
+	paths := make([]string, 0, len(o.Scripts))
+	for _, s := range o.Scripts {
+		paths = append(paths, s.Path)
+	}
+	scripts := strings.Join(paths, " ")
+	b.WriteString("      - name: Check that the generated script is up to date\n")
+	b.WriteString("        run: |\n")
+	b.WriteString("          go-bashly generate --force --skip-partials\n")
+	fmt.Fprintf(b, "          if [ -n \"$(git status --porcelain -- %s)\" ]; then\n", scripts)
+	fmt.Fprintf(b, "            git diff -- %s\n", scripts)
+	b.WriteString("            echo \"::error::run go-bashly generate and commit the result\"\n")
+	b.WriteString("            exit 1\n")
+	b.WriteString("          fi\n")
+	if o.Shellcheck {
+		b.WriteString("      - name: Shellcheck\n")
+		fmt.Fprintf(b, "        run: shellcheck %s\n", scripts)
+	}
+	b.WriteString("      - name: Install bats\n")
+	b.WriteString("        run: sudo apt-get update && sudo apt-get install -y bats\n")
+	tests := make([]string, 0, len(o.Scripts))
+	for _, s := range o.Scripts {
+		tests = append(tests, "test/"+path.Base(s.Path)+".bats")
+	}
+	b.WriteString("      - name: Bats\n")
+	fmt.Fprintf(b, "        run: bats %s\n", strings.Join(tests, " "))
+	return []byte(b.String())
+}
+
+// BatsTests returns bats tests for the public commands of a script: each
+// prints its help, the root its version, and a command without a required
+// arg fails with its validation_exit_code.
+func BatsTests(s ActionScript, o ActionOptions) []byte {
+	b := &strings.Builder{}
+	b.WriteString("#!/usr/bin/env bats\n")
+	fmt.Fprintf(b, "# Written by go-bashly add github-action from the commands of %s.\n\n", s.Root.Name)
+	b.WriteString("setup() {\n")
+	fmt.Fprintf(b, "  cli=\"$BATS_TEST_DIRNAME/../%s\"\n", s.Path)
+	b.WriteString("}\n")
+
+	root := s.Root
+	if root.Version != "" {
+		fmt.Fprintf(b, "\n@test \"%s --version\" {\n", root.Name)
+		b.WriteString("  run \"$cli\" --version\n")
+		b.WriteString("  [ \"$status\" -eq 0 ]\n")
+		if o.CheckVersion {
+			// The last line: view markers may come first.
+			fmt.Fprintf(b, "  [ \"${lines[-1]}\" = %s ]\n", quote(root.Version))
+		}
+		b.WriteString("}\n")
+	}
+
+	var walk func(c *commandmodel.Command)
+	walk = func(c *commandmodel.Command) {
+		call := "run \"$cli\""
+		for _, w := range append(append([]string{}, c.Parents...), c.Name)[1:] {
+			call += " " + word(w)
+		}
+
+		fmt.Fprintf(b, "\n@test \"%s --help\" {\n", c.FullName)
+		fmt.Fprintf(b, "  %s --help\n", call)
+		b.WriteString("  [ \"$status\" -eq 0 ]\n")
+		fmt.Fprintf(b, "  [[ \"$output\" == *%s* ]]\n", quote(c.FullName))
+		b.WriteString("}\n")
+
+		if arg, ok := missingArg(c); ok && o.CheckMissing {
+			fmt.Fprintf(b, "\n@test \"%s without %s\" {\n", c.FullName, strings.ToUpper(arg.Name))
+			fmt.Fprintf(b, "  %s\n", call)
+			fmt.Fprintf(b, "  [ \"$status\" -eq %d ]\n", c.ExitCode)
+			b.WriteString("}\n")
+		}
+
+		for _, child := range c.Commands {
+			if !child.Private {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+	return []byte(b.String())
+}
+
+// missingArg returns the first required arg of c when running c without
+// arguments is sure to fail on it: c has no subcommands or dependencies,
+// and the arg has no environment variable to fall back on.
+func missingArg(c *commandmodel.Command) (commandmodel.Arg, bool) {
+	if len(c.Commands) > 0 || len(c.Deps) > 0 || len(c.Args) == 0 {
+		return commandmodel.Arg{}, false
+	}
+	arg := c.Args[0]
+	return arg, arg.Required && arg.Env == ""
+}
+
+var plainWord = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+// word returns s as a shell word, quoted unless it is plain.
+func word(s string) string {
+	if plainWord.MatchString(s) {
+		return s
+	}
+	return quote(s)
+}
+
+// quote wraps s in single quotes for the shell.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,260 @@
+package scaffold
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Answers describes the project written by Write.
+type Answers struct {
+	Name     string
+	Help     string
+	Commands []CommandAnswer
+	Libs     []string // keys of Libs
+}
+
+// CommandAnswer is one top-level command of a new project.
+type CommandAnswer struct {
+	Name string
+	Help string
+}
+
+// Libs holds the lib files init can add to src/lib, by name.
+var Libs = map[string]string{
+	"colors": `## Color functions: red, green, yellow, blue and bold wrap their
+## arguments in ANSI colors unless NO_COLOR is set.
+print_in_color() {
+  color="$1"
+  shift
+  if [ -z "${NO_COLOR:-}" ]; then
+    printf "\033[%sm%b\033[0m\n" "$color" "$*"
+  else
+    printf "%b\n" "$*"
+  fi
+}
+
+red() { print_in_color "31" "$*"; }
+green() { print_in_color "32" "$*"; }
+yellow() { print_in_color "33" "$*"; }
+blue() { print_in_color "34" "$*"; }
+bold() { print_in_color "1" "$*"; }
+`,
+	"confirm": `## Ask a yes/no question: confirm "Delete all files?" && rm -rf ...
+confirm() {
+  printf "%s [y/N] " "$1" >&2
+  read -r reply || return 1
+  case "$reply" in
+    y | Y | yes | YES) return 0 ;;
+    *) return 1 ;;
+  esac
+}
+`,
+	"log": `## Logging functions printing to stderr; log_debug prints only when
+## DEBUG is set.
+log_info() { printf "info: %s\n" "$*" >&2; }
+log_warn() { printf "warning: %s\n" "$*" >&2; }
+log_error() { printf "error: %s\n" "$*" >&2; }
+log_debug() { [ -z "${DEBUG:-}" ] || printf "debug: %s\n" "$*" >&2; }
+`,
+}
+
+// LibNames returns the names of Libs, sorted.
+func LibNames() []string {
+	names := make([]string, 0, len(Libs))
+	for name := range Libs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Defaults returns the answers used without the wizard: a CLI named after
+// the workdir, without commands or libs.
+func Defaults(workdir string) Answers {
+	name := strings.ToLower(filepath.Base(workdir))
+	if !validName.MatchString(name) {
+		name = "mycli"
+	}
+	return Answers{Name: name, Help: name + " command line tool"}
+}
+
+// Ask prompts for the answers on out and reads them from in, one line per
+// question; an empty line keeps the default. Invalid names are asked
+// again. At the end of the input the remaining questions keep their
+// defaults.
+func Ask(in io.Reader, out io.Writer, defaults Answers) (Answers, error) {
+	r := bufio.NewReader(in)
+	a := defaults
+
+	ask := func(question string, def string) (string, error) {
+		if def != "" {
+			fmt.Fprintf(out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(out, "%s: ", question)
+		}
+		line, err := r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		if errors.Is(err, io.EOF) && line == "" {
+			fmt.Fprintln(out)
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			return def, nil
+		}
+		return line, nil
+	}
+
+	for {
+		name, err := ask("CLI name", a.Name)
+		if err != nil {
+			return a, err
+		}
+		if validName.MatchString(name) {
+			a.Name = name
+			break
+		}
+		fmt.Fprintf(out, "%q is not a valid name: use lowercase letters, digits, - and _\n", name)
+	}
+
+	var err error
+	if a.Help, err = ask("Description", a.Help); err != nil {
+		return a, err
+	}
+
+	for {
+		line, err := ask("Commands, separated by spaces (empty for none)", "")
+		if err != nil {
+			return a, err
+		}
+		var bad []string
+		names := strings.Fields(line)
+		for _, name := range names {
+			if !validName.MatchString(name) {
+				bad = append(bad, name)
+			}
+		}
+		if len(bad) == 0 {
+			a.Commands = nil
+			for _, name := range names {
+				a.Commands = append(a.Commands, CommandAnswer{Name: name})
+			}
+			break
+		}
+		fmt.Fprintf(out, "not valid command names: %s\n", strings.Join(bad, ", "))
+	}
+	for i, c := range a.Commands {
+		if a.Commands[i].Help, err = ask(fmt.Sprintf("Help for %s", c.Name), strings.ToUpper(c.Name[:1])+c.Name[1:]+" command"); err != nil {
+			return a, err
+		}
+	}
+
+	for {
+		line, err := ask(fmt.Sprintf("Libraries (%s), separated by spaces", strings.Join(LibNames(), ", ")), strings.Join(a.Libs, " "))
+		if err != nil {
+			return a, err
+		}
+		var bad []string
+		libs := strings.Fields(strings.ReplaceAll(line, ",", " "))
+		for _, lib := range libs {
+			if _, ok := Libs[lib]; !ok {
+				bad = append(bad, lib)
+			}
+		}
+		if len(bad) == 0 {
+			a.Libs = libs
+			break
+		}
+		fmt.Fprintf(out, "unknown libraries: %s\n", strings.Join(bad, ", "))
+	}
+	return a, nil
+}
+
+type configFile struct {
+	Name     string        `yaml:"name"`
+	Help     string        `yaml:"help,omitempty"`
+	Version  string        `yaml:"version"`
+	Commands []commandFile `yaml:"commands,omitempty"`
+}
+
+type commandFile struct {
+	Name string `yaml:"name"`
+	Help string `yaml:"help,omitempty"`
+}
+
+// Config returns the bashly.yml of a new project.
+func Config(a Answers) ([]byte, error) {
+	cfg := configFile{Name: a.Name, Help: a.Help, Version: "0.1.0"}
+	for _, c := range a.Commands {
+		cfg.Commands = append(cfg.Commands, commandFile{Name: c.Name, Help: c.Help})
+	}
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+type file struct {
+	path    string
+	content []byte
+}
+
+// Write creates the config at configPath and the chosen libs in libDir and
+// returns the files written. Existing files are an error unless force is
+// set.
+func Write(configPath string, libDir string, a Answers, force bool) ([]string, error) {
+	cfg, err := Config(a)
+	if err != nil {
+		return nil, err
+	}
+	files := []file{{configPath, cfg}}
+	for _, lib := range a.Libs {
+		content, ok := Libs[lib]
+		if !ok {
+			return nil, fmt.Errorf("unknown library: %s", lib)
+		}
+		files = append(files, file{filepath.Join(libDir, lib+".sh"), []byte(content)})
+	}
+	return writeFiles(files, force)
+}
+
+// writeFiles writes files, creating their directories, and returns the
+// paths written. Existing files are an error unless force is set.
+func writeFiles(files []file, force bool) ([]string, error) {
+	if !force {
+		for _, f := range files {
+			if _, err := os.Stat(f.path); err == nil {
+				return nil, fmt.Errorf("%s already exists (use --force to overwrite)", f.path)
+			}
+		}
+	}
+	var written []string
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+			return written, err
+		}
+		if err := os.WriteFile(f.path, f.content, 0o644); err != nil {
+			return written, err
+		}
+		written = append(written, f.path)
+	}
+	return written, nil
+}
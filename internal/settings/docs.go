@@ -0,0 +1,110 @@
+package settings
+
+import (
+	"fmt"
+	"io/fs"
+	"reflect"
+	"strings"
+)
+
+// docs describes each setting in one sentence, for editor hovers.
+var docs = map[string]string{
+	"env":                        "Environment the script is generated for; toggles set to an environment are on only there.",
+	"environments":               "Environments accepted by env and the feature toggles, besides always and never.",
+	"source_dir":                 "Directory holding the config, partials, libs and other sources.",
+	"config_path":                "Path of the config file; %{source_dir} is replaced by source_dir.",
+	"target_dir":                 "Directory the script is written to.",
+	"commands_dir":               "Directory under source_dir for command partials; ~ keeps them in source_dir.",
+	"lib_dir":                    "Directory under source_dir whose files are merged into the script.",
+	"extra_lib_dirs":             "More lib directories, relative to the workdir, merged after lib_dir.",
+	"partials_extension":         "File extension of partials.",
+	"tab_indent":                 "Indent the script with tabs instead of two spaces.",
+	"formatter":                  "Script formatter: internal, none, or an external command such as shfmt.",
+	"formatter_args":             "Extra arguments for an external formatter.",
+	"formatter_timeout":          "How long an external formatter may run, as a Go duration.",
+	"formatter_fallback":         "Use the internal formatter when the external one fails, instead of failing.",
+	"target_shell":               "Shell of the script: bash, zsh or sh.",
+	"prompt_missing":             "Ask for missing required args and flags when stdin is a terminal.",
+	"flag_abbreviations":         "Accept unambiguous prefixes of long flags, such as --verb for --verbose.",
+	"validation_exit_code":       "Exit status of validation failures, from 1 to 255.",
+	"discover_commands":          "Add the command fragments found in source_dir/commands.",
+	"auto_prefix_flags":          "Add missing dashes to flag long and short names.",
+	"tree_shake_libs":            "Leave out lib functions that no partial, header or other lib calls.",
+	"lib_namespaces":             "Prefix lib functions with the name of their file.",
+	"backup_script":              "Keep the previous script as <script>.bak.",
+	"skip_src_check":             "Let partials live outside source_dir, with absolute filenames, .. or src, as long as they stay in the workdir.",
+	"allow_external_paths":       "Let imports, text files and partials of the config be outside the workdir, symlinks included.",
+	"script_mode":                "Permissions of a new script, before the umask.",
+	"partial_mode":               "Permissions of new partials, before the umask.",
+	"version_source":             "Where the version comes from: config, git or file.",
+	"version_file":               "File read by version_source: file, relative to the workdir.",
+	"partial_template":           "Template for new partials; ~ uses the built-in scaffold.",
+	"notice_file":                "License or notice text embedded as comments in the script.",
+	"line_endings":               "Line endings of the script: only lf, since bash cannot run CRLF scripts.",
+	"shebang":                    "Shebang line of the script; ~ uses the one of target_shell.",
+	"help_banner_font":           "Font of the help banner: block or ascii.",
+	"variants":                   "Extra scripts with a subset of the commands, by include and exclude paths.",
+	"enable_header_comment":      "Write the generated-by comment at the top of the script.",
+	"enable_bash3_bouncer":       "Exit with an error when the shell is older than the script needs.",
+	"enable_inspect_args":        "Make inspect_args print the arguments of the command.",
+	"enable_view_markers":        "Print a view markers notice when the script starts.",
+	"enable_deps_array":          "Declare the deps array in the script.",
+	"enable_env_var_names_array": "Declare the env_var_names array in the script.",
+	"enable_sourcing":            "Only call run when the script is executed, so sourcing it just defines functions.",
+	"enable_selftest":            "Accept a hidden --bashly-selftest flag that checks the environment.",
+	"enable_command_hook":        "Call bashly_on_command_start before each command runs.",
+	"enable_debug_flag":          "Accept a hidden --bashly-debug flag that traces the command.",
+	"enable_help_pager":          "Page help taller than the terminal through $PAGER.",
+	"enable_help_command":        "Answer to a help command listing every public command.",
+	"enable_completions_command": "Answer to a completions command printing or installing the completion script.",
+	"enable_auto_examples":       "Add usage examples built from the declared args and flags to help.",
+	"enable_help_banner":         "Draw the CLI name in large letters above the global help.",
+	"enable_integrity_footer":    "End the script with a comment holding hashes of the config and script, for go-bashly verify.",
+	"private_reveal_key":         "Environment variable that shows private commands, flags and variables when set.",
+	"inspect_args_key":           "Environment variable that makes inspect_args print when set, even with enable_inspect_args off.",
+	"env_prefix":                 "Prefix of the environment variables overriding settings, such as GOBASHLY_.",
+}
+
+// Doc returns the description and default of the setting key, as written
+// in settings.yml, or "" for unknown keys. Per-env keys such as
+// target_dir_production are described as their base key.
+func Doc(key string) string {
+	doc, ok := docs[key]
+	for !ok {
+		i := strings.LastIndex(key, "_")
+		if i < 0 {
+			return ""
+		}
+		key = key[:i]
+		doc, ok = docs[key]
+	}
+	return fmt.Sprintf("%s\n\nDefault: %s", doc, defaultString(key))
+}
+
+// defaultString formats the default of key as it would be written in
+// settings.yml.
+func defaultString(key string) string {
+	v := reflect.ValueOf(Default())
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != key {
+			continue
+		}
+		switch f := v.Field(i).Interface().(type) {
+		case fs.FileMode:
+			return fmt.Sprintf("%04o", uint32(f))
+		case string:
+			if f == "" {
+				return "~"
+			}
+			return f
+		case []string:
+			return "[" + strings.Join(f, ", ") + "]"
+		case []Variant:
+			return "[]"
+		default:
+			return fmt.Sprint(f)
+		}
+	}
+	return "~"
+}
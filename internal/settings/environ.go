@@ -0,0 +1,38 @@
+package settings
+
+import "os"
+
+// Environ reads environment variables. Settings read the BASHLY_* variables
+// and private_reveal_key through one, so that tests and programs embedding
+// go-bashly can resolve settings without the environment of the process.
+type Environ interface {
+	LookupEnv(key string) (string, bool)
+}
+
+// OSEnviron is the environment of the process.
+var OSEnviron Environ = osEnviron{}
+
+type osEnviron struct{}
+
+func (osEnviron) LookupEnv(key string) (string, bool) { return os.LookupEnv(key) }
+
+// EnvMap is an environment holding only its entries.
+type EnvMap map[string]string
+
+func (m EnvMap) LookupEnv(key string) (string, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+// EnvFunc adapts a lookup function such as os.LookupEnv to Environ.
+type EnvFunc func(key string) (string, bool)
+
+func (f EnvFunc) LookupEnv(key string) (string, bool) { return f(key) }
+
+// orOS returns env, or OSEnviron when env is nil.
+func orOS(env Environ) Environ {
+	if env == nil {
+		return OSEnviron
+	}
+	return env
+}
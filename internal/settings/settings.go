@@ -2,128 +2,545 @@ package settings
 
 import (
 	"fmt"
-	"os"
+	"io/fs"
+	"log/slog"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/banner"
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
 )
 
+// Variant is an extra script generated from the same config, exposing a
+// subset of the commands. Include and Exclude hold command paths such as
+// "db" or "db migrate".
+type Variant struct {
+	Name    string   `json:"name"`
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
 type Settings struct {
-	Env                    string
-	SourceDir              string
-	ConfigPath             string
-	TargetDir              string
-	CommandsDir            string // empty means nil (~)
-	LibDir                 string
-	ExtraLibDirs           []string
-	PartialsExtension      string
-	TabIndent              bool
-	Formatter              string
-	EnableHeaderComment    string
-	EnableBash3Bouncer     string
-	EnableInspectArgs      string
-	EnableViewMarkers      string
-	EnableDepsArray        string
-	EnableEnvVarNamesArray string
-	EnableSourcing         string
-	PrivateRevealKey       string
+	Env                      string      `json:"env"`
+	Environments             []string    `json:"environments"`
+	SourceDir                string      `json:"source_dir"`
+	ConfigPath               string      `json:"config_path"`
+	TargetDir                string      `json:"target_dir"`
+	CommandsDir              string      `json:"commands_dir"` // empty means nil (~)
+	LibDir                   string      `json:"lib_dir"`
+	ExtraLibDirs             []string    `json:"extra_lib_dirs"`
+	PartialsExtension        string      `json:"partials_extension"`
+	TabIndent                bool        `json:"tab_indent"`
+	Formatter                string      `json:"formatter"`
+	FormatterArgs            []string    `json:"formatter_args"`
+	FormatterTimeout         string      `json:"formatter_timeout"`
+	FormatterFallback        bool        `json:"formatter_fallback"`
+	TargetShell              string      `json:"target_shell"`
+	PromptMissing            bool        `json:"prompt_missing"`
+	FlagAbbreviations        bool        `json:"flag_abbreviations"` // accept unambiguous prefixes of long flags
+	ValidationExitCode       int         `json:"validation_exit_code"`
+	DiscoverCommands         bool        `json:"discover_commands"`
+	AutoPrefixFlags          bool        `json:"auto_prefix_flags"`
+	TreeShakeLibs            bool        `json:"tree_shake_libs"`
+	LibNamespaces            bool        `json:"lib_namespaces"` // prefix lib functions with their file name
+	BackupScript             bool        `json:"backup_script"`
+	AllowExternalPaths       bool        `json:"allow_external_paths"`
+	SkipSrcCheck             bool        `json:"skip_src_check"` // let partials live outside source_dir
+	ScriptMode               fs.FileMode `json:"script_mode"`    // of a new script, before the umask
+	PartialMode              fs.FileMode `json:"partial_mode"`   // of new partials, before the umask
+	VersionSource            string      `json:"version_source"` // config, git or file
+	VersionFile              string      `json:"version_file"`
+	PartialTemplate          string      `json:"partial_template"` // empty means the built-in scaffold
+	NoticeFile               string      `json:"notice_file"`      // license or NOTICE text embedded in the script
+	LineEndings              string      `json:"line_endings"`     // only lf
+	Shebang                  string      `json:"shebang"`          // empty means the one of target_shell
+	HelpBannerFont           string      `json:"help_banner_font"` // font of enable_help_banner
+	Variants                 []Variant   `json:"variants"`
+	EnableHeaderComment      string      `json:"enable_header_comment"`
+	EnableBash3Bouncer       string      `json:"enable_bash3_bouncer"`
+	EnableInspectArgs        string      `json:"enable_inspect_args"`
+	EnableViewMarkers        string      `json:"enable_view_markers"`
+	EnableDepsArray          string      `json:"enable_deps_array"`
+	EnableEnvVarNamesArray   string      `json:"enable_env_var_names_array"`
+	EnableSourcing           string      `json:"enable_sourcing"`
+	EnableSelftest           string      `json:"enable_selftest"`
+	EnableCommandHook        string      `json:"enable_command_hook"`
+	EnableDebugFlag          string      `json:"enable_debug_flag"`
+	EnableHelpPager          string      `json:"enable_help_pager"`
+	EnableHelpCommand        string      `json:"enable_help_command"`
+	EnableCompletionsCommand string      `json:"enable_completions_command"`
+	EnableAutoExamples       string      `json:"enable_auto_examples"`
+	EnableHelpBanner         string      `json:"enable_help_banner"`
+	EnableIntegrityFooter    string      `json:"enable_integrity_footer"`
+	PrivateRevealKey         string      `json:"private_reveal_key"`
+	InspectArgsKey           string      `json:"inspect_args_key"` // makes inspect_args print when set at run time
+	EnvPrefix                string      `json:"env_prefix"`       // of the variables overriding settings
+
+	environ Environ // of RevealPrivate; nil means OSEnviron
 }
 
+// DefaultEnvPrefix starts the names of the environment variables that
+// override settings, unless env_prefix or EnvPrefixVar says otherwise.
+const DefaultEnvPrefix = "BASHLY_"
+
+// EnvPrefixVar names the environment variable that sets env_prefix. Its name
+// is fixed, as it decides the names of the others.
+const EnvPrefixVar = "GO_BASHLY_ENV_PREFIX"
+
+var envPrefixPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 func Default() Settings {
 	return Settings{
-		Env:                    "development",
-		SourceDir:              "src",
-		ConfigPath:             "%{source_dir}/bashly.yml",
-		TargetDir:              ".",
-		CommandsDir:            "",
-		LibDir:                 "lib",
-		ExtraLibDirs:           []string{},
-		PartialsExtension:      "sh",
-		TabIndent:              false,
-		Formatter:              "internal",
-		EnableHeaderComment:    "always",
-		EnableBash3Bouncer:     "always",
-		EnableInspectArgs:      "development",
-		EnableViewMarkers:      "development",
-		EnableDepsArray:        "always",
-		EnableEnvVarNamesArray: "always",
-		EnableSourcing:         "development",
-		PrivateRevealKey:       "",
-	}
-}
-
-// Load resolves effective settings for a given workdir.
+		Env:                      "development",
+		Environments:             []string{"development", "production"},
+		SourceDir:                "src",
+		ConfigPath:               "%{source_dir}/bashly.yml",
+		TargetDir:                ".",
+		CommandsDir:              "",
+		LibDir:                   "lib",
+		ExtraLibDirs:             []string{},
+		PartialsExtension:        "sh",
+		TabIndent:                false,
+		Formatter:                "internal",
+		FormatterArgs:            []string{},
+		FormatterTimeout:         "30s",
+		FormatterFallback:        false,
+		TargetShell:              "bash",
+		PromptMissing:            false,
+		FlagAbbreviations:        false,
+		ValidationExitCode:       2,
+		DiscoverCommands:         false,
+		AutoPrefixFlags:          true,
+		TreeShakeLibs:            false,
+		LibNamespaces:            false,
+		BackupScript:             false,
+		SkipSrcCheck:             false,
+		AllowExternalPaths:       false,
+		ScriptMode:               0o755,
+		PartialMode:              0o644,
+		VersionSource:            "config",
+		VersionFile:              "VERSION",
+		PartialTemplate:          "",
+		NoticeFile:               "",
+		LineEndings:              "lf",
+		Shebang:                  "",
+		HelpBannerFont:           banner.DefaultFont,
+		EnableHeaderComment:      "always",
+		EnableBash3Bouncer:       "always",
+		EnableInspectArgs:        "development",
+		EnableViewMarkers:        "development",
+		EnableDepsArray:          "always",
+		EnableEnvVarNamesArray:   "always",
+		EnableSourcing:           "development",
+		EnableSelftest:           "never",
+		EnableCommandHook:        "never",
+		EnableDebugFlag:          "never",
+		EnableHelpPager:          "never",
+		EnableHelpCommand:        "never",
+		EnableCompletionsCommand: "never",
+		EnableAutoExamples:       "never",
+		EnableHelpBanner:         "never",
+		EnableIntegrityFooter:    "never",
+		PrivateRevealKey:         "",
+		InspectArgsKey:           "",
+		EnvPrefix:                DefaultEnvPrefix,
+	}
+}
+
+// Origin tells where the effective value of a setting came from.
+type Origin string
+
+const (
+	OriginDefault  Origin = "default"
+	OriginFile     Origin = "file"
+	OriginOverride Origin = "override" // LoadOptions.Overrides, e.g. workspace settings
+	OriginPerEnv   Origin = "per-env"  // a key such as target_dir_production
+	OriginEnvVar   Origin = "env-var"
+)
+
+// ResolvedSettings are the effective settings along with where each value
+// came from.
+type ResolvedSettings struct {
+	Settings
+	// Path is the settings file that was read, or "" if there was none.
+	Path string
+	// Origins maps every setting key, as written in settings.yml, to the
+	// origin of its value.
+	Origins map[string]Origin
+}
+
+// Origin returns the origin of the setting key; unknown keys are defaults.
+func (r ResolvedSettings) Origin(key string) Origin {
+	if o, ok := r.Origins[key]; ok {
+		return o
+	}
+	return OriginDefault
+}
+
+// LoadOptions configure Load and Resolve.
+type LoadOptions struct {
+	// Overrides are applied on top of the settings file, keys included
+	// (per-env keys such as target_dir_production too). BASHLY_*
+	// environment variables still win.
+	Overrides map[string]any
+	// Env holds the BASHLY_* variables, under env_prefix, EnvPrefixVar and
+	// the private_reveal_key variable; nil means OSEnviron.
+	Env Environ
+	// FS holds the settings file; nil means the disk.
+	FS vfs.FS
+}
+
+// Load resolves and validates effective settings for a given workdir.
 // This is a minimal subset aligned with bashly_settings_resolution.elst.cue.
-func Load(workdir string) (Settings, error) {
+func Load(workdir string, opts LoadOptions) (ResolvedSettings, error) {
+	r, err := Resolve(workdir, opts)
+	if err != nil {
+		return ResolvedSettings{}, err
+	}
+	if err := r.Validate(); err != nil {
+		return ResolvedSettings{}, err
+	}
+	for _, w := range r.Deprecations() {
+		slog.Warn(w)
+	}
+	return r, nil
+}
+
+// Resolve resolves effective settings like Load, without validating them.
+// It is meant for tools that must read settings which may be invalid.
+func Resolve(workdir string, opts LoadOptions) (ResolvedSettings, error) {
+	env := orOS(opts.Env)
+	fsys := vfs.Or(opts.FS)
 	wd, err := filepath.Abs(workdir)
 	if err != nil {
-		return Settings{}, err
+		return ResolvedSettings{}, err
 	}
 
 	st := Default()
+	r := ResolvedSettings{Origins: map[string]Origin{}}
+
+	// 0) The env prefix set by EnvPrefixVar applies from the start, even to
+	// the settings path; the one of the settings file from then on.
+	prefix, prefixSet := env.LookupEnv(EnvPrefixVar)
+	prefix = strings.TrimSpace(prefix)
+	prefixSet = prefixSet && prefix != ""
+	if prefixSet {
+		st.EnvPrefix = prefix
+	}
 
 	// 1) Load optional user settings file.
 
-	path := selectUserSettingsPath(wd)
+	path := selectUserSettingsPath(fsys, wd, withEnvPrefix(env, st.EnvPrefix))
 	var user map[string]any
 	if path != "" {
-		m, err := loadYAMLMap(path)
+		m, err := loadYAMLMap(fsys, path)
 		if err != nil {
-			return Settings{}, err
+			return ResolvedSettings{}, err
 		}
 		user = m
+		r.Path = path
 		applyMap(&st, m)
+		setOrigins(r.Origins, m, "", OriginFile)
+		slog.Debug("settings file loaded", "path", path)
+	} else {
+		slog.Debug("no settings file found, using defaults")
+	}
+	if len(opts.Overrides) > 0 {
+		merged := map[string]any{}
+		for k, v := range user {
+			merged[k] = v
+		}
+		for k, v := range opts.Overrides {
+			merged[k] = v
+		}
+		user = merged
+		applyMap(&st, opts.Overrides)
+		setOrigins(r.Origins, opts.Overrides, "", OriginOverride)
+		slog.Debug("settings overrides applied", "keys", len(opts.Overrides))
+	}
+	if prefixSet {
+		st.EnvPrefix = prefix
+		r.Origins["env_prefix"] = OriginEnvVar
+	}
+	vars := withEnvPrefix(env, st.EnvPrefix)
+	if st.EnvPrefix != DefaultEnvPrefix {
+		slog.Debug("settings env prefix", "prefix", st.EnvPrefix)
 	}
 
 	// 2) Resolve env (config first, then env var override).
-	applyEnv(&st)
+	applyEnv(&st, vars)
 
 	// 3) Apply per-env overrides from config (env var precedence remains in effect).
 	if user != nil {
 		applyPerEnvOverrides(&st, user)
+		setOrigins(r.Origins, user, "_"+st.Env, OriginPerEnv)
 		// Env vars are final authority.
-		applyEnv(&st)
+		applyEnv(&st, vars)
+	}
+
+	for _, key := range Keys() {
+		if key == "env_prefix" {
+			continue
+		}
+		if v, ok := vars.LookupEnv(envVarName(key)); ok && strings.TrimSpace(v) != "" {
+			r.Origins[key] = OriginEnvVar
+		}
+	}
+	for _, key := range Keys() {
+		if o := r.Origin(key); o != OriginDefault {
+			slog.Debug("setting resolved", "key", key, "origin", o)
+		}
 	}
 
 	// 4) Interpolate config_path.
 	st.ConfigPath = strings.ReplaceAll(st.ConfigPath, "%{source_dir}", st.SourceDir)
-	return st, nil
+	slog.Debug("settings resolved", "env", st.Env, "config_path", st.ConfigPath)
+	st.environ = opts.Env
+	r.Settings = st
+	return r, nil
+}
+
+// Keys returns the setting keys, as written in settings.yml, in declaration
+// order.
+func Keys() []string {
+	t := reflect.TypeOf(Settings{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); key != "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// setOrigins records origin for every setting key that m declares with
+// suffix. Only per-env suffixes are accepted by applyPerEnvOverrides, which
+// leaves out env, environments, variants and env_prefix.
+func setOrigins(origins map[string]Origin, m map[string]any, suffix string, origin Origin) {
+	for _, key := range Keys() {
+		if suffix != "" && (key == "env" || key == "environments" || key == "variants" || key == "env_prefix") {
+			continue
+		}
+		if _, ok := m[key+suffix]; ok {
+			origins[key] = origin
+		}
+	}
+}
+
+// envVarName returns the environment variable overriding a setting key,
+// before withEnvPrefix renames it.
+func envVarName(key string) string {
+	return DefaultEnvPrefix + strings.ToUpper(key)
+}
+
+// withEnvPrefix returns env reading the BASHLY_* variables under prefix
+// instead, so that go-bashly and Ruby bashly can share an environment.
+func withEnvPrefix(env Environ, prefix string) Environ {
+	if prefix == DefaultEnvPrefix {
+		return env
+	}
+	return EnvFunc(func(key string) (string, bool) {
+		if name, ok := strings.CutPrefix(key, DefaultEnvPrefix); ok {
+			key = prefix + name
+		}
+		return env.LookupEnv(key)
+	})
+}
+
+// Toggle is a single enable_* setting and its configured value.
+type Toggle struct {
+	Key   string
+	Value string
+}
+
+// Toggles returns all enable_* settings in a stable order.
+func (s Settings) Toggles() []Toggle {
+	return []Toggle{
+		{Key: "enable_header_comment", Value: s.EnableHeaderComment},
+		{Key: "enable_bash3_bouncer", Value: s.EnableBash3Bouncer},
+		{Key: "enable_inspect_args", Value: s.EnableInspectArgs},
+		{Key: "enable_view_markers", Value: s.EnableViewMarkers},
+		{Key: "enable_deps_array", Value: s.EnableDepsArray},
+		{Key: "enable_env_var_names_array", Value: s.EnableEnvVarNamesArray},
+		{Key: "enable_sourcing", Value: s.EnableSourcing},
+		{Key: "enable_selftest", Value: s.EnableSelftest},
+		{Key: "enable_command_hook", Value: s.EnableCommandHook},
+		{Key: "enable_debug_flag", Value: s.EnableDebugFlag},
+		{Key: "enable_help_pager", Value: s.EnableHelpPager},
+		{Key: "enable_help_command", Value: s.EnableHelpCommand},
+		{Key: "enable_completions_command", Value: s.EnableCompletionsCommand},
+		{Key: "enable_auto_examples", Value: s.EnableAutoExamples},
+		{Key: "enable_help_banner", Value: s.EnableHelpBanner},
+		{Key: "enable_integrity_footer", Value: s.EnableIntegrityFooter},
+	}
+}
+
+// LegacyToggleValues maps the boolean toggle values of older configs to
+// the values replacing them; they still work, with a deprecation warning,
+// until go-bashly upgrade rewrites them. Unquoted YAML booleans and numbers
+// are read as these strings.
+var LegacyToggleValues = map[string]string{
+	"true": "always", "yes": "always", "on": "always", "1": "always",
+	"false": "never", "no": "never", "off": "never", "0": "never",
+}
+
+// IsEnabled reports whether a toggle value is active in env.
+// Values are always, never, or the name of the environment they apply to;
+// the deprecated true, yes, on and 1 mean always, false, no, off and 0 never.
+func IsEnabled(value string, env string) bool {
+	v := strings.TrimSpace(strings.ToLower(value))
+	e := strings.TrimSpace(strings.ToLower(env))
+	if legacy, ok := LegacyToggleValues[v]; ok {
+		v = legacy
+	}
+	switch v {
+	case "always":
+		return true
+	case "never":
+		return false
+	default:
+		return v == e
+	}
+}
+
+// Enabled reports whether a toggle value is active in the current env.
+func (s Settings) Enabled(value string) bool {
+	return IsEnabled(value, s.Env)
+}
+
+// Validate checks that every enable_* value is always, never, one of the
+// declared environments or a deprecated boolean, that validation_exit_code is a usable exit code,
+// that file modes are permission bits, and that version_source, line_endings,
+// shebang, help_banner_font, env_prefix and inspect_args_key hold known
+// values.
+func (s Settings) Validate() error {
+	if s.ValidationExitCode < 1 || s.ValidationExitCode > 255 {
+		return fmt.Errorf("invalid validation_exit_code: %d (expected 1-255)", s.ValidationExitCode)
+	}
+	switch s.VersionSource {
+	case "config", "git", "file":
+	default:
+		return fmt.Errorf("invalid version_source: %q (expected config, git or file)", s.VersionSource)
+	}
+	for _, m := range []struct {
+		key  string
+		mode fs.FileMode
+	}{{"script_mode", s.ScriptMode}, {"partial_mode", s.PartialMode}} {
+		if m.mode > fs.ModePerm {
+			return fmt.Errorf("invalid %s: write it in octal with a leading zero, e.g. 0755", m.key)
+		}
+	}
+	switch s.LineEndings {
+	case "lf":
+	case "crlf":
+		// bash stops at the first \r with a syntax error, Git Bash and WSL
+		// included.
+		return fmt.Errorf("invalid line_endings: crlf (bash cannot run a script with CRLF line endings; use lf)")
+	default:
+		return fmt.Errorf("invalid line_endings: %q (expected lf)", s.LineEndings)
+	}
+	if s.Shebang != "" && !strings.HasPrefix(s.Shebang, "#!") {
+		return fmt.Errorf("invalid shebang: %q (expected a line starting with #!)", s.Shebang)
+	}
+	if !slices.Contains(banner.Fonts(), s.HelpBannerFont) {
+		return fmt.Errorf("invalid help_banner_font: %q (expected %s)", s.HelpBannerFont, strings.Join(banner.Fonts(), " or "))
+	}
+	if !envPrefixPattern.MatchString(s.EnvPrefix) {
+		return fmt.Errorf("invalid env_prefix: %q (expected letters, digits and _, such as GOBASHLY_)", s.EnvPrefix)
+	}
+	if s.InspectArgsKey != "" && !envPrefixPattern.MatchString(s.InspectArgsKey) {
+		return fmt.Errorf("invalid inspect_args_key: %q (expected an environment variable name, such as MYCLI_DEBUG_ARGS)", s.InspectArgsKey)
+	}
+	if key := strings.TrimSpace(s.PrivateRevealKey); key != "" && !envPrefixPattern.MatchString(key) {
+		return fmt.Errorf("invalid private_reveal_key: %q (expected an environment variable name, such as MYCLI_SHOW_ALL)", s.PrivateRevealKey)
+	}
+	allowed := append([]string{"always", "never"}, s.Environments...)
+	for _, t := range s.Toggles() {
+		v := strings.TrimSpace(strings.ToLower(t.Value))
+		if _, ok := LegacyToggleValues[v]; ok {
+			continue
+		}
+		valid := false
+		for _, a := range allowed {
+			if v == strings.ToLower(a) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid %s: %q (expected %s)", t.Key, t.Value, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// Deprecations returns a warning for each enable_* setting holding a
+// deprecated boolean value.
+func (s Settings) Deprecations() []string {
+	var out []string
+	for _, t := range s.Toggles() {
+		if legacy, ok := LegacyToggleValues[strings.TrimSpace(strings.ToLower(t.Value))]; ok {
+			out = append(out, fmt.Sprintf("%s: %q is deprecated, use %s (go-bashly upgrade rewrites it)", t.Key, t.Value, legacy))
+		}
+	}
+	return out
 }
 
+// RevealPrivate reports whether the private_reveal_key variable is set in
+// the environment the settings were resolved with.
 func (s Settings) RevealPrivate() bool {
 	if strings.TrimSpace(s.PrivateRevealKey) == "" {
 		return false
 	}
-	_, ok := os.LookupEnv(s.PrivateRevealKey)
+	_, ok := orOS(s.environ).LookupEnv(s.PrivateRevealKey)
 	return ok
 }
 
-func selectUserSettingsPath(wd string) string {
-	if p, ok := os.LookupEnv("BASHLY_SETTINGS_PATH"); ok && strings.TrimSpace(p) != "" {
+// WithEnviron returns s reading the private_reveal_key variable from env.
+func (s Settings) WithEnviron(env Environ) Settings {
+	s.environ = env
+	return s
+}
+
+// UserSettingsPath returns the settings file used for workdir, or "" if none.
+func UserSettingsPath(workdir string) string {
+	return UserSettingsPathIn(workdir, nil)
+}
+
+// UserSettingsPathIn is UserSettingsPath with the variables of env; nil
+// means OSEnviron.
+func UserSettingsPathIn(workdir string, env Environ) string {
+	env = orOS(env)
+	prefix := DefaultEnvPrefix
+	if p, ok := env.LookupEnv(EnvPrefixVar); ok && strings.TrimSpace(p) != "" {
+		prefix = strings.TrimSpace(p)
+	}
+	return selectUserSettingsPath(vfs.Disk, workdir, withEnvPrefix(env, prefix))
+}
+
+func selectUserSettingsPath(fsys vfs.FS, wd string, env Environ) string {
+	if p, ok := env.LookupEnv("BASHLY_SETTINGS_PATH"); ok && strings.TrimSpace(p) != "" {
 		return p
 	}
 	p1 := filepath.Join(wd, "bashly-settings.yml")
-	if existsFile(p1) {
+	if vfs.Exists(fsys, p1) {
 		return p1
 	}
 	p2 := filepath.Join(wd, "settings.yml")
-	if existsFile(p2) {
+	if vfs.Exists(fsys, p2) {
 		return p2
 	}
 	return ""
 }
 
-func existsFile(path string) bool {
-	st, err := os.Stat(path)
-	if err != nil {
-		return false
-	}
-	return !st.IsDir()
-}
-
-func loadYAMLMap(path string) (map[string]any, error) {
-	b, err := os.ReadFile(path)
+func loadYAMLMap(fsys vfs.FS, path string) (map[string]any, error) {
+	b, err := fsys.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read settings: %w", err)
 	}
@@ -142,6 +559,11 @@ func applyMap(s *Settings, m map[string]any) {
 	if v, ok := m["env"].(string); ok && v != "" {
 		s.Env = v
 	}
+	if v, ok := m["environments"]; ok && v != nil {
+		if envs := parseStringList(v); len(envs) > 0 {
+			s.Environments = envs
+		}
+	}
 	if v, ok := m["source_dir"].(string); ok {
 		s.SourceDir = v
 	}
@@ -188,27 +610,183 @@ func applyMap(s *Settings, m map[string]any) {
 	if v, ok := m["formatter"].(string); ok && v != "" {
 		s.Formatter = v
 	}
-	if v, ok := m["enable_header_comment"].(string); ok && v != "" {
+	if v, ok := m["formatter_args"]; ok {
+		s.FormatterArgs = parseStringList(v)
+	}
+	if v, ok := m["formatter_timeout"]; ok {
+		if sv, ok := scalarString(v); ok && sv != "" {
+			s.FormatterTimeout = sv
+		}
+	}
+	if v, ok := m["formatter_fallback"]; ok {
+		if v == nil {
+			s.FormatterFallback = false
+		} else if bv, ok := v.(bool); ok {
+			s.FormatterFallback = bv
+		}
+	}
+	if v, ok := m["target_shell"].(string); ok && v != "" {
+		s.TargetShell = v
+	}
+	if v, ok := m["prompt_missing"]; ok {
+		if v == nil {
+			s.PromptMissing = false
+		} else if bv, ok := v.(bool); ok {
+			s.PromptMissing = bv
+		}
+	}
+	if v, ok := m["flag_abbreviations"]; ok {
+		if v == nil {
+			s.FlagAbbreviations = false
+		} else if bv, ok := v.(bool); ok {
+			s.FlagAbbreviations = bv
+		}
+	}
+	if v, ok := m["validation_exit_code"].(int); ok {
+		s.ValidationExitCode = v
+	}
+	if v, ok := m["variants"]; ok {
+		s.Variants = parseVariants(v)
+	}
+	if v, ok := m["discover_commands"]; ok {
+		if v == nil {
+			s.DiscoverCommands = false
+		} else if bv, ok := v.(bool); ok {
+			s.DiscoverCommands = bv
+		}
+	}
+	if v, ok := m["auto_prefix_flags"]; ok {
+		if v == nil {
+			s.AutoPrefixFlags = false
+		} else if bv, ok := v.(bool); ok {
+			s.AutoPrefixFlags = bv
+		}
+	}
+	if v, ok := m["tree_shake_libs"]; ok {
+		if v == nil {
+			s.TreeShakeLibs = false
+		} else if bv, ok := v.(bool); ok {
+			s.TreeShakeLibs = bv
+		}
+	}
+	if v, ok := m["lib_namespaces"]; ok {
+		if v == nil {
+			s.LibNamespaces = false
+		} else if bv, ok := v.(bool); ok {
+			s.LibNamespaces = bv
+		}
+	}
+	if v, ok := m["backup_script"]; ok {
+		if v == nil {
+			s.BackupScript = false
+		} else if bv, ok := v.(bool); ok {
+			s.BackupScript = bv
+		}
+	}
+	if v, ok := m["skip_src_check"]; ok {
+		if v == nil {
+			s.SkipSrcCheck = false
+		} else if bv, ok := v.(bool); ok {
+			s.SkipSrcCheck = bv
+		}
+	}
+	if v, ok := m["allow_external_paths"]; ok {
+		if v == nil {
+			s.AllowExternalPaths = false
+		} else if bv, ok := v.(bool); ok {
+			s.AllowExternalPaths = bv
+		}
+	}
+	if v, ok := m["script_mode"]; ok {
+		s.ScriptMode = parseFileMode(v)
+	}
+	if v, ok := m["partial_mode"]; ok {
+		s.PartialMode = parseFileMode(v)
+	}
+	if v, ok := m["version_source"].(string); ok && v != "" {
+		s.VersionSource = v
+	}
+	if v, ok := m["version_file"].(string); ok && v != "" {
+		s.VersionFile = v
+	}
+	if v, ok := m["partial_template"]; ok {
+		if v == nil {
+			s.PartialTemplate = ""
+		} else if sv, ok := v.(string); ok {
+			s.PartialTemplate = sv
+		}
+	}
+	if v, ok := m["notice_file"]; ok {
+		if v == nil {
+			s.NoticeFile = ""
+		} else if sv, ok := v.(string); ok {
+			s.NoticeFile = sv
+		}
+	}
+	if v, ok := m["line_endings"].(string); ok && v != "" {
+		s.LineEndings = v
+	}
+	if v, ok := m["help_banner_font"].(string); ok && v != "" {
+		s.HelpBannerFont = v
+	}
+	if v, ok := m["shebang"]; ok {
+		if v == nil {
+			s.Shebang = ""
+		} else if sv, ok := v.(string); ok {
+			s.Shebang = sv
+		}
+	}
+	if v, ok := scalarString(m["enable_header_comment"]); ok && v != "" {
 		s.EnableHeaderComment = v
 	}
-	if v, ok := m["enable_bash3_bouncer"].(string); ok && v != "" {
+	if v, ok := scalarString(m["enable_bash3_bouncer"]); ok && v != "" {
 		s.EnableBash3Bouncer = v
 	}
-	if v, ok := m["enable_inspect_args"].(string); ok && v != "" {
+	if v, ok := scalarString(m["enable_inspect_args"]); ok && v != "" {
 		s.EnableInspectArgs = v
 	}
-	if v, ok := m["enable_view_markers"].(string); ok && v != "" {
+	if v, ok := scalarString(m["enable_view_markers"]); ok && v != "" {
 		s.EnableViewMarkers = v
 	}
-	if v, ok := m["enable_deps_array"].(string); ok && v != "" {
+	if v, ok := scalarString(m["enable_deps_array"]); ok && v != "" {
 		s.EnableDepsArray = v
 	}
-	if v, ok := m["enable_env_var_names_array"].(string); ok && v != "" {
+	if v, ok := scalarString(m["enable_env_var_names_array"]); ok && v != "" {
 		s.EnableEnvVarNamesArray = v
 	}
-	if v, ok := m["enable_sourcing"].(string); ok && v != "" {
+	if v, ok := scalarString(m["enable_sourcing"]); ok && v != "" {
 		s.EnableSourcing = v
 	}
+	if v, ok := scalarString(m["enable_selftest"]); ok && v != "" {
+		s.EnableSelftest = v
+	}
+	if v, ok := scalarString(m["enable_command_hook"]); ok && v != "" {
+		s.EnableCommandHook = v
+	}
+	if v, ok := scalarString(m["enable_debug_flag"]); ok && v != "" {
+		s.EnableDebugFlag = v
+	}
+	if v, ok := scalarString(m["enable_help_pager"]); ok && v != "" {
+		s.EnableHelpPager = v
+	}
+	if v, ok := scalarString(m["enable_help_command"]); ok && v != "" {
+		s.EnableHelpCommand = v
+	}
+	if v, ok := scalarString(m["enable_completions_command"]); ok && v != "" {
+		s.EnableCompletionsCommand = v
+	}
+	if v, ok := scalarString(m["enable_auto_examples"]); ok && v != "" {
+		s.EnableAutoExamples = v
+	}
+	if v, ok := scalarString(m["enable_help_banner"]); ok && v != "" {
+		s.EnableHelpBanner = v
+	}
+	if v, ok := scalarString(m["enable_integrity_footer"]); ok && v != "" {
+		s.EnableIntegrityFooter = v
+	}
+	if v, ok := m["env_prefix"].(string); ok && v != "" {
+		s.EnvPrefix = v
+	}
 	if v, ok := m["private_reveal_key"]; ok {
 		if v == nil {
 			s.PrivateRevealKey = ""
@@ -216,6 +794,13 @@ func applyMap(s *Settings, m map[string]any) {
 			s.PrivateRevealKey = sv
 		}
 	}
+	if v, ok := m["inspect_args_key"]; ok {
+		if v == nil {
+			s.InspectArgsKey = ""
+		} else if sv, ok := v.(string); ok {
+			s.InspectArgsKey = sv
+		}
+	}
 }
 
 func applyPerEnvOverrides(s *Settings, m map[string]any) {
@@ -270,27 +855,177 @@ func applyPerEnvOverrides(s *Settings, m map[string]any) {
 	if v, ok := m["formatter_"+env].(string); ok && v != "" {
 		s.Formatter = v
 	}
-	if v, ok := m["enable_header_comment_"+env].(string); ok && v != "" {
+	if v, ok := m["formatter_args_"+env]; ok {
+		s.FormatterArgs = parseStringList(v)
+	}
+	if v, ok := m["formatter_timeout_"+env]; ok {
+		if sv, ok := scalarString(v); ok && sv != "" {
+			s.FormatterTimeout = sv
+		}
+	}
+	if v, ok := m["formatter_fallback_"+env]; ok {
+		if v == nil {
+			s.FormatterFallback = false
+		} else if bv, ok := v.(bool); ok {
+			s.FormatterFallback = bv
+		}
+	}
+	if v, ok := m["target_shell_"+env].(string); ok && v != "" {
+		s.TargetShell = v
+	}
+	if v, ok := m["prompt_missing_"+env]; ok {
+		if v == nil {
+			s.PromptMissing = false
+		} else if bv, ok := v.(bool); ok {
+			s.PromptMissing = bv
+		}
+	}
+	if v, ok := m["flag_abbreviations_"+env]; ok {
+		if v == nil {
+			s.FlagAbbreviations = false
+		} else if bv, ok := v.(bool); ok {
+			s.FlagAbbreviations = bv
+		}
+	}
+	if v, ok := m["validation_exit_code_"+env].(int); ok {
+		s.ValidationExitCode = v
+	}
+	if v, ok := m["discover_commands_"+env]; ok {
+		if v == nil {
+			s.DiscoverCommands = false
+		} else if bv, ok := v.(bool); ok {
+			s.DiscoverCommands = bv
+		}
+	}
+	if v, ok := m["auto_prefix_flags_"+env]; ok {
+		if v == nil {
+			s.AutoPrefixFlags = false
+		} else if bv, ok := v.(bool); ok {
+			s.AutoPrefixFlags = bv
+		}
+	}
+	if v, ok := m["tree_shake_libs_"+env]; ok {
+		if v == nil {
+			s.TreeShakeLibs = false
+		} else if bv, ok := v.(bool); ok {
+			s.TreeShakeLibs = bv
+		}
+	}
+	if v, ok := m["lib_namespaces_"+env]; ok {
+		if v == nil {
+			s.LibNamespaces = false
+		} else if bv, ok := v.(bool); ok {
+			s.LibNamespaces = bv
+		}
+	}
+	if v, ok := m["backup_script_"+env]; ok {
+		if v == nil {
+			s.BackupScript = false
+		} else if bv, ok := v.(bool); ok {
+			s.BackupScript = bv
+		}
+	}
+	if v, ok := m["skip_src_check_"+env]; ok {
+		if v == nil {
+			s.SkipSrcCheck = false
+		} else if bv, ok := v.(bool); ok {
+			s.SkipSrcCheck = bv
+		}
+	}
+	if v, ok := m["allow_external_paths_"+env]; ok {
+		if v == nil {
+			s.AllowExternalPaths = false
+		} else if bv, ok := v.(bool); ok {
+			s.AllowExternalPaths = bv
+		}
+	}
+	if v, ok := m["script_mode_"+env]; ok {
+		s.ScriptMode = parseFileMode(v)
+	}
+	if v, ok := m["partial_mode_"+env]; ok {
+		s.PartialMode = parseFileMode(v)
+	}
+	if v, ok := m["version_source_"+env].(string); ok && v != "" {
+		s.VersionSource = v
+	}
+	if v, ok := m["version_file_"+env].(string); ok && v != "" {
+		s.VersionFile = v
+	}
+	if v, ok := m["partial_template_"+env]; ok {
+		if v == nil {
+			s.PartialTemplate = ""
+		} else if sv, ok := v.(string); ok {
+			s.PartialTemplate = sv
+		}
+	}
+	if v, ok := m["notice_file_"+env]; ok {
+		if v == nil {
+			s.NoticeFile = ""
+		} else if sv, ok := v.(string); ok {
+			s.NoticeFile = sv
+		}
+	}
+	if v, ok := m["line_endings_"+env].(string); ok && v != "" {
+		s.LineEndings = v
+	}
+	if v, ok := m["help_banner_font_"+env].(string); ok && v != "" {
+		s.HelpBannerFont = v
+	}
+	if v, ok := m["shebang_"+env]; ok {
+		if v == nil {
+			s.Shebang = ""
+		} else if sv, ok := v.(string); ok {
+			s.Shebang = sv
+		}
+	}
+	if v, ok := scalarString(m["enable_header_comment_"+env]); ok && v != "" {
 		s.EnableHeaderComment = v
 	}
-	if v, ok := m["enable_bash3_bouncer_"+env].(string); ok && v != "" {
+	if v, ok := scalarString(m["enable_bash3_bouncer_"+env]); ok && v != "" {
 		s.EnableBash3Bouncer = v
 	}
-	if v, ok := m["enable_inspect_args_"+env].(string); ok && v != "" {
+	if v, ok := scalarString(m["enable_inspect_args_"+env]); ok && v != "" {
 		s.EnableInspectArgs = v
 	}
-	if v, ok := m["enable_view_markers_"+env].(string); ok && v != "" {
+	if v, ok := scalarString(m["enable_view_markers_"+env]); ok && v != "" {
 		s.EnableViewMarkers = v
 	}
-	if v, ok := m["enable_deps_array_"+env].(string); ok && v != "" {
+	if v, ok := scalarString(m["enable_deps_array_"+env]); ok && v != "" {
 		s.EnableDepsArray = v
 	}
-	if v, ok := m["enable_env_var_names_array_"+env].(string); ok && v != "" {
+	if v, ok := scalarString(m["enable_env_var_names_array_"+env]); ok && v != "" {
 		s.EnableEnvVarNamesArray = v
 	}
-	if v, ok := m["enable_sourcing_"+env].(string); ok && v != "" {
+	if v, ok := scalarString(m["enable_sourcing_"+env]); ok && v != "" {
 		s.EnableSourcing = v
 	}
+	if v, ok := scalarString(m["enable_selftest_"+env]); ok && v != "" {
+		s.EnableSelftest = v
+	}
+	if v, ok := scalarString(m["enable_command_hook_"+env]); ok && v != "" {
+		s.EnableCommandHook = v
+	}
+	if v, ok := scalarString(m["enable_debug_flag_"+env]); ok && v != "" {
+		s.EnableDebugFlag = v
+	}
+	if v, ok := scalarString(m["enable_help_pager_"+env]); ok && v != "" {
+		s.EnableHelpPager = v
+	}
+	if v, ok := scalarString(m["enable_help_command_"+env]); ok && v != "" {
+		s.EnableHelpCommand = v
+	}
+	if v, ok := scalarString(m["enable_completions_command_"+env]); ok && v != "" {
+		s.EnableCompletionsCommand = v
+	}
+	if v, ok := scalarString(m["enable_auto_examples_"+env]); ok && v != "" {
+		s.EnableAutoExamples = v
+	}
+	if v, ok := scalarString(m["enable_help_banner_"+env]); ok && v != "" {
+		s.EnableHelpBanner = v
+	}
+	if v, ok := scalarString(m["enable_integrity_footer_"+env]); ok && v != "" {
+		s.EnableIntegrityFooter = v
+	}
 	if v, ok := m["private_reveal_key_"+env]; ok {
 		if v == nil {
 			s.PrivateRevealKey = ""
@@ -298,28 +1033,45 @@ func applyPerEnvOverrides(s *Settings, m map[string]any) {
 			s.PrivateRevealKey = sv
 		}
 	}
+	if v, ok := m["inspect_args_key_"+env]; ok {
+		if v == nil {
+			s.InspectArgsKey = ""
+		} else if sv, ok := v.(string); ok {
+			s.InspectArgsKey = sv
+		}
+	}
 }
 
-func applyEnv(s *Settings) {
-	if v, ok := os.LookupEnv("BASHLY_ENV"); ok && v != "" {
+func applyEnv(s *Settings, env Environ) {
+	lookup := env.LookupEnv
+	if v, ok := lookup("BASHLY_ENV"); ok && v != "" {
 		s.Env = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_SOURCE_DIR"); ok {
+	if v, ok := lookup("BASHLY_ENVIRONMENTS"); ok && strings.TrimSpace(v) != "" {
+		// Split comma-separated string
+		parts := strings.Split(v, ",")
+		envs := make([]string, 0, len(parts))
+		for _, part := range parts {
+			envs = append(envs, strings.TrimSpace(part))
+		}
+		s.Environments = envs
+	}
+	if v, ok := lookup("BASHLY_SOURCE_DIR"); ok {
 		s.SourceDir = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_CONFIG_PATH"); ok {
+	if v, ok := lookup("BASHLY_CONFIG_PATH"); ok {
 		s.ConfigPath = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_TARGET_DIR"); ok {
+	if v, ok := lookup("BASHLY_TARGET_DIR"); ok {
 		s.TargetDir = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_COMMANDS_DIR"); ok {
+	if v, ok := lookup("BASHLY_COMMANDS_DIR"); ok {
 		s.CommandsDir = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_LIB_DIR"); ok {
+	if v, ok := lookup("BASHLY_LIB_DIR"); ok {
 		s.LibDir = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_EXTRA_LIB_DIRS"); ok {
+	if v, ok := lookup("BASHLY_EXTRA_LIB_DIRS"); ok {
 		// Split comma-separated string
 		parts := strings.Split(v, ",")
 		extra := make([]string, 0, len(parts))
@@ -328,41 +1080,238 @@ func applyEnv(s *Settings) {
 		}
 		s.ExtraLibDirs = extra
 	}
-	if v, ok := os.LookupEnv("BASHLY_PARTIALS_EXTENSION"); ok && v != "" {
+	if v, ok := lookup("BASHLY_PARTIALS_EXTENSION"); ok && v != "" {
 		s.PartialsExtension = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_TAB_INDENT"); ok {
+	if v, ok := lookup("BASHLY_TAB_INDENT"); ok {
 		if parsed, ok := parseEnvBool(v); ok {
 			s.TabIndent = parsed
 		}
 	}
-	if v, ok := os.LookupEnv("BASHLY_FORMATTER"); ok && v != "" {
+	if v, ok := lookup("BASHLY_FORMATTER"); ok && v != "" {
 		s.Formatter = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_ENABLE_HEADER_COMMENT"); ok && v != "" {
+	if v, ok := lookup("BASHLY_FORMATTER_ARGS"); ok {
+		s.FormatterArgs = strings.Fields(v)
+	}
+	if v, ok := lookup("BASHLY_FORMATTER_TIMEOUT"); ok && v != "" {
+		s.FormatterTimeout = v
+	}
+	if v, ok := lookup("BASHLY_FORMATTER_FALLBACK"); ok {
+		if parsed, ok := parseEnvBool(v); ok {
+			s.FormatterFallback = parsed
+		}
+	}
+	if v, ok := lookup("BASHLY_TARGET_SHELL"); ok && v != "" {
+		s.TargetShell = v
+	}
+	if v, ok := lookup("BASHLY_PROMPT_MISSING"); ok {
+		if parsed, ok := parseEnvBool(v); ok {
+			s.PromptMissing = parsed
+		}
+	}
+	if v, ok := lookup("BASHLY_FLAG_ABBREVIATIONS"); ok {
+		if parsed, ok := parseEnvBool(v); ok {
+			s.FlagAbbreviations = parsed
+		}
+	}
+	if v, ok := lookup("BASHLY_VALIDATION_EXIT_CODE"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			s.ValidationExitCode = n
+		}
+	}
+	if v, ok := lookup("BASHLY_DISCOVER_COMMANDS"); ok {
+		if parsed, ok := parseEnvBool(v); ok {
+			s.DiscoverCommands = parsed
+		}
+	}
+	if v, ok := lookup("BASHLY_AUTO_PREFIX_FLAGS"); ok {
+		if parsed, ok := parseEnvBool(v); ok {
+			s.AutoPrefixFlags = parsed
+		}
+	}
+	if v, ok := lookup("BASHLY_TREE_SHAKE_LIBS"); ok {
+		if parsed, ok := parseEnvBool(v); ok {
+			s.TreeShakeLibs = parsed
+		}
+	}
+	if v, ok := lookup("BASHLY_LIB_NAMESPACES"); ok {
+		if parsed, ok := parseEnvBool(v); ok {
+			s.LibNamespaces = parsed
+		}
+	}
+	if v, ok := lookup("BASHLY_BACKUP_SCRIPT"); ok {
+		if parsed, ok := parseEnvBool(v); ok {
+			s.BackupScript = parsed
+		}
+	}
+	if v, ok := lookup("BASHLY_SKIP_SRC_CHECK"); ok {
+		if parsed, ok := parseEnvBool(v); ok {
+			s.SkipSrcCheck = parsed
+		}
+	}
+	if v, ok := lookup("BASHLY_ALLOW_EXTERNAL_PATHS"); ok {
+		if parsed, ok := parseEnvBool(v); ok {
+			s.AllowExternalPaths = parsed
+		}
+	}
+	if v, ok := lookup("BASHLY_SCRIPT_MODE"); ok && v != "" {
+		s.ScriptMode = parseFileMode(v)
+	}
+	if v, ok := lookup("BASHLY_PARTIAL_MODE"); ok && v != "" {
+		s.PartialMode = parseFileMode(v)
+	}
+	if v, ok := lookup("BASHLY_VERSION_SOURCE"); ok && v != "" {
+		s.VersionSource = v
+	}
+	if v, ok := lookup("BASHLY_VERSION_FILE"); ok && v != "" {
+		s.VersionFile = v
+	}
+	if v, ok := lookup("BASHLY_PARTIAL_TEMPLATE"); ok {
+		s.PartialTemplate = v
+	}
+	if v, ok := lookup("BASHLY_NOTICE_FILE"); ok {
+		s.NoticeFile = v
+	}
+	if v, ok := lookup("BASHLY_LINE_ENDINGS"); ok && v != "" {
+		s.LineEndings = v
+	}
+	if v, ok := lookup("BASHLY_HELP_BANNER_FONT"); ok && v != "" {
+		s.HelpBannerFont = v
+	}
+	if v, ok := lookup("BASHLY_SHEBANG"); ok {
+		s.Shebang = v
+	}
+	if v, ok := lookup("BASHLY_ENABLE_HEADER_COMMENT"); ok && v != "" {
 		s.EnableHeaderComment = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_ENABLE_BASH3_BOUNCER"); ok && v != "" {
+	if v, ok := lookup("BASHLY_ENABLE_BASH3_BOUNCER"); ok && v != "" {
 		s.EnableBash3Bouncer = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_ENABLE_INSPECT_ARGS"); ok && v != "" {
+	if v, ok := lookup("BASHLY_ENABLE_INSPECT_ARGS"); ok && v != "" {
 		s.EnableInspectArgs = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_ENABLE_VIEW_MARKERS"); ok && v != "" {
+	if v, ok := lookup("BASHLY_ENABLE_VIEW_MARKERS"); ok && v != "" {
 		s.EnableViewMarkers = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_ENABLE_DEPS_ARRAY"); ok && v != "" {
+	if v, ok := lookup("BASHLY_ENABLE_DEPS_ARRAY"); ok && v != "" {
 		s.EnableDepsArray = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_ENABLE_ENV_VAR_NAMES_ARRAY"); ok && v != "" {
+	if v, ok := lookup("BASHLY_ENABLE_ENV_VAR_NAMES_ARRAY"); ok && v != "" {
 		s.EnableEnvVarNamesArray = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_ENABLE_SOURCING"); ok && v != "" {
+	if v, ok := lookup("BASHLY_ENABLE_SOURCING"); ok && v != "" {
 		s.EnableSourcing = v
 	}
-	if v, ok := os.LookupEnv("BASHLY_PRIVATE_REVEAL_KEY"); ok {
+	if v, ok := lookup("BASHLY_ENABLE_SELFTEST"); ok && v != "" {
+		s.EnableSelftest = v
+	}
+	if v, ok := lookup("BASHLY_ENABLE_COMMAND_HOOK"); ok && v != "" {
+		s.EnableCommandHook = v
+	}
+	if v, ok := lookup("BASHLY_ENABLE_DEBUG_FLAG"); ok && v != "" {
+		s.EnableDebugFlag = v
+	}
+	if v, ok := lookup("BASHLY_ENABLE_HELP_PAGER"); ok && v != "" {
+		s.EnableHelpPager = v
+	}
+	if v, ok := lookup("BASHLY_ENABLE_HELP_COMMAND"); ok && v != "" {
+		s.EnableHelpCommand = v
+	}
+	if v, ok := lookup("BASHLY_ENABLE_COMPLETIONS_COMMAND"); ok && v != "" {
+		s.EnableCompletionsCommand = v
+	}
+	if v, ok := lookup("BASHLY_ENABLE_AUTO_EXAMPLES"); ok && v != "" {
+		s.EnableAutoExamples = v
+	}
+	if v, ok := lookup("BASHLY_ENABLE_HELP_BANNER"); ok && v != "" {
+		s.EnableHelpBanner = v
+	}
+	if v, ok := lookup("BASHLY_ENABLE_INTEGRITY_FOOTER"); ok && v != "" {
+		s.EnableIntegrityFooter = v
+	}
+	if v, ok := lookup("BASHLY_PRIVATE_REVEAL_KEY"); ok {
 		s.PrivateRevealKey = v
 	}
+	if v, ok := lookup("BASHLY_INSPECT_ARGS_KEY"); ok {
+		s.InspectArgsKey = v
+	}
+}
+
+// parseStringList accepts either a YAML list of strings or a single
+// whitespace-separated string.
+func parseStringList(v any) []string {
+	switch t := v.(type) {
+	case nil:
+		return []string{}
+	case string:
+		return strings.Fields(t)
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			if str, ok := scalarString(item); ok {
+				out = append(out, str)
+			}
+		}
+		return out
+	default:
+		return []string{}
+	}
+}
+
+// scalarString renders a YAML scalar (string, int, float, bool) as a string.
+func scalarString(v any) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case int, int64, float64, bool:
+		return fmt.Sprint(t), true
+	default:
+		return "", false
+	}
+}
+
+// parseVariants reads the variants list; entries without a name are skipped.
+func parseVariants(v any) []Variant {
+	list, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+	out := make([]Variant, 0, len(list))
+	for _, raw := range list {
+		m, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := m["name"].(string)
+		if name == "" {
+			continue
+		}
+		out = append(out, Variant{
+			Name:    name,
+			Include: parseStringList(m["include"]),
+			Exclude: parseStringList(m["exclude"]),
+		})
+	}
+	return out
+}
+
+// parseFileMode reads a file mode: YAML decodes 0755 to the number itself,
+// strings are read as octal. Values that are not permission bits, such as
+// 755 written without the leading zero, are left above fs.ModePerm for
+// Validate to reject.
+func parseFileMode(v any) fs.FileMode {
+	switch t := v.(type) {
+	case int:
+		if t >= 0 {
+			return fs.FileMode(t)
+		}
+	case string:
+		if n, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(t), "0o"), 8, 32); err == nil {
+			return fs.FileMode(n)
+		}
+	}
+	return fs.ModePerm + 1
 }
 
 func parseEnvBool(s string) (bool, bool) {
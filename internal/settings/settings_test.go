@@ -0,0 +1,314 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
+)
+
+func TestValidateLineEndings(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr string
+	}{
+		{"lf", ""},
+		{"crlf", "bash cannot run a script with CRLF line endings"},
+		{"cr", `invalid line_endings: "cr"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			s := Default()
+			s.LineEndings = tt.value
+			err := s.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidatePrivateRevealKey(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr string
+	}{
+		{"", ""},
+		{"MYCLI_SHOW_ALL", ""},
+		{"_show", ""},
+		{" SHOW_ALL ", ""},
+		{"1SHOW", `invalid private_reveal_key: "1SHOW"`},
+		{"SHOW-ALL", `invalid private_reveal_key: "SHOW-ALL"`},
+		{"X}; rm -rf ~; : ${Y", "invalid private_reveal_key"},
+		{"$(id)", "invalid private_reveal_key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			s := Default()
+			s.PrivateRevealKey = tt.value
+			err := s.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsEnabled(t *testing.T) {
+	tests := []struct {
+		value string
+		env   string
+		want  bool
+	}{
+		{"always", "development", true},
+		{"never", "development", false},
+		{"development", "development", true},
+		{"development", "production", false},
+		{"Production", " production ", true},
+		{"staging", "staging", true},
+		// Deprecated booleans.
+		{"true", "production", true},
+		{"yes", "production", true},
+		{"1", "production", true},
+		{"YES", "development", true},
+		{"false", "development", false},
+		{"no", "development", false},
+		{"0", "development", false},
+		{"on", "production", true},
+		{"off", "development", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value+"/"+tt.env, func(t *testing.T) {
+			if got := IsEnabled(tt.value, tt.env); got != tt.want {
+				t.Errorf("IsEnabled(%q, %q) = %v, want %v", tt.value, tt.env, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateToggles(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        string
+		environments []string
+		wantErr      string
+	}{
+		{"always", "always", nil, ""},
+		{"never", "never", nil, ""},
+		{"default env", "production", nil, ""},
+		{"upper case", "Development", nil, ""},
+		{"declared env", "staging", []string{"development", "staging"}, ""},
+		{"deprecated true", "true", nil, ""},
+		{"deprecated no", "no", nil, ""},
+		{"unknown", "sometimes", nil, `invalid enable_view_markers: "sometimes" (expected always, never, development, production)`},
+		{"undeclared env", "staging", nil, `invalid enable_view_markers: "staging"`},
+		{"env no longer declared", "production", []string{"development", "staging"}, `(expected always, never, development, staging)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Default()
+			if tt.environments != nil {
+				s.Environments = tt.environments
+			}
+			s.EnableViewMarkers = tt.value
+			err := s.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeprecations(t *testing.T) {
+	s := Default()
+	if got := s.Deprecations(); len(got) != 0 {
+		t.Errorf("Deprecations() of the defaults = %q, want none", got)
+	}
+	s.EnableViewMarkers = "yes"
+	s.EnableSourcing = "0"
+	got := s.Deprecations()
+	want := []string{
+		`enable_view_markers: "yes" is deprecated, use always`,
+		`enable_sourcing: "0" is deprecated, use never`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Deprecations() = %q, want %d warnings", got, len(want))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("Deprecations()[%d] = %q, want it to start with %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLoadLegacyToggles(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		wantValue  string
+		wantOn     bool
+		wantWarned bool
+	}{
+		{name: "unquoted false", file: "enable_view_markers: false\n", wantValue: "false", wantWarned: true},
+		{name: "unquoted true", file: "enable_view_markers: true\n", wantValue: "true", wantOn: true, wantWarned: true},
+		{name: "unquoted 0", file: "enable_view_markers: 0\n", wantValue: "0", wantWarned: true},
+		{name: "unquoted 1", file: "enable_view_markers: 1\n", wantValue: "1", wantOn: true, wantWarned: true},
+		{name: "quoted false", file: "enable_view_markers: \"false\"\n", wantValue: "false", wantWarned: true},
+		{name: "off", file: "enable_view_markers: off\n", wantValue: "off", wantWarned: true},
+		{name: "per-env false", file: "enable_view_markers_development: false\n", wantValue: "false", wantWarned: true},
+		{name: "never", file: "enable_view_markers: never\n", wantValue: "never"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "settings.yml"), []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			r, err := Load(dir, LoadOptions{Env: EnvMap{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.EnableViewMarkers != tt.wantValue {
+				t.Errorf("EnableViewMarkers = %q, want %q", r.EnableViewMarkers, tt.wantValue)
+			}
+			if got := r.Enabled(r.EnableViewMarkers); got != tt.wantOn {
+				t.Errorf("view markers enabled = %v, want %v", got, tt.wantOn)
+			}
+			if warned := len(r.Deprecations()) > 0; warned != tt.wantWarned {
+				t.Errorf("Deprecations() = %q, want warnings: %v", r.Deprecations(), tt.wantWarned)
+			}
+		})
+	}
+}
+
+func TestResolveEnv(t *testing.T) {
+	const file = "target_dir: out\ntarget_dir_production: dist\nprivate_reveal_key: SHOW_ALL\n"
+	tests := []struct {
+		name       string
+		env        EnvMap
+		file       string // at /proj/settings.yml
+		wantEnv    string
+		wantTarget string
+		wantOrigin Origin
+		wantReveal bool
+	}{
+		{
+			name:       "defaults",
+			env:        EnvMap{},
+			wantEnv:    "development",
+			wantTarget: ".",
+			wantOrigin: OriginDefault,
+		},
+		{
+			name:       "file",
+			env:        EnvMap{},
+			file:       file,
+			wantEnv:    "development",
+			wantTarget: "out",
+			wantOrigin: OriginFile,
+		},
+		{
+			name:       "per-env key",
+			env:        EnvMap{"BASHLY_ENV": "production"},
+			file:       file,
+			wantEnv:    "production",
+			wantTarget: "dist",
+			wantOrigin: OriginPerEnv,
+		},
+		{
+			name:       "env var wins",
+			env:        EnvMap{"BASHLY_ENV": "production", "BASHLY_TARGET_DIR": "bin"},
+			file:       file,
+			wantEnv:    "production",
+			wantTarget: "bin",
+			wantOrigin: OriginEnvVar,
+		},
+		{
+			name:       "env prefix",
+			env:        EnvMap{EnvPrefixVar: "MYCLI_", "MYCLI_TARGET_DIR": "bin", "BASHLY_TARGET_DIR": "ignored"},
+			wantEnv:    "development",
+			wantTarget: "bin",
+			wantOrigin: OriginEnvVar,
+		},
+		{
+			name:       "private reveal key",
+			env:        EnvMap{"SHOW_ALL": ""},
+			file:       file,
+			wantEnv:    "development",
+			wantTarget: "out",
+			wantOrigin: OriginFile,
+			wantReveal: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mem := vfs.NewMem()
+			if tt.file != "" {
+				if err := mem.WriteFile("/proj/settings.yml", []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r, err := Resolve("/proj", LoadOptions{Env: tt.env, FS: mem})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Env != tt.wantEnv {
+				t.Errorf("Env = %q, want %q", r.Env, tt.wantEnv)
+			}
+			if r.TargetDir != tt.wantTarget {
+				t.Errorf("TargetDir = %q, want %q", r.TargetDir, tt.wantTarget)
+			}
+			if o := r.Origin("target_dir"); o != tt.wantOrigin {
+				t.Errorf("Origin(target_dir) = %q, want %q", o, tt.wantOrigin)
+			}
+			if got := r.RevealPrivate(); got != tt.wantReveal {
+				t.Errorf("RevealPrivate() = %v, want %v", got, tt.wantReveal)
+			}
+		})
+	}
+}
+
+func TestResolveSettingsPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      EnvMap
+		files    []string
+		wantPath string
+	}{
+		{name: "none", env: EnvMap{}},
+		{name: "settings.yml", env: EnvMap{}, files: []string{"/proj/settings.yml"}, wantPath: "/proj/settings.yml"},
+		{name: "bashly-settings.yml first", env: EnvMap{}, files: []string{"/proj/settings.yml", "/proj/bashly-settings.yml"}, wantPath: "/proj/bashly-settings.yml"},
+		{name: "env var", env: EnvMap{"BASHLY_SETTINGS_PATH": "/etc/cli.yml"}, files: []string{"/proj/settings.yml", "/etc/cli.yml"}, wantPath: "/etc/cli.yml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mem := vfs.NewMem()
+			for _, f := range tt.files {
+				if err := mem.WriteFile(f, []byte("target_dir: out\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r, err := Resolve("/proj", LoadOptions{Env: tt.env, FS: mem})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Path != tt.wantPath {
+				t.Errorf("Path = %q, want %q", r.Path, tt.wantPath)
+			}
+		})
+	}
+}
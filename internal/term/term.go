@@ -0,0 +1,122 @@
+package term
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Options holds the terminal flags shared by all subcommands.
+type Options struct {
+	Color   string
+	NoColor bool
+	Width   int
+}
+
+// AddFlags registers --color, --no-color and --width on fs.
+func AddFlags(fs *flag.FlagSet) *Options {
+	o := &Options{}
+	fs.StringVar(&o.Color, "color", "auto", "Color output: auto, always or never")
+	fs.BoolVar(&o.NoColor, "no-color", false, "Same as --color=never")
+	fs.IntVar(&o.Width, "width", 0, "Line width of human-readable output (default: $COLUMNS or the terminal width)")
+	return o
+}
+
+// current holds the options installed by Setup.
+var current = Options{Color: "auto"}
+
+// Setup validates o and makes it the options used by Color and Width.
+func (o *Options) Setup() error {
+	switch o.Color {
+	case "auto", "always", "never":
+	default:
+		return fmt.Errorf("unknown --color: %s (expected auto, always or never)", o.Color)
+	}
+	if o.Width < 0 {
+		return fmt.Errorf("--width must not be negative")
+	}
+	current = *o
+	if o.NoColor {
+		current.Color = "never"
+	}
+	return nil
+}
+
+// IsTerminal reports whether f is a terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Color reports whether output to f should be colored: --color always or
+// never decides; otherwise f must be a terminal, NO_COLOR unset and TERM
+// not dumb.
+func Color(f *os.File) bool {
+	switch current.Color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return IsTerminal(f) && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+}
+
+// Width returns the line width for output to f: --width, then $COLUMNS,
+// then the terminal width when f is a terminal. 0 means no limit.
+func Width(f *os.File) int {
+	if current.Width > 0 {
+		return current.Width
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	if !IsTerminal(f) {
+		return 0
+	}
+	if _, cols := size(); cols > 0 {
+		return cols
+	}
+	return 80
+}
+
+// Height returns the terminal height from $LINES or the terminal on
+// stdin, or fallback when neither is known.
+func Height(fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 0 {
+		return n
+	}
+	if rows, _ := size(); rows > 0 {
+		return rows
+	}
+	return fallback
+}
+
+// size reads the rows and columns of the terminal on stdin with stty;
+// zeros mean unknown.
+func size() (int, int) {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, 0
+	}
+	rows, cols, ok := strings.Cut(strings.TrimSpace(string(out)), " ")
+	if !ok {
+		return 0, 0
+	}
+	r, _ := strconv.Atoi(rows)
+	c, _ := strconv.Atoi(cols)
+	return r, c
+}
+
+// Paint wraps s in the ANSI SGR code when on is set, e.g. Paint(on, "31", s)
+// for red.
+func Paint(on bool, code string, s string) string {
+	if !on {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
@@ -0,0 +1,314 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/project"
+	"github.com/dimitar-trifonov/go-bashly/internal/term"
+)
+
+// action is what a key asks of the terminal loop.
+type action int
+
+const (
+	actionNone action = iota
+	actionQuit
+	actionEdit
+	actionGenerate
+	actionReload
+)
+
+// row is a visible line of the tree.
+type row struct {
+	cmd   *commandmodel.Command
+	depth int
+}
+
+// model is the state of the explorer, independent of the terminal.
+type model struct {
+	project  *project.Project
+	expanded map[string]bool // by full name, so reloading keeps them
+	rows     []row
+	cursor   int
+	offset   int // first tree row shown
+	status   string
+	color    bool
+}
+
+func newModel(p *project.Project, color bool) *model {
+	m := &model{expanded: map[string]bool{p.Root.FullName: true}, color: color}
+	m.setProject(p)
+	return m
+}
+
+// setProject shows p, keeping the expanded commands and the selection
+// when they still exist.
+func (m *model) setProject(p *project.Project) {
+	selected := ""
+	if c := m.selected(); c != nil {
+		selected = c.FullName
+	}
+	m.project = p
+	m.flatten()
+	for i, r := range m.rows {
+		if r.cmd.FullName == selected {
+			m.cursor = i
+		}
+	}
+	m.cursor = min(m.cursor, len(m.rows)-1)
+}
+
+func (m *model) flatten() {
+	m.rows = m.rows[:0]
+	var walk func(c *commandmodel.Command, depth int)
+	walk = func(c *commandmodel.Command, depth int) {
+		m.rows = append(m.rows, row{cmd: c, depth: depth})
+		if m.expanded[c.FullName] {
+			for _, child := range c.Commands {
+				walk(child, depth+1)
+			}
+		}
+	}
+	walk(m.project.Root, 0)
+}
+
+func (m *model) selected() *commandmodel.Command {
+	if m.cursor < 0 || m.cursor >= len(m.rows) {
+		return nil
+	}
+	return m.rows[m.cursor].cmd
+}
+
+// partial returns the path of the partial of c.
+func (m *model) partial(c *commandmodel.Command) string {
+	return c.PartialFile(m.project.Workdir, m.project.Settings.SourceDir)
+}
+
+// key applies a key, as returned by readKey, and tells what else it needs.
+func (m *model) key(k string) action {
+	m.status = ""
+	switch k {
+	case "q", "ctrl-c", "esc":
+		return actionQuit
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		m.cursor = min(m.cursor+1, len(m.rows)-1)
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.rows) - 1
+	case "right", "l", "enter", " ":
+		c := m.selected()
+		if len(c.Commands) == 0 {
+			break
+		}
+		if m.expanded[c.FullName] && k != "right" && k != "l" {
+			delete(m.expanded, c.FullName)
+		} else {
+			m.expanded[c.FullName] = true
+		}
+		m.flatten()
+	case "left", "h":
+		c := m.selected()
+		if m.expanded[c.FullName] && len(c.Commands) > 0 {
+			delete(m.expanded, c.FullName)
+			m.flatten()
+			break
+		}
+		for i := m.cursor - 1; i >= 0; i-- {
+			if m.rows[i].depth < m.rows[m.cursor].depth {
+				m.cursor = i
+				break
+			}
+		}
+	case "e":
+		return actionEdit
+	case "R":
+		return actionGenerate
+	case "r":
+		return actionReload
+	}
+	return actionNone
+}
+
+// render returns the screen: the tree on the left, the details of the
+// selected command on the right, a title and a status line.
+func (m *model) render(width int, height int) []string {
+	body := max(height-2, 1)
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+body {
+		m.offset = m.cursor - body + 1
+	}
+
+	tree := make([]string, 0, len(m.rows))
+	treeWidth := 0
+	for _, r := range m.rows {
+		marker := "  "
+		if len(r.cmd.Commands) > 0 {
+			marker = "▸ "
+			if m.expanded[r.cmd.FullName] {
+				marker = "▾ "
+			}
+		}
+		line := strings.Repeat("  ", r.depth) + marker + r.cmd.Name
+		tree = append(tree, line)
+		treeWidth = max(treeWidth, utf8.RuneCountInString(line))
+	}
+	treeWidth = min(treeWidth+1, max(width/2, 20))
+
+	details := m.details(m.selected())
+	out := []string{term.Paint(m.color, "1", fit(m.title(), width))}
+	for i := 0; i < body; i++ {
+		left := ""
+		if n := m.offset + i; n < len(tree) {
+			left = fit(tree[n], treeWidth)
+			if n == m.cursor {
+				left = term.Paint(true, "7", left) // reverse video, even without color
+			}
+		} else {
+			left = fit("", treeWidth)
+		}
+		right := fit("", max(width-treeWidth-3, 0))
+		if i < len(details) {
+			right = fit(details[i].text, max(width-treeWidth-3, 0))
+			if details[i].heading {
+				right = term.Paint(m.color, "1", right)
+			}
+		}
+		out = append(out, left+" │ "+right)
+	}
+	status := m.status
+	if status == "" {
+		status = "↑/↓ move  →/← open/close  e edit partial  R regenerate  r reload  q quit"
+	}
+	out = append(out, term.Paint(m.color, "2", fit(status, width)))
+	return out
+}
+
+func (m *model) title() string {
+	n := len(commandmodel.DeepCommands(m.project.Root, true))
+	noun := "commands"
+	if n == 1 {
+		noun = "command"
+	}
+	return fmt.Sprintf("%s — %d %s — %s", m.project.Root.Name, n, noun, m.project.Workdir)
+}
+
+// detail is a line of the detail pane.
+type detail struct {
+	text    string
+	heading bool
+}
+
+// details describes c: help, partial, aliases, args, flags, environment
+// variables and what it depends on.
+func (m *model) details(c *commandmodel.Command) []detail {
+	if c == nil {
+		return nil
+	}
+	var out []detail
+	line := func(s string) { out = append(out, detail{text: s}) }
+	heading := func(s string) {
+		if out[len(out)-1].text != "" {
+			line("")
+		}
+		out = append(out, detail{text: s, heading: true})
+	}
+	out = append(out, detail{text: c.FullName, heading: true})
+	for _, l := range strings.Split(strings.TrimSpace(c.Description), "\n") {
+		if l != "" {
+			line(l)
+		}
+	}
+	line("")
+
+	if c.Filename != "" {
+		partial := c.PartialPath(m.project.Settings.SourceDir)
+		if _, err := os.Stat(m.partial(c)); err != nil {
+			partial += " (missing)"
+		}
+		line("Partial: " + partial)
+	}
+	if len(c.Alias) > 1 {
+		line("Aliases: " + strings.Join(c.Alias[1:], ", "))
+	}
+	if c.Private {
+		line("Private")
+	}
+	if len(c.Args) > 0 {
+		heading("Args")
+		for _, a := range c.Args {
+			line("  " + describe(strings.ToUpper(a.Name), a.Required, a.Default, nil, a.Help))
+		}
+	}
+	if len(c.Flags) > 0 {
+		heading("Flags")
+		for _, f := range c.Flags {
+			name := strings.Join(f.Switches(), ", ")
+			if f.Arg != "" {
+				name += " " + strings.ToUpper(f.Arg)
+			}
+			if f.Repeatable {
+				name += " ..."
+			}
+			line("  " + describe(name, f.Required, strings.Join(f.DefaultValues(), ", "), f.Allowed, f.Help))
+		}
+	}
+	if len(c.EnvVars) > 0 {
+		heading("Environment")
+		for _, ev := range c.EnvVars {
+			line("  " + describe(ev.Name, ev.Required, ev.Default, ev.Allowed, ev.Help))
+		}
+	}
+	if (len(c.Deps) > 0 || len(c.Needs) > 0 || len(c.Commands) > 0) && out[len(out)-1].text != "" {
+		line("")
+	}
+	if len(c.Deps) > 0 {
+		line("Dependencies: " + strings.Join(c.Deps, ", "))
+	}
+	if len(c.Needs) > 0 {
+		line("Needs: " + strings.Join(c.Needs, ", "))
+	}
+	if len(c.Commands) > 0 {
+		line(fmt.Sprintf("Subcommands: %d", len(c.Commands)))
+	}
+	return out
+}
+
+// describe is one line about an arg, flag or environment variable.
+func describe(name string, required bool, def string, allowed []string, help string) string {
+	parts := []string{name}
+	if required {
+		parts = append(parts, "(required)")
+	}
+	if len(allowed) > 0 {
+		parts = append(parts, "["+strings.Join(allowed, "|")+"]")
+	}
+	if def != "" {
+		parts = append(parts, "default: "+def)
+	}
+	if help = strings.TrimSpace(help); help != "" {
+		first, _, _ := strings.Cut(help, "\n")
+		parts = append(parts, "— "+first)
+	}
+	return strings.Join(parts, " ")
+}
+
+// fit pads or clips s, which has no ANSI codes, to width characters.
+func fit(s string, width int) string {
+	n := utf8.RuneCountInString(s)
+	if n <= width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	if width <= 0 {
+		return ""
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
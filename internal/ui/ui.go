@@ -0,0 +1,187 @@
+// Package ui is a terminal explorer for the command tree: it browses the
+// commands, shows their args, flags and environment variables, opens
+// their partials in an editor and regenerates the script.
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/project"
+	"github.com/dimitar-trifonov/go-bashly/internal/term"
+)
+
+// Options connects the explorer to the project.
+type Options struct {
+	// Load loads the project, at start and on reload.
+	Load func() (*project.Project, error)
+	// Generate writes the script of p and returns a one-line summary.
+	Generate func(p *project.Project) (string, error)
+	Color    bool
+}
+
+// Run shows the explorer on the terminal in and out until the user quits.
+func Run(in *os.File, out *os.File, opts Options) error {
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return errors.New("ui needs a terminal")
+	}
+	p, err := opts.Load()
+	if err != nil {
+		return err
+	}
+	m := newModel(p, opts.Color)
+
+	state, err := stty(in, "-g")
+	if err != nil {
+		return fmt.Errorf("save terminal state: %w", err)
+	}
+	enter := func() error {
+		if _, err := stty(in, "raw", "-echo"); err != nil {
+			return fmt.Errorf("set terminal mode: %w", err)
+		}
+		fmt.Fprint(out, "\033[?1049h\033[?25l")
+		return nil
+	}
+	leave := func() {
+		fmt.Fprint(out, "\033[?25h\033[?1049l")
+		_, _ = stty(in, strings.TrimSpace(state))
+	}
+	if err := enter(); err != nil {
+		return err
+	}
+	defer leave()
+
+	r := bufio.NewReader(in)
+	for {
+		draw(out, m)
+		k, err := readKey(r)
+		if err != nil {
+			return err
+		}
+		switch m.key(k) {
+		case actionQuit:
+			return nil
+		case actionReload:
+			if p, err := opts.Load(); err != nil {
+				m.status = firstLine(err)
+			} else {
+				m.setProject(p)
+				m.status = "reloaded"
+			}
+		case actionGenerate:
+			if summary, err := opts.Generate(m.project); err != nil {
+				m.status = firstLine(err)
+			} else {
+				m.status = summary
+			}
+		case actionEdit:
+			c := m.selected()
+			if c.Filename == "" {
+				m.status = c.FullName + " has no partial"
+				break
+			}
+			leave()
+			err := edit(in, out, m.partial(c))
+			if eerr := enter(); eerr != nil {
+				return eerr
+			}
+			if err != nil {
+				m.status = err.Error()
+			}
+		}
+	}
+}
+
+// draw repaints the whole screen.
+func draw(out *os.File, m *model) {
+	width := term.Width(out)
+	height := term.Height(24)
+	var b strings.Builder
+	b.WriteString("\033[H")
+	for i, line := range m.render(width, height) {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line)
+		b.WriteString("\033[K")
+	}
+	b.WriteString("\033[J")
+	fmt.Fprint(out, b.String())
+}
+
+// readKey reads one key press: a printable character, or the name of a
+// control or escape sequence such as "up" or "ctrl-c".
+func readKey(r *bufio.Reader) (string, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch b {
+	case 3:
+		return "ctrl-c", nil
+	case '\r', '\n':
+		return "enter", nil
+	case 0x1b:
+		if r.Buffered() == 0 {
+			return "esc", nil
+		}
+		seq := []byte{}
+		for r.Buffered() > 0 {
+			c, _ := r.ReadByte()
+			seq = append(seq, c)
+			if c >= 0x40 && c <= 0x7e && len(seq) > 1 {
+				break
+			}
+		}
+		switch string(seq) {
+		case "[A", "OA":
+			return "up", nil
+		case "[B", "OB":
+			return "down", nil
+		case "[C", "OC":
+			return "right", nil
+		case "[D", "OD":
+			return "left", nil
+		case "[H", "OH", "[1~":
+			return "home", nil
+		case "[F", "OF", "[4~":
+			return "end", nil
+		}
+		return "", nil
+	}
+	return string(b), nil
+}
+
+// edit opens path in $VISUAL or $EDITOR, or vi, on the terminal.
+func edit(in *os.File, out *os.File, path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = in, out, out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", editor, err)
+	}
+	return nil
+}
+
+// stty runs stty with args on the terminal in and returns its output.
+func stty(in *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = in
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+func firstLine(err error) string {
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	return msg
+}
@@ -0,0 +1,178 @@
+package upgrade
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/dimitar-trifonov/go-bashly/internal/configedit"
+	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+)
+
+// Edit is a single in-place rewrite of a YAML scalar.
+type Edit struct {
+	configedit.Edit
+	Reason string
+}
+
+// FileUpgrade is the set of edits planned for one file.
+type FileUpgrade struct {
+	Path   string
+	Before []byte
+	After  []byte
+	Edits  []Edit
+}
+
+// toggleKey matches enable_* settings, including per-env variants.
+var toggleKey = regexp.MustCompile(`^enable_[a-z0-9_]+$`)
+
+// PlanSettings plans upgrades for a settings file.
+// Rewrites legacy boolean enable_* values to always/never.
+func PlanSettings(path string) (*FileUpgrade, error) {
+	return plan(path, func(doc *yaml.Node) []Edit {
+		var edits []Edit
+		root := mappingRoot(doc)
+		if root == nil {
+			return nil
+		}
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			key, val := root.Content[i], root.Content[i+1]
+			if !toggleKey.MatchString(key.Value) || val.Kind != yaml.ScalarNode {
+				continue
+			}
+			if repl, ok := settings.LegacyToggleValues[strings.ToLower(val.Value)]; ok {
+				edits = append(edits, scalarEdit(val, repl, key.Value+" uses always/never instead of booleans"))
+			}
+		}
+		return edits
+	})
+}
+
+// PlanConfig plans upgrades for a bashly config file. It returns the plan and
+// the import paths referenced by the file (relative to workdir), which
+// should be planned as well.
+// Rewrites flag long/short values that lack their leading dashes.
+func PlanConfig(path string) (*FileUpgrade, []string, error) {
+	var imports []string
+	u, err := plan(path, func(doc *yaml.Node) []Edit {
+		var edits []Edit
+		walkMappings(doc, func(m *yaml.Node) {
+			for i := 0; i+1 < len(m.Content); i += 2 {
+				key, val := m.Content[i], m.Content[i+1]
+				if val.Kind != yaml.ScalarNode || val.Value == "" {
+					continue
+				}
+				switch key.Value {
+				case "long":
+					if !strings.HasPrefix(val.Value, "--") {
+						edits = append(edits, scalarEdit(val, "--"+strings.TrimLeft(val.Value, "-"), "long flags start with --"))
+					}
+				case "short":
+					if !strings.HasPrefix(val.Value, "-") {
+						edits = append(edits, scalarEdit(val, "-"+val.Value, "short flags start with -"))
+					}
+				case "import":
+					imports = append(imports, val.Value)
+				}
+			}
+		})
+		return edits
+	})
+	return u, imports, err
+}
+
+// Apply writes the upgraded content to disk.
+func (u *FileUpgrade) Apply() error {
+	info, err := os.Stat(u.Path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(u.Path, u.After, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("write %s: %w", u.Path, err)
+	}
+	return nil
+}
+
+// Diff writes a line diff of the planned edits.
+func (u *FileUpgrade) Diff(w io.Writer) {
+	before := strings.Split(string(u.Before), "\n")
+	after := strings.Split(string(u.After), "\n")
+	fmt.Fprintf(w, "--- %s\n", u.Path)
+	fmt.Fprintf(w, "+++ %s\n", u.Path)
+	last := 0
+	for _, e := range u.Edits {
+		if e.Line == last {
+			continue
+		}
+		last = e.Line
+		fmt.Fprintf(w, "@@ line %d: %s @@\n", e.Line, e.Reason)
+		fmt.Fprintf(w, "-%s\n", before[e.Line-1])
+		fmt.Fprintf(w, "+%s\n", after[e.Line-1])
+	}
+}
+
+func plan(path string, rules func(doc *yaml.Node) []Edit) (*FileUpgrade, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("parse yaml file %s: %w", path, err)
+	}
+
+	edits := rules(&doc)
+	after, err := applyEdits(b, edits)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &FileUpgrade{Path: path, Before: b, After: after, Edits: edits}, nil
+}
+
+// applyEdits rewrites the scalars of edits in src.
+func applyEdits(src []byte, edits []Edit) ([]byte, error) {
+	text := make([]configedit.Edit, len(edits))
+	for i, e := range edits {
+		text[i] = e.Edit
+	}
+	return configedit.Apply(src, text)
+}
+
+// scalarEdit builds an edit replacing the value of a scalar node, keeping
+// its quoting style.
+func scalarEdit(n *yaml.Node, value string, reason string) Edit {
+	return Edit{Edit: configedit.ScalarEdit(n, value), Reason: reason}
+}
+
+func mappingRoot(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		doc = doc.Content[0]
+	}
+	if doc.Kind != yaml.MappingNode {
+		return nil
+	}
+	return doc
+}
+
+// walkMappings calls fn for every mapping node in document order.
+func walkMappings(n *yaml.Node, fn func(m *yaml.Node)) {
+	if n.Kind == yaml.MappingNode {
+		fn(n)
+	}
+	for _, c := range n.Content {
+		walkMappings(c, fn)
+	}
+}
+
+// ResolveImport resolves an import path the same way config composition does.
+func ResolveImport(workdir string, importPath string) string {
+	if filepath.IsAbs(importPath) {
+		return importPath
+	}
+	return filepath.Join(workdir, importPath)
+}
@@ -0,0 +1,89 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// WriteFile writes data to a temporary file next to name and renames it
+// over name, so readers see either the old or the new content. A symlink
+// is followed, so that it keeps pointing at the file.
+func (disk) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
+	}
+	var keep fs.FileMode
+	info, err := os.Stat(name)
+	exists := err == nil
+	if exists {
+		keep = info.Mode().Perm()
+	}
+
+	tmp, err := createTemp(name, perm)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if exists {
+		if err := os.Chmod(tmp.Name(), keep); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// createTemp creates a new file next to path with perm, which the umask
+// reduces as for any other created file (os.CreateTemp always uses 0600).
+func createTemp(path string, perm fs.FileMode) (*os.File, error) {
+	prefix := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	for i := 0; ; i++ {
+		name := prefix + strconv.Itoa(os.Getpid()) + "-" + strconv.Itoa(i)
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if errors.Is(err, fs.ErrExist) && i < 100 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// Inside reports whether path is dir or below it on disk, with the
+// symlinks of both resolved, so that a link cannot lead out of dir. The
+// part of path that does not exist yet is taken as it is.
+func Inside(dir string, path string) bool {
+	rel, err := filepath.Rel(resolveLinks(dir), resolveLinks(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveLinks returns path made absolute, with the symlinks of its
+// longest existing part resolved.
+func resolveLinks(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	rest := ""
+	for p := path; ; p = filepath.Dir(p) {
+		if target, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(target, rest)
+		}
+		if filepath.Dir(p) == p {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+	}
+}
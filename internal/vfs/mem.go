@@ -0,0 +1,200 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// Mem is a file system held in memory, for generating without touching
+// the disk. Names are cleaned, so "/proj/src" and "/proj/./src/" are the
+// same directory; relative names are relative to a root of their own.
+type Mem struct {
+	mu    sync.Mutex
+	files fstest.MapFS
+}
+
+// NewMem returns an empty Mem.
+func NewMem() *Mem {
+	return &Mem{files: fstest.MapFS{}}
+}
+
+// key returns the MapFS path of name.
+func key(name string) string {
+	name = filepath.ToSlash(filepath.Clean(strings.TrimPrefix(name, filepath.VolumeName(name))))
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (m *Mem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return fs.ReadFile(m.files, key(name))
+}
+
+func (m *Mem) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return fs.ReadDir(m.files, key(name))
+}
+
+func (m *Mem) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return fs.Stat(m.files, key(name))
+}
+
+func (m *Mem) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key(name)
+	if info, err := fs.Stat(m.files, k); err == nil {
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+		}
+		return nil
+	}
+	m.files[k] = &fstest.MapFile{Mode: fs.ModeDir | perm.Perm(), ModTime: time.Now()}
+	return nil
+}
+
+func (m *Mem) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key(name)
+	mode := perm.Perm()
+	if info, err := fs.Stat(m.files, k); err == nil {
+		if info.IsDir() {
+			return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+		}
+		mode = info.Mode().Perm()
+	}
+	m.files[k] = &fstest.MapFile{Data: append([]byte(nil), data...), Mode: mode, ModTime: time.Now()}
+	return nil
+}
+
+func (m *Mem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key(name)
+	info, err := fs.Stat(m.files, k)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if info.IsDir() {
+		for p := range m.files {
+			if strings.HasPrefix(p, k+"/") || k == "." {
+				return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+			}
+		}
+	}
+	delete(m.files, k)
+	return nil
+}
+
+// errNotEmpty is the error of removing a directory holding files.
+var errNotEmpty = errors.New("directory not empty")
+
+// Paths returns the files written to m, sorted, as the slash-separated
+// paths they are stored under.
+func (m *Mem) Paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var paths []string
+	for k, f := range m.files {
+		if !f.Mode.IsDir() {
+			paths = append(paths, k)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Overlay returns a file system reading from base and keeping writes in
+// memory, where later reads see them; base is never written to. A dry run
+// generates through an overlay of the disk.
+func Overlay(base FS) FS {
+	return &overlay{base: base, mem: NewMem()}
+}
+
+type overlay struct {
+	base FS
+	mem  *Mem
+}
+
+func (o *overlay) ReadFile(name string) ([]byte, error) {
+	if Exists(o.mem, name) {
+		return o.mem.ReadFile(name)
+	}
+	return o.base.ReadFile(name)
+}
+
+func (o *overlay) Stat(name string) (fs.FileInfo, error) {
+	if info, err := o.mem.Stat(name); err == nil {
+		return info, nil
+	}
+	return o.base.Stat(name)
+}
+
+// ReadDir lists the entries of both file systems; written files take the
+// place of the ones of base.
+func (o *overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := o.base.ReadDir(name)
+	written, merr := o.mem.ReadDir(name)
+	if err != nil && merr != nil {
+		return nil, err
+	}
+	byName := map[string]fs.DirEntry{}
+	for _, e := range entries {
+		byName[e.Name()] = e
+	}
+	for _, e := range written {
+		if _, ok := byName[e.Name()]; !ok || !e.IsDir() {
+			byName[e.Name()] = e
+		}
+	}
+	merged := make([]fs.DirEntry, 0, len(byName))
+	for _, e := range byName {
+		merged = append(merged, e)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
+
+func (o *overlay) MkdirAll(name string, perm fs.FileMode) error {
+	if info, err := o.base.Stat(name); err == nil && info.IsDir() {
+		return nil
+	}
+	return o.mem.MkdirAll(name, perm)
+}
+
+// WriteFile keeps the permissions of a file of base it replaces, as the
+// disk would.
+func (o *overlay) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !Exists(o.mem, name) {
+		if info, err := o.base.Stat(name); err == nil && !info.IsDir() {
+			perm = info.Mode().Perm()
+		}
+	}
+	return o.mem.WriteFile(name, data, perm)
+}
+
+// Remove removes what was written to the overlay; the files of base cannot
+// be removed.
+func (o *overlay) Remove(name string) error {
+	if _, err := o.mem.Stat(name); err == nil {
+		return o.mem.Remove(name)
+	}
+	if _, err := o.base.Stat(name); err == nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+}
@@ -0,0 +1,52 @@
+// Package vfs is the file system that generation and settings work on: the
+// disk, memory, or an overlay that keeps writes in memory over another file
+// system, which is how dry runs are made.
+//
+// Names are paths as filepath builds them, absolute or relative to the
+// working directory, rather than the slash-separated paths of fs.FS.
+package vfs
+
+import (
+	"io/fs"
+	"os"
+)
+
+// FS reads and writes files.
+type FS interface {
+	ReadFile(name string) ([]byte, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Stat(name string) (fs.FileInfo, error)
+	MkdirAll(name string, perm fs.FileMode) error
+	// WriteFile replaces the content of name as a whole: readers see the
+	// old content or the new, never a part. An existing file keeps its
+	// permissions; a new one gets perm, less the umask on disk.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	// Remove removes the file or empty directory name.
+	Remove(name string) error
+}
+
+// Or returns fsys, or Disk when fsys is nil.
+func Or(fsys FS) FS {
+	if fsys == nil {
+		return Disk
+	}
+	return fsys
+}
+
+// Exists reports whether name exists in fsys and is not a directory.
+func Exists(fsys FS, name string) bool {
+	info, err := fsys.Stat(name)
+	return err == nil && !info.IsDir()
+}
+
+// Disk is the real file system.
+var Disk FS = disk{}
+
+type disk struct{}
+
+func (disk) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (disk) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (disk) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+
+func (disk) MkdirAll(name string, perm fs.FileMode) error { return os.MkdirAll(name, perm) }
+func (disk) Remove(name string) error                     { return os.Remove(name) }
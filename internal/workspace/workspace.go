@@ -0,0 +1,66 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the workspace manifest looked up in the working directory.
+const FileName = "bashly-workspace.yml"
+
+// Workspace lists several bashly projects generated together.
+type Workspace struct {
+	// Path is the manifest file.
+	Path string
+	// Projects holds the absolute project directories, in manifest order.
+	Projects []string
+	// Settings overrides the settings of every project.
+	Settings map[string]any
+}
+
+type manifest struct {
+	Projects []string       `yaml:"projects"`
+	Settings map[string]any `yaml:"settings"`
+}
+
+// Load reads the manifest at path. Project directories are relative to the
+// manifest and must exist.
+func Load(path string) (*Workspace, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, fmt.Errorf("read workspace: %w", err)
+	}
+	var m manifest
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("parse workspace file %s: %w", abs, err)
+	}
+	if len(m.Projects) == 0 {
+		return nil, fmt.Errorf("%s: projects must list at least one project directory", abs)
+	}
+
+	ws := &Workspace{Path: abs, Settings: m.Settings}
+	seen := map[string]bool{}
+	for _, p := range m.Projects {
+		dir := p
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(abs), dir)
+		}
+		dir = filepath.Clean(dir)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("%s: project %q is not a directory", abs, p)
+		}
+		if seen[dir] {
+			return nil, fmt.Errorf("%s: project %q is listed twice", abs, p)
+		}
+		seen[dir] = true
+		ws.Projects = append(ws.Projects, dir)
+	}
+	return ws, nil
+}
@@ -1,17 +1,50 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	goruntime "runtime"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/dimitar-trifonov/go-bashly/internal/bashlyconfig"
+	"github.com/dimitar-trifonov/go-bashly/internal/bench"
+	"github.com/dimitar-trifonov/go-bashly/internal/buildinfo"
 	"github.com/dimitar-trifonov/go-bashly/internal/commandmodel"
+	"github.com/dimitar-trifonov/go-bashly/internal/compat"
+	"github.com/dimitar-trifonov/go-bashly/internal/configedit"
+	"github.com/dimitar-trifonov/go-bashly/internal/doctor"
 	"github.com/dimitar-trifonov/go-bashly/internal/generate"
+	"github.com/dimitar-trifonov/go-bashly/internal/golden"
+	"github.com/dimitar-trifonov/go-bashly/internal/logging"
+	"github.com/dimitar-trifonov/go-bashly/internal/lsp"
+	"github.com/dimitar-trifonov/go-bashly/internal/modelcache"
+	"github.com/dimitar-trifonov/go-bashly/internal/pager"
+	"github.com/dimitar-trifonov/go-bashly/internal/progress"
+	"github.com/dimitar-trifonov/go-bashly/internal/project"
+	"github.com/dimitar-trifonov/go-bashly/internal/render"
+	"github.com/dimitar-trifonov/go-bashly/internal/runtime"
+	"github.com/dimitar-trifonov/go-bashly/internal/scaffold"
 	"github.com/dimitar-trifonov/go-bashly/internal/settings"
+	"github.com/dimitar-trifonov/go-bashly/internal/term"
+	"github.com/dimitar-trifonov/go-bashly/internal/ui"
+	"github.com/dimitar-trifonov/go-bashly/internal/upgrade"
+	"github.com/dimitar-trifonov/go-bashly/internal/vfs"
+	"github.com/dimitar-trifonov/go-bashly/internal/workspace"
+	"gopkg.in/yaml.v3"
 )
 
 func main() {
@@ -28,6 +61,34 @@ func main() {
 		runInspect(os.Args[2:])
 	case "generate":
 		runGenerate(os.Args[2:])
+	case "run":
+		runRun(os.Args[2:])
+	case "completions":
+		runCompletions(os.Args[2:])
+	case "test":
+		runTest(os.Args[2:])
+	case "upgrade":
+		runUpgrade(os.Args[2:])
+	case "compat":
+		runCompat(os.Args[2:])
+	case "diff":
+		runDiff(os.Args[2:])
+	case "init":
+		runInit(os.Args[2:])
+	case "doctor":
+		runDoctor(os.Args[2:])
+	case "verify":
+		runVerify(os.Args[2:])
+	case "bench":
+		runBench(os.Args[2:])
+	case "lsp":
+		runLsp(os.Args[2:])
+	case "ui":
+		runUi(os.Args[2:])
+	case "add":
+		runAdd(os.Args[2:])
+	case "config":
+		runConfig(os.Args[2:])
 	case "help", "--help", "-h":
 		printUsage()
 	default:
@@ -38,7 +99,7 @@ func main() {
 }
 
 func printVersion() {
-	fmt.Println("go-bashly version 0.1.0")
+	fmt.Println("go-bashly version " + buildinfo.Version)
 	fmt.Println("A Go clone of bashly CLI generator")
 }
 
@@ -47,169 +108,1881 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Usage:")
 	fmt.Fprintln(os.Stderr, "  go-bashly version")
-	fmt.Fprintln(os.Stderr, "  go-bashly inspect [--config <path>] [--workdir <dir>] [--format tree|json]")
-	fmt.Fprintln(os.Stderr, "  go-bashly generate [--config <path>] [--workdir <dir>] [--force] [--dry-run]")
+	fmt.Fprintln(os.Stderr, "  go-bashly init [--workdir <dir>] [--wizard] [--force]")
+	fmt.Fprintln(os.Stderr, "  go-bashly inspect [--config <path>] [--workdir <dir>] [--profile <name>] [--format tree|json|yaml|toggles|xref|needs|env|csv|tsv] [--depth <n>] [--ascii] [--disabled] [--only <path>]")
+	fmt.Fprintln(os.Stderr, "  go-bashly generate [--config <path>] [--workdir <dir>] [--profile <name>] [--force] [--dry-run] [--skip-partials | --partials-only] [--check-compat <baseline.json>] [--only <path>|usage|completions] [--all [--workspace <path>]] [--watch [--exec <cmd>] [--on-error <cmd>]]")
+	fmt.Fprintln(os.Stderr, "  go-bashly run [--config <path>] [--workdir <dir>] -- <args>")
+	fmt.Fprintln(os.Stderr, "  go-bashly completions [--config <path>] [--workdir <dir>] [--shell bash|zsh|fish] [--output <file> | --install]")
+	fmt.Fprintln(os.Stderr, "  go-bashly test --golden <dir> [--config <path>] [--workdir <dir>] [--update]")
+	fmt.Fprintln(os.Stderr, "  go-bashly upgrade [--config <path>] [--workdir <dir>] [--dry-run]")
+	fmt.Fprintln(os.Stderr, "  go-bashly compat --fixture-dir <dir> [--bashly <cmd>]")
+	fmt.Fprintln(os.Stderr, "  go-bashly doctor [--config <path>] [--workdir <dir>]")
+	fmt.Fprintln(os.Stderr, "  go-bashly verify [--config <path>] [--workdir <dir>] [--profile <name>] [--define key=value] [<script>...]")
+	fmt.Fprintln(os.Stderr, "  go-bashly diff [--workdir <dir>] [--format text|json] [--fail-on-breaking] <old> <new>")
+	fmt.Fprintln(os.Stderr, "  go-bashly bench [--commands <n>] [--runs <n>] [--budget <dur>] [--workdir <dir>] [--format text|json]")
+	fmt.Fprintln(os.Stderr, "  go-bashly lsp [--config <path>] [--workdir <dir>]")
+	fmt.Fprintln(os.Stderr, "  go-bashly ui [--config <path>] [--workdir <dir>] [--profile <name>] [--define key=value]")
+	fmt.Fprintln(os.Stderr, "  go-bashly add github-action [--config <path>] [--workdir <dir>] [--go-bashly-version <version>] [--force]")
+	fmt.Fprintln(os.Stderr, "  go-bashly config get|set|delete <path> [value] [--config <path>] [--workdir <dir>] [--settings]")
+	fmt.Fprintln(os.Stderr, "  go-bashly add command <name> [--config <path>] [--workdir <dir>] [--template <name>] [--description <text>] [--parent <path>] [--show-template]")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Options:")
-	fmt.Fprintln(os.Stderr, "  --config <path>  Path to bashly.yml (default: src/bashly.yml)")
+	fmt.Fprintln(os.Stderr, "  --config <path>  Path to bashly.yml, or - to read it from stdin (default: src/bashly.yml)")
 	fmt.Fprintln(os.Stderr, "  --workdir <dir>  Working directory (default: .)")
-	fmt.Fprintln(os.Stderr, "  --format <fmt>   Output format for inspect: tree or json (default: tree)")
+	fmt.Fprintln(os.Stderr, "  --format <fmt>   Output format for inspect: tree, json, yaml, toggles, xref, needs, env, csv or tsv (default: tree)")
+	fmt.Fprintln(os.Stderr, "  --depth <n>      Levels of subcommands shown by the inspect tree (default: 0, all)")
+	fmt.Fprintln(os.Stderr, "  --ascii          Draw the inspect tree with ASCII connectors")
+	fmt.Fprintln(os.Stderr, "  --disabled       Include disabled commands in inspect, marked (disabled)")
 	fmt.Fprintln(os.Stderr, "  --force         Overwrite existing files")
+	fmt.Fprintln(os.Stderr, "  --wizard        Ask for the name, description, commands and libs of the new project (init)")
 	fmt.Fprintln(os.Stderr, "  --dry-run       Show what would be generated without writing files")
+	fmt.Fprintln(os.Stderr, "  --skip-partials  Render the script without touching the source dir")
+	fmt.Fprintln(os.Stderr, "  --partials-only  Scaffold partials without rendering the script")
+	fmt.Fprintln(os.Stderr, "  --check-compat <file>  Fail if generate would break the public commands of an inspect JSON baseline")
+	fmt.Fprintln(os.Stderr, "  --watch          Generate again each time the project files change (generate)")
+	fmt.Fprintln(os.Stderr, "  --exec <cmd>     With --watch, run a shell command after each successful generation, e.g. \"bats test\"")
+	fmt.Fprintln(os.Stderr, "  --on-error <cmd> With --watch, run a shell command after each failed generation")
+	fmt.Fprintln(os.Stderr, "  --all           Generate every project of the workspace (bashly-workspace.yml)")
+	fmt.Fprintln(os.Stderr, "  --only <path>    Limit inspect, or the partials generate scaffolds, to a command and its subcommands (repeatable)")
+	fmt.Fprintln(os.Stderr, "  --only usage|completions  Re-render only the usage functions of the script, or its bash completions")
+	fmt.Fprintln(os.Stderr, "  --shell <shell>  Shell for completions: bash, zsh or fish (default: bash)")
+	fmt.Fprintln(os.Stderr, "  --output <file>  Write completions to a file instead of stdout")
+	fmt.Fprintln(os.Stderr, "  --install        Install completions where the shell loads them (default shell: $SHELL)")
+	fmt.Fprintln(os.Stderr, "  --golden <dir>   Directory of golden scripts to compare the generated scripts with")
+	fmt.Fprintln(os.Stderr, "  --update         Write the generated scripts to the golden directory instead of failing")
+	fmt.Fprintln(os.Stderr, "  --profile <name> Apply an entry of the config's profiles (inspect, generate)")
+	fmt.Fprintln(os.Stderr, "  --define <k=v>  Set a variable for command \"if\" conditions (inspect, generate, run, verify; repeatable)")
+	fmt.Fprintln(os.Stderr, "  --fail-on-breaking  Exit with status 1 when diff finds breaking changes")
+	fmt.Fprintln(os.Stderr, "  --go-bashly-version <v>  Version of go-bashly the added workflow installs (default: latest)")
+	fmt.Fprintln(os.Stderr, "  --template <name>  Archetype of the added command: basic, crud or one of <source_dir>/archetypes (default: basic)")
+	fmt.Fprintln(os.Stderr, "  --description <text>  Help text of the added command")
+	fmt.Fprintln(os.Stderr, "  --parent <path>  Command to add the command under, e.g. \"db\" (default: the root)")
+	fmt.Fprintln(os.Stderr, "  --show-template  Print the archetype of add command instead of adding one")
+	fmt.Fprintln(os.Stderr, "  --settings       Edit settings.yml instead of bashly.yml (config)")
+	fmt.Fprintln(os.Stderr, "  --commands <n>   Commands in the synthetic bench project (default: 500)")
+	fmt.Fprintln(os.Stderr, "  --runs <n>       Times bench measures each stage (default: 5)")
+	fmt.Fprintln(os.Stderr, "  --budget <dur>   Fail bench when a full generation takes longer on average")
+	fmt.Fprintln(os.Stderr, "  --cpu-profile <file>  Write a pprof CPU profile (generate, bench)")
+	fmt.Fprintln(os.Stderr, "  --mem-profile <file>  Write a pprof heap profile (generate, bench)")
+	fmt.Fprintln(os.Stderr, "  --timeout <dur>  Give up after this long, e.g. 30s (inspect, generate, run, completions, test, diff, doctor)")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Logging options (all commands except version):")
+	fmt.Fprintln(os.Stderr, "  --verbose            Explain each step: settings origin, files written or skipped, formatter used")
+	fmt.Fprintln(os.Stderr, "  --quiet              Only print errors")
+	fmt.Fprintln(os.Stderr, "  --log-format <fmt>   Log line format: text or json (default: text)")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Terminal options (all commands except version):")
+	fmt.Fprintln(os.Stderr, "  --color <when>       Color output: auto, always or never (default: auto)")
+	fmt.Fprintln(os.Stderr, "  --no-color           Same as --color=never")
+	fmt.Fprintln(os.Stderr, "  --width <n>          Line width of the inspect tree (default: $COLUMNS or the terminal width)")
 }
 
-func runInspect(args []string) {
-	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+// defineFlags collects repeated --define key=value flags.
+type defineFlags map[string]string
+
+func (d defineFlags) String() string {
+	pairs := make([]string, 0, len(d))
+	for k, v := range d {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (d defineFlags) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	d[strings.TrimSpace(key)] = value
+	return nil
+}
+
+// pathFlags collects repeated command path flags such as --only "db migrate".
+type pathFlags []string
+
+func (p *pathFlags) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pathFlags) Set(s string) error {
+	path := strings.Join(strings.Fields(s), " ")
+	if path == "" {
+		return fmt.Errorf("expected a command path such as \"db migrate\"")
+	}
+	*p = append(*p, path)
+	return nil
+}
+
+// flagSet reports whether the flag name was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// setupLogging installs the logger configured by the shared logging flags.
+func setupLogging(o *logging.Options, t *term.Options) {
+	if err := t.Setup(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	o.Color = term.Color(os.Stderr)
+	if err := o.Setup(os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+// atExit holds the functions exit runs before the process ends, such as
+// stopping the profiles of a failing command.
+var atExit []func()
+
+// exit runs the atExit functions, newest first, and exits with code.
+func exit(code int) {
+	for i := len(atExit) - 1; i >= 0; i-- {
+		atExit[i]()
+	}
+	os.Exit(code)
+}
+
+// addTimeoutFlag registers the --timeout flag of the commands that load a
+// project.
+func addTimeoutFlag(fs *flag.FlagSet) *time.Duration {
+	return fs.Duration("timeout", 0, "Give up after this long, e.g. 30s (default: no limit)")
+}
+
+// commandContext returns the context of a command: it is cancelled on
+// interrupt and, with a positive timeout, once the timeout elapses.
+func commandContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, fmt.Errorf("timed out after %s", timeout))
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+func runInit(args []string) {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
 
-	configPath := fs.String("config", "", "Path to bashly.yml")
-	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
-	format := fs.String("format", "tree", "Output format: tree or json")
+	workdir := fs.String("workdir", "", "Directory of the new project (defaults to current directory)")
+	wizard := fs.Bool("wizard", false, "Ask for the name, description, commands and libs of the project")
+	force := fs.Bool("force", false, "Overwrite an existing config and lib files")
 	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
 
-	wd := *workdir
-	if wd == "" {
-		var err error
-		wd, err = os.Getwd()
+	wd, err := project.ResolveWorkdir(*workdir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	resolved, err := settings.Load(wd, settings.LoadOptions{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	st := resolved.Settings
+	configPath := st.ConfigPath
+	if !filepath.IsAbs(configPath) {
+		configPath = filepath.Join(wd, configPath)
+	}
+	if _, err := os.Stat(configPath); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "%s already exists (use --force to overwrite)\n", configPath)
+		os.Exit(1)
+	}
+
+	answers := scaffold.Defaults(wd)
+	if *wizard {
+		answers, err = scaffold.Ask(os.Stdin, os.Stderr, answers)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
 	}
-	wd, err := filepath.Abs(wd)
+	written, err := scaffold.Write(configPath, filepath.Join(wd, st.SourceDir, st.LibDir), answers, *force)
+	for _, path := range written {
+		if !logOpts.Quiet {
+			fmt.Fprintln(os.Stdout, "created:", path)
+		}
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
-	st, err := settings.Load(wd)
+	p, err := project.Load(configPath, wd)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
-
-	config := *configPath
-	if config == "" {
-		config = st.ConfigPath
+	generateProject(context.Background(), p, generateOptions{Quiet: logOpts.Quiet, SkipScript: true})
+	if !logOpts.Quiet {
+		fmt.Fprintln(os.Stdout, "run go-bashly generate to create the script")
 	}
+}
 
-	cfg, err := bashlyconfig.LoadComposedConfig(config, "import", wd)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+func runInspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	configPath := fs.String("config", "", "Path to bashly.yml")
+	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
+	format := fs.String("format", "tree", "Output format: tree, json, yaml, toggles, xref, needs, env, csv or tsv")
+	profile := fs.String("profile", "", "Config profile to apply")
+	depth := fs.Int("depth", 0, "Levels of subcommands shown by the tree format (0: all)")
+	ascii := fs.Bool("ascii", false, "Draw the tree format with ASCII connectors")
+	disabled := fs.Bool("disabled", false, "Include the commands declared with disabled: true")
+	timeout := addTimeoutFlag(fs)
+	defines := defineFlags{}
+	fs.Var(defines, "define", "Set a variable for command \"if\" conditions (key=value, repeatable)")
+	var only pathFlags
+	fs.Var(&only, "only", "Only load this command path with its parents and subcommands (repeatable)")
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+
+	if *depth < 0 {
+		fmt.Fprintln(os.Stderr, "--depth must not be negative")
 		os.Exit(1)
 	}
 
-	root, err := commandmodel.BuildFromConfigMap(cfg, st)
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+	p, err := project.LoadContext(ctx, *configPath, *workdir, project.Options{Defines: defines, Profile: *profile, Only: only, KeepDisabled: *disabled})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
-	if err := writeInspectOutput(os.Stdout, *format, root, st); err != nil {
+	tree := commandmodel.TreePrintOptions{MaxDepth: *depth, ASCII: *ascii, Width: term.Width(os.Stdout)}
+	if err := writeInspectOutput(os.Stdout, *format, p, tree); err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 }
 
-func writeInspectOutput(w io.Writer, format string, root *commandmodel.Command, st settings.Settings) error {
+// writeInspectOutput prints the project in format; tree carries the depth
+// and connector style of the tree format.
+func writeInspectOutput(w io.Writer, format string, p *project.Project, tree commandmodel.TreePrintOptions) error {
+	root, st := p.Root, p.Settings
 	switch format {
 	case "tree", "":
-		commandmodel.PrintTree(w, root, commandmodel.TreePrintOptions{
-			ShowDetails:   true,
-			RevealPrivate: st.RevealPrivate(),
-		})
+		tree.ShowDetails = true
+		tree.RevealPrivate = st.RevealPrivate()
+		commandmodel.PrintTree(w, root, tree)
 		return nil
 	case "json":
 		enc := json.NewEncoder(w)
 		enc.SetIndent("", "  ")
-		return enc.Encode(root)
+		return enc.Encode(p.Inspect())
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(commandmodel.NormalizedConfig(p.Config, root)); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "toggles":
+		return writeTogglesTable(w, st)
+	case "xref":
+		return commandmodel.PrintCrossReference(w, root)
+	case "needs":
+		return commandmodel.PrintNeeds(w, root)
+	case "env":
+		return commandmodel.PrintEnvVars(w, root, st.RevealPrivate())
+	case "csv":
+		return commandmodel.WriteSurfaceTable(w, root, ',', st.RevealPrivate())
+	case "tsv":
+		return commandmodel.WriteSurfaceTable(w, root, '\t', st.RevealPrivate())
 	default:
-		return fmt.Errorf("unknown --format: %s (expected tree or json)", format)
+		return fmt.Errorf("unknown --format: %s (expected tree, json, yaml, toggles, xref, needs, env, csv or tsv)", format)
 	}
 }
 
+// writeTogglesTable prints each enable_* setting with its effective state in
+// every declared environment; the current env is marked with '*'.
+func writeTogglesTable(w io.Writer, st settings.Settings) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"SETTING", "VALUE"}
+	for _, env := range st.Environments {
+		if env == st.Env {
+			env += "*"
+		}
+		header = append(header, strings.ToUpper(env))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, t := range st.Toggles() {
+		row := []string{t.Key, t.Value}
+		for _, env := range st.Environments {
+			state := "off"
+			if settings.IsEnabled(t.Value, env) {
+				state = "on"
+			}
+			row = append(row, state)
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
 func runGenerate(args []string) {
 	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
 
 	configPath := fs.String("config", "", "Path to bashly.yml")
 	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
 	force := fs.Bool("force", false, "Overwrite existing partial files")
 	dryRun := fs.Bool("dry-run", false, "Print planned changes without writing files")
+	all := fs.Bool("all", false, "Generate every project listed in the workspace manifest")
+	workspacePath := fs.String("workspace", "", "Workspace manifest used by --all (default: bashly-workspace.yml in the workdir)")
+	profile := fs.String("profile", "", "Config profile to apply")
+	skipPartials := fs.Bool("skip-partials", false, "Render the script without creating or updating partials")
+	partialsOnly := fs.Bool("partials-only", false, "Scaffold partials without rendering the script")
+	checkCompat := fs.String("check-compat", "", "Fail without writing files if the config breaks the public commands of this inspect JSON baseline")
+	watch := fs.Bool("watch", false, "Generate again each time the project files change, until interrupted")
+	execCmd := fs.String("exec", "", "With --watch, shell command run after each successful generation, e.g. \"bats test\"")
+	onError := fs.String("on-error", "", "With --watch, shell command run after each failed generation")
+	timeout := addTimeoutFlag(fs)
+	defines := defineFlags{}
+	fs.Var(defines, "define", "Set a variable for command \"if\" conditions (key=value, repeatable)")
+	var only pathFlags
+	fs.Var(&only, "only", "Only scaffold the partials of this command path and its subcommands, without the script; or re-render only the usage or completions (repeatable)")
+	prof := addProfileFlags(fs)
 	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+	defer prof.start()()
 
-	wd := *workdir
-	if wd == "" {
-		var err error
-		wd, err = os.Getwd()
+	if *skipPartials && *partialsOnly {
+		fmt.Fprintln(os.Stderr, "--skip-partials cannot be combined with --partials-only")
+		exit(1)
+	}
+	if len(only) > 0 && (*skipPartials || *checkCompat != "" || *all) {
+		fmt.Fprintln(os.Stderr, "--only cannot be combined with --skip-partials, --check-compat or --all")
+		exit(1)
+	}
+	if *watch && (*dryRun || *all || len(only) > 0 || *checkCompat != "") {
+		fmt.Fprintln(os.Stderr, "--watch cannot be combined with --dry-run, --all, --only or --check-compat")
+		exit(1)
+	}
+	if !*watch && (*execCmd != "" || *onError != "") {
+		fmt.Fprintln(os.Stderr, "--exec and --on-error need --watch")
+		exit(1)
+	}
+	var sections []string
+	for _, o := range only {
+		if generate.IsSection(o) {
+			sections = append(sections, o)
+		}
+	}
+	if len(sections) > 0 && (len(sections) < len(only) || *partialsOnly) {
+		fmt.Fprintln(os.Stderr, "--only usage and --only completions cannot be combined with command paths or --partials-only")
+		exit(1)
+	}
+	// A script of part of the tree would replace the whole CLI, so --only
+	// leaves the script alone.
+	opts := generateOptions{Force: *force, DryRun: *dryRun, Quiet: logOpts.Quiet, Progress: !logOpts.Quiet && !logOpts.Verbose && !*dryRun, SkipPartials: *skipPartials, SkipScript: *partialsOnly || len(only) > 0}
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+	if len(sections) > 0 {
+		p, err := project.LoadContext(ctx, *configPath, *workdir, project.Options{Defines: defines, Profile: *profile})
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
-			os.Exit(1)
+			exit(1)
+		}
+		generateSections(ctx, p, sections, opts)
+		return
+	}
+	if *watch {
+		// Each run rewrites the script of the last one, but partials being
+		// edited only get scaffolded when new.
+		opts.ForceScript = true
+		wd, err := project.ResolveWorkdir(*workdir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			exit(1)
+		}
+		cache := modelcache.New(*configPath, wd, project.Options{Defines: defines, Profile: *profile})
+		watchProject(ctx, cache, wd, opts, *execCmd, *onError)
+		return
+	}
+	if !*all {
+		p, err := project.LoadContext(ctx, *configPath, *workdir, project.Options{Defines: defines, Profile: *profile, Only: only})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			exit(1)
+		}
+		if *checkCompat != "" {
+			checkBaseline(*checkCompat, p.Root)
+		}
+		generateProject(ctx, p, opts)
+		return
+	}
+
+	if *configPath != "" {
+		fmt.Fprintln(os.Stderr, "--config cannot be combined with --all")
+		exit(1)
+	}
+	if *checkCompat != "" {
+		fmt.Fprintln(os.Stderr, "--check-compat cannot be combined with --all")
+		exit(1)
+	}
+	path := *workspacePath
+	if path == "" {
+		wd, err := project.ResolveWorkdir(*workdir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			exit(1)
 		}
+		path = filepath.Join(wd, workspace.FileName)
 	}
-	wd, err := filepath.Abs(wd)
+	ws, err := workspace.Load(path)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+		exit(1)
 	}
+	for _, dir := range ws.Projects {
+		p, err := project.LoadContext(ctx, "", dir, project.Options{Defines: defines, Overrides: ws.Settings, Profile: *profile})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", dir, err)
+			exit(1)
+		}
+		slog.Debug("generating workspace project", "dir", dir)
+		generateProject(ctx, p, opts)
+	}
+}
 
-	st, err := settings.Load(wd)
+// checkBaseline exits with the breaking changes of root against the
+// command tree of an inspect JSON baseline, if there are any.
+func checkBaseline(path string, root *commandmodel.Command) {
+	baseline, err := project.LoadInspectedRoot(path)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+		exit(1)
+	}
+	breaking := commandmodel.BreakingChanges(baseline, root)
+	if len(breaking) == 0 {
+		slog.Debug("no breaking changes", "baseline", path)
+		return
 	}
+	fmt.Fprintf(os.Stderr, "breaking changes against %s:\n", path)
+	_ = commandmodel.PrintDiff(os.Stderr, breaking, term.Color(os.Stderr))
+	exit(1)
+}
 
-	config := *configPath
-	if config == "" {
-		config = st.ConfigPath
+type generateOptions struct {
+	Force        bool
+	ForceScript  bool // overwrite the scripts, without Force for partials
+	DryRun       bool
+	Quiet        bool
+	Progress     bool // report progress on stderr
+	SkipPartials bool // render the scripts without touching the source dir
+	SkipScript   bool // scaffold partials without rendering the scripts
+}
+
+// fs returns the file system to generate into: with DryRun, writes are
+// kept in memory, so that the files reported are exactly the ones a real
+// run would write.
+func (o generateOptions) fs() vfs.FS {
+	if o.DryRun {
+		return vfs.Overlay(vfs.Disk)
 	}
+	return vfs.Disk
+}
 
-	cfg, err := bashlyconfig.LoadComposedConfig(config, "import", wd)
+// generateProject writes the partials and master scripts of p and reports
+// the files created; it exits on errors.
+func generateProject(ctx context.Context, p *project.Project, opts generateOptions) {
+	res, masters, err := writeProject(ctx, p, opts)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+		exit(1)
+	}
+	printGenerated(res, masters, opts)
+}
+
+// printGenerated reports the files a generation wrote, and its warnings.
+func printGenerated(res generate.Result, masters []generate.MasterResult, opts generateOptions) {
+	for _, master := range masters {
+		for _, w := range master.Warnings {
+			slog.Warn(w)
+		}
+	}
+
+	if opts.DryRun {
+		for _, p := range res.Created {
+			fmt.Fprintln(os.Stdout, p)
+		}
+		for _, p := range res.Updated {
+			fmt.Fprintln(os.Stdout, p)
+		}
+		for _, p := range res.Rejected {
+			fmt.Fprintln(os.Stdout, p)
+		}
+		for _, master := range masters {
+			if master.Written {
+				fmt.Fprintln(os.Stdout, master.Path)
+			}
+		}
+		return
+	}
+	for _, p := range res.Rejected {
+		slog.Warn("edited scaffold lines were not merged", "rejects", p)
+	}
+	if opts.Quiet {
+		return
+	}
+
+	for _, p := range res.Created {
+		fmt.Fprintln(os.Stdout, "created:", p)
+	}
+	for _, p := range res.Updated {
+		fmt.Fprintln(os.Stdout, "updated:", p)
+	}
+	for _, master := range masters {
+		if master.Written {
+			fmt.Fprintln(os.Stdout, "created:", master.Path)
+		}
+	}
+}
+
+// watchProject generates the project of cache, and again each time its
+// files change, until ctx is done. After a successful run, execCmd is run
+// with sh -c in workdir; after a failed one, onError is, with the error in
+// $GO_BASHLY_ERROR. Errors of either run are printed and the watch goes on.
+func watchProject(ctx context.Context, cache *modelcache.Cache, workdir string, opts generateOptions, execCmd string, onError string) {
+	changed := make(chan struct{}, 1)
+	cache.OnInvalidate(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	go func() { _ = cache.Watch(ctx, 0) }()
+	if !opts.Quiet {
+		fmt.Fprintf(os.Stderr, "watching %s for changes (press Ctrl-C to stop)\n", workdir)
+	}
+	for {
+		p, err := cache.Project(ctx)
+		var res generate.Result
+		var masters []generate.MasterResult
+		if err == nil {
+			res, masters, err = writeProject(ctx, p, opts)
+			// The partials the run scaffolded are not a change to act on.
+			cache.Refresh()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			runHook(ctx, workdir, "on-error", onError, "GO_BASHLY_ERROR="+err.Error())
+		} else {
+			printGenerated(res, masters, opts)
+			runHook(ctx, workdir, "exec", execCmd)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+			slog.Debug("project files changed, generating again", "workdir", workdir)
+		}
+	}
+}
+
+// runHook runs the shell command of a --watch hook in workdir, with env
+// added to the environment; a failure is logged.
+func runHook(ctx context.Context, workdir string, name string, command string, env ...string) {
+	if command == "" {
+		return
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = workdir
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	slog.Debug("running hook", "hook", name, "command", command)
+	if err := cmd.Run(); err != nil && ctx.Err() == nil {
+		slog.Warn("hook failed", "hook", name, "command", command, "error", err)
+	}
+}
+
+// generateSections re-renders the given sections of the scripts of p,
+// leaving partials and the rest of the scripts untouched, and reports the
+// files changed; it exits on errors.
+func generateSections(ctx context.Context, p *project.Project, sections []string, opts generateOptions) {
+	scripts, err := scriptProjects(p)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		exit(1)
+	}
+
+	gopts := generate.Options{Workdir: p.Workdir, FS: opts.fs()}
+	for _, sp := range scripts {
+		for _, section := range sections {
+			var res generate.MasterResult
+			var err error
+			if section == generate.SectionUsage {
+				res, err = generate.UpdateUsage(ctx, sp.Root, p.Settings, gopts)
+			} else {
+				res, err = generate.WriteCompletions(sp.Root, p.Settings, gopts)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				exit(1)
+			}
+			for _, w := range res.Warnings {
+				slog.Warn(w)
+			}
+			switch {
+			case !res.Written:
+				slog.Debug("unchanged", "section", section, "path", res.Path)
+			case opts.DryRun:
+				fmt.Fprintln(os.Stdout, res.Path)
+			case !opts.Quiet:
+				fmt.Fprintln(os.Stdout, "updated:", res.Path)
+			}
+		}
+	}
+}
+
+// writeProject writes the partials and master scripts of p; the partials
+// are undone when a script fails to render. With opts.Progress, the
+// partial or script being written is shown on a terminal stderr, and a
+// summary is printed to any other stderr.
+func writeProject(ctx context.Context, p *project.Project, opts generateOptions) (generate.Result, []generate.MasterResult, error) {
+	wd, st := p.Workdir, p.Settings
+	gopts := generate.Options{Workdir: wd, Force: opts.Force, FS: opts.fs()}
+	var report *progress.Reporter
+	if opts.Progress {
+		report = progress.New(os.Stderr)
+		gopts.Progress = report.Step
+	}
+	defer report.Clear()
+
+	var res generate.Result
+	if !opts.SkipPartials {
+		var err error
+		if res, err = generate.EnsureCommandPartials(ctx, p.Root, st, gopts); err != nil {
+			return res, nil, err
+		}
+		n := len(res.Created) + len(res.Updated) + len(res.Skipped)
+		report.Done(fmt.Sprintf("partials: %d checked, %d created, %d updated", n, len(res.Created), len(res.Updated)))
+	}
+	if opts.SkipScript {
+		return res, nil, nil
+	}
+	scripts, err := scriptProjects(p)
+	if err != nil {
+		return res, nil, err
+	}
+	var masters []generate.MasterResult
+	gopts.Force = opts.Force || opts.ForceScript
+	for _, sp := range scripts {
+		report.Status("rendering " + sp.Root.Name)
+		master, err := generate.EnsureMasterScript(ctx, sp.Root, st, gopts)
+		if err != nil {
+			// Leave no partials behind for a script that was not written.
+			if rerr := res.Rollback(); rerr != nil {
+				err = errors.Join(err, rerr)
+			}
+			return generate.Result{}, masters, err
+		}
+		masters = append(masters, master)
+	}
+	return res, masters, nil
+}
+
+// scriptProjects returns the projects of the scripts of p: with variants,
+// each variant is a script of its own; otherwise the whole config is
+// generated as a single script.
+func scriptProjects(p *project.Project) ([]*project.Project, error) {
+	if len(p.Settings.Variants) == 0 {
+		return []*project.Project{p}, nil
+	}
+	var scripts []*project.Project
+	for _, v := range p.Settings.Variants {
+		vp, err := p.Variant(v)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, vp)
 	}
+	return scripts, nil
+}
+
+func runRun(args []string) {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	configPath := fs.String("config", "", "Path to bashly.yml")
+	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
+	timeout := addTimeoutFlag(fs)
+	defines := defineFlags{}
+	fs.Var(defines, "define", "Set a variable for command \"if\" conditions (key=value, repeatable)")
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
 
-	root, err := commandmodel.BuildFromConfigMap(cfg, st)
+	// The timeout covers loading the project, not the command run.
+	ctx, cancel := commandContext(*timeout)
+	p, err := project.LoadContext(ctx, *configPath, *workdir, project.Options{Defines: defines})
+	cancel()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
+	wd, st, root := p.Workdir, p.Settings, p.Root
 
-	res, err := generate.EnsureCommandPartials(root, st, generate.Options{
+	if argv := fs.Args(); len(argv) > 0 && argv[0] == "help" && generate.HelpCommandEnabled(root, st) {
+		runHelpCommand(root, argv[1:])
+		return
+	}
+	if argv := fs.Args(); len(argv) > 0 && argv[0] == "completions" && generate.CompletionsCommandEnabled(root, st) {
+		runCompletionsCommand(root, argv[1:])
+		return
+	}
+
+	libs, err := generate.MergeLibs(vfs.Disk, filepath.Join(wd, st.SourceDir), st.LibDir, st.ExtraLibDirs, st.LibNamespaces)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	help, code, err := runtime.Execute(fs.Args(), root, st, runtime.ExecOptions{
 		Workdir: wd,
-		Force:   *force,
-		DryRun:  *dryRun,
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		Libs:    libs,
 	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err.Error())
+		var unknown *runtime.UnknownCommandError
+		if errors.As(err, &unknown) && len(unknown.Suggestions) > 0 {
+			fmt.Fprintf(os.Stderr, "Did you mean: %s?\n", strings.Join(unknown.Suggestions, ", "))
+		}
+		os.Exit(runtime.ExitCode(err))
+	}
+	if help != "" {
+		if st.Enabled(st.EnableHelpPager) {
+			_ = pager.Print(os.Stdout, help)
+		} else {
+			fmt.Fprint(os.Stdout, help)
+		}
+	}
+	os.Exit(code)
+}
+
+// runHelpCommand mirrors the help meta-command of generated scripts:
+// list the commands, or those matching --search TERM.
+func runHelpCommand(root *commandmodel.Command, args []string) {
+	term := ""
+	switch {
+	case len(args) == 0:
+	case args[0] == "--search" || args[0] == "-s":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "ERROR: flag requires an argument:", args[0])
+			os.Exit(root.ExitCode)
+		}
+		term = args[1]
+	default:
+		fmt.Fprintln(os.Stderr, "ERROR: invalid option:", args[0])
+		os.Exit(root.ExitCode)
+	}
+	matches := generate.SearchCommands(render.CommandIndex(root, render.UsageOptions{}), term)
+	if len(matches) == 0 {
+		fmt.Fprintln(os.Stderr, "no commands match:", term)
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stdout, render.DefaultStrings["commands"])
+	for _, line := range matches {
+		fmt.Fprintln(os.Stdout, line)
+	}
+}
+
+// runCompletionsCommand mirrors the completions meta-command of generated
+// scripts: print the completion script for a shell, or install it.
+func runCompletionsCommand(root *commandmodel.Command, args []string) {
+	install := false
+	shell := generate.InstallShell()
+	for _, arg := range args {
+		switch {
+		case arg == "--install":
+			install = true
+		case slices.Contains(generate.CompletionShells, arg):
+			shell = arg
+		case strings.HasPrefix(arg, "-"):
+			fmt.Fprintln(os.Stderr, "ERROR: invalid option:", arg)
+			os.Exit(root.ExitCode)
+		default:
+			fmt.Fprintln(os.Stderr, "ERROR: unsupported shell:", arg)
+			os.Exit(root.ExitCode)
+		}
+	}
+	if !install {
+		script, err := generate.CompletionScript(root, shell)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprint(os.Stdout, script)
+		return
+	}
+	in, err := generate.CompletionInstallFor(root, shell)
+	if err == nil {
+		err = generate.InstallCompletion(in)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
+	fmt.Fprintln(os.Stdout, "installed:", in.Path)
+	if in.Note != "" {
+		fmt.Fprintln(os.Stdout, in.Note)
+	}
+}
 
-	master, err := generate.EnsureMasterScript(root, st, generate.Options{
-		Workdir: wd,
-		Force:   *force,
-		DryRun:  *dryRun,
-	})
+func runCompletions(args []string) {
+	fs := flag.NewFlagSet("completions", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	configPath := fs.String("config", "", "Path to bashly.yml")
+	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
+	shell := fs.String("shell", "bash", "Shell to complete for: bash, zsh or fish")
+	output := fs.String("output", "", "Write the completion script to this file instead of stdout")
+	install := fs.Bool("install", false, "Install the completion script where the shell loads it from")
+	timeout := addTimeoutFlag(fs)
+	defines := defineFlags{}
+	fs.Var(defines, "define", "Set a variable for command \"if\" conditions (key=value, repeatable)")
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+
+	if *install && *output != "" {
+		fmt.Fprintln(os.Stderr, "--install and --output cannot be combined")
+		os.Exit(1)
+	}
+	// --install completes for the login shell unless --shell says otherwise.
+	if *install && !flagSet(fs, "shell") {
+		*shell = generate.InstallShell()
+	}
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+	p, err := project.LoadContext(ctx, *configPath, *workdir, project.Options{Defines: defines})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
-	if *dryRun {
-		for _, p := range res.Created {
-			fmt.Fprintln(os.Stdout, p)
+	if *install {
+		in, err := generate.CompletionInstallFor(p.Root, *shell)
+		if err == nil {
+			err = generate.InstallCompletion(in)
 		}
-		if master.Written {
-			fmt.Fprintln(os.Stdout, master.Path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		slog.Debug("installed completion script", "path", in.Path, "shell", *shell)
+		if !logOpts.Quiet {
+			fmt.Fprintln(os.Stdout, "installed:", in.Path)
+		}
+		if in.Note != "" {
+			slog.Warn(in.Note)
 		}
 		return
 	}
 
-	for _, p := range res.Created {
-		fmt.Fprintln(os.Stdout, "created:", p)
+	script, err := generate.CompletionScript(p.Root, *shell)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if *output == "" {
+		fmt.Fprint(os.Stdout, script)
+		return
+	}
+	if err := os.WriteFile(*output, []byte(script), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	slog.Debug("wrote completion script", "path", *output, "shell", *shell)
+	if !logOpts.Quiet {
+		fmt.Fprintln(os.Stdout, "created:", *output)
+	}
+}
+
+func runTest(args []string) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	configPath := fs.String("config", "", "Path to bashly.yml")
+	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
+	goldenDir := fs.String("golden", "", "Directory of golden scripts")
+	update := fs.Bool("update", false, "Write missing or changed golden scripts instead of failing")
+	timeout := addTimeoutFlag(fs)
+	defines := defineFlags{}
+	fs.Var(defines, "define", "Set a variable for command \"if\" conditions (key=value, repeatable)")
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+
+	if *goldenDir == "" {
+		fmt.Fprintln(os.Stderr, "--golden is required")
+		os.Exit(1)
+	}
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+	p, err := project.LoadContext(ctx, *configPath, *workdir, project.Options{Defines: defines})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	projects := []*project.Project{p}
+	if len(p.Settings.Variants) > 0 {
+		projects = projects[:0]
+		for _, v := range p.Settings.Variants {
+			vp, err := p.Variant(v)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			projects = append(projects, vp)
+		}
+	}
+
+	var scripts []golden.Script
+	for _, sp := range projects {
+		code, warnings, err := generate.RenderMasterScript(ctx, sp.Root, sp.Settings, generate.Options{Workdir: sp.Workdir})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		for _, w := range warnings {
+			slog.Warn(w)
+		}
+		scripts = append(scripts, golden.Script{Name: sp.Root.Name, Content: code})
+	}
+
+	results, err := golden.Check(*goldenDir, scripts, *update)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, r := range results {
+		switch r.Status {
+		case golden.StatusDiff:
+			failed = true
+			fmt.Fprintf(os.Stdout, "DIFF %s\n%s", r.Path, r.Diff)
+		case golden.StatusMissing:
+			failed = true
+			fmt.Fprintf(os.Stdout, "MISS %s (run with --update to create it)\n", r.Path)
+		case golden.StatusUpdated:
+			if !logOpts.Quiet {
+				fmt.Fprintf(os.Stdout, "UPD  %s\n", r.Path)
+			}
+		default:
+			if !logOpts.Quiet {
+				fmt.Fprintf(os.Stdout, "OK   %s\n", r.Path)
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runUpgrade(args []string) {
+	fs := flag.NewFlagSet("upgrade", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	configPath := fs.String("config", "", "Path to bashly.yml")
+	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
+	dryRun := fs.Bool("dry-run", false, "Print a diff of the changes without writing files")
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+
+	wd, err := project.ResolveWorkdir(*workdir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	// Settings may hold deprecated values that no longer validate, so they
+	// are resolved without validation.
+	resolved, err := settings.Resolve(wd, settings.LoadOptions{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	st := resolved.Settings
+
+	var plans []*upgrade.FileUpgrade
+	if path := settings.UserSettingsPath(wd); path != "" {
+		u, err := upgrade.PlanSettings(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		plans = append(plans, u)
+	}
+
+	config := *configPath
+	if config == "" {
+		config = st.ConfigPath
+	}
+	if config == bashlyconfig.StdinPath {
+		fmt.Fprintln(os.Stderr, "upgrade edits the config in place and cannot read it from stdin")
+		os.Exit(1)
+	}
+	queue := []string{upgrade.ResolveImport(wd, config)}
+	seen := map[string]bool{}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		u, imports, err := upgrade.PlanConfig(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		plans = append(plans, u)
+		for _, imp := range imports {
+			queue = append(queue, upgrade.ResolveImport(wd, imp))
+		}
+	}
+
+	changed := 0
+	for _, u := range plans {
+		if len(u.Edits) == 0 {
+			continue
+		}
+		changed++
+		if *dryRun {
+			u.Diff(os.Stdout)
+			continue
+		}
+		if err := u.Apply(); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		if !logOpts.Quiet {
+			fmt.Fprintf(os.Stdout, "upgraded: %s (%d changes)\n", u.Path, len(u.Edits))
+		}
+	}
+	if changed == 0 && !logOpts.Quiet {
+		fmt.Fprintln(os.Stdout, "nothing to upgrade")
+	}
+}
+
+func runCompat(args []string) {
+	fs := flag.NewFlagSet("compat", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	fixtureDir := fs.String("fixture-dir", "", "Directory containing one bashly project per subdirectory")
+	bashly := fs.String("bashly", "", "Ruby bashly command (defaults to bashly on PATH, if any)")
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+
+	if *fixtureDir == "" {
+		fmt.Fprintln(os.Stderr, "--fixture-dir is required")
+		os.Exit(1)
+	}
+
+	ruby := *bashly
+	if ruby == "" {
+		if _, err := exec.LookPath("bashly"); err == nil {
+			ruby = "bashly"
+		} else {
+			slog.Warn("Ruby bashly not found; rendering with go-bashly only")
+		}
+	}
+
+	fixtures, err := compat.Fixtures(*fixtureDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, f := range fixtures {
+		rep := compat.RunFixture(f, compat.Options{RubyBashly: ruby})
+		switch {
+		case rep.Err != nil:
+			failed = true
+			fmt.Fprintf(os.Stdout, "FAIL %s: %v\n", rep.Fixture, rep.Err)
+		case len(rep.Diffs) > 0:
+			failed = true
+			fmt.Fprintf(os.Stdout, "DIFF %s: %d probes, %d differences\n", rep.Fixture, rep.Probes, len(rep.Diffs))
+			for _, d := range rep.Diffs {
+				fmt.Fprintf(os.Stdout, "  $ %s (%s)\n", d.Probe, d.Field)
+				fmt.Fprintf(os.Stdout, "    go:   %s\n", strings.ReplaceAll(d.Go, "\n", "\n          "))
+				fmt.Fprintf(os.Stdout, "    ruby: %s\n", strings.ReplaceAll(d.Ruby, "\n", "\n          "))
+			}
+		case logOpts.Quiet:
+		case rep.Ruby:
+			fmt.Fprintf(os.Stdout, "OK   %s: %d probes match\n", rep.Fixture, rep.Probes)
+		default:
+			fmt.Fprintf(os.Stdout, "OK   %s: rendered, %d probes ran\n", rep.Fixture, rep.Probes)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	configPath := fs.String("config", "", "Path to bashly.yml")
+	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
+	timeout := addTimeoutFlag(fs)
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+	checks := doctor.Run(ctx, *configPath, *workdir)
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, context.Cause(ctx).Error())
+		os.Exit(1)
+	}
+
+	if err := doctor.Print(os.Stdout, checks, term.Color(os.Stdout)); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if doctor.Failed(checks) {
+		os.Exit(1)
+	}
+}
+
+// runVerify checks the scripts of the project, or the given ones, against
+// their integrity footers: a script edited by hand or generated from
+// another config or settings fails.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	configPath := fs.String("config", "", "Path to bashly.yml")
+	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
+	profile := fs.String("profile", "", "Config profile the scripts were generated with")
+	timeout := addTimeoutFlag(fs)
+	defines := defineFlags{}
+	fs.Var(defines, "define", "Set a variable for command \"if\" conditions, as the scripts were generated with (key=value, repeatable)")
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+	p, err := project.LoadContext(ctx, *configPath, *workdir, project.Options{Defines: defines, Profile: *profile})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	scripts, err := scriptProjects(p)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	byPath := map[string]*project.Project{}
+	var paths []string
+	for _, sp := range scripts {
+		path := generate.ScriptPath(sp.Root, p.Settings, p.Workdir)
+		byPath[path] = sp
+		paths = append(paths, path)
+	}
+	if fs.NArg() > 0 {
+		paths = nil
+		for _, arg := range fs.Args() {
+			path, err := filepath.Abs(arg)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			if byPath[path] == nil {
+				fmt.Fprintf(os.Stderr, "%s is not a script of this project\n", arg)
+				os.Exit(1)
+			}
+			paths = append(paths, path)
+		}
+	}
+
+	failed := false
+	for _, path := range paths {
+		rel := path
+		if r, err := filepath.Rel(p.Workdir, path); err == nil {
+			rel = r
+		}
+		data, err := os.ReadFile(path)
+		var v generate.Verification
+		if err == nil {
+			v, err = generate.VerifyScript(ctx, data, byPath[path].Root, p.Settings, generate.Options{Workdir: p.Workdir})
+		}
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stdout, "error: %s: %s\n", rel, err)
+		case v.Edited:
+			fmt.Fprintf(os.Stdout, "edited: %s changed after it was generated\n", rel)
+		case v.Stale:
+			fmt.Fprintf(os.Stdout, "stale: %s was generated from another config, settings or source files; run go-bashly generate\n", rel)
+		case v.Footer.Version != buildinfo.Version:
+			fmt.Fprintf(os.Stdout, "ok: %s (generated by go-bashly %s)\n", rel, v.Footer.Version)
+		default:
+			fmt.Fprintf(os.Stdout, "ok: %s\n", rel)
+		}
+		failed = failed || err != nil || v.Edited || v.Stale
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	commands := fs.Int("commands", 500, "Commands in the synthetic project")
+	runs := fs.Int("runs", 5, "Times each stage is measured")
+	budget := fs.Duration("budget", 0, "Fail when a full generation takes longer than this on average (default: no limit)")
+	workdir := fs.String("workdir", "", "Keep the synthetic project in this directory (default: a temporary directory)")
+	format := fs.String("format", "text", "Output format: text or json")
+	prof := addProfileFlags(fs)
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown --format: %s (expected text or json)\n", *format)
+		os.Exit(1)
+	}
+	dir := *workdir
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "go-bashly-bench-")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+
+	ctx := context.Background()
+	if err := bench.WriteProject(ctx, dir, *commands); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	slog.Debug("synthetic project written", "dir", dir, "commands", *commands)
+
+	stop := prof.start()
+	results, err := bench.Run(ctx, dir, *runs)
+	stop()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	} else {
+		err = bench.Print(os.Stdout, results)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	for _, r := range results {
+		if r.Stage == "generate" && *budget > 0 && r.Mean > *budget {
+			fmt.Fprintf(os.Stderr, "generate took %s on average, over the budget of %s\n", r.Mean.Round(time.Millisecond), *budget)
+			os.Exit(1)
+		}
+	}
+}
+
+// profileFlags holds the pprof output files of --cpu-profile and
+// --mem-profile.
+type profileFlags struct {
+	cpu string
+	mem string
+}
+
+func addProfileFlags(fs *flag.FlagSet) *profileFlags {
+	p := &profileFlags{}
+	fs.StringVar(&p.cpu, "cpu-profile", "", "Write a pprof CPU profile to this file")
+	fs.StringVar(&p.mem, "mem-profile", "", "Write a pprof heap profile to this file")
+	return p
+}
+
+// start begins CPU profiling and returns the function that stops it and
+// writes the heap profile. Profiles are only complete when it is called;
+// exit calls it too, so a command failing through exit still writes them.
+func (p *profileFlags) start() func() {
+	var cpu *os.File
+	if p.cpu != "" {
+		f, err := os.Create(p.cpu)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		cpu = f
+	}
+	var once sync.Once
+	stop := func() { once.Do(p.stop(cpu)) }
+	atExit = append(atExit, stop)
+	return stop
+}
+
+// stop returns the function that stops the CPU profile written to cpu, if
+// any, and writes the heap profile.
+func (p *profileFlags) stop(cpu *os.File) func() {
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			cpu.Close()
+			slog.Debug("cpu profile written", "path", p.cpu)
+		}
+		if p.mem == "" {
+			return
+		}
+		f, err := os.Create(p.mem)
+		if err == nil {
+			goruntime.GC()
+			err = pprof.WriteHeapProfile(f)
+			f.Close()
+		}
+		if err != nil {
+			slog.Warn("cannot write heap profile", "path", p.mem, "err", err)
+			return
+		}
+		slog.Debug("heap profile written", "path", p.mem)
+	}
+}
+
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml and resolve imports (defaults to current directory)")
+	format := fs.String("format", "text", "Output format: text or json")
+	failOnBreaking := fs.Bool("fail-on-breaking", false, "Exit with status 1 when breaking changes are found")
+	timeout := addTimeoutFlag(fs)
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "diff needs two configs: <old> <new> (a config may be given as <rev>:<path> to read it from git)")
+		os.Exit(1)
+	}
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+	var roots [2]*commandmodel.Command
+	for i, spec := range fs.Args() {
+		root, err := loadDiffSide(ctx, spec, *workdir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		roots[i] = root
+	}
+
+	changes := commandmodel.Diff(roots[0], roots[1])
+	var err error
+	switch *format {
+	case "text", "":
+		err = commandmodel.PrintDiff(os.Stdout, changes, term.Color(os.Stdout))
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if changes == nil {
+			changes = []commandmodel.Change{}
+		}
+		err = enc.Encode(changes)
+	default:
+		err = fmt.Errorf("unknown format: %s", *format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	if *failOnBreaking {
+		for _, c := range changes {
+			if c.Breaking {
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// loadDiffSide loads one side of a diff. A spec of the form <rev>:<path>
+// is read from git, relative to the workdir, and copied next to the
+// working-tree config so that its imports resolve; any other spec is a
+// config path.
+func loadDiffSide(ctx context.Context, spec string, workdir string) (*commandmodel.Command, error) {
+	rev, path, fromGit := strings.Cut(spec, ":")
+	if !fromGit || rev == "" || filepath.VolumeName(spec) != "" {
+		p, err := project.LoadContext(ctx, spec, workdir, project.Options{})
+		if err != nil {
+			return nil, err
+		}
+		return p.Root, nil
+	}
+
+	wd, err := project.ResolveWorkdir(workdir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := exec.CommandContext(ctx, "git", "-C", wd, "show", rev+":./"+filepath.ToSlash(path)).Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("reading %s: %s", spec, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("reading %s: %w", spec, err)
+	}
+
+	f, err := os.CreateTemp(filepath.Join(wd, filepath.Dir(path)), ".bashly-diff-*.yml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(out); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	slog.Debug("config read from git", "rev", rev, "path", path)
+
+	p, err := project.LoadContext(ctx, f.Name(), wd, project.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec, err)
+	}
+	return p.Root, nil
+}
+
+func runLsp(args []string) {
+	fs := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	configPath := fs.String("config", "", "Path to bashly.yml")
+	workdir := fs.String("workdir", "", "Project directory (default: the root the editor opens)")
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+
+	// The protocol runs on stdin and stdout; logs go to stderr.
+	opts := lsp.Options{ConfigPath: *configPath, Workdir: *workdir}
+	if err := lsp.Serve(context.Background(), os.Stdin, os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func runUi(args []string) {
+	fs := flag.NewFlagSet("ui", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	configPath := fs.String("config", "", "Path to bashly.yml")
+	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
+	profile := fs.String("profile", "", "Config profile to apply")
+	defines := defineFlags{}
+	fs.Var(defines, "define", "Set a variable for command \"if\" conditions (key=value, repeatable)")
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+
+	ctx := context.Background()
+	opts := ui.Options{
+		Load: func() (*project.Project, error) {
+			return project.LoadContext(ctx, *configPath, *workdir, project.Options{Defines: defines, Profile: *profile})
+		},
+		// Like generate --force for the script only, so partials being
+		// edited are left alone; the summary replaces the output, which
+		// would break the screen.
+		Generate: func(p *project.Project) (string, error) {
+			res, masters, err := writeProject(ctx, p, generateOptions{ForceScript: true})
+			if err != nil {
+				return "", err
+			}
+			var scripts []string
+			warnings := 0
+			for _, m := range masters {
+				if rel, err := filepath.Rel(p.Workdir, m.Path); err == nil {
+					m.Path = rel
+				}
+				scripts = append(scripts, m.Path)
+				warnings += len(m.Warnings)
+			}
+			summary := fmt.Sprintf("generated %s; partials: %d created, %d updated", strings.Join(scripts, ", "), len(res.Created), len(res.Updated))
+			if len(res.Rejected) > 0 {
+				summary += fmt.Sprintf(", %d with rejected scaffold lines", len(res.Rejected))
+			}
+			if warnings > 0 {
+				summary += fmt.Sprintf("; %d warnings, see generate", warnings)
+			}
+			return summary, nil
+		},
+		Color: term.Color(os.Stdout),
+	}
+	if err := ui.Run(os.Stdin, os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func runAdd(args []string) {
+	switch {
+	case len(args) > 0 && args[0] == "github-action":
+		runAddGitHubAction(args[1:])
+	case len(args) > 0 && args[0] == "command":
+		runAddCommand(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, "usage: go-bashly add github-action|command [options]")
+		os.Exit(1)
+	}
+}
+
+func runAddGitHubAction(args []string) {
+	fs := flag.NewFlagSet("add github-action", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	configPath := fs.String("config", "", "Path to bashly.yml")
+	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
+	version := fs.String("go-bashly-version", "latest", "Version of go-bashly the workflow installs")
+	force := fs.Bool("force", false, "Overwrite an existing workflow and test files")
+	_ = fs.Parse(args)
+	setupLogging(logOpts, termOpts)
+
+	p, err := project.Load(*configPath, *workdir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	scripts, err := scriptProjects(p)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	// The workflow goes to the repository root, found by its .git.
+	repo := p.Workdir
+	for dir := p.Workdir; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			repo = dir
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	dir, err := filepath.Rel(repo, p.Workdir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	st := p.Settings
+	opts := scaffold.ActionOptions{
+		Name:            p.Root.Name,
+		Dir:             filepath.ToSlash(dir),
+		Shellcheck:      st.TargetShell != "zsh",
+		CheckVersion:    st.VersionSource == "config",
+		CheckMissing:    !st.PromptMissing,
+		GoBashlyVersion: *version,
+	}
+	for _, sp := range scripts {
+		path := generate.ScriptPath(sp.Root, sp.Settings, sp.Workdir)
+		if rel, err := filepath.Rel(p.Workdir, path); err == nil {
+			path = rel
+		}
+		opts.Scripts = append(opts.Scripts, scaffold.ActionScript{Path: filepath.ToSlash(path), Root: sp.Root})
+	}
+
+	written, err := scaffold.WriteGitHubAction(repo, opts, *force)
+	for _, path := range written {
+		if !logOpts.Quiet {
+			fmt.Fprintln(os.Stdout, "created:", path)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func runAddCommand(args []string) {
+	fs := flag.NewFlagSet("add command", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	configPath := fs.String("config", "", "Path to bashly.yml")
+	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
+	archetype := fs.String("template", scaffold.DefaultArchetype, "Archetype of the command: basic, crud or one of <source_dir>/archetypes")
+	description := fs.String("description", "", "Help text of the command")
+	parent := fs.String("parent", "", "Command to add the command to, e.g. \"db\" (default: the root)")
+	showTemplate := fs.Bool("show-template", false, "Print the archetype template instead of adding a command")
+	_ = fs.Parse(args)
+	// Options may come before or after the name.
+	name := fs.Arg(0)
+	if fs.NArg() > 1 {
+		_ = fs.Parse(fs.Args()[1:])
+	}
+	setupLogging(logOpts, termOpts)
+
+	wd, err := project.ResolveWorkdir(*workdir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	resolved, err := settings.Load(wd, settings.LoadOptions{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	st := resolved.Settings
+
+	text, err := scaffold.Archetype(filepath.Join(wd, st.SourceDir), *archetype)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if *showTemplate {
+		fmt.Fprint(os.Stdout, text)
+		return
+	}
+	if name == "" || fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: go-bashly add command <name> [options]")
+		os.Exit(1)
+	}
+	list, err := scaffold.RenderArchetype(text, scaffold.ArchetypeData{Name: name, Help: *description})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "archetype %s: %v\n", *archetype, err)
+		os.Exit(1)
+	}
+
+	config := *configPath
+	if config == "" {
+		config = st.ConfigPath
+	}
+	if config == bashlyconfig.StdinPath {
+		fmt.Fprintln(os.Stderr, "add command edits the config in place and cannot read it from stdin")
+		os.Exit(1)
+	}
+	path := upgrade.ResolveImport(wd, config)
+	original, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	parentPath := strings.Fields(*parent)
+	updated, err := scaffold.AppendCommands(original, parentPath, list)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		os.Exit(1)
+	}
+	if err := vfs.Disk.WriteFile(path, updated, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	// The new commands are checked as generate would load them; a config
+	// they break is put back as it was.
+	names, _ := scaffold.CommandNames(list)
+	var only []string
+	for _, c := range names {
+		only = append(only, strings.Join(append(slices.Clone(parentPath), c), " "))
+	}
+	p, err := project.LoadWithOptions(*configPath, *workdir, project.Options{Only: only})
+	if err != nil {
+		if rerr := vfs.Disk.WriteFile(path, original, 0o644); rerr != nil {
+			fmt.Fprintln(os.Stderr, rerr.Error())
+		}
+		fmt.Fprintf(os.Stderr, "the config would not load with the new command, left unchanged: %v\n", err)
+		os.Exit(1)
+	}
+	if !logOpts.Quiet {
+		fmt.Fprintln(os.Stdout, "updated:", path)
+	}
+
+	res, err := generate.EnsureCommandPartials(context.Background(), p.Root, p.Settings, generate.Options{Workdir: p.Workdir})
+	for _, created := range res.Created {
+		if !logOpts.Quiet {
+			fmt.Fprintln(os.Stdout, "created:", created)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func runConfig(args []string) {
+	if len(args) == 0 || (args[0] != "get" && args[0] != "set" && args[0] != "delete") {
+		fmt.Fprintln(os.Stderr, "usage: go-bashly config get|set|delete <path> [value] [options]")
+		os.Exit(1)
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("config "+action, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	logOpts := logging.AddFlags(fs)
+	termOpts := term.AddFlags(fs)
+
+	configPath := fs.String("config", "", "Path to bashly.yml")
+	workdir := fs.String("workdir", "", "Working directory used to locate settings.yml (defaults to current directory)")
+	inSettings := fs.Bool("settings", false, "Edit settings.yml instead of bashly.yml")
+	_ = fs.Parse(args[1:])
+	// Options may come before or after the path and value.
+	var operands []string
+	for fs.NArg() > 0 {
+		operands = append(operands, fs.Arg(0))
+		_ = fs.Parse(fs.Args()[1:])
+	}
+	setupLogging(logOpts, termOpts)
+
+	usage, want := "<path>", 1
+	if action == "set" {
+		usage, want = "<path> <value>", 2
+	}
+	if len(operands) != want {
+		fmt.Fprintf(os.Stderr, "usage: go-bashly config %s %s [options]\n", action, usage)
+		os.Exit(1)
+	}
+	path := configedit.ParsePath(operands[0])
+
+	wd, err := project.ResolveWorkdir(*workdir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	resolved, err := settings.Resolve(wd, settings.LoadOptions{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	var file string
+	if *inSettings {
+		if file = settings.UserSettingsPath(wd); file == "" {
+			fmt.Fprintln(os.Stderr, "no settings file in", wd)
+			os.Exit(1)
+		}
+	} else {
+		config := *configPath
+		if config == "" {
+			config = resolved.Settings.ConfigPath
+		}
+		if config == bashlyconfig.StdinPath {
+			fmt.Fprintln(os.Stderr, "config edits the config in place and cannot read it from stdin")
+			os.Exit(1)
+		}
+		file = upgrade.ResolveImport(wd, config)
+	}
+
+	original, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	doc, err := configedit.Parse(original)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+		os.Exit(1)
+	}
+
+	switch action {
+	case "get":
+		n := doc.Lookup(path)
+		if n == nil {
+			fmt.Fprintf(os.Stderr, "%s: no %s\n", file, path)
+			os.Exit(1)
+		}
+		if n.Kind == yaml.ScalarNode {
+			fmt.Fprintln(os.Stdout, n.Value)
+			return
+		}
+		out, err := yaml.Marshal(n)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		os.Stdout.Write(out)
+		return
+	case "set":
+		err = doc.Set(path, operands[1])
+	case "delete":
+		err = doc.Delete(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+		os.Exit(1)
+	}
+	if err := vfs.Disk.WriteFile(file, doc.Bytes(), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	// An edit that leaves the project unloadable is put back.
+	if _, err := project.Load(*configPath, *workdir); err != nil {
+		if rerr := vfs.Disk.WriteFile(file, original, 0o644); rerr != nil {
+			fmt.Fprintln(os.Stderr, rerr.Error())
+		}
+		fmt.Fprintf(os.Stderr, "the project would not load after the edit, left unchanged: %v\n", err)
+		os.Exit(1)
 	}
-	if master.Written {
-		fmt.Fprintln(os.Stdout, "created:", master.Path)
+	if !logOpts.Quiet {
+		fmt.Fprintln(os.Stdout, "updated:", file)
 	}
 }